@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminExecutorCordon = &cobra.Command{
+	Use:   "cordon",
+	Short: "cordon an executor so it won't receive new tasks",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminExecutorCordon(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type adminExecutorCordonOptions struct {
+	executorID string
+}
+
+var adminExecutorCordonOpts adminExecutorCordonOptions
+
+func init() {
+	flags := cmdAdminExecutorCordon.Flags()
+
+	flags.StringVar(&adminExecutorCordonOpts.executorID, "id", "", "executor id")
+
+	if err := cmdAdminExecutorCordon.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAdminExecutor.AddCommand(cmdAdminExecutorCordon)
+}
+
+func adminExecutorCordon(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("cordoning executor %q", adminExecutorCordonOpts.executorID)
+	if _, _, err := gwclient.CordonExecutor(context.TODO(), adminExecutorCordonOpts.executorID); err != nil {
+		return errors.Errorf("failed to cordon executor: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminExecutorDrain = &cobra.Command{
+	Use:   "drain",
+	Short: "cordon an executor and report the progress of its running tasks",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminExecutorDrain(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type adminExecutorDrainOptions struct {
+	executorID string
+	wait       bool
+	timeout    time.Duration
+}
+
+var adminExecutorDrainOpts adminExecutorDrainOptions
+
+func init() {
+	flags := cmdAdminExecutorDrain.Flags()
+
+	flags.StringVar(&adminExecutorDrainOpts.executorID, "id", "", "executor id")
+	flags.BoolVar(&adminExecutorDrainOpts.wait, "wait", false, "wait for the executor running tasks to finish")
+	flags.DurationVar(&adminExecutorDrainOpts.timeout, "timeout", 0, "max time to wait for the executor to be drained (0 means no timeout)")
+
+	if err := cmdAdminExecutorDrain.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAdminExecutor.AddCommand(cmdAdminExecutorDrain)
+}
+
+func adminExecutorDrain(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	ctx := context.TODO()
+	if adminExecutorDrainOpts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, adminExecutorDrainOpts.timeout)
+		defer cancel()
+	}
+
+	log.Infof("draining executor %q", adminExecutorDrainOpts.executorID)
+	ds, _, err := gwclient.DrainExecutor(ctx, adminExecutorDrainOpts.executorID)
+	if err != nil {
+		return errors.Errorf("failed to drain executor: %w", err)
+	}
+
+	for {
+		if ds.Drained {
+			log.Infof("executor %q drained", adminExecutorDrainOpts.executorID)
+			return nil
+		}
+		log.Infof("executor %q has %d active tasks: %v", adminExecutorDrainOpts.executorID, len(ds.ActiveTasks), ds.ActiveTasks)
+		if !adminExecutorDrainOpts.wait {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("timeout waiting for executor %q to be drained", adminExecutorDrainOpts.executorID)
+		case <-time.After(5 * time.Second):
+		}
+
+		ds, _, err = gwclient.GetExecutorDrainStatus(ctx, adminExecutorDrainOpts.executorID)
+		if err != nil {
+			return errors.Errorf("failed to get executor drain status: %w", err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminExecutorList = &cobra.Command{
+	Use:   "list",
+	Short: "list executors",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminExecutorList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdAdminExecutor.AddCommand(cmdAdminExecutorList)
+}
+
+func executorState(e *api.ExecutorResponse) string {
+	switch {
+	case e.ShuttingDown:
+		return "shutting down"
+	case e.Cordoned:
+		return "cordoned"
+	default:
+		return "schedulable"
+	}
+}
+
+func adminExecutorList(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	executors, _, err := gwclient.GetExecutors(context.TODO())
+	if err != nil {
+		return errors.Errorf("failed to get executors: %w", err)
+	}
+
+	for _, e := range executors {
+		fmt.Printf("%s: ListenURL: %s, State: %s, ActiveTasks: %d/%d, LastStatusUpdate: %s\n", e.ID, e.ListenURL, executorState(e), e.ActiveTasks, e.ActiveTasksLimit, e.LastStatusUpdateTime)
+	}
+
+	return nil
+}
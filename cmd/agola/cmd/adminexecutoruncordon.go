@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminExecutorUncordon = &cobra.Command{
+	Use:   "uncordon",
+	Short: "uncordon an executor so it will receive new tasks",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminExecutorUncordon(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type adminExecutorUncordonOptions struct {
+	executorID string
+}
+
+var adminExecutorUncordonOpts adminExecutorUncordonOptions
+
+func init() {
+	flags := cmdAdminExecutorUncordon.Flags()
+
+	flags.StringVar(&adminExecutorUncordonOpts.executorID, "id", "", "executor id")
+
+	if err := cmdAdminExecutorUncordon.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAdminExecutor.AddCommand(cmdAdminExecutorUncordon)
+}
+
+func adminExecutorUncordon(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("uncordoning executor %q", adminExecutorUncordonOpts.executorID)
+	if _, _, err := gwclient.UncordonExecutor(context.TODO(), adminExecutorUncordonOpts.executorID); err != nil {
+		return errors.Errorf("failed to uncordon executor: %w", err)
+	}
+
+	return nil
+}
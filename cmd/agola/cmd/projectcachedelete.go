@@ -0,0 +1,81 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectCacheDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "delete a project cache or all the project caches",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectCacheDelete(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectCacheDeleteOptions struct {
+	projectRef string
+	key        string
+	all        bool
+}
+
+var projectCacheDeleteOpts projectCacheDeleteOptions
+
+func init() {
+	flags := cmdProjectCacheDelete.Flags()
+
+	flags.StringVar(&projectCacheDeleteOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVarP(&projectCacheDeleteOpts.key, "key", "k", "", "cache key")
+	flags.BoolVar(&projectCacheDeleteOpts.all, "all", false, "delete all the project caches")
+
+	if err := cmdProjectCacheDelete.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectCache.AddCommand(cmdProjectCacheDelete)
+}
+
+func projectCacheDelete(cmd *cobra.Command, args []string) error {
+	if projectCacheDeleteOpts.all == (projectCacheDeleteOpts.key != "") {
+		return errors.Errorf(`one of flags "key" or "all" must be set`)
+	}
+
+	gwclient := api.NewClient(gatewayURL, token)
+
+	if projectCacheDeleteOpts.all {
+		log.Infof("deleting project caches")
+		if _, err := gwclient.DeleteProjectCaches(context.TODO(), projectCacheDeleteOpts.projectRef); err != nil {
+			return errors.Errorf("failed to delete project caches: %w", err)
+		}
+		log.Infof("project caches deleted")
+		return nil
+	}
+
+	log.Infof("deleting project cache")
+	if _, err := gwclient.DeleteProjectCache(context.TODO(), projectCacheDeleteOpts.projectRef, projectCacheDeleteOpts.key); err != nil {
+		return errors.Errorf("failed to delete project cache: %w", err)
+	}
+	log.Infof("project cache deleted")
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectCacheList = &cobra.Command{
+	Use:   "list",
+	Short: "list project caches",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectCacheList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectCacheListOptions struct {
+	projectRef string
+}
+
+var projectCacheListOpts projectCacheListOptions
+
+func init() {
+	flags := cmdProjectCacheList.Flags()
+
+	flags.StringVar(&projectCacheListOpts.projectRef, "project", "", "project id or full path")
+
+	if err := cmdProjectCacheList.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectCache.AddCommand(cmdProjectCacheList)
+}
+
+func projectCacheList(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	caches, _, err := gwclient.GetProjectCaches(context.TODO(), projectCacheListOpts.projectRef)
+	if err != nil {
+		return errors.Errorf("failed to get project caches: %w", err)
+	}
+
+	for _, c := range caches {
+		fmt.Printf("%s: Size: %s, LastUsed: %s\n", c.Key, units.BytesSize(float64(c.Size)), c.LastUsed)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunExport = &cobra.Command{
+	Use:   "export <runid>",
+	Short: "export a run, with its logs and workspace archives, as a bundle",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runExport(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type runExportOptions struct {
+	output string
+}
+
+var runExportOpts runExportOptions
+
+func init() {
+	flags := cmdRunExport.Flags()
+
+	flags.StringVarP(&runExportOpts.output, "output", "o", "", `bundle output file (default "<runid>.tar.gz")`)
+
+	cmdRun.AddCommand(cmdRunExport)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	runID := args[0]
+
+	output := runExportOpts.output
+	if output == "" {
+		output = runID + ".tar.gz"
+	}
+
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("exporting run %q", runID)
+	resp, err := gwclient.ExportRun(context.TODO(), runID)
+	if err != nil {
+		return errors.Errorf("failed to export run: %w", err)
+	}
+	defer resp.Body.Close()
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(output)
+		return errors.Errorf("failed to write run bundle: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Infof("run exported to %q", output)
+
+	return nil
+}
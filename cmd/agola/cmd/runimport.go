@@ -0,0 +1,73 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunImport = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "import a run bundle as an archived project run",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runImport(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type runImportOptions struct {
+	projectRef string
+}
+
+var runImportOpts runImportOptions
+
+func init() {
+	flags := cmdRunImport.Flags()
+
+	flags.StringVar(&runImportOpts.projectRef, "project", "", "project id or full path")
+
+	if err := cmdRunImport.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunImport)
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("importing run bundle %q", args[0])
+	run, _, err := gwclient.ImportRun(context.TODO(), runImportOpts.projectRef, f)
+	if err != nil {
+		return errors.Errorf("failed to import run: %w", err)
+	}
+	log.Infof("run %q imported", run.ID)
+
+	return nil
+}
@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/gateway/api"
 	errors "golang.org/x/xerrors"
@@ -40,6 +42,17 @@ type runListOptions struct {
 	phaseFilter []string
 	limit       int
 	start       string
+
+	commitSHA     string
+	ref           string
+	branch        string
+	tag           string
+	pullRequestID string
+	trigger       string
+	name          string
+	annotations   []string
+	since         string
+	until         string
 }
 
 var runListOpts runListOptions
@@ -51,6 +64,16 @@ func init() {
 	flags.StringSliceVarP(&runListOpts.phaseFilter, "phase", "s", nil, "filter runs matching the provided phase. This option can be repeated multiple times")
 	flags.IntVar(&runListOpts.limit, "limit", 10, "max number of runs to show")
 	flags.StringVar(&runListOpts.start, "start", "", "starting run id (excluded) to fetch")
+	flags.StringVar(&runListOpts.commitSHA, "commit", "", "filter runs of the provided commit sha (also a short sha can be used)")
+	flags.StringVar(&runListOpts.ref, "ref", "", "filter runs of the provided git ref")
+	flags.StringVar(&runListOpts.branch, "branch", "", "filter runs of the provided branch")
+	flags.StringVar(&runListOpts.tag, "tag", "", "filter runs of the provided tag")
+	flags.StringVar(&runListOpts.pullRequestID, "pull-request", "", "filter runs of the provided pull request id")
+	flags.StringVar(&runListOpts.trigger, "trigger", "", "filter runs by creation trigger (webhook, manual)")
+	flags.StringVar(&runListOpts.name, "name", "", "filter runs with the provided name")
+	flags.StringSliceVar(&runListOpts.annotations, "annotation", nil, "filter runs with the provided annotation in the format key=value. This option can be repeated multiple times")
+	flags.StringVar(&runListOpts.since, "since", "", "filter runs created after the provided time (RFC3339 format)")
+	flags.StringVar(&runListOpts.until, "until", "", "filter runs created before the provided time (RFC3339 format)")
 
 	if err := cmdRunList.MarkFlagRequired("project"); err != nil {
 		log.Fatal(err)
@@ -75,8 +98,40 @@ func runList(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return errors.Errorf("failed to get project %s: %v", runListOpts.projectRef, err)
 	}
+	filter := &api.RunsFilter{
+		CommitSHA:     runListOpts.commitSHA,
+		Ref:           runListOpts.ref,
+		Branch:        runListOpts.branch,
+		Tag:           runListOpts.tag,
+		PullRequestID: runListOpts.pullRequestID,
+		Trigger:       runListOpts.trigger,
+		Name:          runListOpts.name,
+		Annotations:   map[string]string{},
+	}
+	for _, a := range runListOpts.annotations {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.Errorf("wrong annotation %q, must be in the format key=value", a)
+		}
+		filter.Annotations[parts[0]] = parts[1]
+	}
+	if runListOpts.since != "" {
+		since, err := time.Parse(time.RFC3339, runListOpts.since)
+		if err != nil {
+			return errors.Errorf("failed to parse since: %w", err)
+		}
+		filter.Since = &since
+	}
+	if runListOpts.until != "" {
+		until, err := time.Parse(time.RFC3339, runListOpts.until)
+		if err != nil {
+			return errors.Errorf("failed to parse until: %w", err)
+		}
+		filter.Until = &until
+	}
+
 	groups := []string{path.Join("/project", project.ID)}
-	runsResp, _, err := gwclient.GetRuns(context.TODO(), runListOpts.phaseFilter, nil, groups, nil, runListOpts.start, runListOpts.limit, false)
+	runsResp, _, err := gwclient.GetRuns(context.TODO(), runListOpts.phaseFilter, nil, groups, nil, filter, runListOpts.start, runListOpts.limit, false)
 	if err != nil {
 		return err
 	}
@@ -17,6 +17,9 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"agola.io/agola/cmd"
 	"agola.io/agola/internal/services/config"
@@ -118,7 +121,12 @@ func isComponentEnabled(name string) bool {
 }
 
 func serve(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the executor is stopped before the other components so it can
+	// gracefully terminate its tasks and report their status
+	exCtx, exCancel := context.WithCancel(ctx)
+	defer exCancel()
 
 	if len(serveOpts.components) == 0 {
 		return errors.Errorf("no enabled components")
@@ -197,28 +205,64 @@ func serve(cmd *cobra.Command, args []string) error {
 	}
 
 	errCh := make(chan error)
+	exDoneCh := make(chan struct{})
+	running := 0
 
 	if rs != nil {
+		running++
 		go func() { errCh <- rs.Run(ctx) }()
 	}
 	if ex != nil {
-		go func() { errCh <- ex.Run(ctx) }()
+		running++
+		go func() {
+			err := ex.Run(exCtx)
+			close(exDoneCh)
+			errCh <- err
+		}()
+	} else {
+		close(exDoneCh)
 	}
 	if cs != nil {
+		running++
 		go func() { errCh <- cs.Run(ctx) }()
 	}
 	if sched != nil {
+		running++
 		go func() { errCh <- sched.Run(ctx) }()
 	}
 	if ns != nil {
+		running++
 		go func() { errCh <- ns.Run(ctx) }()
 	}
 	if gw != nil {
+		running++
 		go func() { errCh <- gw.Run(ctx) }()
 	}
 	if gs != nil {
+		running++
 		go func() { errCh <- gs.Run(ctx) }()
 	}
 
-	return <-errCh
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		log.Infof("received signal %s, shutting down", sig)
+		exCancel()
+		go func() {
+			// exit immediately on a second signal
+			<-sigCh
+			log.Fatalf("forced shutdown")
+		}()
+		<-exDoneCh
+		cancel()
+	}()
+
+	for i := 0; i < running; i++ {
+		if err := <-errCh; err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
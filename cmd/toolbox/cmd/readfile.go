@@ -0,0 +1,52 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdReadFile = &cobra.Command{
+	Use:   "readfile",
+	Run:   readFileRun,
+	Short: "write the provided file to stdout. A missing file is ignored",
+}
+
+func init() {
+	CmdToolbox.AddCommand(cmdReadFile)
+}
+
+func readFileRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("a file name must be specified")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		log.Fatalf("failed to open file %q: %v", args[0], err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		log.Fatalf("failed to read file %q: %v", args[0], err)
+	}
+}
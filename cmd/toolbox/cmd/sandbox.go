@@ -0,0 +1,47 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"agola.io/agola/internal/toolbox/sandbox"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdSandboxInit = &cobra.Command{
+	Use:    "sandbox-init",
+	Run:    sandboxInitRun,
+	Short:  "sandbox driver pod init process",
+	Hidden: true,
+}
+
+func init() {
+	CmdToolbox.AddCommand(cmdSandboxInit)
+}
+
+func sandboxInitRun(cmd *cobra.Command, args []string) {
+	var c *sandbox.Config
+	if err := json.NewDecoder(os.Stdin).Decode(&c); err != nil {
+		log.Fatalf("failed to decode config: %v", err)
+	}
+
+	if err := sandbox.Init(c); err != nil {
+		log.Fatalf("err: %v", err)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"agola.io/agola/internal/services/types"
 	"agola.io/agola/internal/util"
 
+	units "github.com/docker/go-units"
 	"github.com/ghodss/yaml"
 	"github.com/google/go-jsonnet"
 	errors "golang.org/x/xerrors"
@@ -33,6 +34,8 @@ const (
 	maxRunNameLength  = 100
 	maxTaskNameLength = 100
 	maxStepNameLength = 100
+	// max dns label length
+	maxContainerAliasLength = 63
 
 	defaultWorkingDir = "~/project"
 )
@@ -66,6 +69,8 @@ type DockerRegistryAuthType string
 const (
 	DockerRegistryAuthTypeBasic       DockerRegistryAuthType = "basic"
 	DockerRegistryAuthTypeEncodedAuth DockerRegistryAuthType = "encodedauth"
+	DockerRegistryAuthTypeECR         DockerRegistryAuthType = "ecr"
+	DockerRegistryAuthTypeOAuth2      DockerRegistryAuthType = "oauth2"
 )
 
 type DockerRegistryAuth struct {
@@ -78,13 +83,76 @@ type DockerRegistryAuth struct {
 	// encoded auth string
 	Auth string `json:"auth"`
 
-	// future auths like aws ecr auth
+	// aws ecr auth. The access key is exchanged for a registry token. If
+	// not provided the region is taken from the registry name. Endpoint
+	// overrides the ecr api endpoint (i.e. to use a vpc interface endpoint),
+	// it must be an https aws ecr api endpoint
+	AccessKeyID     Value  `json:"access_key_id"`
+	SecretAccessKey Value  `json:"secret_access_key"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+
+	// oauth2 auth. The client credentials are exchanged for a registry bearer
+	// token using the token service advertised by the registry
+	ClientID     Value `json:"client_id"`
+	ClientSecret Value `json:"client_secret"`
 }
 
+type NetworkMode string
+
+const (
+	// NetworkModeShared makes all the containers share the network namespace of
+	// the main container
+	NetworkModeShared NetworkMode = "shared"
+	// NetworkModeIsolated connects every container to a dedicated pod network
+	// where it's reachable by its alias
+	NetworkModeIsolated NetworkMode = "isolated"
+)
+
 type Runtime struct {
 	Type       RuntimeType  `json:"type,omitempty"`
 	Arch       common.Arch  `json:"arch,omitempty"`
 	Containers []*Container `json:"containers,omitempty"`
+	// NetworkMode defines how the containers network is configured. Defaults to
+	// shared. The isolated mode is currently supported only by the docker
+	// driver
+	NetworkMode NetworkMode `json:"network_mode,omitempty"`
+	// K8s defines the kubernetes pod customizations. They're applied only by
+	// the kubernetes driver and only when allowed by the executor
+	K8s *RuntimeK8s `json:"k8s,omitempty"`
+}
+
+type RuntimeK8s struct {
+	NodeSelector       map[string]string `json:"node_selector,omitempty"`
+	Tolerations        []*K8sToleration  `json:"tolerations,omitempty"`
+	ServiceAccountName string            `json:"service_account_name,omitempty"`
+	PriorityClassName  string            `json:"priority_class_name,omitempty"`
+	Annotations        map[string]string `json:"annotations,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+}
+
+type K8sToleration struct {
+	Key               string `json:"key,omitempty"`
+	Operator          string `json:"operator,omitempty"`
+	Value             string `json:"value,omitempty"`
+	Effect            string `json:"effect,omitempty"`
+	TolerationSeconds *int64 `json:"toleration_seconds,omitempty"`
+}
+
+type ImagePullPolicy string
+
+const (
+	ImagePullPolicyAlways       ImagePullPolicy = "always"
+	ImagePullPolicyIfNotPresent ImagePullPolicy = "if_not_present"
+	ImagePullPolicyNever        ImagePullPolicy = "never"
+)
+
+func IsValidImagePullPolicy(p ImagePullPolicy) bool {
+	switch p {
+	case ImagePullPolicyAlways, ImagePullPolicyIfNotPresent, ImagePullPolicyNever:
+		return true
+	}
+	return false
 }
 
 type Container struct {
@@ -93,6 +161,13 @@ type Container struct {
 	User        string           `json:"user"`
 	Privileged  bool             `json:"privileged"`
 	Entrypoint  string           `json:"entrypoint"`
+	// ImagePullPolicy defines when the container image is pulled. If empty the
+	// image is always pulled. Other policies are honored only for the images
+	// prepulled by the executor
+	ImagePullPolicy ImagePullPolicy `json:"image_pull_policy,omitempty"`
+	// Alias is the name the container is reachable at from the other
+	// containers when using the isolated network mode
+	Alias string `json:"alias,omitempty"`
 }
 
 type Run struct {
@@ -112,8 +187,18 @@ type Task struct {
 	Depends              Depends                        `json:"depends"`
 	IgnoreFailure        bool                           `json:"ignore_failure"`
 	Approval             bool                           `json:"approval"`
+	CommitStatus         bool                           `json:"commit_status"`
 	When                 *When                          `json:"when"`
 	DockerRegistriesAuth map[string]*DockerRegistryAuth `json:"docker_registries_auth"`
+	// RescheduleOnExecutorLoss makes the task execute again on another executor
+	// when its executor is lost. Enable it only for tasks without side effects
+	// since a partially executed task will be executed again from the start
+	RescheduleOnExecutorLoss bool `json:"reschedule_on_executor_loss"`
+	// MaxLogSize overrides the executor maximum log size of every task step
+	// (i.e. "10MB"). It cannot exceed the executor maximum log size. When
+	// exceeded the step log is truncated
+	MaxLogSize          string `json:"max_log_size"`
+	FailOnLogTruncation bool   `json:"fail_on_log_truncation"`
 }
 
 type DependCondition string
@@ -644,6 +729,25 @@ func ParseConfig(configData []byte, format ConfigFormat) (*Config, error) {
 	return &config, checkConfig(&config)
 }
 
+func checkDockerRegistriesAuth(auths map[string]*DockerRegistryAuth) error {
+	for regname, auth := range auths {
+		switch auth.Type {
+		case "", DockerRegistryAuthTypeBasic, DockerRegistryAuthTypeEncodedAuth:
+		case DockerRegistryAuthTypeECR:
+			if auth.AccessKeyID.Value == "" || auth.SecretAccessKey.Value == "" {
+				return errors.Errorf("docker registry %q auth: access_key_id and secret_access_key are required for auth type %q", regname, auth.Type)
+			}
+		case DockerRegistryAuthTypeOAuth2:
+			if auth.ClientID.Value == "" || auth.ClientSecret.Value == "" {
+				return errors.Errorf("docker registry %q auth: client_id and client_secret are required for auth type %q", regname, auth.Type)
+			}
+		default:
+			return errors.Errorf("docker registry %q auth: unknown auth type %q", regname, auth.Type)
+		}
+	}
+	return nil
+}
+
 func checkConfig(config *Config) error {
 	if len(config.Runs) == 0 {
 		return errors.Errorf("no runs defined")
@@ -687,6 +791,13 @@ func checkConfig(config *Config) error {
 			}
 			seenTasks[task.Name] = struct{}{}
 
+			if task.MaxLogSize != "" {
+				maxLogSize, err := units.RAMInBytes(task.MaxLogSize)
+				if err != nil || maxLogSize <= 0 {
+					return errors.Errorf("task %q: invalid max log size %q", task.Name, task.MaxLogSize)
+				}
+			}
+
 			// check tasks runtime
 			if task.Runtime == nil {
 				return errors.Errorf("task %q: runtime is not defined", task.Name)
@@ -706,6 +817,46 @@ func checkConfig(config *Config) error {
 					return errors.Errorf("task %q runtime: invalid arch %q", task.Name, r.Arch)
 				}
 			}
+			switch r.NetworkMode {
+			case "", NetworkModeShared, NetworkModeIsolated:
+			default:
+				return errors.Errorf("task %q runtime: invalid network mode %q", task.Name, r.NetworkMode)
+			}
+			seenAliases := map[string]struct{}{}
+			for ci, c := range r.Containers {
+				if c.ImagePullPolicy != "" && !IsValidImagePullPolicy(c.ImagePullPolicy) {
+					return errors.Errorf("task %q runtime: container at index %d: invalid image pull policy %q", task.Name, ci, c.ImagePullPolicy)
+				}
+				if c.Alias != "" {
+					if r.NetworkMode != NetworkModeIsolated {
+						return errors.Errorf("task %q runtime: container at index %d: alias requires the %q network mode", task.Name, ci, NetworkModeIsolated)
+					}
+					if len(c.Alias) > maxContainerAliasLength || !util.ValidateName(c.Alias) {
+						return errors.Errorf("task %q runtime: container at index %d: invalid alias %q", task.Name, ci, c.Alias)
+					}
+					if _, ok := seenAliases[c.Alias]; ok {
+						return errors.Errorf("task %q runtime: duplicate container alias %q", task.Name, c.Alias)
+					}
+					seenAliases[c.Alias] = struct{}{}
+				}
+			}
+			if r.K8s != nil {
+				for ti, t := range r.K8s.Tolerations {
+					switch t.Operator {
+					case "", "Equal", "Exists":
+					default:
+						return errors.Errorf("task %q runtime: k8s toleration at index %d: invalid operator %q", task.Name, ti, t.Operator)
+					}
+					if t.Operator == "Exists" && t.Value != "" {
+						return errors.Errorf("task %q runtime: k8s toleration at index %d: value must be empty when operator is %q", task.Name, ti, t.Operator)
+					}
+					switch t.Effect {
+					case "", "NoSchedule", "PreferNoSchedule", "NoExecute":
+					default:
+						return errors.Errorf("task %q runtime: k8s toleration at index %d: invalid effect %q", task.Name, ti, t.Effect)
+					}
+				}
+			}
 		}
 	}
 
@@ -810,6 +961,20 @@ func checkConfig(config *Config) error {
 		}
 	}
 
+	if err := checkDockerRegistriesAuth(config.DockerRegistriesAuth); err != nil {
+		return err
+	}
+	for _, run := range config.Runs {
+		if err := checkDockerRegistriesAuth(run.DockerRegistriesAuth); err != nil {
+			return errors.Errorf("run %q: %w", run.Name, err)
+		}
+		for _, task := range run.Tasks {
+			if err := checkDockerRegistriesAuth(task.DockerRegistriesAuth); err != nil {
+				return errors.Errorf("run %q task %q: %w", run.Name, task.Name, err)
+			}
+		}
+	}
+
 	// Set defaults
 	for _, registryAuth := range config.DockerRegistriesAuth {
 		if registryAuth.Type == "" {
@@ -89,6 +89,143 @@ func TestParseConfig(t *testing.T) {
                 `,
 			err: fmt.Errorf(`task "task01" runtime: invalid arch "invalidarch"`),
 		},
+		{
+			name: "test invalid task max log size",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        max_log_size: 10 parsecs
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: fmt.Errorf(`task "task01": invalid max log size "10 parsecs"`),
+		},
+		{
+			name: "test invalid container image pull policy",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                              image_pull_policy: sometimes
+                `,
+			err: fmt.Errorf(`task "task01" runtime: container at index 0: invalid image pull policy "sometimes"`),
+		},
+		{
+			name: "test unknown docker registry auth type",
+			in: `
+                docker_registries_auth:
+                  index.docker.io:
+                    type: token
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: fmt.Errorf(`docker registry "index.docker.io" auth: unknown auth type "token"`),
+		},
+		{
+			name: "test ecr docker registry auth without credentials",
+			in: `
+                runs:
+                  - name: run01
+                    docker_registries_auth:
+                      123456789012.dkr.ecr.eu-west-1.amazonaws.com:
+                        type: ecr
+                        access_key_id: AKID
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: fmt.Errorf(`run "run01": docker registry "123456789012.dkr.ecr.eu-west-1.amazonaws.com" auth: access_key_id and secret_access_key are required for auth type "ecr"`),
+		},
+		{
+			name: "test invalid k8s toleration operator",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          k8s:
+                            tolerations:
+                              - key: dedicated
+                                operator: Maybe
+                `,
+			err: fmt.Errorf(`task "task01" runtime: k8s toleration at index 0: invalid operator "Maybe"`),
+		},
+		{
+			name: "test invalid k8s toleration effect",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          k8s:
+                            tolerations:
+                              - key: dedicated
+                                operator: Exists
+                                effect: NoRun
+                `,
+			err: fmt.Errorf(`task "task01" runtime: k8s toleration at index 0: invalid effect "NoRun"`),
+		},
+		{
+			name: "test container alias without isolated network mode",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                            - image: postgres
+                              alias: db
+                `,
+			err: fmt.Errorf(`task "task01" runtime: container at index 1: alias requires the "isolated" network mode`),
+		},
+		{
+			name: "test duplicate container alias",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          network_mode: isolated
+                          containers:
+                            - image: busybox
+                            - image: postgres
+                              alias: db
+                            - image: mysql
+                              alias: db
+                `,
+			err: fmt.Errorf(`task "task01" runtime: duplicate container alias "db"`),
+		},
 		{
 			name: "test missing task dependency",
 			in: `
@@ -0,0 +1,56 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datamanager
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	walsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agola_datamanager_etcd_wals",
+			Help: "Number of wals in etcd by status",
+		},
+		[]string{"datamanager", "status"},
+	)
+	checkpointDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "agola_datamanager_checkpoint_duration_seconds",
+			Help:    "Duration of the data checkpoints",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+		},
+		[]string{"datamanager"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(walsGauge)
+	prometheus.MustRegister(checkpointDurationHistogram)
+}
+
+func (d *DataManager) updateWalsMetrics(walsData []*WalData) {
+	counts := map[WalStatus]int{
+		WalStatusCommitted:        0,
+		WalStatusCommittedStorage: 0,
+		WalStatusCheckpointed:     0,
+	}
+	for _, walData := range walsData {
+		counts[walData.WalStatus]++
+	}
+	for status, c := range counts {
+		walsGauge.WithLabelValues(d.basePath, string(status)).Set(float64(c))
+	}
+}
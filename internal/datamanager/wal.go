@@ -310,6 +310,39 @@ func (d *DataManager) LastCommittedStorageWal(ctx context.Context) (string, int6
 	return lastCommittedStorageWal, revision, nil
 }
 
+// WalsLag returns the number of wals committed after the provided wal sequence
+func (d *DataManager) WalsLag(ctx context.Context, walSeq string) (uint64, error) {
+	resp, err := d.e.Get(ctx, etcdWalsDataKey, 0)
+	if err != nil {
+		return 0, err
+	}
+	var walsData WalsData
+	if err := json.Unmarshal(resp.Kvs[0].Value, &walsData); err != nil {
+		return 0, err
+	}
+	if walsData.LastCommittedWalSequence == "" {
+		return 0, nil
+	}
+	lastWalSequence, err := sequence.Parse(walsData.LastCommittedWalSequence)
+	if err != nil {
+		return 0, err
+	}
+	if walSeq == "" {
+		return lastWalSequence.C, nil
+	}
+	walSequence, err := sequence.Parse(walSeq)
+	if err != nil {
+		return 0, err
+	}
+	if !walSequence.EqualEpoch(lastWalSequence) {
+		return 0, errors.Errorf("wal sequence %q epoch different than last committed wal sequence %q epoch", walSeq, walsData.LastCommittedWalSequence)
+	}
+	if walSequence.C >= lastWalSequence.C {
+		return 0, nil
+	}
+	return lastWalSequence.C - walSequence.C, nil
+}
+
 type WatchElement struct {
 	Revision              int64
 	WalData               *WalData
@@ -677,14 +710,19 @@ func (d *DataManager) checkpoint(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	walsData := []*WalData{}
+	allWalsData := []*WalData{}
 	for _, kv := range resp.Kvs {
 		var walData *WalData
 		if err := json.Unmarshal(kv.Value, &walData); err != nil {
 			return err
 		}
 		walData.Revision = kv.ModRevision
+		allWalsData = append(allWalsData, walData)
+	}
+	d.updateWalsMetrics(allWalsData)
 
+	walsData := []*WalData{}
+	for _, walData := range allWalsData {
 		if walData.WalStatus == WalStatusCommitted {
 			d.log.Warnf("wal %s not yet committed storage", walData.WalSequence)
 			break
@@ -698,9 +736,11 @@ func (d *DataManager) checkpoint(ctx context.Context) error {
 		return nil
 	}
 
+	start := time.Now()
 	if err := d.writeDataSnapshot(ctx, walsData); err != nil {
 		return errors.Errorf("checkpoint function error: %w", err)
 	}
+	checkpointDurationHistogram.WithLabelValues(d.basePath).Observe(time.Since(start).Seconds())
 
 	for _, walData := range walsData {
 		d.log.Debugf("updating wal to state %q", WalStatusCheckpointed)
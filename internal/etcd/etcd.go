@@ -251,7 +251,7 @@ func (s *Store) AtomicPut(ctx context.Context, key string, value []byte, prevRev
 	etcdv3Options := []etcdclientv3.OpOption{}
 	if options != nil {
 		if options.TTL > 0 {
-			lease, err := s.c.Grant(ctx, int64(options.TTL))
+			lease, err := s.c.Grant(ctx, int64(options.TTL.Seconds()))
 			if err != nil {
 				return nil, err
 			}
@@ -160,6 +160,14 @@ func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource
 	return nil
 }
 
+func (c *Client) CreatePullRequestComment(repopath, prID, body string) (string, error) {
+	return "", nil
+}
+
+func (c *Client) UpdatePullRequestComment(repopath, prID, commentID, body string) error {
+	return nil
+}
+
 func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	return nil, nil
 }
@@ -108,7 +108,7 @@ func New(opts Opts) (*Client, error) {
 		ExpectContinueTimeout: 1 * time.Second,
 		TLSClientConfig:       &tls.Config{InsecureSkipVerify: opts.SkipVerify},
 	}
-	httpClient := &http.Client{Transport: transport}
+	httpClient := &http.Client{Transport: gitsource.NewMetricsTransport("gitea", transport)}
 
 	client := gitea.NewClient(opts.APIURL, opts.Token)
 	client.SetHTTPClient(httpClient)
@@ -375,6 +375,43 @@ func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource
 	return err
 }
 
+func (c *Client) CreatePullRequestComment(repopath, prID, body string) (string, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return "", err
+	}
+	index, err := strconv.ParseInt(prID, 10, 64)
+	if err != nil {
+		return "", errors.Errorf("failed to parse pull request id %q: %w", prID, err)
+	}
+	comment, err := c.client.CreateIssueComment(owner, reponame, index, gtypes.CreateIssueCommentOption{
+		Body: body,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(comment.ID, 10), nil
+}
+
+func (c *Client) UpdatePullRequestComment(repopath, prID, commentID, body string) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	index, err := strconv.ParseInt(prID, 10, 64)
+	if err != nil {
+		return errors.Errorf("failed to parse pull request id %q: %w", prID, err)
+	}
+	id, err := strconv.ParseInt(commentID, 10, 64)
+	if err != nil {
+		return errors.Errorf("failed to parse comment id %q: %w", commentID, err)
+	}
+	_, err = c.client.EditIssueComment(owner, reponame, index, id, gtypes.EditIssueCommentOption{
+		Body: body,
+	})
+	return err
+}
+
 func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	remoteRepos, err := c.client.ListMyRepos()
 	if err != nil {
@@ -460,9 +497,15 @@ func (c *Client) GetCommit(repopath, commitSHA string) (*gitsource.Commit, error
 		return nil, err
 	}
 
+	var authorEmail string
+	if commit.RepoCommit.Author != nil {
+		authorEmail = commit.RepoCommit.Author.Email
+	}
+
 	return &gitsource.Commit{
-		SHA:     commit.SHA,
-		Message: commit.RepoCommit.Message,
+		SHA:         commit.SHA,
+		Message:     commit.RepoCommit.Message,
+		AuthorEmail: authorEmail,
 	}, nil
 }
 
@@ -120,7 +120,7 @@ func New(opts Opts) (*Client, error) {
 		ExpectContinueTimeout: 1 * time.Second,
 		TLSClientConfig:       &tls.Config{InsecureSkipVerify: opts.SkipVerify},
 	}
-	httpClient := &http.Client{Transport: &TokenTransport{token: opts.Token, rt: transport}}
+	httpClient := &http.Client{Transport: &TokenTransport{token: opts.Token, rt: gitsource.NewMetricsTransport("github", transport)}}
 
 	if opts.APIURL == GitHubAPIURL {
 		opts.WebURL = GitHubWebURL
@@ -358,6 +358,39 @@ func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource
 	return err
 }
 
+func (c *Client) CreatePullRequestComment(repopath, prID, body string) (string, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return "", err
+	}
+	number, err := strconv.Atoi(prID)
+	if err != nil {
+		return "", errors.Errorf("failed to parse pull request id %q: %w", prID, err)
+	}
+	comment, _, err := c.client.Issues.CreateComment(context.TODO(), owner, reponame, number, &github.IssueComment{
+		Body: github.String(body),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(comment.GetID(), 10), nil
+}
+
+func (c *Client) UpdatePullRequestComment(repopath, prID, commentID, body string) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(commentID, 10, 64)
+	if err != nil {
+		return errors.Errorf("failed to parse comment id %q: %w", commentID, err)
+	}
+	_, _, err = c.client.Issues.EditComment(context.TODO(), owner, reponame, id, &github.IssueComment{
+		Body: github.String(body),
+	})
+	return err
+}
+
 func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	remoteRepos := []*github.Repository{}
 
@@ -456,8 +489,9 @@ func (c *Client) GetCommit(repopath, commitSHA string) (*gitsource.Commit, error
 	}
 
 	return &gitsource.Commit{
-		SHA:     *commit.SHA,
-		Message: *commit.Message,
+		SHA:         *commit.SHA,
+		Message:     *commit.Message,
+		AuthorEmail: commit.GetAuthor().GetEmail(),
 	}, nil
 }
 
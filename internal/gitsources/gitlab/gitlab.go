@@ -88,7 +88,7 @@ func New(opts Opts) (*Client, error) {
 		ExpectContinueTimeout: 1 * time.Second,
 		TLSClientConfig:       &tls.Config{InsecureSkipVerify: opts.SkipVerify},
 	}
-	httpClient := &http.Client{Transport: transport}
+	httpClient := &http.Client{Transport: gitsource.NewMetricsTransport("gitlab", transport)}
 	client := gitlab.NewOAuthClient(httpClient, opts.Token)
 	if err := client.SetBaseURL(opts.APIURL); err != nil {
 		return nil, errors.Errorf("failed to set gitlab client base url: %w", err)
@@ -267,6 +267,35 @@ func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource
 	return err
 }
 
+func (c *Client) CreatePullRequestComment(repopath, prID, body string) (string, error) {
+	mergeRequest, err := strconv.Atoi(prID)
+	if err != nil {
+		return "", errors.Errorf("failed to parse merge request id %q: %w", prID, err)
+	}
+	note, _, err := c.client.Notes.CreateMergeRequestNote(repopath, mergeRequest, &gitlab.CreateMergeRequestNoteOptions{
+		Body: gitlab.String(body),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(note.ID), nil
+}
+
+func (c *Client) UpdatePullRequestComment(repopath, prID, commentID, body string) error {
+	mergeRequest, err := strconv.Atoi(prID)
+	if err != nil {
+		return errors.Errorf("failed to parse merge request id %q: %w", prID, err)
+	}
+	id, err := strconv.Atoi(commentID)
+	if err != nil {
+		return errors.Errorf("failed to parse comment id %q: %w", commentID, err)
+	}
+	_, _, err = c.client.Notes.UpdateMergeRequestNote(repopath, mergeRequest, id, &gitlab.UpdateMergeRequestNoteOptions{
+		Body: gitlab.String(body),
+	})
+	return err
+}
+
 func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	// get only repos with permission greater or equal to maintainer
 	opts := &gitlab.ListProjectsOptions{MinAccessLevel: gitlab.AccessLevel(gitlab.MaintainerPermissions)}
@@ -350,8 +379,9 @@ func (c *Client) GetCommit(repopath, commitSHA string) (*gitsource.Commit, error
 	}
 
 	return &gitsource.Commit{
-		SHA:     commit.ID,
-		Message: commit.Message,
+		SHA:         commit.ID,
+		Message:     commit.Message,
+		AuthorEmail: commit.AuthorEmail,
 	}, nil
 }
 
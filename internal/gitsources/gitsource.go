@@ -43,6 +43,10 @@ type GitSource interface {
 	CreateRepoWebhook(repopath, url, secret string) error
 	ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error)
 	CreateCommitStatus(repopath, commitSHA string, status CommitStatus, targetURL, description, context string) error
+	// CreatePullRequestComment creates a comment on the pull request and returns
+	// the comment id
+	CreatePullRequestComment(repopath, prID, body string) (string, error)
+	UpdatePullRequestComment(repopath, prID, commentID, body string) error
 	// ListUserRepos report repos where the user has the permission to create deploy keys and webhooks
 	ListUserRepos() ([]*RepoInfo, error)
 	GetRef(repopath, ref string) (*Ref, error)
@@ -108,6 +112,7 @@ type Ref struct {
 }
 
 type Commit struct {
-	SHA     string
-	Message string
+	SHA         string
+	Message     string
+	AuthorEmail string
 }
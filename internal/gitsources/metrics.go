@@ -0,0 +1,58 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitsource
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var apiErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "agola_gitsource_api_errors_total",
+		Help: "Number of failed git source api requests",
+	},
+	[]string{"gitsource", "code"},
+)
+
+func init() {
+	prometheus.MustRegister(apiErrors)
+}
+
+// MetricsTransport is an http.RoundTripper that counts the failed requests
+// (transport errors and responses with a status code >= 400) made to a git
+// source api
+type MetricsTransport struct {
+	gitsource string
+	rt        http.RoundTripper
+}
+
+func NewMetricsTransport(gitsource string, rt http.RoundTripper) *MetricsTransport {
+	return &MetricsTransport{gitsource: gitsource, rt: rt}
+}
+
+func (t *MetricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(r)
+	if err != nil {
+		apiErrors.WithLabelValues(t.gitsource, "error").Inc()
+		return resp, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErrors.WithLabelValues(t.gitsource, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	return resp, nil
+}
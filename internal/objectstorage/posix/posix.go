@@ -73,7 +73,7 @@ func (s *PosixStorage) Stat(p string) (*types.ObjectInfo, error) {
 		return nil, err
 	}
 
-	return &types.ObjectInfo{Path: p, LastModified: fi.ModTime()}, nil
+	return &types.ObjectInfo{Path: p, LastModified: fi.ModTime(), Size: fi.Size()}, nil
 }
 
 func (s *PosixStorage) ReadObject(p string) (types.ReadSeekCloser, error) {
@@ -98,7 +98,11 @@ func (s *PosixStorage) WriteObject(p string, data io.Reader, size int64, persist
 	if err := os.MkdirAll(path.Dir(fspath), 0770); err != nil {
 		return err
 	}
-	lr := io.LimitReader(data, size)
+	// a negative size means unknown size, read until EOF
+	lr := data
+	if size >= 0 {
+		lr = io.LimitReader(data, size)
+	}
 	return common.WriteFileAtomicFunc(fspath, s.dataDir, s.tmpDir, 0660, persist, func(f io.Writer) error {
 		_, err := io.Copy(f, lr)
 		return err
@@ -215,7 +219,7 @@ func (s *PosixStorage) List(prefix, startWith, delimiter string, doneCh <-chan s
 			if strings.HasPrefix(p, prefix) && p > startWith {
 				select {
 				// Send object content.
-				case objectCh <- types.ObjectInfo{Path: p, LastModified: info.ModTime()}:
+				case objectCh <- types.ObjectInfo{Path: p, LastModified: info.ModTime(), Size: info.Size()}:
 				// If receives done from the caller, return here.
 				case <-doneCh:
 					return io.EOF
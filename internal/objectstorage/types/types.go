@@ -36,6 +36,7 @@ type ObjectInfo struct {
 	Path string
 
 	LastModified time.Time
+	Size         int64
 
 	Err error
 }
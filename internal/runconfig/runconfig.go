@@ -17,12 +17,14 @@ package runconfig
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/config"
 	rstypes "agola.io/agola/internal/services/runservice/types"
 	"agola.io/agola/internal/services/types"
 	"agola.io/agola/internal/util"
 
+	units "github.com/docker/go-units"
 	errors "golang.org/x/xerrors"
 )
 
@@ -31,20 +33,48 @@ func genRuntime(c *config.Config, ce *config.Runtime, variables map[string]strin
 	for _, cc := range ce.Containers {
 		env := genEnv(cc.Environment, variables)
 		container := &rstypes.Container{
-			Image:       cc.Image,
-			Environment: env,
-			User:        cc.User,
-			Privileged:  cc.Privileged,
-			Entrypoint:  cc.Entrypoint,
+			Image:           cc.Image,
+			Environment:     env,
+			User:            cc.User,
+			Privileged:      cc.Privileged,
+			Entrypoint:      cc.Entrypoint,
+			ImagePullPolicy: rstypes.ImagePullPolicy(cc.ImagePullPolicy),
+			Alias:           cc.Alias,
 		}
 
 		containers = append(containers, container)
 	}
 
 	return &rstypes.Runtime{
-		Type:       rstypes.RuntimeType(ce.Type),
-		Arch:       ce.Arch,
-		Containers: containers,
+		Type:        rstypes.RuntimeType(ce.Type),
+		Arch:        ce.Arch,
+		Containers:  containers,
+		NetworkMode: rstypes.NetworkMode(ce.NetworkMode),
+		K8s:         genRuntimeK8s(ce.K8s),
+	}
+}
+
+func genRuntimeK8s(ck *config.RuntimeK8s) *rstypes.RuntimeK8s {
+	if ck == nil {
+		return nil
+	}
+	tolerations := []*rstypes.K8sToleration{}
+	for _, ct := range ck.Tolerations {
+		tolerations = append(tolerations, &rstypes.K8sToleration{
+			Key:               ct.Key,
+			Operator:          ct.Operator,
+			Value:             ct.Value,
+			Effect:            ct.Effect,
+			TolerationSeconds: ct.TolerationSeconds,
+		})
+	}
+	return &rstypes.RuntimeK8s{
+		NodeSelector:       ck.NodeSelector,
+		Tolerations:        tolerations,
+		ServiceAccountName: ck.ServiceAccountName,
+		PriorityClassName:  ck.PriorityClassName,
+		Annotations:        ck.Annotations,
+		Labels:             ck.Labels,
 	}
 }
 
@@ -203,6 +233,12 @@ func GenRunConfigTasks(uuid util.UUIDGenerator, c *config.Config, runName string
 
 		tEnv := genEnv(ct.Environment, variables)
 
+		// the max log size has already been validated by the config parser
+		var maxLogSize int64
+		if ct.MaxLogSize != "" {
+			maxLogSize, _ = units.RAMInBytes(ct.MaxLogSize)
+		}
+
 		t := &rstypes.RunConfigTask{
 			ID:                   uuid.New(ct.Name).String(),
 			Name:                 ct.Name,
@@ -215,38 +251,31 @@ func GenRunConfigTasks(uuid util.UUIDGenerator, c *config.Config, runName string
 			IgnoreFailure:        ct.IgnoreFailure,
 			Skip:                 !include,
 			NeedsApproval:        ct.Approval,
+			CommitStatus:         ct.CommitStatus,
 			DockerRegistriesAuth: make(map[string]rstypes.DockerRegistryAuth),
+
+			RescheduleOnExecutorLoss: ct.RescheduleOnExecutorLoss,
+			MaxLogSize:               maxLogSize,
+			FailOnLogTruncation:      ct.FailOnLogTruncation,
 		}
 
 		if c.DockerRegistriesAuth != nil {
 			for regname, auth := range c.DockerRegistriesAuth {
-				t.DockerRegistriesAuth[regname] = rstypes.DockerRegistryAuth{
-					Type:     rstypes.DockerRegistryAuthType(auth.Type),
-					Username: genValue(auth.Username, variables),
-					Password: genValue(auth.Password, variables),
-				}
+				t.DockerRegistriesAuth[regname] = genDockerRegistryAuth(auth, variables)
 			}
 		}
 
 		// override with per run docker registry auth
 		if cr.DockerRegistriesAuth != nil {
 			for regname, auth := range cr.DockerRegistriesAuth {
-				t.DockerRegistriesAuth[regname] = rstypes.DockerRegistryAuth{
-					Type:     rstypes.DockerRegistryAuthType(auth.Type),
-					Username: genValue(auth.Username, variables),
-					Password: genValue(auth.Password, variables),
-				}
+				t.DockerRegistriesAuth[regname] = genDockerRegistryAuth(auth, variables)
 			}
 		}
 
 		// override with per task docker registry auth
 		if ct.DockerRegistriesAuth != nil {
 			for regname, auth := range ct.DockerRegistriesAuth {
-				t.DockerRegistriesAuth[regname] = rstypes.DockerRegistryAuth{
-					Type:     rstypes.DockerRegistryAuthType(auth.Type),
-					Username: genValue(auth.Username, variables),
-					Password: genValue(auth.Password, variables),
-				}
+				t.DockerRegistriesAuth[regname] = genDockerRegistryAuth(auth, variables)
 			}
 		}
 
@@ -424,6 +453,22 @@ func GetAllParents(rcts map[string]*rstypes.RunConfigTask, task *rstypes.RunConf
 	return parents
 }
 
+// TaskReadyTime returns the time when the run task became ready to be
+// executed: the run start time or the end time of its last finished parent
+func TaskReadyTime(r *rstypes.Run, rc *rstypes.RunConfig, rct *rstypes.RunConfigTask) *time.Time {
+	readyTime := r.StartTime
+	for _, parent := range GetParents(rc.Tasks, rct) {
+		prt, ok := r.Tasks[parent.ID]
+		if !ok || prt.EndTime == nil {
+			continue
+		}
+		if readyTime == nil || prt.EndTime.After(*readyTime) {
+			readyTime = prt.EndTime
+		}
+	}
+	return readyTime
+}
+
 func GetParentDependConditions(t, pt *rstypes.RunConfigTask) []rstypes.RunConfigTaskDependCondition {
 	if dt, ok := t.Depends[pt.ID]; ok {
 		return dt.Conditions
@@ -439,6 +484,21 @@ func genEnv(cenv map[string]config.Value, variables map[string]string) map[strin
 	return env
 }
 
+func genDockerRegistryAuth(auth *config.DockerRegistryAuth, variables map[string]string) rstypes.DockerRegistryAuth {
+	return rstypes.DockerRegistryAuth{
+		Type:            rstypes.DockerRegistryAuthType(auth.Type),
+		Username:        genValue(auth.Username, variables),
+		Password:        genValue(auth.Password, variables),
+		Auth:            auth.Auth,
+		AccessKeyID:     genValue(auth.AccessKeyID, variables),
+		SecretAccessKey: genValue(auth.SecretAccessKey, variables),
+		Region:          auth.Region,
+		Endpoint:        auth.Endpoint,
+		ClientID:        genValue(auth.ClientID, variables),
+		ClientSecret:    genValue(auth.ClientSecret, variables),
+	}
+}
+
 func genValue(val config.Value, variables map[string]string) string {
 	switch val.Type {
 	case config.ValueTypeString:
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"agola.io/agola/internal/config"
 	rstypes "agola.io/agola/internal/services/runservice/types"
@@ -938,3 +939,90 @@ func TestGenRunConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskReadyTime(t *testing.T) {
+	runStart := time.Now().Add(-1 * time.Hour)
+	parent01End := runStart.Add(10 * time.Minute)
+	parent02End := runStart.Add(20 * time.Minute)
+
+	r := &rstypes.Run{
+		StartTime: &runStart,
+		Tasks: map[string]*rstypes.RunTask{
+			"task01": {ID: "task01", EndTime: &parent01End},
+			"task02": {ID: "task02", EndTime: &parent02End},
+			"task03": {ID: "task03"},
+			"task04": {ID: "task04"},
+			"task05": {ID: "task05", Status: rstypes.RunTaskStatusSkipped},
+			"task06": {ID: "task06"},
+		},
+	}
+	rc := &rstypes.RunConfig{
+		Tasks: map[string]*rstypes.RunConfigTask{
+			"task01": {ID: "task01"},
+			"task02": {ID: "task02"},
+			"task03": {
+				ID: "task03",
+				Depends: map[string]*rstypes.RunConfigTaskDepend{
+					"task01": {TaskID: "task01"},
+					"task02": {TaskID: "task02"},
+				},
+			},
+			"task04": {
+				ID: "task04",
+				Depends: map[string]*rstypes.RunConfigTaskDepend{
+					"task03": {TaskID: "task03"},
+				},
+			},
+			"task05": {ID: "task05"},
+			"task06": {
+				ID: "task06",
+				Depends: map[string]*rstypes.RunConfigTaskDepend{
+					"task01": {TaskID: "task01"},
+					"task05": {TaskID: "task05"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		rtID string
+		out  *time.Time
+	}{
+		{
+			name: "test root task",
+			rtID: "task01",
+			out:  &runStart,
+		},
+		{
+			name: "test task with finished parents",
+			rtID: "task03",
+			out:  &parent02End,
+		},
+		{
+			name: "test task with not finished parent",
+			rtID: "task04",
+			out:  &runStart,
+		},
+		{
+			name: "test task with a skipped parent",
+			rtID: "task06",
+			out:  &parent01End,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := TaskReadyTime(r, rc, rc.Tasks[tt.rtID])
+			if tt.out == nil {
+				if out != nil {
+					t.Fatalf("expected nil, got %s", out)
+				}
+				return
+			}
+			if out == nil || !out.Equal(*tt.out) {
+				t.Fatalf("expected %s, got %v", tt.out, out)
+			}
+		})
+	}
+}
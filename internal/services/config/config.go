@@ -15,12 +15,15 @@
 package config
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"time"
 
 	"agola.io/agola/internal/util"
 	errors "golang.org/x/xerrors"
 	yaml "gopkg.in/yaml.v2"
+
+	units "github.com/docker/go-units"
 )
 
 const (
@@ -55,6 +58,10 @@ type Gateway struct {
 	RunserviceURL  string `yaml:"runserviceURL"`
 	ConfigstoreURL string `yaml:"configstoreURL"`
 	GitserverURL   string `yaml:"gitserverURL"`
+	// NotificationURL is the notification service api url. If empty the
+	// features requiring it (run webhook deliveries and project
+	// subscriptions) are disabled
+	NotificationURL string `yaml:"notificationURL"`
 
 	Web           Web           `yaml:"web"`
 	Etcd          Etcd          `yaml:"etcd"`
@@ -63,11 +70,18 @@ type Gateway struct {
 	TokenSigning TokenSigning `yaml:"tokenSigning"`
 
 	AdminToken string `yaml:"adminToken"`
+
+	// MaxRunImportSize is the max size in bytes of a run bundle uploaded to
+	// the run import api. Defaults to 1GiB
+	MaxRunImportSize int64 `yaml:"maxRunImportSize"`
 }
 
 type Scheduler struct {
 	Debug bool `yaml:"debug"`
 
+	// Web is optional, when defined the scheduler will expose its metrics
+	Web Web `yaml:"web"`
+
 	RunserviceURL string `yaml:"runserviceURL"`
 }
 
@@ -81,7 +95,33 @@ type Notification struct {
 	RunserviceURL  string `yaml:"runserviceURL"`
 	ConfigstoreURL string `yaml:"configstoreURL"`
 
+	// Web is the notification service api listen configuration. If the listen
+	// address is empty the api isn't served
+	Web  Web  `yaml:"web"`
 	Etcd Etcd `yaml:"etcd"`
+
+	SMTP SMTP `yaml:"smtp"`
+}
+
+// SMTP defines the smtp server used to send email notifications. Email
+// notifications are disabled when Host is empty
+type SMTP struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// TLS enables implicit TLS. When false STARTTLS will be used if supported by
+	// the server
+	TLS           bool `yaml:"tls"`
+	SkipTLSVerify bool `yaml:"skipTLSVerify"`
+
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	FromAddress string `yaml:"fromAddress"`
+
+	// NotifyCommitAuthor enables sending email notifications also to the author
+	// of the run commit
+	NotifyCommitAuthor bool `yaml:"notifyCommitAuthor"`
 }
 
 type Runservice struct {
@@ -93,6 +133,25 @@ type Runservice struct {
 	ObjectStorage ObjectStorage `yaml:"objectStorage"`
 
 	RunCacheExpireInterval time.Duration `yaml:"runCacheExpireInterval"`
+	// RunCacheMaxSize is the max size of all the caches (i.e. 100GiB). When
+	// exceeded the least recently used caches are removed. Empty means no limit
+	RunCacheMaxSize string `yaml:"runCacheMaxSize"`
+
+	// RunRetention is the default retention policy of the finished runs. It can
+	// be overridden per project
+	RunRetention RunRetention `yaml:"runRetention"`
+}
+
+// RunRetention defines which finished runs are kept. A run is kept when at
+// least one of the rules matches it. When both keepLast and maxAge are not
+// defined all the runs are kept.
+type RunRetention struct {
+	// KeepLast is the number of latest runs to keep for every run group
+	KeepLast int `yaml:"keepLast"`
+	// MaxAge keeps the runs younger than MaxAge
+	MaxAge time.Duration `yaml:"maxAge"`
+	// KeepTagged always keeps the runs created for a tag
+	KeepTagged bool `yaml:"keepTagged"`
 }
 
 type Executor struct {
@@ -112,6 +171,58 @@ type Executor struct {
 	ActiveTasksLimit int `yaml:"active_tasks_limit"`
 
 	AllowPrivilegedContainers bool `yaml:"allowPrivilegedContainers"`
+
+	// Images defines how the executor manages the containers images. Currently
+	// used only by the docker driver
+	Images ExecutorImages `yaml:"images"`
+
+	// ArchiveCache defines the local cache of the workspace and cache archives
+	ArchiveCache ExecutorArchiveCache `yaml:"archiveCache"`
+
+	// PushLogsAndArchives makes the executor push the tasks logs and workspace
+	// archives to the runservice as soon as a step completes instead of
+	// waiting for the runservice to fetch them. When a push fails the
+	// runservice will fetch them as usual
+	PushLogsAndArchives bool `yaml:"pushLogsAndArchives"`
+
+	// ShutdownTimeout is the time the executor waits, when asked to
+	// terminate, for its running tasks to finish before stopping them. If 0
+	// the running tasks are stopped immediately
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	// StepLogs defines the limits of the tasks steps logs
+	StepLogs ExecutorStepLogs `yaml:"stepLogs"`
+}
+
+type ExecutorImages struct {
+	// Prepull are the images pulled at executor start. They are kept warm:
+	// periodically pulled again and never pruned. The tasks image pull
+	// policies other than "always" are honored only for these images
+	Prepull []string `yaml:"prepull"`
+	// MaxDiskUsage is the disk budget (i.e. "20GB") of the images used by the
+	// executor. When exceeded the least recently used images are removed. If
+	// empty the images aren't pruned
+	MaxDiskUsage string `yaml:"maxDiskUsage"`
+	// CheckInterval is the interval between two warm images refresh and images
+	// pruning (defaults to 1 hour)
+	CheckInterval time.Duration `yaml:"checkInterval"`
+}
+
+type ExecutorArchiveCache struct {
+	// MaxSize is the disk budget (i.e. "5GB") of the archive cache. When
+	// exceeded the least recently used archives are removed. The archive cache
+	// is disabled by default (empty or "0")
+	MaxSize string `yaml:"maxSize"`
+}
+
+type ExecutorStepLogs struct {
+	// MaxSize is the max size (i.e. "100MB") of a step log, log entries
+	// headers included. When exceeded the executor stops writing the step log
+	// and appends a truncation marker. A task max_log_size can only lower it.
+	// If empty the step logs aren't limited
+	MaxSize string `yaml:"maxSize"`
+	// FailOnTruncation makes a step fail when its log is truncated
+	FailOnTruncation bool `yaml:"failOnTruncation"`
 }
 
 type Configstore struct {
@@ -188,8 +299,10 @@ type Etcd struct {
 type DriverType string
 
 const (
-	DriverTypeDocker DriverType = "docker"
-	DriverTypeK8s    DriverType = "kubernetes"
+	DriverTypeDocker  DriverType = "docker"
+	DriverTypeK8s     DriverType = "kubernetes"
+	DriverTypeProcess DriverType = "process"
+	DriverTypeSandbox DriverType = "sandbox"
 )
 
 type Driver struct {
@@ -199,6 +312,129 @@ type Driver struct {
 
 	// k8s fields
 
+	// K8sPod defines the kubernetes driver pods customization
+	K8sPod K8sPod `yaml:"k8sPod"`
+
+	// process fields
+
+	// User is the unprivileged user used to execute the tasks processes. If
+	// empty the processes are executed as the executor user. Tasks containers
+	// and steps defining a different user will fail
+	User string `yaml:"user"`
+
+	// sandbox fields
+
+	// NoNetwork must be set to acknowledge that the sandbox driver pods have
+	// only the loopback network interface, so the tasks cannot access the
+	// network (also the clone step won't work with remote repositories)
+	NoNetwork bool `yaml:"noNetwork"`
+}
+
+// K8sTaskOverride is a kubernetes pod field that can be overridden by a task
+type K8sTaskOverride string
+
+const (
+	K8sTaskOverrideNodeSelector       K8sTaskOverride = "nodeSelector"
+	K8sTaskOverrideTolerations        K8sTaskOverride = "tolerations"
+	K8sTaskOverrideServiceAccountName K8sTaskOverride = "serviceAccountName"
+	K8sTaskOverridePriorityClassName  K8sTaskOverride = "priorityClassName"
+	K8sTaskOverrideAnnotations        K8sTaskOverride = "annotations"
+	K8sTaskOverrideLabels             K8sTaskOverride = "labels"
+)
+
+func IsValidK8sTaskOverride(o K8sTaskOverride) bool {
+	switch o {
+	case K8sTaskOverrideNodeSelector, K8sTaskOverrideTolerations, K8sTaskOverrideServiceAccountName,
+		K8sTaskOverridePriorityClassName, K8sTaskOverrideAnnotations, K8sTaskOverrideLabels:
+		return true
+	}
+	return false
+}
+
+type K8sPod struct {
+	NodeSelector map[string]string `yaml:"nodeSelector"`
+	Tolerations  []K8sToleration   `yaml:"tolerations"`
+	// Affinity is the pod affinity in the kubernetes api format
+	Affinity K8sRawObject `yaml:"affinity"`
+
+	ServiceAccountName string `yaml:"serviceAccountName"`
+	// AutomountServiceAccountToken mounts the service account token inside the
+	// pod. By default it isn't mounted so the tasks cannot talk with the
+	// kubernetes api
+	AutomountServiceAccountToken bool   `yaml:"automountServiceAccountToken"`
+	PriorityClassName            string `yaml:"priorityClassName"`
+	// ImagePullSecrets are the names of existing secrets added to the pod image
+	// pull secrets
+	ImagePullSecrets []string `yaml:"imagePullSecrets"`
+
+	Annotations map[string]string `yaml:"annotations"`
+	Labels      map[string]string `yaml:"labels"`
+
+	// AllowedTaskOverrides are the pod fields that the tasks can override using
+	// their runtime k8s definition
+	AllowedTaskOverrides []K8sTaskOverride `yaml:"allowedTaskOverrides"`
+}
+
+type K8sToleration struct {
+	Key               string `yaml:"key"`
+	Operator          string `yaml:"operator"`
+	Value             string `yaml:"value"`
+	Effect            string `yaml:"effect"`
+	TolerationSeconds *int64 `yaml:"tolerationSeconds"`
+}
+
+// K8sRawObject is a kubernetes api object defined in yaml. It's converted to
+// json so it can be unmarshalled in the related kubernetes api type
+type K8sRawObject []byte
+
+func (o *K8sRawObject) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	jv, err := yamlToJSONValue(v)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(jv)
+	if err != nil {
+		return err
+	}
+	*o = data
+	return nil
+}
+
+// yamlToJSONValue converts the yaml maps with interface keys to maps with
+// string keys so they can be marshalled to json
+func yamlToJSONValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, mv := range v {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, errors.Errorf("unsupported non string key %v", k)
+			}
+			jv, err := yamlToJSONValue(mv)
+			if err != nil {
+				return nil, err
+			}
+			m[ks] = jv
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, sv := range v {
+			jv, err := yamlToJSONValue(sv)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = jv
+		}
+		return s, nil
+	default:
+		return v, nil
+	}
 }
 
 type TokenSigning struct {
@@ -220,12 +456,22 @@ var defaultConfig = Config{
 		TokenSigning: TokenSigning{
 			Duration: 12 * time.Hour,
 		},
+		MaxRunImportSize: 1024 * 1024 * 1024,
+	},
+	Notification: Notification{
+		SMTP: SMTP{
+			Port: 25,
+		},
 	},
 	Runservice: Runservice{
 		RunCacheExpireInterval: 7 * 24 * time.Hour,
 	},
 	Executor: Executor{
 		ActiveTasksLimit: 2,
+		Images: ExecutorImages{
+			CheckInterval: 1 * time.Hour,
+		},
+		ShutdownTimeout: 10 * time.Minute,
 	},
 }
 
@@ -285,6 +531,9 @@ func Validate(c *Config) error {
 	if err := validateWeb(&c.Gateway.Web); err != nil {
 		return errors.Errorf("gateway web configuration error: %w", err)
 	}
+	if c.Gateway.MaxRunImportSize <= 0 {
+		return errors.Errorf("gateway maxRunImportSize must be greater than 0")
+	}
 
 	// Configstore
 	if c.Configstore.DataDir == "" {
@@ -301,6 +550,17 @@ func Validate(c *Config) error {
 	if err := validateWeb(&c.Runservice.Web); err != nil {
 		return errors.Errorf("runservice web configuration error: %w", err)
 	}
+	if c.Runservice.RunCacheMaxSize != "" {
+		if _, err := units.RAMInBytes(c.Runservice.RunCacheMaxSize); err != nil {
+			return errors.Errorf("runservice runCacheMaxSize is invalid: %w", err)
+		}
+	}
+	if c.Runservice.RunRetention.KeepLast < 0 {
+		return errors.Errorf("runservice runRetention keepLast must be greater or equal than 0")
+	}
+	if c.Runservice.RunRetention.MaxAge < 0 {
+		return errors.Errorf("runservice runRetention maxAge must be greater or equal than 0")
+	}
 
 	// Executor
 	if c.Executor.DataDir == "" {
@@ -318,14 +578,47 @@ func Validate(c *Config) error {
 	switch c.Executor.Driver.Type {
 	case DriverTypeDocker:
 	case DriverTypeK8s:
+	case DriverTypeProcess:
+	case DriverTypeSandbox:
+		if !c.Executor.Driver.NoNetwork {
+			return errors.Errorf("executor driver %q pods cannot access the network, set the driver noNetwork option to acknowledge it", c.Executor.Driver.Type)
+		}
 	default:
 		return errors.Errorf("executor driver type %q unknown", c.Executor.Driver.Type)
 	}
+	for _, o := range c.Executor.Driver.K8sPod.AllowedTaskOverrides {
+		if !IsValidK8sTaskOverride(o) {
+			return errors.Errorf("executor driver k8sPod allowedTaskOverrides: unknown override %q", o)
+		}
+	}
+	if c.Executor.Images.MaxDiskUsage != "" {
+		if _, err := units.RAMInBytes(c.Executor.Images.MaxDiskUsage); err != nil {
+			return errors.Errorf("executor images maxDiskUsage is invalid: %w", err)
+		}
+	}
+	if c.Executor.Images.CheckInterval <= 0 {
+		return errors.Errorf("executor images checkInterval must be greater than 0")
+	}
+	if c.Executor.ArchiveCache.MaxSize != "" {
+		if _, err := units.RAMInBytes(c.Executor.ArchiveCache.MaxSize); err != nil {
+			return errors.Errorf("executor archiveCache maxSize is invalid: %w", err)
+		}
+	}
+	if c.Executor.StepLogs.MaxSize != "" {
+		if _, err := units.RAMInBytes(c.Executor.StepLogs.MaxSize); err != nil {
+			return errors.Errorf("executor stepLogs maxSize is invalid: %w", err)
+		}
+	}
 
 	// Scheduler
 	if c.Scheduler.RunserviceURL == "" {
 		return errors.Errorf("scheduler runserviceURL is empty")
 	}
+	if c.Scheduler.Web.ListenAddress != "" {
+		if err := validateWeb(&c.Scheduler.Web); err != nil {
+			return errors.Errorf("scheduler web configuration error: %w", err)
+		}
+	}
 
 	// Notification
 	if c.Notification.WebExposedURL == "" {
@@ -337,6 +630,16 @@ func Validate(c *Config) error {
 	if c.Notification.RunserviceURL == "" {
 		return errors.Errorf("notification runserviceURL is empty")
 	}
+	if c.Notification.Web.ListenAddress != "" {
+		if err := validateWeb(&c.Notification.Web); err != nil {
+			return errors.Errorf("notification web configuration error: %w", err)
+		}
+	}
+	if c.Notification.SMTP.Host != "" {
+		if c.Notification.SMTP.FromAddress == "" {
+			return errors.Errorf("notification smtp fromAddress is empty")
+		}
+	}
 
 	// Git server
 	if c.Gitserver.DataDir == "" {
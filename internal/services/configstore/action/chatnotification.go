@@ -0,0 +1,261 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetChatNotifications(ctx context.Context, parentType types.ConfigType, parentRef string) ([]*types.ChatNotification, error) {
+	var chatNotifications []*types.ChatNotification
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		parentID, err := h.readDB.ResolveConfigID(tx, parentType, parentRef)
+		if err != nil {
+			return err
+		}
+		chatNotifications, err = h.readDB.GetChatNotifications(tx, parentID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chatNotifications, nil
+}
+
+func (h *ActionHandler) ValidateChatNotification(ctx context.Context, chatNotification *types.ChatNotification) error {
+	if chatNotification.Name == "" {
+		return util.NewErrBadRequest(errors.Errorf("chat notification name required"))
+	}
+	if !util.ValidateName(chatNotification.Name) {
+		return util.NewErrBadRequest(errors.Errorf("invalid chat notification name %q", chatNotification.Name))
+	}
+	if !types.IsValidChatNotificationType(chatNotification.Type) {
+		return util.NewErrBadRequest(errors.Errorf("invalid chat notification type %q", chatNotification.Type))
+	}
+	if chatNotification.SecretName == "" {
+		return util.NewErrBadRequest(errors.Errorf("chat notification secret name required"))
+	}
+	if chatNotification.SecretKey == "" {
+		return util.NewErrBadRequest(errors.Errorf("chat notification secret key required"))
+	}
+	for _, e := range chatNotification.Events {
+		if !types.IsValidChatNotificationEvent(e) {
+			return util.NewErrBadRequest(errors.Errorf("invalid chat notification event %q", e))
+		}
+	}
+	if chatNotification.Parent.Type == "" {
+		return util.NewErrBadRequest(errors.Errorf("chat notification parent type required"))
+	}
+	if chatNotification.Parent.ID == "" {
+		return util.NewErrBadRequest(errors.Errorf("chat notification parent id required"))
+	}
+	if chatNotification.Parent.Type != types.ConfigTypeProject {
+		return util.NewErrBadRequest(errors.Errorf("invalid chat notification parent type %q", chatNotification.Parent.Type))
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) CreateChatNotification(ctx context.Context, chatNotification *types.ChatNotification) (*types.ChatNotification, error) {
+	if err := h.ValidateChatNotification(ctx, chatNotification); err != nil {
+		return nil, err
+	}
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+	// changegroup is the chat notification name
+	cgNames := []string{util.EncodeSha256Hex("chatnotificationname-" + chatNotification.Name)}
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		parentID, err := h.readDB.ResolveConfigID(tx, chatNotification.Parent.Type, chatNotification.Parent.ID)
+		if err != nil {
+			return err
+		}
+		chatNotification.Parent.ID = parentID
+
+		// check duplicate chat notification name
+		w, err := h.readDB.GetChatNotificationByName(tx, chatNotification.Parent.ID, chatNotification.Name)
+		if err != nil {
+			return err
+		}
+		if w != nil {
+			return util.NewErrBadRequest(errors.Errorf("chat notification with name %q for %s with id %q already exists", chatNotification.Name, chatNotification.Parent.Type, chatNotification.Parent.ID))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chatNotification.ID = uuid.NewV4().String()
+
+	chatNotificationj, err := json.Marshal(chatNotification)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal chat notification: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeChatNotification),
+			ID:         chatNotification.ID,
+			Data:       chatNotificationj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return chatNotification, err
+}
+
+type UpdateChatNotificationRequest struct {
+	ChatNotificationName string
+
+	ChatNotification *types.ChatNotification
+}
+
+func (h *ActionHandler) UpdateChatNotification(ctx context.Context, req *UpdateChatNotificationRequest) (*types.ChatNotification, error) {
+	if err := h.ValidateChatNotification(ctx, req.ChatNotification); err != nil {
+		return nil, err
+	}
+
+	var curChatNotification *types.ChatNotification
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+
+		parentID, err := h.readDB.ResolveConfigID(tx, req.ChatNotification.Parent.Type, req.ChatNotification.Parent.ID)
+		if err != nil {
+			return err
+		}
+		req.ChatNotification.Parent.ID = parentID
+
+		// check chat notification exists
+		curChatNotification, err = h.readDB.GetChatNotificationByName(tx, req.ChatNotification.Parent.ID, req.ChatNotificationName)
+		if err != nil {
+			return err
+		}
+		if curChatNotification == nil {
+			return util.NewErrBadRequest(errors.Errorf("chat notification with name %q for %s with id %q doesn't exists", req.ChatNotificationName, req.ChatNotification.Parent.Type, req.ChatNotification.Parent.ID))
+		}
+
+		if curChatNotification.Name != req.ChatNotification.Name {
+			// check duplicate chat notification name
+			w, err := h.readDB.GetChatNotificationByName(tx, req.ChatNotification.Parent.ID, req.ChatNotification.Name)
+			if err != nil {
+				return err
+			}
+			if w != nil {
+				return util.NewErrBadRequest(errors.Errorf("chat notification with name %q for %s with id %q already exists", req.ChatNotification.Name, req.ChatNotification.Parent.Type, req.ChatNotification.Parent.ID))
+			}
+		}
+
+		// set/override ID that must be kept from the current chat notification
+		req.ChatNotification.ID = curChatNotification.ID
+
+		cgNames := []string{
+			util.EncodeSha256Hex("chatnotificationid-" + req.ChatNotification.ID),
+			util.EncodeSha256Hex("chatnotificationname-" + req.ChatNotification.Name),
+		}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chatNotificationj, err := json.Marshal(req.ChatNotification)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal chat notification: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeChatNotification),
+			ID:         req.ChatNotification.ID,
+			Data:       chatNotificationj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return req.ChatNotification, err
+}
+
+func (h *ActionHandler) DeleteChatNotification(ctx context.Context, parentType types.ConfigType, parentRef, chatNotificationName string) error {
+	var chatNotification *types.ChatNotification
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		parentID, err := h.readDB.ResolveConfigID(tx, parentType, parentRef)
+		if err != nil {
+			return err
+		}
+
+		// check chat notification existance
+		chatNotification, err = h.readDB.GetChatNotificationByName(tx, parentID, chatNotificationName)
+		if err != nil {
+			return err
+		}
+		if chatNotification == nil {
+			return util.NewErrBadRequest(errors.Errorf("chat notification with name %q doesn't exist", chatNotificationName))
+		}
+
+		// changegroup is the chat notification id
+		cgNames := []string{util.EncodeSha256Hex("chatnotificationid-" + chatNotification.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypeDelete,
+			DataType:   string(types.ConfigTypeChatNotification),
+			ID:         chatNotification.ID,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
@@ -61,6 +61,17 @@ func (h *ActionHandler) ValidateProject(ctx context.Context, project *types.Proj
 			return util.NewErrBadRequest(errors.Errorf("empty remote repository path"))
 		}
 	}
+	if project.CacheQuota < 0 {
+		return util.NewErrBadRequest(errors.Errorf("invalid cache quota %d", project.CacheQuota))
+	}
+	if project.RunRetention != nil {
+		if project.RunRetention.KeepLast < 0 {
+			return util.NewErrBadRequest(errors.Errorf("invalid run retention keep last %d", project.RunRetention.KeepLast))
+		}
+		if project.RunRetention.MaxAge < 0 {
+			return util.NewErrBadRequest(errors.Errorf("invalid run retention max age %s", project.RunRetention.MaxAge))
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,271 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetRunWebhooks(ctx context.Context, parentType types.ConfigType, parentRef string, tree bool) ([]*types.RunWebhook, error) {
+	var runWebhooks []*types.RunWebhook
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		parentID, err := h.readDB.ResolveConfigID(tx, parentType, parentRef)
+		if err != nil {
+			return err
+		}
+		if tree {
+			runWebhooks, err = h.readDB.GetRunWebhooksTree(tx, parentType, parentID)
+		} else {
+			runWebhooks, err = h.readDB.GetRunWebhooks(tx, parentID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return runWebhooks, nil
+}
+
+func (h *ActionHandler) ValidateRunWebhook(ctx context.Context, runWebhook *types.RunWebhook) error {
+	if runWebhook.Name == "" {
+		return util.NewErrBadRequest(errors.Errorf("run webhook name required"))
+	}
+	if !util.ValidateName(runWebhook.Name) {
+		return util.NewErrBadRequest(errors.Errorf("invalid run webhook name %q", runWebhook.Name))
+	}
+	if runWebhook.URL == "" {
+		return util.NewErrBadRequest(errors.Errorf("run webhook url required"))
+	}
+	u, err := url.Parse(runWebhook.URL)
+	if err != nil {
+		return util.NewErrBadRequest(errors.Errorf("invalid run webhook url %q: %w", runWebhook.URL, err))
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return util.NewErrBadRequest(errors.Errorf("invalid run webhook url %q: scheme must be http or https", runWebhook.URL))
+	}
+	for _, e := range runWebhook.Events {
+		if !types.IsValidRunWebhookEvent(e) {
+			return util.NewErrBadRequest(errors.Errorf("invalid run webhook event %q", e))
+		}
+	}
+	if runWebhook.Parent.Type == "" {
+		return util.NewErrBadRequest(errors.Errorf("run webhook parent type required"))
+	}
+	if runWebhook.Parent.ID == "" {
+		return util.NewErrBadRequest(errors.Errorf("run webhook parent id required"))
+	}
+	if runWebhook.Parent.Type != types.ConfigTypeProject && runWebhook.Parent.Type != types.ConfigTypeProjectGroup {
+		return util.NewErrBadRequest(errors.Errorf("invalid run webhook parent type %q", runWebhook.Parent.Type))
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) CreateRunWebhook(ctx context.Context, runWebhook *types.RunWebhook) (*types.RunWebhook, error) {
+	if err := h.ValidateRunWebhook(ctx, runWebhook); err != nil {
+		return nil, err
+	}
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+	// changegroup is the run webhook name
+	cgNames := []string{util.EncodeSha256Hex("runwebhookname-" + runWebhook.Name)}
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		parentID, err := h.readDB.ResolveConfigID(tx, runWebhook.Parent.Type, runWebhook.Parent.ID)
+		if err != nil {
+			return err
+		}
+		runWebhook.Parent.ID = parentID
+
+		// check duplicate run webhook name
+		w, err := h.readDB.GetRunWebhookByName(tx, runWebhook.Parent.ID, runWebhook.Name)
+		if err != nil {
+			return err
+		}
+		if w != nil {
+			return util.NewErrBadRequest(errors.Errorf("run webhook with name %q for %s with id %q already exists", runWebhook.Name, runWebhook.Parent.Type, runWebhook.Parent.ID))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	runWebhook.ID = uuid.NewV4().String()
+
+	runWebhookj, err := json.Marshal(runWebhook)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal run webhook: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeRunWebhook),
+			ID:         runWebhook.ID,
+			Data:       runWebhookj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return runWebhook, err
+}
+
+type UpdateRunWebhookRequest struct {
+	RunWebhookName string
+
+	RunWebhook *types.RunWebhook
+}
+
+func (h *ActionHandler) UpdateRunWebhook(ctx context.Context, req *UpdateRunWebhookRequest) (*types.RunWebhook, error) {
+	if err := h.ValidateRunWebhook(ctx, req.RunWebhook); err != nil {
+		return nil, err
+	}
+
+	var curRunWebhook *types.RunWebhook
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+
+		parentID, err := h.readDB.ResolveConfigID(tx, req.RunWebhook.Parent.Type, req.RunWebhook.Parent.ID)
+		if err != nil {
+			return err
+		}
+		req.RunWebhook.Parent.ID = parentID
+
+		// check run webhook exists
+		curRunWebhook, err = h.readDB.GetRunWebhookByName(tx, req.RunWebhook.Parent.ID, req.RunWebhookName)
+		if err != nil {
+			return err
+		}
+		if curRunWebhook == nil {
+			return util.NewErrBadRequest(errors.Errorf("run webhook with name %q for %s with id %q doesn't exists", req.RunWebhookName, req.RunWebhook.Parent.Type, req.RunWebhook.Parent.ID))
+		}
+
+		if curRunWebhook.Name != req.RunWebhook.Name {
+			// check duplicate run webhook name
+			w, err := h.readDB.GetRunWebhookByName(tx, req.RunWebhook.Parent.ID, req.RunWebhook.Name)
+			if err != nil {
+				return err
+			}
+			if w != nil {
+				return util.NewErrBadRequest(errors.Errorf("run webhook with name %q for %s with id %q already exists", req.RunWebhook.Name, req.RunWebhook.Parent.Type, req.RunWebhook.Parent.ID))
+			}
+		}
+
+		// set/override ID that must be kept from the current run webhook
+		req.RunWebhook.ID = curRunWebhook.ID
+		// keep the current secret if not provided
+		if req.RunWebhook.Secret == "" {
+			req.RunWebhook.Secret = curRunWebhook.Secret
+		}
+
+		cgNames := []string{
+			util.EncodeSha256Hex("runwebhookid-" + req.RunWebhook.ID),
+			util.EncodeSha256Hex("runwebhookname-" + req.RunWebhook.Name),
+		}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	runWebhookj, err := json.Marshal(req.RunWebhook)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal run webhook: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeRunWebhook),
+			ID:         req.RunWebhook.ID,
+			Data:       runWebhookj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return req.RunWebhook, err
+}
+
+func (h *ActionHandler) DeleteRunWebhook(ctx context.Context, parentType types.ConfigType, parentRef, runWebhookName string) error {
+	var runWebhook *types.RunWebhook
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		parentID, err := h.readDB.ResolveConfigID(tx, parentType, parentRef)
+		if err != nil {
+			return err
+		}
+
+		// check run webhook existance
+		runWebhook, err = h.readDB.GetRunWebhookByName(tx, parentID, runWebhookName)
+		if err != nil {
+			return err
+		}
+		if runWebhook == nil {
+			return util.NewErrBadRequest(errors.Errorf("run webhook with name %q doesn't exist", runWebhookName))
+		}
+
+		// changegroup is the run webhook id
+		cgNames := []string{util.EncodeSha256Hex("runwebhookid-" + runWebhook.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypeDelete,
+			DataType:   string(types.ConfigTypeRunWebhook),
+			ID:         runWebhook.ID,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/services/configstore/readdb"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// ChatNotification augments types.ChatNotification with dynamic data
+type ChatNotification struct {
+	*types.ChatNotification
+
+	// dynamic data
+	ParentPath string
+}
+
+type ChatNotificationsHandler struct {
+	log    *zap.SugaredLogger
+	ah     *action.ActionHandler
+	readDB *readdb.ReadDB
+}
+
+func NewChatNotificationsHandler(logger *zap.Logger, ah *action.ActionHandler, readDB *readdb.ReadDB) *ChatNotificationsHandler {
+	return &ChatNotificationsHandler{log: logger.Sugar(), ah: ah, readDB: readDB}
+}
+
+func (h *ChatNotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	chatNotifications, err := h.ah.GetChatNotifications(ctx, parentType, parentRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	resChatNotifications := make([]*ChatNotification, len(chatNotifications))
+	for i, cn := range chatNotifications {
+		resChatNotifications[i] = &ChatNotification{ChatNotification: cn}
+	}
+	err = h.readDB.Do(func(tx *db.Tx) error {
+		// populate parent path
+		for _, cn := range resChatNotifications {
+			pp, err := h.readDB.GetPath(tx, cn.Parent.Type, cn.Parent.ID)
+			if err != nil {
+				return err
+			}
+			cn.ParentPath = pp
+		}
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, resChatNotifications); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateChatNotificationHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateChatNotificationHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateChatNotificationHandler {
+	return &CreateChatNotificationHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateChatNotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var chatNotification *types.ChatNotification
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&chatNotification); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	chatNotification.Parent.Type = parentType
+	chatNotification.Parent.ID = parentRef
+
+	chatNotification, err = h.ah.CreateChatNotification(ctx, chatNotification)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, chatNotification); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateChatNotificationHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateChatNotificationHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateChatNotificationHandler {
+	return &UpdateChatNotificationHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateChatNotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	chatNotificationName := vars["chatnotificationname"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var chatNotification *types.ChatNotification
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&chatNotification); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	chatNotification.Parent.Type = parentType
+	chatNotification.Parent.ID = parentRef
+
+	areq := &action.UpdateChatNotificationRequest{
+		ChatNotificationName: chatNotificationName,
+		ChatNotification:     chatNotification,
+	}
+	chatNotification, err = h.ah.UpdateChatNotification(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, chatNotification); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteChatNotificationHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteChatNotificationHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteChatNotificationHandler {
+	return &DeleteChatNotificationHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteChatNotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	chatNotificationName := vars["chatnotificationname"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	err = h.ah.DeleteChatNotification(ctx, parentType, parentRef, chatNotificationName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
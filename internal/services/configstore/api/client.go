@@ -330,6 +330,112 @@ func (c *Client) DeleteProjectVariable(ctx context.Context, projectRef, variable
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/variables/%s", url.PathEscape(projectRef), variableName), nil, jsonContent, nil)
 }
 
+func (c *Client) GetProjectGroupRunWebhooks(ctx context.Context, projectGroupRef string, tree bool) ([]*RunWebhook, *http.Response, error) {
+	q := url.Values{}
+	if tree {
+		q.Add("tree", "")
+	}
+
+	runWebhooks := []*RunWebhook{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projectgroups/%s/runwebhooks", url.PathEscape(projectGroupRef)), q, jsonContent, nil, &runWebhooks)
+	return runWebhooks, resp, err
+}
+
+func (c *Client) GetProjectRunWebhooks(ctx context.Context, projectRef string, tree bool) ([]*RunWebhook, *http.Response, error) {
+	q := url.Values{}
+	if tree {
+		q.Add("tree", "")
+	}
+
+	runWebhooks := []*RunWebhook{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/runwebhooks", url.PathEscape(projectRef)), q, jsonContent, nil, &runWebhooks)
+	return runWebhooks, resp, err
+}
+
+func (c *Client) CreateProjectGroupRunWebhook(ctx context.Context, projectGroupRef string, runWebhook *types.RunWebhook) (*RunWebhook, *http.Response, error) {
+	pj, err := json.Marshal(runWebhook)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resRunWebhook := new(RunWebhook)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projectgroups/%s/runwebhooks", url.PathEscape(projectGroupRef)), nil, jsonContent, bytes.NewReader(pj), resRunWebhook)
+	return resRunWebhook, resp, err
+}
+
+func (c *Client) UpdateProjectGroupRunWebhook(ctx context.Context, projectGroupRef, runWebhookName string, runWebhook *types.RunWebhook) (*RunWebhook, *http.Response, error) {
+	pj, err := json.Marshal(runWebhook)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resRunWebhook := new(RunWebhook)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projectgroups/%s/runwebhooks/%s", url.PathEscape(projectGroupRef), runWebhookName), nil, jsonContent, bytes.NewReader(pj), resRunWebhook)
+	return resRunWebhook, resp, err
+}
+
+func (c *Client) CreateProjectRunWebhook(ctx context.Context, projectRef string, runWebhook *types.RunWebhook) (*RunWebhook, *http.Response, error) {
+	pj, err := json.Marshal(runWebhook)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resRunWebhook := new(RunWebhook)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projects/%s/runwebhooks", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(pj), resRunWebhook)
+	return resRunWebhook, resp, err
+}
+
+func (c *Client) UpdateProjectRunWebhook(ctx context.Context, projectRef, runWebhookName string, runWebhook *types.RunWebhook) (*RunWebhook, *http.Response, error) {
+	pj, err := json.Marshal(runWebhook)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resRunWebhook := new(RunWebhook)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/runwebhooks/%s", url.PathEscape(projectRef), runWebhookName), nil, jsonContent, bytes.NewReader(pj), resRunWebhook)
+	return resRunWebhook, resp, err
+}
+
+func (c *Client) DeleteProjectGroupRunWebhook(ctx context.Context, projectGroupRef, runWebhookName string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projectgroups/%s/runwebhooks/%s", url.PathEscape(projectGroupRef), runWebhookName), nil, jsonContent, nil)
+}
+
+func (c *Client) DeleteProjectRunWebhook(ctx context.Context, projectRef, runWebhookName string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/runwebhooks/%s", url.PathEscape(projectRef), runWebhookName), nil, jsonContent, nil)
+}
+
+func (c *Client) GetProjectChatNotifications(ctx context.Context, projectRef string) ([]*ChatNotification, *http.Response, error) {
+	chatNotifications := []*ChatNotification{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/chatnotifications", url.PathEscape(projectRef)), nil, jsonContent, nil, &chatNotifications)
+	return chatNotifications, resp, err
+}
+
+func (c *Client) CreateProjectChatNotification(ctx context.Context, projectRef string, chatNotification *types.ChatNotification) (*ChatNotification, *http.Response, error) {
+	pj, err := json.Marshal(chatNotification)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resChatNotification := new(ChatNotification)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projects/%s/chatnotifications", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(pj), resChatNotification)
+	return resChatNotification, resp, err
+}
+
+func (c *Client) UpdateProjectChatNotification(ctx context.Context, projectRef, chatNotificationName string, chatNotification *types.ChatNotification) (*ChatNotification, *http.Response, error) {
+	pj, err := json.Marshal(chatNotification)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resChatNotification := new(ChatNotification)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/chatnotifications/%s", url.PathEscape(projectRef), chatNotificationName), nil, jsonContent, bytes.NewReader(pj), resChatNotification)
+	return resChatNotification, resp, err
+}
+
+func (c *Client) DeleteProjectChatNotification(ctx context.Context, projectRef, chatNotificationName string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/chatnotifications/%s", url.PathEscape(projectRef), chatNotificationName), nil, jsonContent, nil)
+}
+
 func (c *Client) GetUser(ctx context.Context, userRef string) (*types.User, *http.Response, error) {
 	user := new(types.User)
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s", userRef), nil, jsonContent, nil, user)
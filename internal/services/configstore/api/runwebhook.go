@@ -0,0 +1,202 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/services/configstore/readdb"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// RunWebhook augments types.RunWebhook with dynamic data
+type RunWebhook struct {
+	*types.RunWebhook
+
+	// dynamic data
+	ParentPath string
+}
+
+type RunWebhooksHandler struct {
+	log    *zap.SugaredLogger
+	ah     *action.ActionHandler
+	readDB *readdb.ReadDB
+}
+
+func NewRunWebhooksHandler(logger *zap.Logger, ah *action.ActionHandler, readDB *readdb.ReadDB) *RunWebhooksHandler {
+	return &RunWebhooksHandler{log: logger.Sugar(), ah: ah, readDB: readDB}
+}
+
+func (h *RunWebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	_, tree := query["tree"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	runWebhooks, err := h.ah.GetRunWebhooks(ctx, parentType, parentRef, tree)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	resRunWebhooks := make([]*RunWebhook, len(runWebhooks))
+	for i, rw := range runWebhooks {
+		resRunWebhooks[i] = &RunWebhook{RunWebhook: rw}
+	}
+	err = h.readDB.Do(func(tx *db.Tx) error {
+		// populate parent path
+		for _, rw := range resRunWebhooks {
+			pp, err := h.readDB.GetPath(tx, rw.Parent.Type, rw.Parent.ID)
+			if err != nil {
+				return err
+			}
+			rw.ParentPath = pp
+		}
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, resRunWebhooks); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateRunWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateRunWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateRunWebhookHandler {
+	return &CreateRunWebhookHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateRunWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var runWebhook *types.RunWebhook
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&runWebhook); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	runWebhook.Parent.Type = parentType
+	runWebhook.Parent.ID = parentRef
+
+	runWebhook, err = h.ah.CreateRunWebhook(ctx, runWebhook)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, runWebhook); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateRunWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateRunWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateRunWebhookHandler {
+	return &UpdateRunWebhookHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateRunWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runWebhookName := vars["runwebhookname"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var runWebhook *types.RunWebhook
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&runWebhook); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	runWebhook.Parent.Type = parentType
+	runWebhook.Parent.ID = parentRef
+
+	areq := &action.UpdateRunWebhookRequest{
+		RunWebhookName: runWebhookName,
+		RunWebhook:     runWebhook,
+	}
+	runWebhook, err = h.ah.UpdateRunWebhook(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, runWebhook); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteRunWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteRunWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteRunWebhookHandler {
+	return &DeleteRunWebhookHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteRunWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runWebhookName := vars["runwebhookname"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	err = h.ah.DeleteRunWebhook(ctx, parentType, parentRef, runWebhookName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
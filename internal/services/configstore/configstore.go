@@ -33,6 +33,7 @@ import (
 	"agola.io/agola/internal/util"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -83,6 +84,8 @@ func NewConfigstore(ctx context.Context, c *config.Configstore) (*Configstore, e
 			string(types.ConfigTypeRemoteSource),
 			string(types.ConfigTypeSecret),
 			string(types.ConfigTypeVariable),
+			string(types.ConfigTypeRunWebhook),
+			string(types.ConfigTypeChatNotification),
 		},
 	}
 	dm, err := datamanager.NewDataManager(ctx, logger, dmConf)
@@ -136,6 +139,16 @@ func (s *Configstore) Run(ctx context.Context) error {
 	updateVariableHandler := api.NewUpdateVariableHandler(logger, s.ah)
 	deleteVariableHandler := api.NewDeleteVariableHandler(logger, s.ah)
 
+	runWebhooksHandler := api.NewRunWebhooksHandler(logger, s.ah, s.readDB)
+	createRunWebhookHandler := api.NewCreateRunWebhookHandler(logger, s.ah)
+	updateRunWebhookHandler := api.NewUpdateRunWebhookHandler(logger, s.ah)
+	deleteRunWebhookHandler := api.NewDeleteRunWebhookHandler(logger, s.ah)
+
+	chatNotificationsHandler := api.NewChatNotificationsHandler(logger, s.ah, s.readDB)
+	createChatNotificationHandler := api.NewCreateChatNotificationHandler(logger, s.ah)
+	updateChatNotificationHandler := api.NewUpdateChatNotificationHandler(logger, s.ah)
+	deleteChatNotificationHandler := api.NewDeleteChatNotificationHandler(logger, s.ah)
+
 	userHandler := api.NewUserHandler(logger, s.readDB)
 	usersHandler := api.NewUsersHandler(logger, s.readDB)
 	createUserHandler := api.NewCreateUserHandler(logger, s.ah)
@@ -169,6 +182,8 @@ func (s *Configstore) Run(ctx context.Context) error {
 	router := mux.NewRouter()
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
 
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
 	apirouter.Handle("/projectgroups/{projectgroupref}", projectGroupHandler).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/subgroups", projectGroupSubgroupsHandler).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/projects", projectGroupProjectsHandler).Methods("GET")
@@ -199,6 +214,20 @@ func (s *Configstore) Run(ctx context.Context) error {
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables/{variablename}", deleteVariableHandler).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/variables/{variablename}", deleteVariableHandler).Methods("DELETE")
 
+	apirouter.Handle("/projectgroups/{projectgroupref}/runwebhooks", runWebhooksHandler).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/runwebhooks", runWebhooksHandler).Methods("GET")
+	apirouter.Handle("/projectgroups/{projectgroupref}/runwebhooks", createRunWebhookHandler).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/runwebhooks", createRunWebhookHandler).Methods("POST")
+	apirouter.Handle("/projectgroups/{projectgroupref}/runwebhooks/{runwebhookname}", updateRunWebhookHandler).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/runwebhooks/{runwebhookname}", updateRunWebhookHandler).Methods("PUT")
+	apirouter.Handle("/projectgroups/{projectgroupref}/runwebhooks/{runwebhookname}", deleteRunWebhookHandler).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/runwebhooks/{runwebhookname}", deleteRunWebhookHandler).Methods("DELETE")
+
+	apirouter.Handle("/projects/{projectref}/chatnotifications", chatNotificationsHandler).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/chatnotifications", createChatNotificationHandler).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/chatnotifications/{chatnotificationname}", updateChatNotificationHandler).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/chatnotifications/{chatnotificationname}", deleteChatNotificationHandler).Methods("DELETE")
+
 	apirouter.Handle("/users/{userref}", userHandler).Methods("GET")
 	apirouter.Handle("/users", usersHandler).Methods("GET")
 	apirouter.Handle("/users", createUserHandler).Methods("POST")
@@ -0,0 +1,154 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	sq "github.com/Masterminds/squirrel"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	chatNotificationSelect = sb.Select("id", "data").From("chatnotification")
+	chatNotificationInsert = sb.Insert("chatnotification").Columns("id", "name", "parentid", "parenttype", "data")
+)
+
+func (r *ReadDB) insertChatNotification(tx *db.Tx, data []byte) error {
+	chatNotification := types.ChatNotification{}
+	if err := json.Unmarshal(data, &chatNotification); err != nil {
+		return errors.Errorf("failed to unmarshal chat notification: %w", err)
+	}
+	// poor man insert or update...
+	if err := r.deleteChatNotification(tx, chatNotification.ID); err != nil {
+		return err
+	}
+	q, args, err := chatNotificationInsert.Values(chatNotification.ID, chatNotification.Name, chatNotification.Parent.ID, chatNotification.Parent.Type, data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return errors.Errorf("failed to insert chat notification: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReadDB) deleteChatNotification(tx *db.Tx, id string) error {
+	// poor man insert or update...
+	if _, err := tx.Exec("delete from chatnotification where id = $1", id); err != nil {
+		return errors.Errorf("failed to delete chat notification: %w", err)
+	}
+	return nil
+}
+
+func (r *ReadDB) GetChatNotificationByID(tx *db.Tx, chatNotificationID string) (*types.ChatNotification, error) {
+	q, args, err := chatNotificationSelect.Where(sq.Eq{"id": chatNotificationID}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	chatNotifications, _, err := fetchChatNotifications(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(chatNotifications) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(chatNotifications) == 0 {
+		return nil, nil
+	}
+	return chatNotifications[0], nil
+}
+
+func (r *ReadDB) GetChatNotificationByName(tx *db.Tx, parentID, name string) (*types.ChatNotification, error) {
+	q, args, err := chatNotificationSelect.Where(sq.Eq{"parentid": parentID, "name": name}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	chatNotifications, _, err := fetchChatNotifications(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(chatNotifications) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(chatNotifications) == 0 {
+		return nil, nil
+	}
+	return chatNotifications[0], nil
+}
+
+func (r *ReadDB) GetChatNotifications(tx *db.Tx, parentID string) ([]*types.ChatNotification, error) {
+	q, args, err := chatNotificationSelect.Where(sq.Eq{"parentid": parentID}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	chatNotifications, _, err := fetchChatNotifications(tx, q, args...)
+	return chatNotifications, err
+}
+
+func fetchChatNotifications(tx *db.Tx, q string, args ...interface{}) ([]*types.ChatNotification, []string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanChatNotifications(rows)
+}
+
+func scanChatNotification(rows *sql.Rows, additionalFields ...interface{}) (*types.ChatNotification, string, error) {
+	var id string
+	var data []byte
+	if err := rows.Scan(&id, &data); err != nil {
+		return nil, "", errors.Errorf("failed to scan rows: %w", err)
+	}
+	chatNotification := types.ChatNotification{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &chatNotification); err != nil {
+			return nil, "", errors.Errorf("failed to unmarshal chat notification: %w", err)
+		}
+	}
+
+	return &chatNotification, id, nil
+}
+
+func scanChatNotifications(rows *sql.Rows) ([]*types.ChatNotification, []string, error) {
+	chatNotifications := []*types.ChatNotification{}
+	ids := []string{}
+	for rows.Next() {
+		p, id, err := scanChatNotification(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		chatNotifications = append(chatNotifications, p)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return chatNotifications, ids, nil
+}
@@ -53,4 +53,10 @@ var Stmts = []string{
 
 	"create table variable (id uuid, name varchar, parentid varchar, parenttype varchar, data bytea, PRIMARY KEY (id))",
 	"create index variable_name on variable(name)",
+
+	"create table runwebhook (id uuid, name varchar, parentid varchar, parenttype varchar, data bytea, PRIMARY KEY (id))",
+	"create index runwebhook_name on runwebhook(name)",
+
+	"create table chatnotification (id uuid, name varchar, parentid varchar, parenttype varchar, data bytea, PRIMARY KEY (id))",
+	"create index chatnotification_name on chatnotification(name)",
 }
@@ -0,0 +1,79 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	syncLagUpdaterInterval = 10 * time.Second
+)
+
+var syncLagGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "agola_configstore_readdb_sync_lag_wals",
+		Help: "Number of committed wals not yet applied to the readdb",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(syncLagGauge)
+}
+
+func (r *ReadDB) syncLagUpdaterLoop(ctx context.Context) {
+	for {
+		if err := r.syncLagUpdater(ctx); err != nil {
+			r.log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		time.Sleep(syncLagUpdaterInterval)
+	}
+}
+
+func (r *ReadDB) syncLagUpdater(ctx context.Context) error {
+	if !r.IsInitialized() {
+		return nil
+	}
+
+	var curWalSeq string
+	err := r.rdb.Do(func(tx *db.Tx) error {
+		var err error
+		curWalSeq, err = r.GetCommittedWalSequence(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	lag, err := r.dm.WalsLag(ctx, curWalSeq)
+	if err != nil {
+		return err
+	}
+	syncLagGauge.Set(float64(lag))
+
+	return nil
+}
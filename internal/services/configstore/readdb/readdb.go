@@ -418,6 +418,8 @@ func (r *ReadDB) Run(ctx context.Context) error {
 	}
 	r.SetInitialized(true)
 
+	go r.syncLagUpdaterLoop(ctx)
+
 	errCh := make(chan error)
 	for {
 		for {
@@ -648,6 +650,14 @@ func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
 			if err := r.insertVariable(tx, action.Data); err != nil {
 				return err
 			}
+		case types.ConfigTypeRunWebhook:
+			if err := r.insertRunWebhook(tx, action.Data); err != nil {
+				return err
+			}
+		case types.ConfigTypeChatNotification:
+			if err := r.insertChatNotification(tx, action.Data); err != nil {
+				return err
+			}
 		}
 
 	case datamanager.ActionTypeDelete:
@@ -692,6 +702,16 @@ func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
 			if err := r.deleteVariable(tx, action.ID); err != nil {
 				return err
 			}
+		case types.ConfigTypeRunWebhook:
+			r.log.Debugf("deleting run webhook with id: %s", action.ID)
+			if err := r.deleteRunWebhook(tx, action.ID); err != nil {
+				return err
+			}
+		case types.ConfigTypeChatNotification:
+			r.log.Debugf("deleting chat notification with id: %s", action.ID)
+			if err := r.deleteChatNotification(tx, action.ID); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -0,0 +1,191 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	sq "github.com/Masterminds/squirrel"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	runWebhookSelect = sb.Select("id", "data").From("runwebhook")
+	runWebhookInsert = sb.Insert("runwebhook").Columns("id", "name", "parentid", "parenttype", "data")
+)
+
+func (r *ReadDB) insertRunWebhook(tx *db.Tx, data []byte) error {
+	runWebhook := types.RunWebhook{}
+	if err := json.Unmarshal(data, &runWebhook); err != nil {
+		return errors.Errorf("failed to unmarshal run webhook: %w", err)
+	}
+	// poor man insert or update...
+	if err := r.deleteRunWebhook(tx, runWebhook.ID); err != nil {
+		return err
+	}
+	q, args, err := runWebhookInsert.Values(runWebhook.ID, runWebhook.Name, runWebhook.Parent.ID, runWebhook.Parent.Type, data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return errors.Errorf("failed to insert run webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReadDB) deleteRunWebhook(tx *db.Tx, id string) error {
+	// poor man insert or update...
+	if _, err := tx.Exec("delete from runwebhook where id = $1", id); err != nil {
+		return errors.Errorf("failed to delete run webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *ReadDB) GetRunWebhookByID(tx *db.Tx, runWebhookID string) (*types.RunWebhook, error) {
+	q, args, err := runWebhookSelect.Where(sq.Eq{"id": runWebhookID}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	runWebhooks, _, err := fetchRunWebhooks(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(runWebhooks) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(runWebhooks) == 0 {
+		return nil, nil
+	}
+	return runWebhooks[0], nil
+}
+
+func (r *ReadDB) GetRunWebhookByName(tx *db.Tx, parentID, name string) (*types.RunWebhook, error) {
+	q, args, err := runWebhookSelect.Where(sq.Eq{"parentid": parentID, "name": name}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	runWebhooks, _, err := fetchRunWebhooks(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(runWebhooks) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(runWebhooks) == 0 {
+		return nil, nil
+	}
+	return runWebhooks[0], nil
+}
+
+func (r *ReadDB) GetRunWebhooks(tx *db.Tx, parentID string) ([]*types.RunWebhook, error) {
+	q, args, err := runWebhookSelect.Where(sq.Eq{"parentid": parentID}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	runWebhooks, _, err := fetchRunWebhooks(tx, q, args...)
+	return runWebhooks, err
+}
+
+func (r *ReadDB) GetRunWebhooksTree(tx *db.Tx, parentType types.ConfigType, parentID string) ([]*types.RunWebhook, error) {
+	allRunWebhooks := []*types.RunWebhook{}
+
+	for parentType == types.ConfigTypeProjectGroup || parentType == types.ConfigTypeProject {
+		webhooks, err := r.GetRunWebhooks(tx, parentID)
+		if err != nil {
+			return nil, errors.Errorf("failed to get run webhooks for %s %q: %w", parentType, parentID, err)
+		}
+		allRunWebhooks = append(allRunWebhooks, webhooks...)
+
+		switch parentType {
+		case types.ConfigTypeProjectGroup:
+			projectGroup, err := r.GetProjectGroup(tx, parentID)
+			if err != nil {
+				return nil, err
+			}
+			if projectGroup == nil {
+				return nil, errors.Errorf("projectgroup with id %q doesn't exist", parentID)
+			}
+			parentType = projectGroup.Parent.Type
+			parentID = projectGroup.Parent.ID
+		case types.ConfigTypeProject:
+			project, err := r.GetProject(tx, parentID)
+			if err != nil {
+				return nil, err
+			}
+			if project == nil {
+				return nil, errors.Errorf("project with id %q doesn't exist", parentID)
+			}
+			parentType = project.Parent.Type
+			parentID = project.Parent.ID
+		}
+	}
+
+	return allRunWebhooks, nil
+}
+
+func fetchRunWebhooks(tx *db.Tx, q string, args ...interface{}) ([]*types.RunWebhook, []string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanRunWebhooks(rows)
+}
+
+func scanRunWebhook(rows *sql.Rows, additionalFields ...interface{}) (*types.RunWebhook, string, error) {
+	var id string
+	var data []byte
+	if err := rows.Scan(&id, &data); err != nil {
+		return nil, "", errors.Errorf("failed to scan rows: %w", err)
+	}
+	runWebhook := types.RunWebhook{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &runWebhook); err != nil {
+			return nil, "", errors.Errorf("failed to unmarshal run webhook: %w", err)
+		}
+	}
+
+	return &runWebhook, id, nil
+}
+
+func scanRunWebhooks(rows *sql.Rows) ([]*types.RunWebhook, []string, error) {
+	runWebhooks := []*types.RunWebhook{}
+	ids := []string{}
+	for rows.Next() {
+		p, id, err := scanRunWebhook(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		runWebhooks = append(runWebhooks, p)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return runWebhooks, ids, nil
+}
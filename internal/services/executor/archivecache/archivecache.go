@@ -0,0 +1,282 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archivecache implements the executor local cache of the workspace
+// and cache archives.
+//
+// Archives are content addressed: they're saved using the hex encoded sha256
+// of their content. The runservice returns the same hash as the archive ETag
+// so, before downloading a task archive or a cache, the executor checks it with
+// a HEAD request and uses the local archive when available.
+// The cache is size bounded, when its size is exceeded the least recently used
+// archives (using the file modification time) are removed.
+package archivecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+const tmpPrefix = ".tmp-"
+
+var hashRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type ArchiveCache struct {
+	dir     string
+	maxSize int64
+
+	mu sync.Mutex
+}
+
+// New creates an archive cache in dir. If maxSize is 0 the cache is disabled
+// and a nil ArchiveCache is returned. A nil ArchiveCache is valid and never
+// caches anything.
+func New(dir string, maxSize int64) (*ArchiveCache, error) {
+	if maxSize <= 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return nil, err
+	}
+
+	c := &ArchiveCache{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+
+	// remove temporary files left by a previous executor instance
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		if strings.HasPrefix(fi.Name(), tmpPrefix) {
+			if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+
+	if err := c.prune(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ETagHash returns the archive hash contained in the provided ETag header
+// value or an empty string if it doesn't contain a valid hash
+func ETagHash(etag string) string {
+	etag = strings.TrimPrefix(etag, "W/")
+	etag = strings.Trim(etag, `"`)
+	if !hashRegexp.MatchString(etag) {
+		return ""
+	}
+	return etag
+}
+
+func (c *ArchiveCache) archivePath(hash string) string {
+	return filepath.Join(c.dir, hash)
+}
+
+// Open opens the archive with the provided hash marking it as recently used.
+// It returns an error satisfying os.IsNotExist if the archive isn't cached.
+func (c *ArchiveCache) Open(hash string) (*os.File, error) {
+	if c == nil || !hashRegexp.MatchString(hash) {
+		return nil, os.ErrNotExist
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.archivePath(hash)
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// AddFile adds a copy of the archive at path p to the cache returning its hash.
+func (c *ArchiveCache) AddFile(p string) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tmpf, err := ioutil.TempFile(c.dir, tmpPrefix)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpf, h), f); err != nil {
+		tmpf.Close()
+		os.Remove(tmpf.Name())
+		return "", err
+	}
+	if err := tmpf.Close(); err != nil {
+		os.Remove(tmpf.Name())
+		return "", err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	if err := c.commit(tmpf.Name(), hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// NewReader returns a reader that reads from r and saves the read content in
+// the cache. The archive is added to the cache when the reader is closed only
+// if r has been fully read and its content hash is the expected one. If
+// the cache is nil or the expected hash is empty r is returned.
+func (c *ArchiveCache) NewReader(r io.ReadCloser, expectedHash string) io.ReadCloser {
+	if c == nil || !hashRegexp.MatchString(expectedHash) {
+		return r
+	}
+
+	tmpf, err := ioutil.TempFile(c.dir, tmpPrefix)
+	if err != nil {
+		// just don't cache the archive
+		return r
+	}
+	return &cacheReader{
+		c:            c,
+		r:            r,
+		tmpf:         tmpf,
+		h:            sha256.New(),
+		expectedHash: expectedHash,
+	}
+}
+
+type cacheReader struct {
+	c            *ArchiveCache
+	r            io.ReadCloser
+	tmpf         *os.File
+	h            hash.Hash
+	expectedHash string
+
+	eof    bool
+	failed bool
+}
+
+func (cr *cacheReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 && !cr.failed {
+		if _, werr := cr.tmpf.Write(p[:n]); werr != nil {
+			// stop caching but continue reading
+			cr.failed = true
+		}
+		_, _ = cr.h.Write(p[:n])
+	}
+	if err == io.EOF {
+		cr.eof = true
+	}
+	return n, err
+}
+
+func (cr *cacheReader) Close() error {
+	err := cr.r.Close()
+
+	tmpPath := cr.tmpf.Name()
+	if cerr := cr.tmpf.Close(); cerr != nil {
+		cr.failed = true
+	}
+	if !cr.eof || cr.failed || hex.EncodeToString(cr.h.Sum(nil)) != cr.expectedHash {
+		os.Remove(tmpPath)
+		return err
+	}
+	// caching is best effort
+	_ = cr.c.commit(tmpPath, cr.expectedHash)
+
+	return err
+}
+
+// commit moves the temporary file to its final path and prunes the cache
+func (c *ArchiveCache) commit(tmpPath, hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmpPath, c.archivePath(hash)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return c.pruneLocked()
+}
+
+func (c *ArchiveCache) prune() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pruneLocked()
+}
+
+// pruneLocked removes the least recently used archives until the cache size is
+// lower than the max size
+func (c *ArchiveCache) pruneLocked() error {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	archives := []os.FileInfo{}
+	var size int64
+	for _, fi := range files {
+		if !hashRegexp.MatchString(fi.Name()) {
+			continue
+		}
+		archives = append(archives, fi)
+		size += fi.Size()
+	}
+	if size <= c.maxSize {
+		return nil
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].ModTime().Before(archives[j].ModTime())
+	})
+	for _, fi := range archives {
+		if size <= c.maxSize {
+			break
+		}
+		// removing an archive currently being read is safe since open files
+		// stay readable until closed
+		if err := os.Remove(c.archivePath(fi.Name())); err != nil && !os.IsNotExist(err) {
+			return errors.Errorf("failed to remove cached archive %q: %w", fi.Name(), err)
+		}
+		size -= fi.Size()
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archivecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func contentHash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func readCached(t *testing.T, c *ArchiveCache, hash string) []byte {
+	f, err := c.Open(hash)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	return data
+}
+
+func TestArchiveCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archivecache")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New(filepath.Join(dir, "cache"), 100)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	t.Run("add file", func(t *testing.T) {
+		data := bytes.Repeat([]byte("a"), 40)
+		p := filepath.Join(dir, "archive01")
+		if err := ioutil.WriteFile(p, data, 0660); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		hash, err := c.AddFile(p)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if hash != contentHash(data) {
+			t.Fatalf("expected hash %q, got %q", contentHash(data), hash)
+		}
+		if got := readCached(t, c, hash); !bytes.Equal(got, data) {
+			t.Fatalf("unexpected cached data")
+		}
+	})
+
+	t.Run("reader with expected hash", func(t *testing.T) {
+		data := bytes.Repeat([]byte("b"), 40)
+		r := c.NewReader(ioutil.NopCloser(bytes.NewReader(data)), contentHash(data))
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		r.Close()
+		if got := readCached(t, c, contentHash(data)); !bytes.Equal(got, data) {
+			t.Fatalf("unexpected cached data")
+		}
+	})
+
+	t.Run("reader with wrong hash or partially read isn't cached", func(t *testing.T) {
+		data := bytes.Repeat([]byte("c"), 40)
+		wrongHash := contentHash([]byte("wrong"))
+		r := c.NewReader(ioutil.NopCloser(bytes.NewReader(data)), wrongHash)
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		r.Close()
+		if _, err := c.Open(wrongHash); !os.IsNotExist(err) {
+			t.Fatalf("expected not exist error, got: %v", err)
+		}
+
+		r = c.NewReader(ioutil.NopCloser(bytes.NewReader(data)), contentHash(data))
+		if _, err := r.Read(make([]byte, 10)); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		r.Close()
+		if _, err := c.Open(contentHash(data)); !os.IsNotExist(err) {
+			t.Fatalf("expected not exist error, got: %v", err)
+		}
+	})
+
+	t.Run("least recently used archives are pruned", func(t *testing.T) {
+		hashA := contentHash(bytes.Repeat([]byte("a"), 40))
+		hashB := contentHash(bytes.Repeat([]byte("b"), 40))
+		// make archive "b" the least recently used
+		old := time.Now().Add(-1 * time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, "cache", hashB), old, old); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		data := bytes.Repeat([]byte("d"), 40)
+		p := filepath.Join(dir, "archive02")
+		if err := ioutil.WriteFile(p, data, 0660); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := c.AddFile(p); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if _, err := c.Open(hashB); !os.IsNotExist(err) {
+			t.Fatalf("expected archive %q to be pruned, got: %v", hashB, err)
+		}
+		for _, hash := range []string{hashA, contentHash(data)} {
+			f, err := c.Open(hash)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			f.Close()
+		}
+	})
+}
+
+func TestETagHash(t *testing.T) {
+	hash := contentHash([]byte("data"))
+	tests := []struct {
+		etag string
+		hash string
+	}{
+		{etag: `"` + hash + `"`, hash: hash},
+		{etag: `W/"` + hash + `"`, hash: hash},
+		{etag: `"../../etc/passwd"`, hash: ""},
+		{etag: "", hash: ""},
+	}
+	for _, tt := range tests {
+		if got := ETagHash(tt.etag); got != tt.hash {
+			t.Errorf("etag %q: expected hash %q, got %q", tt.etag, tt.hash, got)
+		}
+	}
+}
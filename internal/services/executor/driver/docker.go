@@ -26,6 +26,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"agola.io/agola/internal/common"
@@ -35,12 +36,17 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/stdcopy"
 	"go.uber.org/zap"
 )
 
+const (
+	podNetworkPrefix = "agola-pod-"
+)
+
 type DockerDriver struct {
 	log               *zap.SugaredLogger
 	client            *client.Client
@@ -48,14 +54,32 @@ type DockerDriver struct {
 	toolboxPath       string
 	executorID        string
 	arch              common.Arch
+
+	imagesConfig *DockerImagesConfig
+	// imagesLock is held in read mode while creating pods and in write mode
+	// while pruning images so an image won't be removed between its fetch
+	// and the creation of the container using it
+	imagesLock sync.RWMutex
+	// imagesUsage is the last usage time of the images by image id
+	imagesUsage     map[string]time.Time
+	imagesUsageLock sync.Mutex
 }
 
-func NewDockerDriver(logger *zap.Logger, executorID, initVolumeHostDir, toolboxPath string) (*DockerDriver, error) {
+// NewDockerDriver creates a new docker driver. If imagesConfig is nil images
+// won't be prepulled or pruned
+func NewDockerDriver(logger *zap.Logger, executorID, initVolumeHostDir, toolboxPath string, imagesConfig *DockerImagesConfig) (*DockerDriver, error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
 		return nil, err
 	}
 
+	if imagesConfig == nil {
+		imagesConfig = &DockerImagesConfig{}
+	}
+	if imagesConfig.CheckInterval <= 0 {
+		imagesConfig.CheckInterval = defaultImagesCheckInterval
+	}
+
 	return &DockerDriver{
 		log:               logger.Sugar(),
 		client:            cli,
@@ -63,11 +87,16 @@ func NewDockerDriver(logger *zap.Logger, executorID, initVolumeHostDir, toolboxP
 		toolboxPath:       toolboxPath,
 		executorID:        executorID,
 		arch:              common.ArchFromString(runtime.GOARCH),
+		imagesConfig:      imagesConfig,
+		imagesUsage:       map[string]time.Time{},
 	}, nil
 }
 
 func (d *DockerDriver) Setup(ctx context.Context) error {
-	return d.CopyToolbox(ctx)
+	if err := d.CopyToolbox(ctx); err != nil {
+		return err
+	}
+	return d.setupImages(ctx)
 }
 
 // CopyToolbox is an hack needed when running the executor inside a docker
@@ -142,9 +171,22 @@ func (d *DockerDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.
 		return nil, errors.Errorf("empty container config")
 	}
 
+	// don't prune images while creating the pod containers
+	d.imagesLock.RLock()
+	defer d.imagesLock.RUnlock()
+
+	var networkID string
+	if podConfig.NetworkMode == NetworkModeIsolated {
+		var err error
+		networkID, err = d.createPodNetwork(ctx, podConfig)
+		if err != nil {
+			return nil, errors.Errorf("failed to create pod network: %w", err)
+		}
+	}
+
 	var mainContainerID string
 	for cindex := range podConfig.Containers {
-		resp, err := d.createContainer(ctx, cindex, podConfig, mainContainerID, out)
+		resp, err := d.createContainer(ctx, cindex, podConfig, mainContainerID, networkID, out)
 		if err != nil {
 			return nil, err
 		}
@@ -186,6 +228,7 @@ func (d *DockerDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.
 		client:     d.client,
 		executorID: d.executorID,
 		containers: []*DockerContainer{},
+		networkID:  networkID,
 	}
 
 	count := 0
@@ -222,7 +265,29 @@ func (d *DockerDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.
 	return pod, nil
 }
 
-func (d *DockerDriver) fetchImage(ctx context.Context, image string, registryConfig *registry.DockerConfig, out io.Writer) error {
+func (d *DockerDriver) fetchImage(ctx context.Context, image string, pullPolicy ImagePullPolicy, registryConfig *registry.DockerConfig, out io.Writer) error {
+	switch pullPolicy {
+	case ImagePullPolicyIfNotPresent, ImagePullPolicyNever:
+		present, err := d.imagePresent(ctx, image)
+		if err != nil {
+			return err
+		}
+		if present {
+			_, _ = fmt.Fprintf(out, "Image %q already present\n", image)
+			return d.markImageUsed(ctx, image)
+		}
+		if pullPolicy == ImagePullPolicyNever {
+			return errors.Errorf("image %q not present and image pull policy is %q", image, pullPolicy)
+		}
+	}
+
+	if err := d.pullImage(ctx, image, registryConfig, out); err != nil {
+		return err
+	}
+	return d.markImageUsed(ctx, image)
+}
+
+func (d *DockerDriver) pullImage(ctx context.Context, image string, registryConfig *registry.DockerConfig, out io.Writer) error {
 	regName, err := registry.GetRegistry(image)
 	if err != nil {
 		return err
@@ -250,19 +315,43 @@ func (d *DockerDriver) fetchImage(ctx context.Context, image string, registryCon
 	return err
 }
 
-func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig *PodConfig, maincontainerID string, out io.Writer) (*container.ContainerCreateCreatedBody, error) {
-	containerConfig := podConfig.Containers[index]
-
-	if err := d.fetchImage(ctx, containerConfig.Image, podConfig.DockerConfig, out); err != nil {
-		return nil, err
-	}
-
+func (d *DockerDriver) podLabels(podConfig *PodConfig) map[string]string {
 	labels := map[string]string{}
 	labels[agolaLabelKey] = agolaLabelValue
 	labels[executorIDKey] = d.executorID
 	labels[podIDKey] = podConfig.ID
 	labels[taskIDKey] = podConfig.TaskID
 
+	return labels
+}
+
+// createPodNetwork creates a dedicated bridge network for the pod. It returns
+// the network id
+func (d *DockerDriver) createPodNetwork(ctx context.Context, podConfig *PodConfig) (string, error) {
+	resp, err := d.client.NetworkCreate(ctx, podNetworkName(podConfig.ID), types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels:         d.podLabels(podConfig),
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func podNetworkName(podID string) string {
+	return podNetworkPrefix + podID
+}
+
+func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig *PodConfig, maincontainerID, networkID string, out io.Writer) (*container.ContainerCreateCreatedBody, error) {
+	containerConfig := podConfig.Containers[index]
+
+	if err := d.fetchImage(ctx, containerConfig.Image, containerConfig.ImagePullPolicy, podConfig.DockerConfig, out); err != nil {
+		return nil, err
+	}
+
+	labels := d.podLabels(podConfig)
+
 	containerLabels := map[string]string{}
 	for k, v := range labels {
 		containerLabels[k] = v
@@ -285,12 +374,26 @@ func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig
 		// main container requires the initvolume containing the toolbox
 		cliHostConfig.Binds = []string{fmt.Sprintf("%s:%s", d.initVolumeHostDir, podConfig.InitVolumeDir)}
 		cliHostConfig.ReadonlyPaths = []string{fmt.Sprintf("%s:%s", d.initVolumeHostDir, podConfig.InitVolumeDir)}
-	} else {
+	}
+
+	var cliNetworkingConfig *network.NetworkingConfig
+	if networkID != "" {
+		// attach all the containers to the pod network
+		networkName := podNetworkName(podConfig.ID)
+		endpointSettings := &network.EndpointSettings{NetworkID: networkID}
+		if containerConfig.Alias != "" {
+			endpointSettings.Aliases = []string{containerConfig.Alias}
+		}
+		cliHostConfig.NetworkMode = container.NetworkMode(networkName)
+		cliNetworkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{networkName: endpointSettings},
+		}
+	} else if index != 0 {
 		// attach other containers to maincontainer network
 		cliHostConfig.NetworkMode = container.NetworkMode(fmt.Sprintf("container:%s", maincontainerID))
 	}
 
-	resp, err := d.client.ContainerCreate(ctx, cliContainerConfig, cliHostConfig, nil, "")
+	resp, err := d.client.ContainerCreate(ctx, cliContainerConfig, cliHostConfig, cliNetworkingConfig, "")
 	return &resp, err
 }
 
@@ -382,6 +485,44 @@ func (d *DockerDriver) GetPods(ctx context.Context, all bool) ([]Pod, error) {
 		}
 	}
 
+	networksArgs := filters.NewArgs()
+	networksArgs.Add("label", fmt.Sprintf("%s=%s", agolaLabelKey, agolaLabelValue))
+	networksArgs.Add("label", fmt.Sprintf("%s=%s", executorIDKey, d.executorID))
+	networks, err := d.client.NetworkList(ctx, types.NetworkListOptions{Filters: networksArgs})
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range networks {
+		podID, ok := network.Labels[podIDKey]
+		if !ok {
+			// skip network
+			continue
+		}
+		if pod, ok := podsMap[podID]; ok {
+			pod.networkID = network.ID
+			continue
+		}
+		if !all {
+			continue
+		}
+		// report the pod network without containers (i.e. when the pod
+		// creation failed) so it'll be removed
+		podLabels := map[string]string{}
+		for labelName, labelValue := range network.Labels {
+			if strings.HasPrefix(labelName, labelPrefix) {
+				podLabels[labelName] = labelValue
+			}
+		}
+		podsMap[podID] = &DockerPod{
+			id:         podID,
+			client:     d.client,
+			executorID: d.executorID,
+			labels:     podLabels,
+			containers: []*DockerContainer{},
+			networkID:  network.ID,
+		}
+	}
+
 	pods := make([]Pod, 0, len(podsMap))
 	for _, pod := range podsMap {
 		// put the containers in the right order based on their container index
@@ -397,6 +538,8 @@ type DockerPod struct {
 	labels     map[string]string
 	containers []*DockerContainer
 	executorID string
+	// networkID is the pod network id when using the isolated network mode
+	networkID string
 }
 
 type DockerContainer struct {
@@ -443,6 +586,12 @@ func (dp *DockerPod) Remove(ctx context.Context) error {
 			errs = append(errs, err)
 		}
 	}
+	// the network can be removed only when all the containers are removed
+	if dp.networkID != "" && len(errs) == 0 {
+		if err := dp.client.NetworkRemove(ctx, dp.networkID); err != nil && !client.IsErrNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
 	if len(errs) != 0 {
 		return errors.Errorf("remove errors: %v", errs)
 	}
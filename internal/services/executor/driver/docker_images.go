@@ -0,0 +1,252 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+const (
+	defaultImagesCheckInterval = 1 * time.Hour
+)
+
+// DockerImagesConfig defines how the docker driver manages the images
+type DockerImagesConfig struct {
+	// WarmImages are pulled at setup, pulled again at every check interval and
+	// never pruned
+	WarmImages []string
+	// MaxDiskUsage is the disk budget in bytes of the images used by the
+	// driver. When exceeded the least recently used images are removed. If 0
+	// the images aren't pruned
+	MaxDiskUsage int64
+	// CheckInterval is the interval between two warm images refresh and images
+	// pruning
+	CheckInterval time.Duration
+	// UsageFile is the file where the images last usage time is saved. If
+	// empty it won't be saved and the images used before a restart won't be
+	// pruned
+	UsageFile string
+}
+
+func (d *DockerDriver) setupImages(ctx context.Context) error {
+	if err := d.loadImagesUsage(); err != nil {
+		return errors.Errorf("failed to load images usage: %w", err)
+	}
+
+	if len(d.imagesConfig.WarmImages) == 0 && d.imagesConfig.MaxDiskUsage == 0 {
+		return nil
+	}
+
+	d.pullWarmImages(ctx)
+	go d.imagesManagerLoop(ctx)
+
+	return nil
+}
+
+func (d *DockerDriver) imagesManagerLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.imagesConfig.CheckInterval):
+		}
+
+		d.pullWarmImages(ctx)
+		if err := d.pruneImages(ctx); err != nil {
+			d.log.Errorf("failed to prune images: %+v", err)
+		}
+	}
+}
+
+func (d *DockerDriver) pullWarmImages(ctx context.Context) {
+	for _, image := range d.imagesConfig.WarmImages {
+		d.log.Infof("pulling warm image %q", image)
+		if err := d.pullImage(ctx, image, nil, ioutil.Discard); err != nil {
+			d.log.Errorf("failed to pull warm image %q: %+v", image, err)
+		}
+	}
+}
+
+func (d *DockerDriver) imagePresent(ctx context.Context, image string) (bool, error) {
+	if _, _, err := d.client.ImageInspectWithRaw(ctx, image); err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *DockerDriver) markImageUsed(ctx context.Context, image string) error {
+	inspect, _, err := d.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return err
+	}
+
+	d.imagesUsageLock.Lock()
+	defer d.imagesUsageLock.Unlock()
+
+	d.imagesUsage[inspect.ID] = time.Now()
+	return d.saveImagesUsage()
+}
+
+func (d *DockerDriver) loadImagesUsage() error {
+	if d.imagesConfig.UsageFile == "" {
+		return nil
+	}
+
+	d.imagesUsageLock.Lock()
+	defer d.imagesUsageLock.Unlock()
+
+	data, err := ioutil.ReadFile(d.imagesConfig.UsageFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &d.imagesUsage)
+}
+
+// saveImagesUsage saves the images usage. imagesUsageLock must be held.
+func (d *DockerDriver) saveImagesUsage() error {
+	if d.imagesConfig.UsageFile == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(d.imagesUsage)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.imagesConfig.UsageFile), 0770); err != nil {
+		return err
+	}
+	// atomically replace the usage file
+	tmpFile := d.imagesConfig.UsageFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0660); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, d.imagesConfig.UsageFile)
+}
+
+type imageUsage struct {
+	id       string
+	size     int64
+	lastUsed time.Time
+}
+
+// pruneImages removes the least recently used images until the disk usage of
+// the images used by the driver is under the disk budget. Warm images and
+// images used by existing containers are never removed. Since the images
+// layers can be shared the computed disk usage is an upper bound.
+func (d *DockerDriver) pruneImages(ctx context.Context) error {
+	if d.imagesConfig.MaxDiskUsage == 0 {
+		return nil
+	}
+
+	d.imagesLock.Lock()
+	defer d.imagesLock.Unlock()
+
+	images, err := d.client.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return err
+	}
+	containers, err := d.client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return err
+	}
+
+	protected := map[string]struct{}{}
+	for _, c := range containers {
+		protected[c.ImageID] = struct{}{}
+	}
+	for _, image := range d.imagesConfig.WarmImages {
+		inspect, _, err := d.client.ImageInspectWithRaw(ctx, image)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				continue
+			}
+			return err
+		}
+		protected[inspect.ID] = struct{}{}
+	}
+
+	d.imagesUsageLock.Lock()
+	defer d.imagesUsageLock.Unlock()
+
+	imagesSize := map[string]int64{}
+	for _, image := range images {
+		imagesSize[image.ID] = image.Size
+	}
+
+	for _, c := range imagesToPrune(d.imagesUsage, imagesSize, protected, d.imagesConfig.MaxDiskUsage) {
+		d.log.Infof("removing image %q last used at %s", c.id, c.lastUsed)
+		if _, err := d.client.ImageRemove(ctx, c.id, types.ImageRemoveOptions{Force: true, PruneChildren: true}); err != nil {
+			d.log.Errorf("failed to remove image %q: %+v", c.id, err)
+			continue
+		}
+		delete(d.imagesUsage, c.id)
+	}
+
+	return d.saveImagesUsage()
+}
+
+// imagesToPrune returns, ordered from the least recently used, the images to
+// remove to bring their disk usage under maxDiskUsage. The images in usage but
+// not in imagesSize were removed by someone else and are deleted from usage.
+func imagesToPrune(usage map[string]time.Time, imagesSize map[string]int64, protected map[string]struct{}, maxDiskUsage int64) []*imageUsage {
+	var diskUsage int64
+	candidates := []*imageUsage{}
+	for id, lastUsed := range usage {
+		size, ok := imagesSize[id]
+		if !ok {
+			delete(usage, id)
+			continue
+		}
+		diskUsage += size
+		if _, ok := protected[id]; ok {
+			continue
+		}
+		candidates = append(candidates, &imageUsage{id: id, size: size, lastUsed: lastUsed})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].lastUsed.Equal(candidates[j].lastUsed) {
+			return candidates[i].id < candidates[j].id
+		}
+		return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+	})
+
+	toPrune := []*imageUsage{}
+	for _, c := range candidates {
+		if diskUsage <= maxDiskUsage {
+			break
+		}
+		toPrune = append(toPrune, c)
+		diskUsage -= c.size
+	}
+	return toPrune
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImagesToPrune(t *testing.T) {
+	now := time.Now()
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name          string
+		usage         map[string]time.Time
+		imagesSize    map[string]int64
+		protected     []string
+		maxDiskUsage  int64
+		out           []string
+		expectedUsage []string
+	}{
+		{
+			name:          "test under budget",
+			usage:         map[string]time.Time{"image01": at(1), "image02": at(2)},
+			imagesSize:    map[string]int64{"image01": 10, "image02": 10},
+			maxDiskUsage:  20,
+			out:           []string{},
+			expectedUsage: []string{"image01", "image02"},
+		},
+		{
+			name:          "test least recently used images are removed first",
+			usage:         map[string]time.Time{"image01": at(3), "image02": at(1), "image03": at(2)},
+			imagesSize:    map[string]int64{"image01": 10, "image02": 10, "image03": 10},
+			maxDiskUsage:  15,
+			out:           []string{"image02", "image03"},
+			expectedUsage: []string{"image01", "image02", "image03"},
+		},
+		{
+			name:          "test images are removed only until under budget",
+			usage:         map[string]time.Time{"image01": at(3), "image02": at(1), "image03": at(2)},
+			imagesSize:    map[string]int64{"image01": 10, "image02": 30, "image03": 10},
+			maxDiskUsage:  25,
+			out:           []string{"image02"},
+			expectedUsage: []string{"image01", "image02", "image03"},
+		},
+		{
+			name:          "test protected images are never removed but count in the disk usage",
+			usage:         map[string]time.Time{"image01": at(3), "image02": at(1), "image03": at(2)},
+			imagesSize:    map[string]int64{"image01": 10, "image02": 10, "image03": 10},
+			protected:     []string{"image02"},
+			maxDiskUsage:  15,
+			out:           []string{"image03", "image01"},
+			expectedUsage: []string{"image01", "image02", "image03"},
+		},
+		{
+			name:          "test images removed by someone else are forgotten",
+			usage:         map[string]time.Time{"image01": at(2), "image02": at(1)},
+			imagesSize:    map[string]int64{"image01": 10, "image03": 100},
+			maxDiskUsage:  10,
+			out:           []string{},
+			expectedUsage: []string{"image01"},
+		},
+		{
+			name:          "test images not used by the driver aren't removed",
+			usage:         map[string]time.Time{"image01": at(1)},
+			imagesSize:    map[string]int64{"image01": 10, "image02": 100},
+			maxDiskUsage:  5,
+			out:           []string{"image01"},
+			expectedUsage: []string{"image01"},
+		},
+		{
+			name:          "test ties are ordered by image id",
+			usage:         map[string]time.Time{"image02": at(1), "image01": at(1), "image03": at(2)},
+			imagesSize:    map[string]int64{"image01": 10, "image02": 10, "image03": 10},
+			maxDiskUsage:  15,
+			out:           []string{"image01", "image02"},
+			expectedUsage: []string{"image01", "image02", "image03"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protected := map[string]struct{}{}
+			for _, id := range tt.protected {
+				protected[id] = struct{}{}
+			}
+
+			toPrune := imagesToPrune(tt.usage, tt.imagesSize, protected, tt.maxDiskUsage)
+
+			out := []string{}
+			for _, c := range toPrune {
+				out = append(out, c.id)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("images to prune mismatch (-want +got):\n%s", diff)
+			}
+			for _, id := range tt.expectedUsage {
+				if _, ok := tt.usage[id]; !ok {
+					t.Fatalf("expected image %q in usage", id)
+				}
+			}
+			if len(tt.usage) != len(tt.expectedUsage) {
+				t.Fatalf("expected %d images in usage, got %d", len(tt.expectedUsage), len(tt.usage))
+			}
+		})
+	}
+}
@@ -89,7 +89,7 @@ func TestDockerPod(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	d, err := NewDockerDriver(logger, "executorid01", dir, toolboxPath)
+	d, err := NewDockerDriver(logger, "executorid01", dir, toolboxPath, nil)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -264,6 +264,72 @@ func TestDockerPod(t *testing.T) {
 		}
 	})
 
+	t.Run("test communication between two containers in an isolated network", func(t *testing.T) {
+		pod, err := d.NewPod(ctx, &PodConfig{
+			ID:          uuid.NewV4().String(),
+			TaskID:      uuid.NewV4().String(),
+			NetworkMode: NetworkModeIsolated,
+			Containers: []*ContainerConfig{
+				&ContainerConfig{
+					Cmd:   []string{"cat"},
+					Image: "busybox",
+				},
+				&ContainerConfig{
+					Image: "nginx:1.16",
+					Alias: "web01",
+				},
+				&ContainerConfig{
+					Image: "nginx:1.16",
+					Alias: "web02",
+				},
+			},
+			InitVolumeDir: "/tmp/agola",
+		}, ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// wait for nginx up
+		time.Sleep(1 * time.Second)
+
+		// both sidecars listen on the same port
+		for _, alias := range []string{"web01", "web02"} {
+			ce, err := pod.Exec(ctx, &ExecConfig{
+				Cmd: []string{"nc", "-z", alias, "80"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			code, err := ce.Wait(ctx)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if code != 0 {
+				t.Fatalf("unexpected exit code: %d", code)
+			}
+		}
+
+		pods, err := d.GetPods(ctx, true)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		for _, p := range pods {
+			if p.ID() != pod.ID() {
+				continue
+			}
+			if err := p.Remove(ctx); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		}
+
+		// the pod network must be removed
+		dp := pod.(*DockerPod)
+		if _, err := dp.client.NetworkInspect(ctx, dp.networkID, types.NetworkInspectOptions{}); err == nil {
+			t.Fatalf("expected pod network %q removed", dp.networkID)
+		}
+	})
+
 	t.Run("test get pods single container", func(t *testing.T) {
 		pod, err := d.NewPod(ctx, &PodConfig{
 			ID:     uuid.NewV4().String(),
@@ -23,6 +23,7 @@ import (
 
 	"agola.io/agola/internal/common"
 	"agola.io/agola/internal/services/executor/registry"
+	errors "golang.org/x/xerrors"
 )
 
 const (
@@ -76,16 +77,56 @@ type ContainerExec interface {
 	Wait(ctx context.Context) (int, error)
 }
 
+type NetworkMode string
+
+const (
+	// NetworkModeShared makes all the pod containers share the network
+	// namespace of the first container
+	NetworkModeShared NetworkMode = "shared"
+	// NetworkModeIsolated creates a dedicated pod network where every
+	// container is reachable by its alias
+	NetworkModeIsolated NetworkMode = "isolated"
+)
+
 type PodConfig struct {
 	ID         string
 	TaskID     string
 	Containers []*ContainerConfig
 	Arch       common.Arch
+	// NetworkMode defines how the pod network is configured. If empty the
+	// shared network mode is used
+	NetworkMode NetworkMode
 	// The container dir where the init volume will be mounted
 	InitVolumeDir string
 	DockerConfig  *registry.DockerConfig
+	// K8s defines the task kubernetes pod customizations. It's used only by
+	// the kubernetes driver
+	K8s *K8sPodConfig
+}
+
+// checkSharedNetwork returns an error if the pod requires network features
+// not available with the shared network mode. It's used by the drivers that
+// support only the shared network mode.
+func checkSharedNetwork(driverName string, podConfig *PodConfig) error {
+	if podConfig.NetworkMode != "" && podConfig.NetworkMode != NetworkModeShared {
+		return errors.Errorf("%s driver doesn't support network mode %q", driverName, podConfig.NetworkMode)
+	}
+	for i, c := range podConfig.Containers {
+		if c.Alias != "" {
+			return errors.Errorf("%s driver doesn't support container aliases (container at index %d has alias %q)", driverName, i, c.Alias)
+		}
+	}
+	return nil
 }
 
+type ImagePullPolicy string
+
+const (
+	ImagePullPolicyAlways       ImagePullPolicy = "always"
+	ImagePullPolicyIfNotPresent ImagePullPolicy = "if_not_present"
+	ImagePullPolicyNever        ImagePullPolicy = "never"
+)
+
 type ContainerConfig struct {
 	Cmd        []string
 	Env        map[string]string
@@ -93,6 +134,12 @@ type ContainerConfig struct {
 	Image      string
 	User       string
 	Privileged bool
+	// ImagePullPolicy defines when the image is pulled. If empty the image is
+	// always pulled
+	ImagePullPolicy ImagePullPolicy
+	// Alias is the name the container is reachable at from the other
+	// containers when using the isolated network mode
+	Alias string
 }
 
 type ExecConfig struct {
@@ -82,6 +82,9 @@ type K8sDriver struct {
 	cmLister         listerscorev1.ConfigMapLister
 	leaseLister      coordinationlistersv1.LeaseLister
 	k8sLabelArch     string
+
+	podOptions *K8sDriverConfig
+	affinity   *corev1.Affinity
 }
 
 type K8sPod struct {
@@ -94,7 +97,18 @@ type K8sPod struct {
 	initVolumeDir string
 }
 
-func NewK8sDriver(logger *zap.Logger, executorID, toolboxPath string) (*K8sDriver, error) {
+func NewK8sDriver(logger *zap.Logger, executorID, toolboxPath string, podOptions *K8sDriverConfig) (*K8sDriver, error) {
+	if podOptions == nil {
+		podOptions = &K8sDriverConfig{}
+	}
+	var affinity *corev1.Affinity
+	if len(podOptions.Affinity) > 0 {
+		affinity = &corev1.Affinity{}
+		if err := json.Unmarshal(podOptions.Affinity, affinity); err != nil {
+			return nil, errors.Errorf("failed to parse pod affinity: %w", err)
+		}
+	}
+
 	kubeClientConfig := NewKubeClientConfig("", "", "")
 	kubecfg, err := kubeClientConfig.ClientConfig()
 	if err != nil {
@@ -118,6 +132,8 @@ func NewK8sDriver(logger *zap.Logger, executorID, toolboxPath string) (*K8sDrive
 		namespace:    namespace,
 		executorID:   executorID,
 		k8sLabelArch: corev1.LabelArchStable,
+		podOptions:   podOptions,
+		affinity:     affinity,
 	}
 
 	serverVersion, err := d.client.Discovery().ServerVersion()
@@ -310,6 +326,13 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 	if len(podConfig.Containers) == 0 {
 		return nil, errors.Errorf("empty container config")
 	}
+	if err := checkSharedNetwork("kubernetes", podConfig); err != nil {
+		return nil, err
+	}
+
+	if err := d.checkTaskOverrides(podConfig.K8s); err != nil {
+		return nil, err
+	}
 
 	secretClient := d.client.CoreV1().Secrets(d.namespace)
 	podClient := d.client.CoreV1().Pods(d.namespace)
@@ -321,6 +344,15 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 	labels[executorIDKey] = d.executorID
 	labels[executorsGroupIDKey] = d.executorsGroupID
 
+	// kubelet only supports basic registry auths
+	if podConfig.DockerConfig != nil {
+		for regName, auth := range podConfig.DockerConfig.Auths {
+			if auth.RegistryToken != "" {
+				return nil, errors.Errorf("registry %q: registry bearer tokens aren't supported by the kubernetes driver", regName)
+			}
+		}
+	}
+
 	dockerconfigj, err := json.Marshal(podConfig.DockerConfig)
 	if err != nil {
 		return nil, err
@@ -393,15 +425,13 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 			containerName = fmt.Sprintf("service%d", cIndex)
 		}
 		c := corev1.Container{
-			Name:       containerName,
-			Image:      containerConfig.Image,
-			Command:    containerConfig.Cmd,
-			Env:        genEnvVars(containerConfig.Env),
-			Stdin:      true,
-			WorkingDir: containerConfig.WorkingDir,
-			// by default always try to pull the image so we are sure only authorized users can fetch them
-			// see https://kubernetes.io/docs/reference/access-authn-authz/admission-controllers/#alwayspullimages
-			ImagePullPolicy: corev1.PullAlways,
+			Name:            containerName,
+			Image:           containerConfig.Image,
+			Command:         containerConfig.Cmd,
+			Env:             genEnvVars(containerConfig.Env),
+			Stdin:           true,
+			WorkingDir:      containerConfig.WorkingDir,
+			ImagePullPolicy: k8sImagePullPolicy(containerConfig.ImagePullPolicy),
 			SecurityContext: &corev1.SecurityContext{
 				Privileged: &containerConfig.Privileged,
 			},
@@ -419,10 +449,13 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		pod.Spec.Containers = append(pod.Spec.Containers, c)
 	}
 
+	d.customizePod(pod, podConfig.K8s)
+
 	if podConfig.Arch != "" {
-		pod.Spec.NodeSelector = map[string]string{
-			d.k8sLabelArch: string(podConfig.Arch),
+		if pod.Spec.NodeSelector == nil {
+			pod.Spec.NodeSelector = map[string]string{}
 		}
+		pod.Spec.NodeSelector[d.k8sLabelArch] = string(podConfig.Arch)
 	}
 
 	pod, err = podClient.Create(pod)
@@ -784,3 +817,16 @@ func parseGitVersion(gitVersion string) (*serverVersion, error) {
 	}
 	return sv, nil
 }
+
+func k8sImagePullPolicy(p ImagePullPolicy) corev1.PullPolicy {
+	switch p {
+	case ImagePullPolicyIfNotPresent:
+		return corev1.PullIfNotPresent
+	case ImagePullPolicyNever:
+		return corev1.PullNever
+	default:
+		// by default always try to pull the image so we are sure only authorized users can fetch them
+		// see https://kubernetes.io/docs/reference/access-authn-authz/admission-controllers/#alwayspullimages
+		return corev1.PullAlways
+	}
+}
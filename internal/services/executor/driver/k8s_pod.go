@@ -0,0 +1,163 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// K8sTaskOverride is a kubernetes pod field that can be overridden by a task
+type K8sTaskOverride string
+
+const (
+	K8sTaskOverrideNodeSelector       K8sTaskOverride = "nodeSelector"
+	K8sTaskOverrideTolerations        K8sTaskOverride = "tolerations"
+	K8sTaskOverrideServiceAccountName K8sTaskOverride = "serviceAccountName"
+	K8sTaskOverridePriorityClassName  K8sTaskOverride = "priorityClassName"
+	K8sTaskOverrideAnnotations        K8sTaskOverride = "annotations"
+	K8sTaskOverrideLabels             K8sTaskOverride = "labels"
+)
+
+type K8sToleration struct {
+	Key               string
+	Operator          string
+	Value             string
+	Effect            string
+	TolerationSeconds *int64
+}
+
+// K8sPodConfig defines the pod customizations that can be defined both at the
+// executor and at the task level
+type K8sPodConfig struct {
+	NodeSelector       map[string]string
+	Tolerations        []K8sToleration
+	ServiceAccountName string
+	PriorityClassName  string
+	Annotations        map[string]string
+	Labels             map[string]string
+}
+
+// K8sDriverConfig defines the executor level pod customizations
+type K8sDriverConfig struct {
+	Pod K8sPodConfig
+	// Affinity is the pod affinity in the kubernetes api json format
+	Affinity                     []byte
+	AutomountServiceAccountToken bool
+	// ImagePullSecrets are the names of existing secrets added to the pod
+	// image pull secrets
+	ImagePullSecrets []string
+	// AllowedTaskOverrides are the pod fields that a task is allowed to
+	// override
+	AllowedTaskOverrides []K8sTaskOverride
+}
+
+func (d *K8sDriver) isTaskOverrideAllowed(o K8sTaskOverride) bool {
+	for _, ao := range d.podOptions.AllowedTaskOverrides {
+		if ao == o {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTaskOverrides returns an error if the task defines a pod customization
+// not allowed by the executor
+func (d *K8sDriver) checkTaskOverrides(tc *K8sPodConfig) error {
+	if tc == nil {
+		return nil
+	}
+
+	overrides := []struct {
+		o   K8sTaskOverride
+		set bool
+	}{
+		{K8sTaskOverrideNodeSelector, len(tc.NodeSelector) > 0},
+		{K8sTaskOverrideTolerations, len(tc.Tolerations) > 0},
+		{K8sTaskOverrideServiceAccountName, tc.ServiceAccountName != ""},
+		{K8sTaskOverridePriorityClassName, tc.PriorityClassName != ""},
+		{K8sTaskOverrideAnnotations, len(tc.Annotations) > 0},
+		{K8sTaskOverrideLabels, len(tc.Labels) > 0},
+	}
+	for _, ov := range overrides {
+		if ov.set && !d.isTaskOverrideAllowed(ov.o) {
+			return errors.Errorf("task k8s pod %s override isn't allowed by the executor", ov.o)
+		}
+	}
+	return nil
+}
+
+// customizePod applies the executor and task pod customizations. Maps are
+// merged with the task values taking precedence, task tolerations are appended
+// to the executor ones and the other values are replaced. The agola labels are
+// always kept.
+func (d *K8sDriver) customizePod(pod *corev1.Pod, tc *K8sPodConfig) {
+	ec := &d.podOptions.Pod
+	if tc == nil {
+		tc = &K8sPodConfig{}
+	}
+
+	pod.Spec.NodeSelector = mergeStringMaps(ec.NodeSelector, tc.NodeSelector)
+	for _, t := range append(append([]K8sToleration{}, ec.Tolerations...), tc.Tolerations...) {
+		pod.Spec.Tolerations = append(pod.Spec.Tolerations, corev1.Toleration{
+			Key:               t.Key,
+			Operator:          corev1.TolerationOperator(t.Operator),
+			Value:             t.Value,
+			Effect:            corev1.TaintEffect(t.Effect),
+			TolerationSeconds: t.TolerationSeconds,
+		})
+	}
+	if d.affinity != nil {
+		pod.Spec.Affinity = d.affinity.DeepCopy()
+	}
+
+	pod.Spec.ServiceAccountName = ec.ServiceAccountName
+	if tc.ServiceAccountName != "" {
+		pod.Spec.ServiceAccountName = tc.ServiceAccountName
+	}
+	// the service account token is mounted only when explicitly enabled
+	if d.podOptions.AutomountServiceAccountToken {
+		pod.Spec.AutomountServiceAccountToken = util.BoolP(true)
+	}
+
+	pod.Spec.PriorityClassName = ec.PriorityClassName
+	if tc.PriorityClassName != "" {
+		pod.Spec.PriorityClassName = tc.PriorityClassName
+	}
+
+	for _, s := range d.podOptions.ImagePullSecrets {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: s})
+	}
+
+	pod.Annotations = mergeStringMaps(ec.Annotations, tc.Annotations)
+	pod.Labels = mergeStringMaps(ec.Labels, tc.Labels, pod.Labels)
+}
+
+// mergeStringMaps merges the provided maps, the values of the latest maps take
+// precedence. Returns nil if all the maps are empty
+func mergeStringMaps(maps ...map[string]string) map[string]string {
+	var m map[string]string
+	for _, sm := range maps {
+		for k, v := range sm {
+			if m == nil {
+				m = map[string]string{}
+			}
+			m[k] = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestK8sCustomizePod(t *testing.T) {
+	d := &K8sDriver{
+		podOptions: &K8sDriverConfig{
+			Pod: K8sPodConfig{
+				NodeSelector:       map[string]string{"pool": "ci", "disk": "ssd"},
+				Tolerations:        []K8sToleration{{Key: "dedicated", Operator: "Equal", Value: "ci", Effect: "NoSchedule"}},
+				ServiceAccountName: "agola-tasks",
+				Labels:             map[string]string{"team": "infra", podIDKey: "wrong"},
+			},
+			ImagePullSecrets:     []string{"registry-secret"},
+			AllowedTaskOverrides: []K8sTaskOverride{K8sTaskOverrideNodeSelector, K8sTaskOverrideTolerations, K8sTaskOverrideAnnotations},
+		},
+	}
+
+	tc := &K8sPodConfig{
+		NodeSelector: map[string]string{"disk": "nvme"},
+		Tolerations:  []K8sToleration{{Key: "gpu", Operator: "Exists"}},
+		Annotations:  map[string]string{"owner": "task01"},
+	}
+	if err := d.checkTaskOverrides(tc); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{podIDKey: "pod01"},
+		},
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "agola-task-pod01"}},
+		},
+	}
+	d.customizePod(pod, tc)
+
+	expectedPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      map[string]string{"team": "infra", podIDKey: "pod01"},
+			Annotations: map[string]string{"owner": "task01"},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{"pool": "ci", "disk": "nvme"},
+			Tolerations: []corev1.Toleration{
+				{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "ci", Effect: corev1.TaintEffectNoSchedule},
+				{Key: "gpu", Operator: corev1.TolerationOpExists},
+			},
+			ServiceAccountName: "agola-tasks",
+			ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "agola-task-pod01"}, {Name: "registry-secret"}},
+		},
+	}
+	if diff := cmp.Diff(expectedPod, pod); diff != "" {
+		t.Fatalf("pod mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := d.checkTaskOverrides(&K8sPodConfig{ServiceAccountName: "admin"}); err == nil {
+		t.Fatalf("expected error for not allowed service account override")
+	}
+}
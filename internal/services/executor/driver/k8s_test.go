@@ -41,7 +41,7 @@ func TestK8sPod(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	d, err := NewK8sDriver(logger, "executorid01", toolboxPath)
+	d, err := NewK8sDriver(logger, "executorid01", toolboxPath, nil)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -0,0 +1,60 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// processStartTime returns the start time (in clock ticks after boot) of the
+// process with the provided pid, read from /proc/<pid>/stat. Since a pid can
+// be reused, it's used together with the pid to uniquely identify a process.
+func processStartTime(pid int) (uint64, error) {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, err
+	}
+	// the process name could contain spaces and parenthesis so skip it
+	// looking for the last ")"
+	s := string(data)
+	i := strings.LastIndex(s, ")")
+	if i < 0 {
+		return 0, errors.Errorf("malformed process %d stat", pid)
+	}
+	// fields start from the third one (state) and the start time is the 22nd
+	fields := strings.Fields(s[i+1:])
+	if len(fields) < 20 {
+		return 0, errors.Errorf("malformed process %d stat", pid)
+	}
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("malformed process %d start time: %w", pid, err)
+	}
+	return startTime, nil
+}
+
+// sameProcess reports if the process with the provided pid is still the one
+// started at startTime
+func sameProcess(pid int, startTime uint64) bool {
+	st, err := processStartTime(pid)
+	if err != nil {
+		return false
+	}
+	return st == startTime
+}
@@ -0,0 +1,473 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/common"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestProcessDriver(t *testing.T, dir, executorID, username string) *ProcessDriver {
+	toolboxDir := filepath.Join(dir, "toolbox")
+	if err := os.MkdirAll(toolboxDir, 0755); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// fake toolbox, the process driver only links it inside the pod dir
+	toolboxPath := filepath.Join(toolboxDir, fmt.Sprintf("%s-linux-%s", toolboxPrefix, common.ArchFromString(runtime.GOARCH)))
+	if err := ioutil.WriteFile(toolboxPath, []byte("#!/bin/sh\necho toolbox \"$@\"\n"), 0755); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	d, err := NewProcessDriver(logger, executorID, filepath.Join(dir, "pods"), toolboxDir, username)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := d.Setup(context.Background()); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	return d
+}
+
+func TestProcessPod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := newTestProcessDriver(t, dir, "executorid01", "")
+
+	ctx := context.Background()
+
+	newPod := func(t *testing.T, env map[string]string) Pod {
+		pod, err := d.NewPod(ctx, &PodConfig{
+			ID:     uuid.NewV4().String(),
+			TaskID: uuid.NewV4().String(),
+			Containers: []*ContainerConfig{
+				{
+					Image: "busybox",
+					Env:   env,
+				},
+			},
+			InitVolumeDir: "/tmp/agola",
+		}, ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		return pod
+	}
+
+	t.Run("create a pod with multiple containers", func(t *testing.T) {
+		_, err := d.NewPod(ctx, &PodConfig{
+			ID:     uuid.NewV4().String(),
+			TaskID: uuid.NewV4().String(),
+			Containers: []*ContainerConfig{
+				{Image: "busybox"},
+				{Image: "busybox"},
+			},
+		}, ioutil.Discard)
+		if err == nil {
+			t.Fatalf("expected err")
+		}
+	})
+
+	t.Run("create a pod with unsupported network settings", func(t *testing.T) {
+		for _, podConfig := range []*PodConfig{
+			{
+				NetworkMode: NetworkModeIsolated,
+				Containers:  []*ContainerConfig{{Image: "busybox"}},
+			},
+			{
+				Containers: []*ContainerConfig{{Image: "busybox", Alias: "db"}},
+			},
+		} {
+			podConfig.ID = uuid.NewV4().String()
+			podConfig.TaskID = uuid.NewV4().String()
+			if _, err := d.NewPod(ctx, podConfig, ioutil.Discard); err == nil {
+				t.Fatalf("expected err")
+			}
+		}
+	})
+
+	t.Run("execute a command and get exit code", func(t *testing.T) {
+		pod := newPod(t, nil)
+		defer func() { _ = pod.Remove(ctx) }()
+
+		ce, err := pod.Exec(ctx, &ExecConfig{
+			Cmd:    []string{"sh", "-c", "exit 2"},
+			Stdout: ioutil.Discard,
+			Stderr: ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		code, err := ce.Wait(ctx)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if code != 2 {
+			t.Fatalf("expected exit code 2, got: %d", code)
+		}
+	})
+
+	t.Run("test pod environment and working dir", func(t *testing.T) {
+		env := map[string]string{
+			"ENV01": "ENVVALUE01",
+			"ENV02": "ENVVALUE02",
+		}
+		pod := newPod(t, env)
+		defer func() { _ = pod.Remove(ctx) }()
+
+		podDir := filepath.Join(d.podsDir, pod.ID())
+
+		var buf bytes.Buffer
+		ce, err := pod.Exec(ctx, &ExecConfig{
+			Cmd:    []string{"sh", "-c", "echo $ENV01 $ENV02 $ENV03; echo $HOME; echo $TMPDIR; pwd"},
+			Env:    map[string]string{"ENV02": "OVERRIDDEN02", "ENV03": "ENVVALUE03"},
+			Stdout: &buf,
+			Stderr: &buf,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		code, err := ce.Wait(ctx)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if code != 0 {
+			t.Fatalf("unexpected exit code: %d, output: %s", code, buf.String())
+		}
+
+		expected := fmt.Sprintf("ENVVALUE01 OVERRIDDEN02 ENVVALUE03\n%[1]s\n%[2]s\n%[1]s\n", filepath.Join(podDir, processPodHomeDir), filepath.Join(podDir, processPodTmpDir))
+		if diff := cmp.Diff(expected, buf.String()); diff != "" {
+			t.Fatalf("unexpected output: %s", diff)
+		}
+	})
+
+	t.Run("execute the toolbox from the init volume dir", func(t *testing.T) {
+		pod := newPod(t, nil)
+		defer func() { _ = pod.Remove(ctx) }()
+
+		var buf bytes.Buffer
+		ce, err := pod.Exec(ctx, &ExecConfig{
+			Cmd:    []string{"/tmp/agola/agola-toolbox", "mkdir"},
+			Stdout: &buf,
+			Stderr: &buf,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		code, err := ce.Wait(ctx)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if code != 0 {
+			t.Fatalf("unexpected exit code: %d, output: %s", code, buf.String())
+		}
+		if diff := cmp.Diff("toolbox mkdir\n", buf.String()); diff != "" {
+			t.Fatalf("unexpected output: %s", diff)
+		}
+	})
+
+	t.Run("test get pods and remove", func(t *testing.T) {
+		pod := newPod(t, nil)
+
+		// pods of other executors sharing the same pods dir must be ignored
+		od, err := NewProcessDriver(logger, "executorid02", d.podsDir, d.toolboxPath, "")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		opod, err := od.NewPod(ctx, &PodConfig{
+			ID:         uuid.NewV4().String(),
+			TaskID:     uuid.NewV4().String(),
+			Containers: []*ContainerConfig{{Image: "busybox"}},
+		}, ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer func() { _ = opod.Remove(ctx) }()
+
+		pods, err := d.GetPods(ctx, true)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(pods) != 1 {
+			t.Fatalf("expected 1 pod, got: %d", len(pods))
+		}
+		if pods[0].ID() != pod.ID() || pods[0].TaskID() != pod.TaskID() {
+			t.Fatalf("unexpected pod: %s", pods[0].ID())
+		}
+
+		// start a long running process that must be killed on remove
+		ce, err := pod.Exec(ctx, &ExecConfig{
+			Cmd:    []string{"sleep", "60"},
+			Stdout: ioutil.Discard,
+			Stderr: ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := pods[0].Remove(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := ce.Wait(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		pods, err = d.GetPods(ctx, true)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(pods) != 0 {
+			t.Fatalf("expected 0 pods, got: %d", len(pods))
+		}
+	})
+
+	t.Run("test stop after an executor restart", func(t *testing.T) {
+		pod := newPod(t, nil)
+		defer func() { _ = pod.Remove(ctx) }()
+
+		ce, err := pod.Exec(ctx, &ExecConfig{
+			Cmd:    []string{"sleep", "60"},
+			Stdout: ioutil.Discard,
+			Stderr: ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// a new driver instance doesn't know about the running processes
+		nd := newTestProcessDriver(t, dir, "executorid01", "")
+		pods, err := nd.GetPods(ctx, true)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		var npod Pod
+		for _, p := range pods {
+			if p.ID() == pod.ID() {
+				npod = p
+			}
+		}
+		if npod == nil {
+			t.Fatalf("pod %q not found", pod.ID())
+		}
+		if err := npod.Stop(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		code, err := ce.Wait(ctx)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if code != 128+int(syscall.SIGKILL) {
+			t.Fatalf("expected exit code %d, got: %d", 128+int(syscall.SIGKILL), code)
+		}
+	})
+
+	t.Run("test stop doesn't kill processes with a reused pid", func(t *testing.T) {
+		pod := newPod(t, nil)
+		defer func() { _ = pod.Remove(ctx) }()
+
+		// an unrelated process with its own process group
+		cmd := exec.Command("sleep", "60")
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}()
+		startTime, err := processStartTime(cmd.Process.Pid)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// simulate a pod process whose pid has been reused
+		pidFile := filepath.Join(d.podsDir, pod.ID(), processPodPidsDir, strconv.Itoa(cmd.Process.Pid))
+		if err := ioutil.WriteFile(pidFile, []byte(strconv.FormatUint(startTime-1, 10)), 0600); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if err := pod.Stop(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !sameProcess(cmd.Process.Pid, startTime) {
+			t.Fatalf("expected process %d to be alive", cmd.Process.Pid)
+		}
+	})
+
+	t.Run("test stop kills the process group after its leader exited", func(t *testing.T) {
+		pod := newPod(t, nil)
+		defer func() { _ = pod.Remove(ctx) }()
+
+		// the shell exits leaving a background process in its process group
+		var buf bytes.Buffer
+		ce, err := pod.Exec(ctx, &ExecConfig{
+			Cmd:    []string{"/bin/sh", "-c", "sleep 60 >/dev/null 2>&1 & echo $!"},
+			Stdout: &buf,
+			Stderr: ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := ce.Wait(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(buf.String()))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		startTime, err := processStartTime(pid)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if err := pod.Stop(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// the killed process is reaped by init so wait for it to disappear
+		for i := 0; sameProcess(pid, startTime); i++ {
+			if i == 50 {
+				t.Fatalf("expected process %d to be killed", pid)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+
+	t.Run("test container and exec users", func(t *testing.T) {
+		cu, err := user.Current()
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if _, err := d.NewPod(ctx, &PodConfig{
+			ID:         uuid.NewV4().String(),
+			TaskID:     uuid.NewV4().String(),
+			Containers: []*ContainerConfig{{Image: "busybox", User: "agolanotexistinguser"}},
+		}, ioutil.Discard); err == nil {
+			t.Fatalf("expected error creating a pod with a different container user")
+		}
+
+		pod := newPod(t, nil)
+		defer func() { _ = pod.Remove(ctx) }()
+
+		if _, err := pod.Exec(ctx, &ExecConfig{Cmd: []string{"true"}, User: "agolanotexistinguser"}); err == nil {
+			t.Fatalf("expected error executing a process as a different user")
+		}
+		for _, u := range []string{cu.Username, cu.Uid} {
+			ce, err := pod.Exec(ctx, &ExecConfig{Cmd: []string{"true"}, User: u})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if _, err := ce.Wait(ctx); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		}
+	})
+}
+
+func TestProcessPodUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("test requires the nobody user")
+	}
+
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	t.Run("test pods dir not traversable by the user", func(t *testing.T) {
+		d, err := NewProcessDriver(logger, "executorid01", filepath.Join(dir, "private", "pods"), dir, "nobody")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, "private"), 0700); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if err := d.Setup(ctx); err == nil {
+			t.Fatalf("expected err")
+		}
+	})
+
+	t.Run("test pod processes executed as the user", func(t *testing.T) {
+		if err := os.Chmod(dir, 0755); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		d := newTestProcessDriver(t, dir, "executorid01", "nobody")
+
+		pod, err := d.NewPod(ctx, &PodConfig{
+			ID:            uuid.NewV4().String(),
+			TaskID:        uuid.NewV4().String(),
+			Containers:    []*ContainerConfig{{Image: "busybox"}},
+			InitVolumeDir: "/tmp/agola",
+		}, ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer func() { _ = pod.Remove(ctx) }()
+
+		for _, cmd := range [][]string{
+			{"sh", "-c", "cd && touch $HOME/file $TMPDIR/file && id -u"},
+			{"/tmp/agola/agola-toolbox", "mkdir"},
+		} {
+			var buf bytes.Buffer
+			ce, err := pod.Exec(ctx, &ExecConfig{
+				Cmd:    cmd,
+				Stdout: &buf,
+				Stderr: &buf,
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			code, err := ce.Wait(ctx)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if code != 0 {
+				t.Fatalf("unexpected exit code: %d, output: %s", code, buf.String())
+			}
+			if cmd[0] == "sh" && buf.String() != u.Uid+"\n" {
+				t.Fatalf("expected uid %s, got: %s", u.Uid, buf.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,810 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+
+	"agola.io/agola/internal/common"
+	"agola.io/agola/internal/services/executor/registry"
+	"agola.io/agola/internal/toolbox/sandbox"
+	errors "golang.org/x/xerrors"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"go.uber.org/zap"
+)
+
+const (
+	sandboxPodConfigFile = "pod.json"
+	sandboxPodInitLog    = "init.log"
+	sandboxPodSocket     = "sandbox.sock"
+
+	sandboxPodRootFSDir  = "rootfs"
+	sandboxPodToolboxDir = "toolbox"
+
+	sandboxDefaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	// maxSymlinks is the max number of symlinks followed when resolving a path
+	// inside the pod rootfs
+	maxSymlinks = 255
+)
+
+// SandboxDriver runs every pod inside new user, mount, pid, network, uts and
+// ipc namespaces using a root filesystem extracted from the container image.
+// It doesn't require a container engine and can be executed by an unprivileged
+// user if the kernel permits unprivileged user namespaces.
+//
+// Only the executor user is mapped inside the pod user namespace (as root), so
+// changing files ownership and executing processes as other users inside the
+// pod isn't supported. Pods have only the loopback network interface so tasks
+// cannot access the network (the executor config must explicitly acknowledge
+// it). Pods with multiple containers aren't supported.
+type SandboxDriver struct {
+	log         *zap.SugaredLogger
+	podsDir     string
+	toolboxPath string
+	executorID  string
+	arch        common.Arch
+}
+
+func NewSandboxDriver(logger *zap.Logger, executorID, podsDir, toolboxPath string) (*SandboxDriver, error) {
+	return &SandboxDriver{
+		log:         logger.Sugar(),
+		podsDir:     podsDir,
+		toolboxPath: toolboxPath,
+		executorID:  executorID,
+		arch:        common.ArchFromString(runtime.GOARCH),
+	}, nil
+}
+
+func (d *SandboxDriver) Setup(ctx context.Context) error {
+	return os.MkdirAll(d.podsDir, 0700)
+}
+
+func (d *SandboxDriver) Archs(ctx context.Context) ([]common.Arch, error) {
+	// pods are executed on the executor host so we can return our go arch information
+	return []common.Arch{d.arch}, nil
+}
+
+func (d *SandboxDriver) ExecutorGroup(ctx context.Context) (string, error) {
+	// use the same group as the executor id
+	return d.executorID, nil
+}
+
+func (d *SandboxDriver) GetExecutors(ctx context.Context) ([]string, error) {
+	return []string{d.executorID}, nil
+}
+
+// sandboxPodConfig is the pod state saved inside the pod dir. It's used to
+// recover the pods after an executor restart
+type sandboxPodConfig struct {
+	ID         string `json:"id"`
+	ExecutorID string `json:"executor_id"`
+	TaskID     string `json:"task_id"`
+	InitPID    int    `json:"init_pid"`
+	// InitStartTime is the init process start time, used to detect if InitPID
+	// has been reused by another process
+	InitStartTime uint64            `json:"init_start_time"`
+	Env           map[string]string `json:"env"`
+	WorkingDir    string            `json:"working_dir"`
+}
+
+func (d *SandboxDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Writer) (Pod, error) {
+	if len(podConfig.Containers) == 0 {
+		return nil, errors.Errorf("empty container config")
+	}
+	if len(podConfig.Containers) > 1 {
+		return nil, errors.Errorf("sandbox driver doesn't support pods with multiple containers")
+	}
+	if podConfig.Arch != "" && podConfig.Arch != d.arch {
+		return nil, errors.Errorf("unsupported pod arch %q", podConfig.Arch)
+	}
+	if err := checkSharedNetwork("sandbox", podConfig); err != nil {
+		return nil, err
+	}
+	containerConfig := podConfig.Containers[0]
+	if containerConfig.Privileged {
+		return nil, errors.Errorf("sandbox driver doesn't support privileged containers")
+	}
+	if err := checkSandboxUser(containerConfig.User); err != nil {
+		return nil, err
+	}
+
+	podDir := filepath.Join(d.podsDir, podConfig.ID)
+	rootfs := filepath.Join(podDir, sandboxPodRootFSDir)
+	toolboxDir := filepath.Join(podDir, sandboxPodToolboxDir)
+	for _, dir := range []string{rootfs, toolboxDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	// save the pod config before fetching the image so a partially created pod
+	// will be reported by GetPods and removed
+	spc := &sandboxPodConfig{
+		ID:         podConfig.ID,
+		ExecutorID: d.executorID,
+		TaskID:     podConfig.TaskID,
+	}
+	pod := &SandboxPod{dir: podDir, config: spc}
+	if err := pod.saveConfig(); err != nil {
+		return nil, err
+	}
+
+	_, _ = fmt.Fprintf(out, "Pulling image %q\n", containerConfig.Image)
+	imageConfig, err := d.fetchImage(ctx, containerConfig.Image, podConfig.DockerConfig, rootfs)
+	if err != nil {
+		return nil, errors.Errorf("failed to fetch image %q: %w", containerConfig.Image, err)
+	}
+
+	// copy the toolbox since a link to it cannot be resolved inside the pod
+	toolboxExecPath, err := toolboxExecPath(d.toolboxPath, d.arch)
+	if err != nil {
+		return nil, errors.Errorf("failed to get toolbox path for arch %q: %w", d.arch, err)
+	}
+	if err := copyFile(toolboxExecPath, filepath.Join(toolboxDir, toolboxPrefix), 0755); err != nil {
+		return nil, errors.Errorf("failed to copy toolbox: %w", err)
+	}
+
+	env := map[string]string{}
+	for _, e := range imageConfig.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	for k, v := range containerConfig.Env {
+		env[k] = v
+	}
+	if _, ok := env["PATH"]; !ok {
+		env["PATH"] = sandboxDefaultPath
+	}
+	if _, ok := env["HOME"]; !ok {
+		env["HOME"] = "/root"
+	}
+	if imageConfig.User != "" && checkSandboxUser(imageConfig.User) != nil {
+		_, _ = fmt.Fprintf(out, "Ignoring image user %q, processes will be executed as root\n", imageConfig.User)
+	}
+	workingDir := containerConfig.WorkingDir
+	if workingDir == "" {
+		workingDir = imageConfig.WorkingDir
+	}
+	if workingDir == "" {
+		workingDir = "/"
+	}
+
+	hostname := podConfig.ID
+	if len(hostname) > 12 {
+		hostname = hostname[:12]
+	}
+	pid, err := d.startInit(podDir, &sandbox.Config{
+		RootFS:        rootfs,
+		ToolboxDir:    toolboxDir,
+		InitVolumeDir: podConfig.InitVolumeDir,
+		Hostname:      hostname,
+	})
+	if err != nil {
+		return nil, err
+	}
+	startTime, err := processStartTime(pid)
+	if err != nil {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		return nil, errors.Errorf("failed to get pod init process start time: %w", err)
+	}
+
+	spc.InitPID = pid
+	spc.InitStartTime = startTime
+	spc.Env = env
+	spc.WorkingDir = workingDir
+	if err := pod.saveConfig(); err != nil {
+		_ = pod.Stop(ctx)
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+// checkSandboxUser checks that the container or exec user, if defined, is root
+// since it's the only user mapped inside the pod user namespace. The user could
+// be in the "user:group" form
+func checkSandboxUser(u string) error {
+	if u == "" {
+		return nil
+	}
+	for _, p := range strings.SplitN(u, ":", 2) {
+		if p != "root" && p != "0" {
+			return errors.Errorf("sandbox driver cannot execute processes as user %q, only root is supported", u)
+		}
+	}
+	return nil
+}
+
+// fetchImage fetches the image and extracts its flattened layers inside rootfs.
+// Like the docker driver the image is always fetched so we are sure only
+// authorized users can use it.
+func (d *SandboxDriver) fetchImage(ctx context.Context, image string, registryConfig *registry.DockerConfig, rootfs string) (*v1.Config, error) {
+	ref, err := name.ParseReference(image, name.WeakValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := authn.Anonymous
+	var transport http.RoundTripper = http.DefaultTransport
+	if registryConfig != nil {
+		if regauth, ok := registryConfig.Auths[ref.Context().RegistryStr()]; ok {
+			if regauth.RegistryToken != "" {
+				transport = &registryTokenTransport{inner: transport, registry: ref.Context().RegistryStr(), token: regauth.RegistryToken}
+			} else if regauth.Username != "" {
+				auth = &authn.Basic{Username: regauth.Username, Password: regauth.Password}
+			}
+		}
+	}
+
+	img, err := remote.Image(ref, remote.WithAuth(auth), remote.WithTransport(transport), remote.WithPlatform(v1.Platform{OS: "linux", Architecture: string(d.arch)}))
+	if err != nil {
+		return nil, err
+	}
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	rc := mutate.Extract(img)
+	defer rc.Close()
+	if err := extractRootFS(rc, rootfs); err != nil {
+		return nil, err
+	}
+
+	return &configFile.Config, nil
+}
+
+// startInit starts the pod init process inside the new namespaces and waits
+// for its setup to complete. It returns the host pid of the init process
+func (d *SandboxDriver) startInit(podDir string, c *sandbox.Config) (int, error) {
+	cj, err := json.Marshal(c)
+	if err != nil {
+		return 0, err
+	}
+
+	socketPath := filepath.Join(podDir, sandboxPodSocket)
+	// remove a stale socket
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		return 0, errors.Errorf("failed to listen on pod socket: %w", err)
+	}
+	// the socket will be used by the init process, don't remove it
+	l.SetUnlinkOnClose(false)
+	defer l.Close()
+	lf, err := l.File()
+	if err != nil {
+		return 0, err
+	}
+	defer lf.Close()
+
+	sr, sw, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer sr.Close()
+
+	logf, err := os.Create(filepath.Join(podDir, sandboxPodInitLog))
+	if err != nil {
+		sw.Close()
+		return 0, err
+	}
+	defer logf.Close()
+
+	cmd := exec.Command(filepath.Join(c.ToolboxDir, toolboxPrefix), "sandbox-init")
+	cmd.Stdin = bytes.NewReader(cj)
+	cmd.Stdout = logf
+	cmd.Stderr = logf
+	// the order must match sandbox.ListenerFD and sandbox.StatusFD
+	cmd.ExtraFiles = []*os.File{lf, sw}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		// the init process must survive an executor restart
+		Setsid: true,
+	}
+
+	err = cmd.Start()
+	sw.Close()
+	if err != nil {
+		return 0, errors.Errorf("failed to start pod init process: %w", err)
+	}
+	// reap the init process when it exits
+	go func() { _ = cmd.Wait() }()
+
+	status, err := ioutil.ReadAll(sr)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return 0, err
+	}
+	if string(status) != sandbox.StatusOK {
+		_ = cmd.Process.Kill()
+		if len(status) == 0 {
+			return 0, errors.Errorf("pod init process exited unexpectedly, see %s", filepath.Join(podDir, sandboxPodInitLog))
+		}
+		return 0, errors.Errorf("pod init process setup failed: %s", status)
+	}
+
+	return cmd.Process.Pid, nil
+}
+
+func (d *SandboxDriver) GetPods(ctx context.Context, all bool) ([]Pod, error) {
+	entries, err := ioutil.ReadDir(d.podsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Pod{}, nil
+		}
+		return nil, err
+	}
+
+	pods := []Pod{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		podDir := filepath.Join(d.podsDir, entry.Name())
+		spcj, err := ioutil.ReadFile(filepath.Join(podDir, sandboxPodConfigFile))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// skip pod dir being created
+				continue
+			}
+			return nil, err
+		}
+		var spc *sandboxPodConfig
+		if err := json.Unmarshal(spcj, &spc); err != nil {
+			d.log.Warnf("failed to unmarshal pod %q config: %v", entry.Name(), err)
+			continue
+		}
+		if spc.ExecutorID != d.executorID {
+			// skip pod
+			continue
+		}
+		pods = append(pods, &SandboxPod{dir: podDir, config: spc})
+	}
+
+	return pods, nil
+}
+
+type SandboxPod struct {
+	dir    string
+	config *sandboxPodConfig
+}
+
+func (sp *SandboxPod) saveConfig() error {
+	spcj, err := json.Marshal(sp.config)
+	if err != nil {
+		return err
+	}
+	// atomically replace the config file
+	tmpFile := filepath.Join(sp.dir, sandboxPodConfigFile+".tmp")
+	if err := ioutil.WriteFile(tmpFile, spcj, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filepath.Join(sp.dir, sandboxPodConfigFile))
+}
+
+func (sp *SandboxPod) ID() string {
+	return sp.config.ID
+}
+
+func (sp *SandboxPod) ExecutorID() string {
+	return sp.config.ExecutorID
+}
+
+func (sp *SandboxPod) TaskID() string {
+	return sp.config.TaskID
+}
+
+// Stop kills the pod init process. Since it's the pid 1 of the pod pid
+// namespace all the other pod processes will be killed by the kernel
+func (sp *SandboxPod) Stop(ctx context.Context) error {
+	if sp.config.InitPID == 0 {
+		return nil
+	}
+	// the init process could have exited (i.e. after a host reboot) and its
+	// pid reused by another process
+	if !sameProcess(sp.config.InitPID, sp.config.InitStartTime) {
+		return nil
+	}
+	if err := syscall.Kill(sp.config.InitPID, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+func (sp *SandboxPod) Remove(ctx context.Context) error {
+	if err := sp.Stop(ctx); err != nil {
+		return err
+	}
+	// image dirs could be without write permissions, fix them to be able to
+	// remove their content
+	_ = filepath.Walk(sp.dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && info.Mode().Perm()&0700 != 0700 {
+			_ = os.Chmod(path, info.Mode().Perm()|0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(sp.dir)
+}
+
+func (sp *SandboxPod) Exec(ctx context.Context, execConfig *ExecConfig) (ContainerExec, error) {
+	if err := checkSandboxUser(execConfig.User); err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	for k, v := range sp.config.Env {
+		env[k] = v
+	}
+	for k, v := range execConfig.Env {
+		env[k] = v
+	}
+	workingDir := execConfig.WorkingDir
+	if workingDir == "" {
+		workingDir = sp.config.WorkingDir
+	}
+	req := &sandbox.ExecRequest{
+		Cmd:        execConfig.Cmd,
+		Env:        env,
+		WorkingDir: workingDir,
+	}
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: filepath.Join(sp.dir, sandboxPodSocket), Net: "unix"})
+	if err != nil {
+		return nil, errors.Errorf("failed to connect to pod: %w", err)
+	}
+
+	// the process pipes ends passed to the pod init process
+	remoteFiles := []*os.File{}
+	closeRemoteFiles := func() {
+		for _, f := range remoteFiles {
+			f.Close()
+		}
+	}
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	remoteFiles = append(remoteFiles, stdinR)
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		closeRemoteFiles()
+		stdinW.Close()
+		conn.Close()
+		return nil, err
+	}
+	remoteFiles = append(remoteFiles, stdoutW)
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		closeRemoteFiles()
+		stdinW.Close()
+		stdoutR.Close()
+		conn.Close()
+		return nil, err
+	}
+	remoteFiles = append(remoteFiles, stderrW)
+
+	fds := make([]int, len(remoteFiles))
+	for i, f := range remoteFiles {
+		fds[i] = int(f.Fd())
+	}
+	_, _, err = conn.WriteMsgUnix(reqj, syscall.UnixRights(fds...), nil)
+	closeRemoteFiles()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		stderrR.Close()
+		conn.Close()
+		return nil, errors.Errorf("failed to send exec request: %w", err)
+	}
+
+	if !execConfig.AttachStdin {
+		stdinW.Close()
+		stdinW = nil
+	}
+
+	stdout := execConfig.Stdout
+	stderr := execConfig.Stderr
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	// stdout and stderr could be the same writer
+	var mu sync.Mutex
+	stdout = &lockedWriter{w: stdout, mu: &mu}
+	stderr = &lockedWriter{w: stderr, mu: &mu}
+	copyDoneCh := make(chan struct{}, 2)
+	for _, c := range []struct {
+		w io.Writer
+		r *os.File
+	}{{stdout, stdoutR}, {stderr, stderrR}} {
+		go func(w io.Writer, r *os.File) {
+			defer r.Close()
+			_, _ = io.Copy(w, r)
+			copyDoneCh <- struct{}{}
+		}(c.w, c.r)
+	}
+
+	return &SandboxExec{
+		conn:       conn,
+		stdin:      stdinW,
+		copyDoneCh: copyDoneCh,
+	}, nil
+}
+
+type lockedWriter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+type SandboxExec struct {
+	conn       *net.UnixConn
+	stdin      *os.File
+	copyDoneCh chan struct{}
+}
+
+func (e *SandboxExec) Wait(ctx context.Context) (int, error) {
+	defer e.conn.Close()
+
+	resCh := make(chan *sandbox.ExecResponse, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		var res *sandbox.ExecResponse
+		if err := json.NewDecoder(e.conn).Decode(&res); err != nil {
+			errCh <- err
+			return
+		}
+		resCh <- res
+	}()
+
+	var res *sandbox.ExecResponse
+	select {
+	case res = <-resCh:
+	case err := <-errCh:
+		return -1, errors.Errorf("failed to read exec response: %w", err)
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+	if res.Error != "" {
+		return -1, errors.Errorf("exec error: %s", res.Error)
+	}
+
+	// wait for all the output to be copied
+	for i := 0; i < 2; i++ {
+		select {
+		case <-e.copyDoneCh:
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+
+	return res.ExitCode, nil
+}
+
+func (e *SandboxExec) Stdin() io.WriteCloser {
+	if e.stdin == nil {
+		return nopWriteCloser{ioutil.Discard}
+	}
+	return e.stdin
+}
+
+// extractRootFS extracts the image tar stream inside rootfs. Since the image
+// content isn't trusted all the paths are resolved inside rootfs. Devices
+// cannot be created inside a user namespace and are skipped.
+func extractRootFS(r io.Reader, rootfs string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		p, err := rootfsPath(rootfs, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if p == rootfs {
+			continue
+		}
+		mode := hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+
+		if hdr.Typeflag != tar.TypeDir {
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return err
+			}
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if fi, err := os.Lstat(p); err == nil && !fi.IsDir() {
+				if err := os.Remove(p); err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			// always keep the directories writable by the owner so we can
+			// extract files inside them
+			if err := os.Chmod(p, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			if err := os.Chmod(p, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, p); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			target, err := rootfsPath(rootfs, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.Link(target, p); err != nil {
+				return err
+			}
+		default:
+			// skip devices and fifos
+		}
+	}
+
+	return nil
+}
+
+// rootfsPath returns the host path of the provided rootfs path resolving all
+// the symlinks in its parent dirs inside rootfs
+func rootfsPath(rootfs, p string) (string, error) {
+	parts := strings.Split(filepath.Clean("/"+p), "/")[1:]
+	if len(parts) == 1 && parts[0] == "" {
+		return rootfs, nil
+	}
+	dirParts, last := parts[:len(parts)-1], parts[len(parts)-1]
+
+	cur := "/"
+	links := 0
+	for len(dirParts) > 0 {
+		part := dirParts[0]
+		dirParts = dirParts[1:]
+
+		next := filepath.Join(cur, part)
+		fi, err := os.Lstat(filepath.Join(rootfs, next))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", errors.Errorf("too many symlinks resolving %q", p)
+		}
+		target, err := os.Readlink(filepath.Join(rootfs, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			cur = "/"
+		}
+		targetParts := strings.Split(filepath.Clean(filepath.Join(cur, target)), "/")[1:]
+		cur = "/"
+		if !(len(targetParts) == 1 && targetParts[0] == "") {
+			dirParts = append(targetParts, dirParts...)
+		}
+	}
+
+	return filepath.Join(rootfs, cur, last), nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// registryTokenTransport sends the registry bearer token with every request to
+// the registry
+type registryTokenTransport struct {
+	inner    http.RoundTripper
+	registry string
+	token    string
+}
+
+func (t *registryTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// don't send the token to other hosts (like blob storage redirects)
+	if req.URL.Host == t.registry || req.Host == t.registry {
+		// a RoundTripper must not modify the request so set the header on a
+		// copy of it
+		r2 := new(http.Request)
+		*r2 = *req
+		r2.Header = make(http.Header, len(req.Header))
+		for k, v := range req.Header {
+			r2.Header[k] = append([]string(nil), v...)
+		}
+		r2.Header.Set("Authorization", "Bearer "+t.token)
+		req = r2
+	}
+	return t.inner.RoundTrip(req)
+}
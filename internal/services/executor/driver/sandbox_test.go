@@ -0,0 +1,502 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/toolbox/sandbox"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+type testTarEntry struct {
+	typeflag byte
+	name     string
+	linkname string
+	content  string
+}
+
+func testTar(t *testing.T, entries []testTarEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Typeflag: e.typeflag,
+			Name:     e.name,
+			Linkname: e.linkname,
+			Mode:     0644,
+			Size:     int64(len(e.content)),
+		}
+		if e.typeflag == tar.TypeDir {
+			hdr.Mode = 0555
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	return &buf
+}
+
+func TestExtractRootFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rootfs := filepath.Join(dir, "rootfs")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{rootfs, outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	buf := testTar(t, []testTarEntry{
+		{typeflag: tar.TypeDir, name: "usr/"},
+		{typeflag: tar.TypeDir, name: "usr/lib/"},
+		{typeflag: tar.TypeSymlink, name: "lib", linkname: "usr/lib"},
+		// must be written inside usr/lib
+		{typeflag: tar.TypeReg, name: "lib/file01", content: "file01"},
+		{typeflag: tar.TypeLink, name: "usr/file02", linkname: "lib/file01"},
+		// symlinks pointing outside the rootfs must be resolved inside it
+		{typeflag: tar.TypeSymlink, name: "abs", linkname: outside},
+		{typeflag: tar.TypeSymlink, name: "rel", linkname: "../../../../../../../../outside"},
+		{typeflag: tar.TypeReg, name: "abs/file03", content: "file03"},
+		{typeflag: tar.TypeReg, name: "rel/file04", content: "file04"},
+		{typeflag: tar.TypeReg, name: "../file05", content: "file05"},
+	})
+
+	if err := extractRootFS(buf, rootfs); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expectedFiles := map[string]string{
+		"usr/lib/file01": "file01",
+		"usr/file02":     "file01",
+		// abs/file03 is written in the outside dir path relative to rootfs
+		filepath.Join(outside, "file03"): "file03",
+		"outside/file04":                 "file04",
+		"file05":                         "file05",
+	}
+
+	for p, content := range expectedFiles {
+		data, err := ioutil.ReadFile(filepath.Join(rootfs, p))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if string(data) != content {
+			t.Fatalf("file %q: expected content %q, got %q", p, content, data)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(outside)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no files outside rootfs, got %d", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "file05")); !os.IsNotExist(err) {
+		t.Fatalf("expected no files outside rootfs")
+	}
+
+	// directories must be writable by the owner
+	fi, err := os.Stat(filepath.Join(rootfs, "usr"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Fatalf("expected dir mode %o, got %o", 0755, fi.Mode().Perm())
+	}
+}
+
+// testSandboxInit emulates the pod init process: it serves the exec requests
+// received on the pod socket executing the commands on the host
+func testSandboxInit(t *testing.T, podDir string) func() {
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(podDir, sandboxPodSocket), Net: "unix"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.AcceptUnix()
+			if err != nil {
+				return
+			}
+			go testSandboxInitExec(conn)
+		}
+	}()
+
+	return func() { l.Close() }
+}
+
+func testSandboxInitExec(conn *net.UnixConn) {
+	defer conn.Close()
+
+	res := &sandbox.ExecResponse{}
+	exitCode, err := func() (int, error) {
+		buf := make([]byte, 1024*1024)
+		oob := make([]byte, syscall.CmsgSpace(3*4))
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return 0, err
+		}
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return 0, err
+		}
+		files := []*os.File{}
+		for _, msg := range msgs {
+			fds, err := syscall.ParseUnixRights(&msg)
+			if err != nil {
+				return 0, err
+			}
+			for _, fd := range fds {
+				files = append(files, os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd)))
+			}
+		}
+		defer func() {
+			for _, f := range files {
+				f.Close()
+			}
+		}()
+		if len(files) != 3 {
+			return 0, fmt.Errorf("expected 3 file descriptors, got %d", len(files))
+		}
+
+		var req *sandbox.ExecRequest
+		if err := json.Unmarshal(buf[:n], &req); err != nil {
+			return 0, err
+		}
+		cmd := exec.Command(req.Cmd[0], req.Cmd[1:]...)
+		for k, v := range req.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		cmd.Dir = req.WorkingDir
+		cmd.Stdin = files[0]
+		cmd.Stdout = files[1]
+		cmd.Stderr = files[2]
+		if err := cmd.Run(); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				return exitErr.Sys().(syscall.WaitStatus).ExitStatus(), nil
+			}
+			return 0, err
+		}
+		return 0, nil
+	}()
+	res.ExitCode = exitCode
+	if err != nil {
+		res.ExitCode = -1
+		res.Error = err.Error()
+	}
+
+	_ = json.NewEncoder(conn).Encode(res)
+}
+
+func TestSandboxPod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := zap.NewNop()
+	ctx := context.Background()
+
+	d, err := NewSandboxDriver(logger, "executorid01", filepath.Join(dir, "pods"), filepath.Join(dir, "toolbox"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := d.Setup(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// create a pod like NewPod does after its init process has been started
+	// since the real init process requires the pod image and the toolbox
+	newTestPod := func(t *testing.T, id string) *SandboxPod {
+		podDir := filepath.Join(d.podsDir, id)
+		if err := os.MkdirAll(podDir, 0700); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		pod := &SandboxPod{
+			dir: podDir,
+			config: &sandboxPodConfig{
+				ID:         id,
+				ExecutorID: d.executorID,
+				TaskID:     "taskid01",
+				Env:        map[string]string{"ENV01": "ENVVALUE01", "ENV02": "ENVVALUE02"},
+				WorkingDir: dir,
+			},
+		}
+		if err := pod.saveConfig(); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		return pod
+	}
+
+	t.Run("test pod exec", func(t *testing.T) {
+		pod := newTestPod(t, "pod01")
+		defer pod.Remove(ctx)
+		defer testSandboxInit(t, pod.dir)()
+
+		var stdout, stderr bytes.Buffer
+		ce, err := pod.Exec(ctx, &ExecConfig{
+			Cmd:    []string{"/bin/sh", "-c", "echo $ENV01 $ENV02 $PWD; echo error >&2; exit 3"},
+			Env:    map[string]string{"ENV02": "OVERRIDDEN02"},
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		exitCode, err := ce.Wait(ctx)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if exitCode != 3 {
+			t.Fatalf("expected exit code 3, got %d", exitCode)
+		}
+		if diff := cmp.Diff(fmt.Sprintf("ENVVALUE01 OVERRIDDEN02 %s\n", dir), stdout.String()); diff != "" {
+			t.Fatalf("stdout mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff("error\n", stderr.String()); diff != "" {
+			t.Fatalf("stderr mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("test pod exec with stdin", func(t *testing.T) {
+		pod := newTestPod(t, "pod01")
+		defer pod.Remove(ctx)
+		defer testSandboxInit(t, pod.dir)()
+
+		var stdout bytes.Buffer
+		ce, err := pod.Exec(ctx, &ExecConfig{
+			Cmd:         []string{"cat"},
+			AttachStdin: true,
+			Stdout:      &stdout,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		stdin := ce.Stdin()
+		if _, err := stdin.Write([]byte("stdin data")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		stdin.Close()
+		exitCode, err := ce.Wait(ctx)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if exitCode != 0 {
+			t.Fatalf("expected exit code 0, got %d", exitCode)
+		}
+		if diff := cmp.Diff("stdin data", stdout.String()); diff != "" {
+			t.Fatalf("stdout mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("test get pods after an executor restart", func(t *testing.T) {
+		pod := newTestPod(t, "pod01")
+		defer pod.Remove(ctx)
+		defer testSandboxInit(t, pod.dir)()
+
+		// pod of another executor
+		op := newTestPod(t, "pod02")
+		defer op.Remove(ctx)
+		op.config.ExecutorID = "executorid02"
+		if err := op.saveConfig(); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		nd, err := NewSandboxDriver(logger, d.executorID, d.podsDir, d.toolboxPath)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		pods, err := nd.GetPods(ctx, true)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(pods) != 1 {
+			t.Fatalf("expected 1 pod, got %d", len(pods))
+		}
+		rp := pods[0].(*SandboxPod)
+		if diff := cmp.Diff(pod.config, rp.config); diff != "" {
+			t.Fatalf("pod config mismatch (-want +got):\n%s", diff)
+		}
+
+		// the recovered pod must be usable
+		var stdout bytes.Buffer
+		ce, err := rp.Exec(ctx, &ExecConfig{
+			Cmd:    []string{"/bin/sh", "-c", "echo $ENV01"},
+			Stdout: &stdout,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := ce.Wait(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if diff := cmp.Diff("ENVVALUE01\n", stdout.String()); diff != "" {
+			t.Fatalf("stdout mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("test stop kills the init process", func(t *testing.T) {
+		cmd := exec.Command("sleep", "60")
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer func() { _ = cmd.Process.Kill() }()
+		exitCh := make(chan struct{})
+		go func() { _ = cmd.Wait(); close(exitCh) }()
+
+		startTime, err := processStartTime(cmd.Process.Pid)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		pod := newTestPod(t, "pod01")
+		pod.config.InitPID = cmd.Process.Pid
+		pod.config.InitStartTime = startTime
+		if err := pod.Remove(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		select {
+		case <-exitCh:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected init process to be killed")
+		}
+	})
+
+	t.Run("test stop doesn't kill processes with a reused pid", func(t *testing.T) {
+		cmd := exec.Command("sleep", "60")
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer func() { _ = cmd.Process.Kill(); _ = cmd.Wait() }()
+
+		startTime, err := processStartTime(cmd.Process.Pid)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// emulate a pid reused by a process started later
+		pod := newTestPod(t, "pod01")
+		pod.config.InitPID = cmd.Process.Pid
+		pod.config.InitStartTime = startTime - 1
+		if err := pod.Remove(ctx); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if !sameProcess(cmd.Process.Pid, startTime) {
+			t.Fatalf("expected process to be alive")
+		}
+	})
+}
+
+type testRoundTripper func(req *http.Request) (*http.Response, error)
+
+func (f testRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRegistryTokenTransport(t *testing.T) {
+	var auth string
+	rt := &registryTokenTransport{
+		inner: testRoundTripper(func(req *http.Request) (*http.Response, error) {
+			auth = req.Header.Get("Authorization")
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+		}),
+		registry: "registry.example.com",
+		token:    "token01",
+	}
+
+	for _, tt := range []struct {
+		url  string
+		auth string
+	}{
+		{url: "https://registry.example.com/v2/", auth: "Bearer token01"},
+		// the token must not be sent to other hosts
+		{url: "https://storage.example.com/blob", auth: ""},
+	} {
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		req.Header.Set("Accept", "application/json")
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if auth != tt.auth {
+			t.Fatalf("url %q: expected authorization %q, got %q", tt.url, tt.auth, auth)
+		}
+		// the original request must not be modified
+		if req.Header.Get("Authorization") != "" || len(req.Header) != 1 {
+			t.Fatalf("url %q: request headers modified: %v", tt.url, req.Header)
+		}
+	}
+}
+
+func TestCheckSandboxUser(t *testing.T) {
+	tests := []struct {
+		user string
+		err  bool
+	}{
+		{user: ""},
+		{user: "root"},
+		{user: "0"},
+		{user: "root:root"},
+		{user: "0:0"},
+		{user: "node", err: true},
+		{user: "1000", err: true},
+		{user: "root:1000", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			err := checkSandboxUser(tt.user)
+			if tt.err && err == nil {
+				t.Fatalf("expected error for user %q", tt.user)
+			}
+			if !tt.err && err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		})
+	}
+}
@@ -33,15 +33,19 @@ import (
 	"agola.io/agola/internal/common"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/services/executor/archivecache"
 	"agola.io/agola/internal/services/executor/driver"
 	"agola.io/agola/internal/services/executor/registry"
 	rsapi "agola.io/agola/internal/services/runservice/api"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/steplog"
 	"agola.io/agola/internal/util"
 	uuid "github.com/satori/go.uuid"
 
+	units "github.com/docker/go-units"
 	"github.com/gorilla/mux"
 	sockaddr "github.com/hashicorp/go-sockaddr"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	errors "golang.org/x/xerrors"
@@ -54,7 +58,18 @@ var log = logger.Sugar()
 const (
 	defaultShell = "/bin/sh -e"
 
+	// stoppedTasksWaitTimeout is the time to wait for the stopped tasks to
+	// report their final status when shutting down
+	stoppedTasksWaitTimeout = 30 * time.Second
+
 	toolboxContainerDir = "/mnt/agola"
+
+	// taskAnnotationsFile is the file where the task steps can report task
+	// annotations. Its expanded path is provided in the steps environment
+	taskAnnotationsFile = "~/.agola-task-annotations"
+	// maxTaskAnnotationsFileSize is the max read size of the task annotations
+	// file
+	maxTaskAnnotationsFileSize = 64 * 1024
 )
 
 var (
@@ -99,16 +114,7 @@ func (e *Executor) createFile(ctx context.Context, pod driver.Pod, command, user
 	return buf.String(), nil
 }
 
-func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (int, error) {
-	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
-		return -1, err
-	}
-	outf, err := os.Create(logPath)
-	if err != nil {
-		return -1, err
-	}
-	defer outf.Close()
-
+func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.ExecutorTask, pod driver.Pod, outf *stepLog) (int, error) {
 	shell := defaultShell
 	if t.Shell != "" {
 		shell = t.Shell
@@ -154,7 +160,7 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 		environment[envName] = envValue
 	}
 
-	workingDir, err = e.expandDir(ctx, t, pod, outf, workingDir)
+	workingDir, err := e.expandDir(ctx, t, pod, outf, workingDir)
 	if err != nil {
 		_, _ = outf.WriteString(fmt.Sprintf("failed to expand working dir %q. Error: %s\n", workingDir, err))
 		return -1, err
@@ -184,18 +190,9 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 	return exitCode, nil
 }
 
-func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWorkspaceStep, t *types.ExecutorTask, pod driver.Pod, logPath string, archivePath string) (int, error) {
+func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWorkspaceStep, t *types.ExecutorTask, pod driver.Pod, logf *stepLog, archivePath string) (int, error) {
 	cmd := []string{toolboxContainerPath, "archive"}
 
-	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
-		return -1, err
-	}
-	logf, err := os.Create(logPath)
-	if err != nil {
-		return -1, err
-	}
-	defer logf.Close()
-
 	if err := os.MkdirAll(filepath.Dir(archivePath), 0770); err != nil {
 		return -1, err
 	}
@@ -217,7 +214,7 @@ func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWor
 		WorkingDir:  workingDir,
 		AttachStdin: true,
 		Stdout:      archivef,
-		Stderr:      logf,
+		Stderr:      logf.Stream(steplog.StreamStderr),
 	}
 
 	ce, err := pod.Exec(ctx, execConfig)
@@ -262,6 +259,13 @@ func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWor
 		return -1, err
 	}
 
+	if exitCode == 0 {
+		// the archive will be probably restored by the next tasks
+		if _, err := e.archiveCache.AddFile(archivePath); err != nil {
+			log.Warnf("failed to add archive to the archive cache: %v", err)
+		}
+	}
+
 	return exitCode, nil
 }
 
@@ -414,25 +418,52 @@ func (e *Executor) unarchive(ctx context.Context, t *types.ExecutorTask, source
 	return nil
 }
 
-func (e *Executor) doRestoreWorkspaceStep(ctx context.Context, s *types.RestoreWorkspaceStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (int, error) {
-	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
-		return -1, err
+// openArchive returns a reader for an archive provided by the runservice. check
+// is used to get the archive hash from its etag, if the archive cache contains
+// an archive with the same hash it's used, otherwise the archive is fetched
+// with get and saved in the archive cache.
+// The returned http response is the last runservice response.
+func (e *Executor) openArchive(ctx context.Context, logf io.Writer, check, get func(ctx context.Context) (*http.Response, error)) (io.ReadCloser, *http.Response, error) {
+	if e.archiveCache != nil {
+		resp, err := check(ctx)
+		if err != nil {
+			return nil, resp, err
+		}
+		resp.Body.Close()
+
+		f, err := e.archiveCache.Open(archivecache.ETagHash(resp.Header.Get("ETag")))
+		if err == nil {
+			fmt.Fprintf(logf, "using locally cached archive\n")
+			return f, resp, nil
+		}
+		if !os.IsNotExist(err) {
+			log.Warnf("failed to open cached archive: %v", err)
+		}
 	}
-	logf, err := os.Create(logPath)
+
+	resp, err := get(ctx)
 	if err != nil {
-		return -1, err
+		return nil, resp, err
 	}
-	defer logf.Close()
+	return e.archiveCache.NewReader(resp.Body, archivecache.ETagHash(resp.Header.Get("ETag"))), resp, nil
+}
 
+func (e *Executor) doRestoreWorkspaceStep(ctx context.Context, s *types.RestoreWorkspaceStep, t *types.ExecutorTask, pod driver.Pod, logf *stepLog) (int, error) {
 	for _, op := range t.WorkspaceOperations {
 		log.Debugf("unarchiving workspace for taskID: %s, step: %d", level, op.TaskID, op.Step)
-		resp, err := e.runserviceClient.GetArchive(ctx, op.TaskID, op.Step)
+		archivef, _, err := e.openArchive(ctx, logf,
+			func(ctx context.Context) (*http.Response, error) {
+				return e.runserviceClient.CheckArchive(ctx, op.TaskID, op.Step)
+			},
+			func(ctx context.Context) (*http.Response, error) {
+				return e.runserviceClient.GetArchive(ctx, op.TaskID, op.Step)
+			},
+		)
 		if err != nil {
 			// TODO(sgotti) retry before giving up
 			fmt.Fprintf(logf, "error reading workspace archive: %v\n", err)
 			return -1, err
 		}
-		archivef := resp.Body
 		if err := e.unarchive(ctx, t, archivef, pod, logf, s.DestDir, false, false); err != nil {
 			archivef.Close()
 			return -1, err
@@ -443,18 +474,9 @@ func (e *Executor) doRestoreWorkspaceStep(ctx context.Context, s *types.RestoreW
 	return 0, nil
 }
 
-func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep, t *types.ExecutorTask, pod driver.Pod, logPath string, archivePath string) (int, error) {
+func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep, t *types.ExecutorTask, pod driver.Pod, logf *stepLog, archivePath string) (int, error) {
 	cmd := []string{toolboxContainerPath, "archive"}
 
-	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
-		return -1, err
-	}
-	logf, err := os.Create(logPath)
-	if err != nil {
-		return -1, err
-	}
-	defer logf.Close()
-
 	save := false
 
 	// calculate key from template
@@ -507,7 +529,7 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 		WorkingDir:  workingDir,
 		AttachStdin: true,
 		Stdout:      archivef,
-		Stderr:      logf,
+		Stderr:      logf.Stream(steplog.StreamStderr),
 	}
 
 	ce, err := pod.Exec(ctx, execConfig)
@@ -556,6 +578,10 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 		return exitCode, errors.Errorf("save cache archiving command ended with exit code %d", exitCode)
 	}
 
+	if _, err := e.archiveCache.AddFile(archivePath); err != nil {
+		log.Warnf("failed to add cache archive to the archive cache: %v", err)
+	}
+
 	f, err := os.Open(archivePath)
 	if err != nil {
 		return -1, err
@@ -576,16 +602,7 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 	return exitCode, nil
 }
 
-func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCacheStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (int, error) {
-	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
-		return -1, err
-	}
-	logf, err := os.Create(logPath)
-	if err != nil {
-		return -1, err
-	}
-	defer logf.Close()
-
+func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCacheStep, t *types.ExecutorTask, pod driver.Pod, logf *stepLog) (int, error) {
 	fmt.Fprintf(logf, "restoring cache: %s\n", util.Dump(s))
 	for _, key := range s.Keys {
 		// calculate key from template
@@ -598,7 +615,14 @@ func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCache
 		// append cache prefix
 		key := t.CachePrefix + "-" + userKey
 
-		resp, err := e.runserviceClient.GetCache(ctx, key, true)
+		cachef, resp, err := e.openArchive(ctx, logf,
+			func(ctx context.Context) (*http.Response, error) {
+				return e.runserviceClient.CheckCache(ctx, key, true)
+			},
+			func(ctx context.Context) (*http.Response, error) {
+				return e.runserviceClient.GetCache(ctx, key, true)
+			},
+		)
 		if err != nil {
 			// ignore 404 errors since they means that the cache key doesn't exists
 			if resp != nil && resp.StatusCode == http.StatusNotFound {
@@ -610,7 +634,6 @@ func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCache
 			return -1, err
 		}
 		fmt.Fprintf(logf, "restoring cache with key %q\n", userKey)
-		cachef := resp.Body
 		if err := e.unarchive(ctx, t, cachef, pod, logf, s.DestDir, false, false); err != nil {
 			cachef.Close()
 			return -1, err
@@ -644,6 +667,15 @@ func (e *Executor) setupLogPath(taskID string) string {
 	return filepath.Join(e.taskLogsPath(taskID), "setup.log")
 }
 
+// maxLogSize returns the max size of the task steps logs. The task max log
+// size is honored only when it doesn't exceed the executor one
+func (e *Executor) maxLogSize(et *types.ExecutorTask) int64 {
+	if et.MaxLogSize > 0 && (e.stepLogsMaxSize <= 0 || et.MaxLogSize < e.stepLogsMaxSize) {
+		return et.MaxLogSize
+	}
+	return e.stepLogsMaxSize
+}
+
 func (e *Executor) stepLogPath(taskID string, stepID int) string {
 	return filepath.Join(e.taskLogsPath(taskID), "steps", fmt.Sprintf("%d.log", stepID))
 }
@@ -660,6 +692,9 @@ func (e *Executor) sendExecutorStatus(ctx context.Context) error {
 
 	activeTasks := e.runningTasks.len()
 
+	activeTasksGauge.Set(float64(activeTasks))
+	activeTasksLimitGauge.Set(float64(e.c.ActiveTasksLimit))
+
 	archs, err := e.driver.Archs(ctx)
 	if err != nil {
 		return err
@@ -702,6 +737,7 @@ func (e *Executor) sendExecutorStatus(ctx context.Context) error {
 		Dynamic:                   e.dynamic,
 		ExecutorGroup:             executorGroup,
 		SiblingsExecutors:         siblingsExecutors,
+		ShuttingDown:              e.isShuttingDown(),
 	}
 
 	log.Debugf("send executor status: %s", util.Dump(executor))
@@ -753,6 +789,12 @@ func (e *Executor) executeTask(ctx context.Context, et *types.ExecutorTask) {
 		return
 	}
 
+	// don't start new tasks when shutting down
+	if e.isShuttingDown() {
+		log.Debugf("executor is shutting down, not starting task %s", et.ID)
+		return
+	}
+
 	activeTasks := e.runningTasks.len()
 	// don't start task if we have reached the active tasks limit
 	// they will be executed later
@@ -786,7 +828,9 @@ func (e *Executor) executeTask(ctx context.Context, et *types.ExecutorTask) {
 		log.Errorf("err: %+v", err)
 	}
 
-	if err := e.setupTask(ctx, rt); err != nil {
+	err := e.setupTask(ctx, rt)
+	e.pushLog(ctx, et.ID, true, 0)
+	if err != nil {
 		log.Errorf("err: %+v", err)
 		rt.et.Status.Phase = types.ExecutorTaskPhaseFailed
 		et.Status.SetupStep.EndTime = util.TimePtr(time.Now())
@@ -807,9 +851,17 @@ func (e *Executor) executeTask(ctx context.Context, et *types.ExecutorTask) {
 
 	rt.Unlock()
 
-	_, err := e.executeTaskSteps(ctx, rt, rt.pod)
+	_, err = e.executeTaskSteps(ctx, rt, rt.pod)
+
+	annotations, aerr := e.readTaskAnnotations(ctx, rt.et, rt.pod)
+	if aerr != nil {
+		log.Errorf("failed to read task %s annotations: %+v", rt.et.ID, aerr)
+	}
 
 	rt.Lock()
+	if len(annotations) > 0 {
+		rt.et.Status.Annotations = annotations
+	}
 	if err != nil {
 		log.Errorf("err: %+v", err)
 		rt.et.Status.Phase = types.ExecutorTaskPhaseFailed
@@ -825,6 +877,23 @@ func (e *Executor) executeTask(ctx context.Context, et *types.ExecutorTask) {
 	rt.Unlock()
 }
 
+// imagePullPolicy returns the container image pull policy. Policies other than
+// always are honored only for the executor prepull images: a private image
+// already present could have been pulled by another user and the pull is the
+// only check that the task is authorized to use it.
+func (e *Executor) imagePullPolicy(c *types.Container, out io.Writer) driver.ImagePullPolicy {
+	if c.ImagePullPolicy == "" || c.ImagePullPolicy == types.ImagePullPolicyAlways {
+		return driver.ImagePullPolicyAlways
+	}
+	for _, image := range e.c.Images.Prepull {
+		if c.Image == image {
+			return driver.ImagePullPolicy(c.ImagePullPolicy)
+		}
+	}
+	_, _ = fmt.Fprintf(out, "Image %q isn't a prepull image, ignoring image pull policy %q.\n", c.Image, c.ImagePullPolicy)
+	return driver.ImagePullPolicyAlways
+}
+
 func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 	et := rt.et
 	if err := os.RemoveAll(e.taskPath(et.ID)); err != nil {
@@ -834,11 +903,7 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 		return err
 	}
 
-	setupLogPath := e.setupLogPath(et.ID)
-	if err := os.MkdirAll(filepath.Dir(setupLogPath), 0770); err != nil {
-		return err
-	}
-	outf, err := os.Create(setupLogPath)
+	outf, err := newStepLog(e.setupLogPath(et.ID), 0)
 	if err != nil {
 		return err
 	}
@@ -859,8 +924,13 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 
 	log.Debugf("starting pod")
 
-	dockerConfig, err := registry.GenDockerConfig(et.DockerRegistriesAuth, []string{et.Containers[0].Image})
+	images := make([]string, len(et.Containers))
+	for i, c := range et.Containers {
+		images[i] = c.Image
+	}
+	dockerConfig, err := registry.GenDockerConfig(ctx, et.DockerRegistriesAuth, images, e.registryTokenCache)
 	if err != nil {
+		_, _ = outf.WriteString(fmt.Sprintf("Failed to resolve registries auth. Error: %s\n", err))
 		return err
 	}
 
@@ -870,6 +940,7 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 		ID:            uuid.NewV4().String(),
 		TaskID:        et.ID,
 		Arch:          et.Arch,
+		NetworkMode:   driver.NetworkMode(et.NetworkMode),
 		InitVolumeDir: toolboxContainerDir,
 		DockerConfig:  dockerConfig,
 		Containers:    make([]*driver.ContainerConfig, len(et.Containers)),
@@ -884,13 +955,18 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 		}
 
 		podConfig.Containers[i] = &driver.ContainerConfig{
-			Image:      c.Image,
-			Cmd:        cmd,
-			Env:        c.Environment,
-			User:       c.User,
-			Privileged: c.Privileged,
+			Image:           c.Image,
+			Cmd:             cmd,
+			Env:             c.Environment,
+			User:            c.User,
+			Privileged:      c.Privileged,
+			ImagePullPolicy: e.imagePullPolicy(c, outf),
+			Alias:           c.Alias,
 		}
 	}
+	if et.K8s != nil {
+		podConfig.K8s = k8sPodConfig(et.K8s)
+	}
 
 	_, _ = outf.WriteString("Starting pod.\n")
 	pod, err := e.driver.NewPod(ctx, podConfig, outf)
@@ -908,10 +984,70 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 		}
 	}
 
+	annotationsFile, err := e.expandDir(ctx, et, pod, outf, taskAnnotationsFile)
+	if err != nil {
+		_, _ = outf.WriteString(fmt.Sprintf("Failed to expand task annotations file path %q. Error: %s\n", taskAnnotationsFile, err))
+		return err
+	}
+	if et.Environment == nil {
+		et.Environment = map[string]string{}
+	}
+	et.Environment[types.TaskAnnotationsFileEnv] = annotationsFile
+
 	rt.pod = pod
 	return nil
 }
 
+// readTaskAnnotations reads the task annotations reported by the task steps.
+// Invalid or unknown annotations are ignored
+func (e *Executor) readTaskAnnotations(ctx context.Context, et *types.ExecutorTask, pod driver.Pod) (map[string]string, error) {
+	annotationsFile, ok := et.Environment[types.TaskAnnotationsFileEnv]
+	if !ok {
+		return nil, nil
+	}
+	cmd := []string{toolboxContainerPath, "readfile", annotationsFile}
+
+	stdout := util.NewLimitedBuffer(maxTaskAnnotationsFileSize)
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		Env:         et.Environment,
+		AttachStdin: true,
+		Stdout:      stdout,
+		Stderr:      ioutil.Discard,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return nil, err
+	}
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, errors.Errorf("readfile ended with exit code %d", exitCode)
+	}
+
+	return parseTaskAnnotations(stdout.String()), nil
+}
+
+// parseTaskAnnotations parses "key=value" lines. The last value of a key wins
+func parseTaskAnnotations(s string) map[string]string {
+	annotations := map[string]string{}
+	for _, line := range strings.Split(s, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !types.ValidReportedTaskAnnotation(k, v) {
+			continue
+		}
+		annotations[k] = v
+	}
+	return annotations
+}
+
 func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod driver.Pod) (int, error) {
 	for i, step := range rt.et.Steps {
 		rt.Lock()
@@ -922,7 +1058,12 @@ func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod dr
 		}
 		rt.Unlock()
 
-		var err error
+		maxLogSize := e.maxLogSize(rt.et)
+		logf, err := newStepLog(e.stepLogPath(rt.et.ID, i), maxLogSize)
+		if err != nil {
+			return i, err
+		}
+
 		var exitCode int
 		var stepName string
 
@@ -930,33 +1071,35 @@ func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod dr
 		case *types.RunStep:
 			log.Debugf("run step: %s", util.Dump(s))
 			stepName = s.Name
-			exitCode, err = e.doRunStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+			exitCode, err = e.doRunStep(ctx, s, rt.et, pod, logf)
 
 		case *types.SaveToWorkspaceStep:
 			log.Debugf("save to workspace step: %s", util.Dump(s))
 			stepName = s.Name
 			archivePath := e.archivePath(rt.et.ID, i)
-			exitCode, err = e.doSaveToWorkspaceStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
+			exitCode, err = e.doSaveToWorkspaceStep(ctx, s, rt.et, pod, logf, archivePath)
 
 		case *types.RestoreWorkspaceStep:
 			log.Debugf("restore workspace step: %s", util.Dump(s))
 			stepName = s.Name
-			exitCode, err = e.doRestoreWorkspaceStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+			exitCode, err = e.doRestoreWorkspaceStep(ctx, s, rt.et, pod, logf)
 
 		case *types.SaveCacheStep:
 			log.Debugf("save cache step: %s", util.Dump(s))
 			stepName = s.Name
 			archivePath := e.archivePath(rt.et.ID, i)
-			exitCode, err = e.doSaveCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
+			exitCode, err = e.doSaveCacheStep(ctx, s, rt.et, pod, logf, archivePath)
 
 		case *types.RestoreCacheStep:
 			log.Debugf("restore cache step: %s", util.Dump(s))
 			stepName = s.Name
-			exitCode, err = e.doRestoreCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+			exitCode, err = e.doRestoreCacheStep(ctx, s, rt.et, pod, logf)
 
 		default:
+			logf.Close()
 			return i, errors.Errorf("unknown step type: %s", util.Dump(s))
 		}
+		logf.Close()
 
 		var serr error
 
@@ -978,11 +1121,24 @@ func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod dr
 			serr = errors.Errorf("step %q failed with exitcode %d", stepName, exitCode)
 		}
 
+		if logf.Truncated() {
+			rt.et.Status.Steps[i].LogTruncated = true
+			if serr == nil && (e.c.StepLogs.FailOnTruncation || rt.et.FailOnLogTruncation) {
+				rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseFailed
+				serr = errors.Errorf("step %q log exceeded the max log size of %d bytes", stepName, maxLogSize)
+			}
+		}
+
 		if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
 			log.Errorf("err: %+v", err)
 		}
 		rt.Unlock()
 
+		e.pushLog(ctx, rt.et.ID, false, i)
+		if _, ok := step.(*types.SaveToWorkspaceStep); ok && serr == nil {
+			e.pushArchive(ctx, rt.et.ID, i)
+		}
+
 		if serr != nil {
 			return i, serr
 		}
@@ -991,6 +1147,61 @@ func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod dr
 	return 0, nil
 }
 
+// pushLog pushes in background the task setup or step log to the runservice
+// when push mode is enabled
+func (e *Executor) pushLog(ctx context.Context, taskID string, setup bool, step int) {
+	if !e.c.PushLogsAndArchives {
+		return
+	}
+	logPath := e.stepLogPath(taskID, step)
+	if setup {
+		logPath = e.setupLogPath(taskID)
+	}
+	go func() {
+		if err := e.pushFile(logPath, func(size int64, r io.Reader) (*http.Response, error) {
+			return e.runserviceClient.PutLog(ctx, e.id, taskID, setup, step, size, r)
+		}); err != nil {
+			// the runservice will fetch it
+			log.Warnf("failed to push log for task %q: %v", taskID, err)
+		}
+	}()
+}
+
+// pushArchive pushes in background the task step workspace archive to the
+// runservice when push mode is enabled
+func (e *Executor) pushArchive(ctx context.Context, taskID string, step int) {
+	if !e.c.PushLogsAndArchives {
+		return
+	}
+	go func() {
+		if err := e.pushFile(e.archivePath(taskID, step), func(size int64, r io.Reader) (*http.Response, error) {
+			return e.runserviceClient.PutArchive(ctx, e.id, taskID, step, size, r)
+		}); err != nil {
+			// the runservice will fetch it
+			log.Warnf("failed to push workspace archive for task %q: %v", taskID, err)
+		}
+	}()
+}
+
+func (e *Executor) pushFile(p string, put func(size int64, r io.Reader) (*http.Response, error)) error {
+	f, err := os.Open(p)
+	if err != nil {
+		// nothing to push
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = put(fi.Size(), f)
+	return err
+}
+
 func (e *Executor) podsCleanerLoop(ctx context.Context) {
 	for {
 		log.Debugf("podsCleaner")
@@ -1070,25 +1281,7 @@ func (e *Executor) executorTasksStatusSenderLoop(ctx context.Context) {
 	for {
 		log.Debugf("executorTasksStatusSenderLoop")
 
-		for _, rtID := range e.runningTasks.ids() {
-			rt, ok := e.runningTasks.get(rtID)
-			if !ok {
-				continue
-			}
-
-			rt.Lock()
-			if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
-				log.Errorf("err: %+v", err)
-				rt.Unlock()
-				continue
-			}
-
-			// remove running task if send was successful and it's not executing
-			if !rt.executing {
-				e.runningTasks.delete(rtID)
-			}
-			rt.Unlock()
-		}
+		e.sendExecutorTasksStatus(ctx)
 
 		select {
 		case <-ctx.Done():
@@ -1100,6 +1293,28 @@ func (e *Executor) executorTasksStatusSenderLoop(ctx context.Context) {
 	}
 }
 
+func (e *Executor) sendExecutorTasksStatus(ctx context.Context) {
+	for _, rtID := range e.runningTasks.ids() {
+		rt, ok := e.runningTasks.get(rtID)
+		if !ok {
+			continue
+		}
+
+		rt.Lock()
+		if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
+			log.Errorf("err: %+v", err)
+			rt.Unlock()
+			continue
+		}
+
+		// remove running task if send was successful and it's not executing
+		if !rt.executing {
+			e.runningTasks.delete(rtID)
+		}
+		rt.Unlock()
+	}
+}
+
 func (e *Executor) tasksUpdaterLoop(ctx context.Context) {
 	for {
 		log.Debugf("tasksUpdater")
@@ -1314,6 +1529,15 @@ type Executor struct {
 	driver           driver.Driver
 	listenURL        string
 	dynamic          bool
+
+	shuttingDownMutex sync.Mutex
+	shuttingDown      bool
+
+	registryTokenCache *registry.TokenCache
+	archiveCache       *archivecache.ArchiveCache
+
+	// stepLogsMaxSize is the default max size of the steps logs
+	stepLogsMaxSize int64
 }
 
 func NewExecutor(c *config.Executor) (*Executor, error) {
@@ -1333,6 +1557,7 @@ func NewExecutor(c *config.Executor) (*Executor, error) {
 		runningTasks: &runningTasks{
 			tasks: make(map[string]*runningTask),
 		},
+		registryTokenCache: registry.NewTokenCache(),
 	}
 
 	if err := os.MkdirAll(e.tasksDir(), 0770); err != nil {
@@ -1343,6 +1568,24 @@ func NewExecutor(c *config.Executor) (*Executor, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	var archiveCacheMaxSize int64
+	if c.ArchiveCache.MaxSize != "" {
+		archiveCacheMaxSize, err = units.RAMInBytes(c.ArchiveCache.MaxSize)
+		if err != nil {
+			return nil, errors.Errorf("wrong archive cache max size: %w", err)
+		}
+	}
+	e.archiveCache, err = archivecache.New(filepath.Join(c.DataDir, "archivecache"), archiveCacheMaxSize)
+	if err != nil {
+		return nil, errors.Errorf("failed to create archive cache: %w", err)
+	}
+	if c.StepLogs.MaxSize != "" {
+		e.stepLogsMaxSize, err = units.RAMInBytes(c.StepLogs.MaxSize)
+		if err != nil {
+			return nil, errors.Errorf("wrong step logs max size: %w", err)
+		}
+	}
 	if id == "" {
 		id = uuid.NewV4().String()
 		if err := e.saveExecutorID(id); err != nil {
@@ -1373,16 +1616,39 @@ func NewExecutor(c *config.Executor) (*Executor, error) {
 	var d driver.Driver
 	switch c.Driver.Type {
 	case config.DriverTypeDocker:
-		d, err = driver.NewDockerDriver(logger, e.id, "/tmp/agola/bin", e.c.ToolboxPath)
+		var maxDiskUsage int64
+		if c.Images.MaxDiskUsage != "" {
+			maxDiskUsage, err = units.RAMInBytes(c.Images.MaxDiskUsage)
+			if err != nil {
+				return nil, errors.Errorf("failed to parse images max disk usage: %w", err)
+			}
+		}
+		imagesConfig := &driver.DockerImagesConfig{
+			WarmImages:    c.Images.Prepull,
+			MaxDiskUsage:  maxDiskUsage,
+			CheckInterval: c.Images.CheckInterval,
+			UsageFile:     filepath.Join(c.DataDir, "docker-images-usage.json"),
+		}
+		d, err = driver.NewDockerDriver(logger, e.id, "/tmp/agola/bin", e.c.ToolboxPath, imagesConfig)
 		if err != nil {
 			return nil, errors.Errorf("failed to create docker driver: %w", err)
 		}
 	case config.DriverTypeK8s:
-		d, err = driver.NewK8sDriver(logger, e.id, c.ToolboxPath)
+		d, err = driver.NewK8sDriver(logger, e.id, c.ToolboxPath, k8sDriverConfig(&c.Driver.K8sPod))
 		if err != nil {
 			return nil, errors.Errorf("failed to create kubernetes driver: %w", err)
 		}
 		e.dynamic = true
+	case config.DriverTypeProcess:
+		d, err = driver.NewProcessDriver(logger, e.id, filepath.Join(c.DataDir, "pods"), c.ToolboxPath, c.Driver.User)
+		if err != nil {
+			return nil, errors.Errorf("failed to create process driver: %w", err)
+		}
+	case config.DriverTypeSandbox:
+		d, err = driver.NewSandboxDriver(logger, e.id, filepath.Join(c.DataDir, "sandbox"), c.ToolboxPath)
+		if err != nil {
+			return nil, errors.Errorf("failed to create sandbox driver: %w", err)
+		}
 	default:
 		return nil, errors.Errorf("unknown driver type %q", c.Driver.Type)
 	}
@@ -1392,7 +1658,12 @@ func NewExecutor(c *config.Executor) (*Executor, error) {
 }
 
 func (e *Executor) Run(ctx context.Context) error {
-	if err := e.driver.Setup(ctx); err != nil {
+	// the executor goroutines use their own context since they must continue
+	// working while gracefully shutting down after ctx is done
+	ectx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := e.driver.Setup(ectx); err != nil {
 		return err
 	}
 
@@ -1408,17 +1679,19 @@ func (e *Executor) Run(ctx context.Context) error {
 	apirouter.Handle("/executor/logs", logsHandler).Methods("GET")
 	apirouter.Handle("/executor/archives", archivesHandler).Methods("GET")
 
-	go e.executorStatusSenderLoop(ctx)
-	go e.executorTasksStatusSenderLoop(ctx)
-	go e.podsCleanerLoop(ctx)
-	go e.tasksUpdaterLoop(ctx)
-	go e.tasksDataCleanerLoop(ctx)
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
 
-	go e.handleTasks(ctx, ch)
+	go e.executorStatusSenderLoop(ectx)
+	go e.executorTasksStatusSenderLoop(ectx)
+	go e.podsCleanerLoop(ectx)
+	go e.tasksUpdaterLoop(ectx)
+	go e.tasksDataCleanerLoop(ectx)
+
+	go e.handleTasks(ectx, ch)
 
 	httpServer := http.Server{
 		Addr:    e.c.Web.ListenAddress,
-		Handler: apirouter,
+		Handler: router,
 	}
 	lerrCh := make(chan error)
 	go func() {
@@ -1428,6 +1701,9 @@ func (e *Executor) Run(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
 		log.Infof("runservice executor exiting")
+		// keep the http server running while shutting down since the
+		// runservice could fetch the logs and archives of the tasks
+		e.shutdown(ectx)
 		httpServer.Close()
 	case err := <-lerrCh:
 		if err != nil {
@@ -1438,3 +1714,148 @@ func (e *Executor) Run(ctx context.Context) error {
 
 	return nil
 }
+
+func (e *Executor) setShuttingDown() {
+	e.shuttingDownMutex.Lock()
+	defer e.shuttingDownMutex.Unlock()
+	e.shuttingDown = true
+}
+
+func (e *Executor) isShuttingDown() bool {
+	e.shuttingDownMutex.Lock()
+	defer e.shuttingDownMutex.Unlock()
+	return e.shuttingDown
+}
+
+// executingTasks returns the number of tasks currently executing
+func (e *Executor) executingTasks() int {
+	n := 0
+	for _, rtID := range e.runningTasks.ids() {
+		rt, ok := e.runningTasks.get(rtID)
+		if !ok {
+			continue
+		}
+		rt.Lock()
+		if rt.executing {
+			n++
+		}
+		rt.Unlock()
+	}
+	return n
+}
+
+// waitExecutingTasks waits for the executing tasks to finish until timeout.
+// It returns false if some tasks are still executing
+func (e *Executor) waitExecutingTasks(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		n := e.executingTasks()
+		if n == 0 {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		log.Infof("waiting for %d executing tasks to finish", n)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// stopExecutingTasks stops the pods of the executing tasks. Their steps will
+// fail and the tasks will be marked as failed
+func (e *Executor) stopExecutingTasks(ctx context.Context) {
+	for _, rtID := range e.runningTasks.ids() {
+		rt, ok := e.runningTasks.get(rtID)
+		if !ok {
+			continue
+		}
+		rt.Lock()
+		if rt.executing && rt.pod != nil {
+			log.Infof("stopping task %s", rt.et.ID)
+			if err := rt.pod.Stop(ctx); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+		}
+		rt.Unlock()
+	}
+}
+
+// shutdown gracefully terminates the executor: it reports itself as shutting
+// down so no new tasks will be assigned to it, waits for the executing tasks
+// to finish until the configured shutdown timeout, stops the remaining ones
+// and sends the final tasks status
+func (e *Executor) shutdown(ctx context.Context) {
+	log.Infof("shutting down executor")
+	e.setShuttingDown()
+	if err := e.sendExecutorStatus(ctx); err != nil {
+		log.Errorf("err: %+v", err)
+	}
+
+	if !e.waitExecutingTasks(e.c.ShutdownTimeout) {
+		log.Warnf("shutdown timeout reached, stopping executing tasks")
+		e.stopExecutingTasks(ctx)
+		if !e.waitExecutingTasks(stoppedTasksWaitTimeout) {
+			log.Warnf("some tasks are still executing")
+		}
+	}
+
+	e.sendExecutorTasksStatus(ctx)
+	if err := e.sendExecutorStatus(ctx); err != nil {
+		log.Errorf("err: %+v", err)
+	}
+	log.Infof("executor shut down")
+}
+
+func k8sDriverConfig(cp *config.K8sPod) *driver.K8sDriverConfig {
+	tolerations := make([]driver.K8sToleration, len(cp.Tolerations))
+	for i, t := range cp.Tolerations {
+		tolerations[i] = driver.K8sToleration{
+			Key:               t.Key,
+			Operator:          t.Operator,
+			Value:             t.Value,
+			Effect:            t.Effect,
+			TolerationSeconds: t.TolerationSeconds,
+		}
+	}
+	allowedTaskOverrides := make([]driver.K8sTaskOverride, len(cp.AllowedTaskOverrides))
+	for i, o := range cp.AllowedTaskOverrides {
+		allowedTaskOverrides[i] = driver.K8sTaskOverride(o)
+	}
+
+	return &driver.K8sDriverConfig{
+		Pod: driver.K8sPodConfig{
+			NodeSelector:       cp.NodeSelector,
+			Tolerations:        tolerations,
+			ServiceAccountName: cp.ServiceAccountName,
+			PriorityClassName:  cp.PriorityClassName,
+			Annotations:        cp.Annotations,
+			Labels:             cp.Labels,
+		},
+		Affinity:                     cp.Affinity,
+		AutomountServiceAccountToken: cp.AutomountServiceAccountToken,
+		ImagePullSecrets:             cp.ImagePullSecrets,
+		AllowedTaskOverrides:         allowedTaskOverrides,
+	}
+}
+
+func k8sPodConfig(rk *types.RuntimeK8s) *driver.K8sPodConfig {
+	tolerations := make([]driver.K8sToleration, len(rk.Tolerations))
+	for i, t := range rk.Tolerations {
+		tolerations[i] = driver.K8sToleration{
+			Key:               t.Key,
+			Operator:          t.Operator,
+			Value:             t.Value,
+			Effect:            t.Effect,
+			TolerationSeconds: t.TolerationSeconds,
+		}
+	}
+
+	return &driver.K8sPodConfig{
+		NodeSelector:       rk.NodeSelector,
+		Tolerations:        tolerations,
+		ServiceAccountName: rk.ServiceAccountName,
+		PriorityClassName:  rk.PriorityClassName,
+		Annotations:        rk.Annotations,
+		Labels:             rk.Labels,
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"testing"
+
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/services/executor/driver"
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTaskAnnotations(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  map[string]string
+	}{
+		{
+			name: "test empty file",
+			in:   "",
+			out:  map[string]string{},
+		},
+		{
+			name: "test failed tests",
+			in:   "failed_tests=3\n",
+			out:  map[string]string{"failed_tests": "3"},
+		},
+		{
+			name: "test last value wins and spaces are trimmed",
+			in:   "failed_tests=3\n  failed_tests = 5  \n",
+			out:  map[string]string{"failed_tests": "5"},
+		},
+		{
+			name: "test invalid and unknown annotations are ignored",
+			in:   "failed_tests=-1\nfailed_tests=abc\nunknown=1\ngarbage\n=2\n",
+			out:  map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := parseTaskAnnotations(tt.in)
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("annotations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMaxLogSize(t *testing.T) {
+	tests := []struct {
+		name            string
+		executorMaxSize int64
+		taskMaxSize     int64
+		out             int64
+	}{
+		{
+			name: "test unlimited",
+		},
+		{
+			name:            "test executor max size",
+			executorMaxSize: 100,
+			out:             100,
+		},
+		{
+			name:        "test task max size with unlimited executor",
+			taskMaxSize: 1000,
+			out:         1000,
+		},
+		{
+			name:            "test task max size lower than executor max size",
+			executorMaxSize: 100,
+			taskMaxSize:     10,
+			out:             10,
+		},
+		{
+			name:            "test task max size greater than executor max size",
+			executorMaxSize: 100,
+			taskMaxSize:     1000,
+			out:             100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executor{stepLogsMaxSize: tt.executorMaxSize}
+			out := e.maxLogSize(&types.ExecutorTask{MaxLogSize: tt.taskMaxSize})
+			if out != tt.out {
+				t.Fatalf("expected max log size %d, got %d", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestImagePullPolicy(t *testing.T) {
+	e := &Executor{c: &config.Executor{Images: config.ExecutorImages{Prepull: []string{"busybox", "golang:1.12"}}}}
+
+	tests := []struct {
+		name       string
+		container  *types.Container
+		out        driver.ImagePullPolicy
+		outWarning bool
+	}{
+		{
+			name:      "test default policy",
+			container: &types.Container{Image: "alpine"},
+			out:       driver.ImagePullPolicyAlways,
+		},
+		{
+			name:      "test always policy",
+			container: &types.Container{Image: "busybox", ImagePullPolicy: types.ImagePullPolicyAlways},
+			out:       driver.ImagePullPolicyAlways,
+		},
+		{
+			name:      "test if not present policy with prepull image",
+			container: &types.Container{Image: "golang:1.12", ImagePullPolicy: types.ImagePullPolicyIfNotPresent},
+			out:       driver.ImagePullPolicyIfNotPresent,
+		},
+		{
+			name:      "test never policy with prepull image",
+			container: &types.Container{Image: "busybox", ImagePullPolicy: types.ImagePullPolicyNever},
+			out:       driver.ImagePullPolicyNever,
+		},
+		{
+			name:       "test if not present policy with non prepull image",
+			container:  &types.Container{Image: "golang:1.13", ImagePullPolicy: types.ImagePullPolicyIfNotPresent},
+			out:        driver.ImagePullPolicyAlways,
+			outWarning: true,
+		},
+		{
+			name:       "test never policy with non prepull image",
+			container:  &types.Container{Image: "registry.example.com/private", ImagePullPolicy: types.ImagePullPolicyNever},
+			out:        driver.ImagePullPolicyAlways,
+			outWarning: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			out := e.imagePullPolicy(tt.container, &buf)
+			if out != tt.out {
+				t.Fatalf("expected image pull policy %q, got %q", tt.out, out)
+			}
+			if tt.outWarning != (buf.Len() > 0) {
+				t.Fatalf("unexpected output: %q", buf.String())
+			}
+		})
+	}
+}
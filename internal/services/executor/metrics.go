@@ -0,0 +1,39 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	activeTasksGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "agola_executor_active_tasks",
+			Help: "Number of tasks currently executed by the executor",
+		},
+	)
+	activeTasksLimitGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "agola_executor_active_tasks_limit",
+			Help: "Max number of tasks that the executor can execute concurrently",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(activeTasksGauge)
+	prometheus.MustRegister(activeTasksLimitGauge)
+}
@@ -0,0 +1,198 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	ecrService   = "ecr"
+	ecrTarget    = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+	ecrAmzFormat = "20060102T150405Z"
+)
+
+// ecrRegistryRegexp matches the ecr registry names and extracts the registry
+// (account) id, the region and the optional china partition suffix
+var ecrRegistryRegexp = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// ecrEndpointHostRegexp matches the ecr api endpoints hosts, including the
+// fips and vpc interface endpoints. Other endpoints aren't allowed since they
+// would receive the signed request
+var ecrEndpointHostRegexp = regexp.MustCompile(`^(?:[a-z0-9-]+\.)?api\.ecr(?:-fips)?\.[a-z0-9-]+(?:\.vpce)?\.amazonaws\.com(?:\.cn)?$`)
+
+type ecrAuthorizationData struct {
+	AuthorizationToken string  `json:"authorizationToken"`
+	ExpiresAt          float64 `json:"expiresAt"`
+	ProxyEndpoint      string  `json:"proxyEndpoint"`
+}
+
+type ecrGetAuthorizationTokenResponse struct {
+	AuthorizationData []ecrAuthorizationData `json:"authorizationData"`
+}
+
+// ecrAuth exchanges the aws access key for an ecr registry token calling the
+// GetAuthorizationToken api. The returned token is a base64 encoded
+// "user:password" pair usable as a registry basic auth.
+func ecrAuth(ctx context.Context, client *http.Client, auth types.DockerRegistryAuth, regname string) (*DockerConfigAuth, time.Time, error) {
+	region := auth.Region
+	var registryIDs []string
+	endpointSuffix := ""
+	if m := ecrRegistryRegexp.FindStringSubmatch(regname); m != nil {
+		registryIDs = []string{m[1]}
+		if region == "" {
+			region = m[2]
+		}
+		endpointSuffix = m[3]
+	}
+	if region == "" {
+		return nil, time.Time{}, errors.Errorf("cannot determine ecr region for registry %q", regname)
+	}
+
+	endpoint := auth.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://api.ecr.%s.amazonaws.com%s/", region, endpointSuffix)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, time.Time{}, errors.Errorf("wrong ecr endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "https" || (u.Port() != "" && u.Port() != "443") || !ecrEndpointHostRegexp.MatchString(u.Hostname()) {
+		return nil, time.Time{}, errors.Errorf("ecr endpoint %q isn't an aws ecr api endpoint", endpoint)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	body, err := json.Marshal(struct {
+		RegistryIDs []string `json:"registryIds,omitempty"`
+	}{RegistryIDs: registryIDs})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecrTarget)
+	signAWSv4(req, body, auth.AccessKeyID, auth.SecretAccessKey, region, ecrService, time.Now())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, errors.Errorf("ecr token request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var tr ecrGetAuthorizationTokenResponse
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, time.Time{}, errors.Errorf("failed to decode ecr token response: %w", err)
+	}
+	if len(tr.AuthorizationData) == 0 {
+		return nil, time.Time{}, errors.Errorf("empty ecr authorization data")
+	}
+	ad := tr.AuthorizationData[0]
+
+	decoded, err := base64.StdEncoding.DecodeString(ad.AuthorizationToken)
+	if err != nil {
+		return nil, time.Time{}, errors.Errorf("failed to decode ecr authorization token: %w", err)
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return nil, time.Time{}, errors.Errorf("wrong ecr authorization token")
+	}
+
+	expiresAt := time.Unix(int64(ad.ExpiresAt), 0)
+	return &DockerConfigAuth{Username: parts[0], Password: parts[1], Auth: ad.AuthorizationToken}, expiresAt, nil
+}
+
+// signAWSv4 signs the request using the aws signature version 4
+func signAWSv4(req *http.Request, body []byte, accessKeyID, secretAccessKey, region, service string, t time.Time) {
+	amzDate := t.UTC().Format(ecrAmzFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		sha256Hex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
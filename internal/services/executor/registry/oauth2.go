@@ -0,0 +1,185 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	errors "golang.org/x/xerrors"
+)
+
+// defaultTokenExpiration is the token expiration when the token service
+// doesn't provide it (see https://docs.docker.com/registry/spec/auth/token/)
+const defaultTokenExpiration = 60 * time.Second
+
+type oauth2TokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// oauth2Auth exchanges the client credentials for a registry bearer token. The
+// token service is discovered from the registry WWW-Authenticate challenge and
+// the token is requested for pulling the provided repositories.
+func oauth2Auth(ctx context.Context, client *http.Client, auth types.DockerRegistryAuth, regname string, repositories []string) (*DockerConfigAuth, time.Time, error) {
+	reg, err := name.NewRegistry(regname, name.WeakValidation)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s://%s/v2/", reg.Scheme(), reg.RegistryStr()), nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, time.Time{}, errors.Errorf("registry %q didn't request authentication (status %d)", regname, resp.StatusCode)
+	}
+	scheme, params := parseAuthChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !strings.EqualFold(scheme, "bearer") {
+		return nil, time.Time{}, errors.Errorf("registry %q doesn't support bearer tokens", regname)
+	}
+	realm := params["realm"]
+	if realm == "" {
+		return nil, time.Time{}, errors.Errorf("registry %q auth challenge without realm", regname)
+	}
+
+	scopes := make([]string, len(repositories))
+	for i, repo := range repositories {
+		scopes[i] = fmt.Sprintf("repository:%s:pull", repo)
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {auth.ClientID},
+		"client_secret": {auth.ClientSecret},
+	}
+	if service := params["service"]; service != "" {
+		form.Set("service", service)
+	}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+
+	req, err = http.NewRequest("POST", realm, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, errors.Errorf("oauth2 token request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var tr oauth2TokenResponse
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, time.Time{}, errors.Errorf("failed to decode oauth2 token response: %w", err)
+	}
+	// some token services only provide one of token or access_token
+	token := tr.AccessToken
+	if token == "" {
+		token = tr.Token
+	}
+	if token == "" {
+		return nil, time.Time{}, errors.Errorf("no token in oauth2 token response")
+	}
+	expiration := defaultTokenExpiration
+	if tr.ExpiresIn > 0 {
+		expiration = time.Duration(tr.ExpiresIn) * time.Second
+	}
+
+	return &DockerConfigAuth{RegistryToken: token}, time.Now().Add(expiration), nil
+}
+
+// parseAuthChallenge parses a WWW-Authenticate header value like
+// `Bearer realm="https://auth.example.com/token",service="registry"`
+// returning the auth scheme and its parameters
+func parseAuthChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+	header = strings.TrimSpace(header)
+	parts := strings.SplitN(header, " ", 2)
+	scheme := parts[0]
+	if len(parts) < 2 {
+		return scheme, params
+	}
+
+	s := parts[1]
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+		i := strings.Index(s, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			// quoted value, handle escaped chars
+			var b strings.Builder
+			j := 1
+			for ; j < len(s); j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+					b.WriteByte(s[j])
+					continue
+				}
+				if s[j] == '"' {
+					break
+				}
+				b.WriteByte(s[j])
+			}
+			value = b.String()
+			if j < len(s) {
+				j++
+			}
+			s = s[j:]
+		} else {
+			j := strings.Index(s, ",")
+			if j < 0 {
+				j = len(s)
+			}
+			value = strings.TrimSpace(s[:j])
+			s = s[j:]
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
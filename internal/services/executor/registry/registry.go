@@ -15,11 +15,16 @@
 package registry
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
 	errors "golang.org/x/xerrors"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -57,8 +62,14 @@ type DockerConfigAuth struct {
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
 	Auth     string `json:"auth,omitempty"`
+
+	// RegistryToken is a bearer token sent directly to the registry
+	RegistryToken string `json:"registrytoken,omitempty"`
 }
 
+// tokenClient is the http client used for the registry token exchanges
+var tokenClient = &http.Client{Timeout: 30 * time.Second}
+
 // There are a variety of ways a domain may get qualified within the Docker credential file.
 // We enumerate them here as format strings.
 var (
@@ -85,8 +96,12 @@ func GetRegistry(image string) (string, error) {
 	return regName, nil
 }
 
-// ResolveAuth resolves the auth username and password for the provided registry name
-func ResolveAuth(auths map[string]types.DockerRegistryAuth, regname string) (string, string, error) {
+// ResolveAuth resolves the auth for the provided registry name. repositories
+// are the registry repositories the auth will be used for since token exchange
+// auths could issue repository scoped tokens. Token exchange auths are cached
+// in tokenCache (if not nil) until they're near expiration.
+// It returns nil if there's no auth defined for the registry.
+func ResolveAuth(ctx context.Context, auths map[string]types.DockerRegistryAuth, regname string, repositories []string, tokenCache *TokenCache) (*DockerConfigAuth, error) {
 	if auths != nil {
 		for _, form := range domainForms {
 			if auth, ok := auths[fmt.Sprintf(form, regname)]; ok {
@@ -94,45 +109,89 @@ func ResolveAuth(auths map[string]types.DockerRegistryAuth, regname string) (str
 				case types.DockerRegistryAuthTypeEncodedAuth:
 					decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
 					if err != nil {
-						return "", "", errors.Errorf("failed to decode docker auth: %w", err)
+						return nil, errors.Errorf("failed to decode docker auth: %w", err)
 					}
 					parts := strings.Split(string(decoded), ":")
 					if len(parts) != 2 {
-						return "", "", errors.Errorf("wrong docker auth: %w", err)
+						return nil, errors.Errorf("wrong docker auth: %w", err)
 					}
-					return parts[0], parts[1], nil
+					return basicDockerConfigAuth(parts[0], parts[1]), nil
 				case types.DockerRegistryAuthTypeBasic:
-					return auth.Username, auth.Password, nil
+					return basicDockerConfigAuth(auth.Username, auth.Password), nil
+				case types.DockerRegistryAuthTypeECR:
+					key := tokenCacheKey(string(auth.Type), regname, auth.Region, auth.Endpoint, auth.AccessKeyID, auth.SecretAccessKey)
+					return exchangeToken(tokenCache, key, func() (*DockerConfigAuth, time.Time, error) {
+						return ecrAuth(ctx, tokenClient, auth, regname)
+					})
+				case types.DockerRegistryAuthTypeOAuth2:
+					repos := append([]string{}, repositories...)
+					sort.Strings(repos)
+					key := tokenCacheKey(string(auth.Type), regname, strings.Join(repos, ","), auth.ClientID, auth.ClientSecret)
+					return exchangeToken(tokenCache, key, func() (*DockerConfigAuth, time.Time, error) {
+						return oauth2Auth(ctx, tokenClient, auth, regname, repos)
+					})
 				default:
-					return "", "", fmt.Errorf("unsupported auth type %q", auth.Type)
+					return nil, fmt.Errorf("unsupported auth type %q", auth.Type)
 				}
 			}
 		}
 	}
 
-	return "", "", nil
+	return nil, nil
 }
 
-func GenDockerConfig(auths map[string]types.DockerRegistryAuth, images []string) (*DockerConfig, error) {
-	dockerConfig := &DockerConfig{Auths: make(map[string]DockerConfigAuth)}
+func basicDockerConfigAuth(username, password string) *DockerConfigAuth {
+	delimited := fmt.Sprintf("%s:%s", username, password)
+	auth := base64.StdEncoding.EncodeToString([]byte(delimited))
+	return &DockerConfigAuth{Username: username, Password: password, Auth: auth}
+}
+
+// exchangeToken returns the cached auth for key or executes the token exchange
+// caching its result
+func exchangeToken(tokenCache *TokenCache, key string, exchange func() (*DockerConfigAuth, time.Time, error)) (*DockerConfigAuth, error) {
+	if auth, ok := tokenCache.get(key); ok {
+		return &auth, nil
+	}
+	auth, expiresAt, err := exchange()
+	if err != nil {
+		return nil, errors.Errorf("token exchange failed: %w", err)
+	}
+	tokenCache.set(key, *auth, expiresAt)
+	return auth, nil
+}
+
+// GenDockerConfig generates the docker config containing the auths for the
+// registries of the provided images
+func GenDockerConfig(ctx context.Context, auths map[string]types.DockerRegistryAuth, images []string, tokenCache *TokenCache) (*DockerConfig, error) {
+	// group the images repositories by registry
+	regNames := []string{}
+	regRepositories := map[string][]string{}
 	for _, image := range images {
 		ref, err := name.ParseReference(image, name.WeakValidation)
 		if err != nil {
 			return nil, err
 		}
 		regName := ref.Context().RegistryStr()
+		repo := ref.Context().RepositoryStr()
 
-		if _, ok := dockerConfig.Auths[regName]; ok {
-			continue
+		if _, ok := regRepositories[regName]; !ok {
+			regNames = append(regNames, regName)
+		}
+		if !util.StringInSlice(regRepositories[regName], repo) {
+			regRepositories[regName] = append(regRepositories[regName], repo)
 		}
+	}
 
-		username, password, err := ResolveAuth(auths, regName)
+	dockerConfig := &DockerConfig{Auths: make(map[string]DockerConfigAuth)}
+	for _, regName := range regNames {
+		auth, err := ResolveAuth(ctx, auths, regName, regRepositories[regName], tokenCache)
 		if err != nil {
 			return nil, errors.Errorf("failed to resolve auth: %w", err)
 		}
-		delimited := fmt.Sprintf("%s:%s", username, password)
-		auth := base64.StdEncoding.EncodeToString([]byte(delimited))
-		dockerConfig.Auths[regName] = DockerConfigAuth{Username: username, Password: password, Auth: auth}
+		if auth == nil {
+			auth = basicDockerConfigAuth("", "")
+		}
+		dockerConfig.Auths[regName] = *auth
 	}
 
 	return dockerConfig, nil
@@ -0,0 +1,191 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenDockerConfigBasic(t *testing.T) {
+	auths := map[string]types.DockerRegistryAuth{
+		"index.docker.io": {Type: types.DockerRegistryAuthTypeBasic, Username: "user01", Password: "password01"},
+		"https://registry.example.com/v2/": {
+			Type: types.DockerRegistryAuthTypeEncodedAuth,
+			Auth: base64.StdEncoding.EncodeToString([]byte("user02:password02")),
+		},
+	}
+
+	dockerConfig, err := GenDockerConfig(context.Background(), auths, []string{"busybox", "registry.example.com/org/image:1.0", "quay.io/org/image"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expected := &DockerConfig{
+		Auths: map[string]DockerConfigAuth{
+			"index.docker.io":      {Username: "user01", Password: "password01", Auth: base64.StdEncoding.EncodeToString([]byte("user01:password01"))},
+			"registry.example.com": {Username: "user02", Password: "password02", Auth: base64.StdEncoding.EncodeToString([]byte("user02:password02"))},
+			"quay.io":              {Auth: base64.StdEncoding.EncodeToString([]byte(":"))},
+		},
+	}
+	if diff := cmp.Diff(expected, dockerConfig); diff != "" {
+		t.Fatalf("docker config mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResolveAuthECR(t *testing.T) {
+	var requests int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("X-Amz-Target") != ecrTarget {
+			http.Error(w, "wrong target", http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID01/") || !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/ecr/aws4_request") {
+			http.Error(w, "wrong authorization", http.StatusForbidden)
+			return
+		}
+		var req struct {
+			RegistryIDs []string `json:"registryIds"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.RegistryIDs) != 1 || req.RegistryIDs[0] != "123456789012" {
+			http.Error(w, "wrong registry ids", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d}]}`, base64.StdEncoding.EncodeToString([]byte("AWS:secrettoken")), time.Now().Add(12*time.Hour).Unix())
+	}))
+	defer ts.Close()
+
+	// send the requests to the aws endpoints to the test server
+	client := ts.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+	}
+	origTokenClient := tokenClient
+	tokenClient = client
+	defer func() { tokenClient = origTokenClient }()
+
+	regname := "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	auths := map[string]types.DockerRegistryAuth{
+		regname: {Type: types.DockerRegistryAuthTypeECR, AccessKeyID: "AKID01", SecretAccessKey: "secret01"},
+	}
+
+	tokenCache := NewTokenCache()
+	for i := 0; i < 2; i++ {
+		auth, err := ResolveAuth(context.Background(), auths, regname, []string{"image"}, tokenCache)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if auth.Username != "AWS" || auth.Password != "secrettoken" {
+			t.Fatalf("unexpected auth: %#v", auth)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected 1 token request, got %d", n)
+	}
+
+	// the endpoint override must be an aws ecr api endpoint
+	for _, endpoint := range []string{
+		"https://vpce-0123456789abcdef0-abcdefgh.api.ecr.eu-west-1.vpce.amazonaws.com",
+		"https://api.ecr-fips.us-east-1.amazonaws.com/",
+	} {
+		auths[regname] = types.DockerRegistryAuth{Type: types.DockerRegistryAuthTypeECR, AccessKeyID: "AKID01", SecretAccessKey: "secret01", Endpoint: endpoint}
+		if _, err := ResolveAuth(context.Background(), auths, regname, []string{"image"}, nil); err != nil {
+			t.Fatalf("unexpected err with endpoint %q: %v", endpoint, err)
+		}
+	}
+	for _, endpoint := range []string{
+		"http://api.ecr.eu-west-1.amazonaws.com",
+		"https://api.ecr.eu-west-1.amazonaws.com:8443",
+		"https://api.ecr.eu-west-1.amazonaws.com.example.com",
+		"https://169.254.169.254/",
+		"https://internal.example.com",
+	} {
+		auths[regname] = types.DockerRegistryAuth{Type: types.DockerRegistryAuthTypeECR, AccessKeyID: "AKID01", SecretAccessKey: "secret01", Endpoint: endpoint}
+		if _, err := ResolveAuth(context.Background(), auths, regname, []string{"image"}, nil); err == nil {
+			t.Fatalf("expected error with endpoint %q", endpoint)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("expected 3 token requests, got %d", n)
+	}
+}
+
+func TestTokenCacheExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		cached   bool
+	}{
+		{
+			name:     "test long lived token",
+			lifetime: 12 * time.Hour,
+			cached:   true,
+		},
+		{
+			name:     "test token with the default oauth2 expiration",
+			lifetime: defaultTokenExpiration,
+			cached:   true,
+		},
+		{
+			name:     "test token near expiration",
+			lifetime: 2 * time.Second,
+			cached:   true,
+		},
+		{
+			name:     "test expired token",
+			lifetime: -time.Second,
+			cached:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewTokenCache()
+			c.set("key01", DockerConfigAuth{RegistryToken: "token01"}, time.Now().Add(tt.lifetime))
+			if _, ok := c.get("key01"); ok != tt.cached {
+				t.Fatalf("expected cached %t, got %t", tt.cached, ok)
+			}
+		})
+	}
+
+	// the expiry margin is a fraction of the token lifetime, at most
+	// maxTokenExpiryMargin
+	c := NewTokenCache()
+	now := time.Now()
+	c.set("key01", DockerConfigAuth{}, now.Add(12*time.Hour))
+	if margin := c.auths["key01"].expiresAt.Sub(c.auths["key01"].refreshAt); margin != maxTokenExpiryMargin {
+		t.Fatalf("expected margin %s, got %s", maxTokenExpiryMargin, margin)
+	}
+	c.set("key02", DockerConfigAuth{}, now.Add(defaultTokenExpiration))
+	if margin := c.auths["key02"].expiresAt.Sub(c.auths["key02"].refreshAt); margin <= 0 || margin > defaultTokenExpiration/tokenExpiryMarginDivisor {
+		t.Fatalf("expected margin in (0, %s], got %s", defaultTokenExpiration/tokenExpiryMarginDivisor, margin)
+	}
+}
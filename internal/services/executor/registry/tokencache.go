@@ -0,0 +1,102 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTokenExpiryMargin is the max time before the token expiration after
+	// which a cached token isn't used anymore, so the token won't expire while
+	// pulling an image
+	maxTokenExpiryMargin = 1 * time.Minute
+	// tokenExpiryMarginDivisor defines the expiry margin as a fraction of the
+	// token lifetime so short lived tokens are cached too
+	tokenExpiryMarginDivisor = 4
+)
+
+type cachedAuth struct {
+	auth      DockerConfigAuth
+	expiresAt time.Time
+	// refreshAt is the time after which the token isn't used anymore
+	refreshAt time.Time
+}
+
+// TokenCache caches the short lived registry auths obtained from token
+// exchanges. It's safe for concurrent use.
+type TokenCache struct {
+	auths map[string]*cachedAuth
+	mu    sync.Mutex
+}
+
+func NewTokenCache() *TokenCache {
+	return &TokenCache{
+		auths: make(map[string]*cachedAuth),
+	}
+}
+
+// tokenCacheKey generates a cache key from all the values that define the
+// token. The credentials are hashed to avoid keeping them in clear as map keys.
+func tokenCacheKey(values ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(values, "\x00")))
+	return hex.EncodeToString(h[:])
+}
+
+func (c *TokenCache) get(key string) (DockerConfigAuth, bool) {
+	if c == nil {
+		return DockerConfigAuth{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ca, ok := c.auths[key]
+	if !ok {
+		return DockerConfigAuth{}, false
+	}
+	if time.Now().After(ca.refreshAt) {
+		delete(c.auths, key)
+		return DockerConfigAuth{}, false
+	}
+	return ca.auth, true
+}
+
+func (c *TokenCache) set(key string, auth DockerConfigAuth, expiresAt time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// remove expired entries
+	now := time.Now()
+	for k, ca := range c.auths {
+		if now.After(ca.expiresAt) {
+			delete(c.auths, k)
+		}
+	}
+	margin := expiresAt.Sub(now) / tokenExpiryMarginDivisor
+	if margin > maxTokenExpiryMargin {
+		margin = maxTokenExpiryMargin
+	}
+	if margin < 0 {
+		margin = 0
+	}
+	c.auths[key] = &cachedAuth{auth: auth, expiresAt: expiresAt, refreshAt: expiresAt.Add(-margin)}
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"agola.io/agola/internal/steplog"
+
+	units "github.com/docker/go-units"
+)
+
+// stepLog is the writer of a task step log. Every write is saved as a
+// timestamped log entry. When maxSize is greater than 0 it stops writing when
+// the framed log (entries headers included) would exceed maxSize bytes and
+// appends a truncation marker. The discarded writes are reported as
+// successful to not break the step command output streaming.
+type stepLog struct {
+	f       *os.File
+	w       *steplog.Writer
+	maxSize int64
+
+	mu sync.Mutex
+	// size is the framed log size
+	size      int64
+	truncated bool
+}
+
+func newStepLog(logPath string, maxSize int64) (*stepLog, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(logPath)
+	if err != nil {
+		return nil, err
+	}
+	w, err := steplog.NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &stepLog{f: f, w: w, maxSize: maxSize, size: int64(len(steplog.Header))}, nil
+}
+
+func (l *stepLog) Write(p []byte) (int, error) {
+	return l.write("", p)
+}
+
+// Stream returns a writer that saves the log entries with the provided
+// stream. It should be used only for commands executed without a tty
+func (l *stepLog) Stream(stream string) io.Writer {
+	return &stepLogStream{l: l, stream: stream}
+}
+
+func (l *stepLog) write(stream string, p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.truncated {
+		return len(p), nil
+	}
+	now := time.Now()
+	entrySize := func(n int) int64 {
+		return int64(steplog.EntrySize(now, stream, p[:n]))
+	}
+	if l.maxSize <= 0 || l.size+entrySize(len(p)) <= l.maxSize {
+		if err := l.w.WriteEntry(now, stream, p); err != nil {
+			return 0, err
+		}
+		l.size += entrySize(len(p))
+		return len(p), nil
+	}
+
+	// write the longest part of p that fits in the remaining size
+	n := sort.Search(len(p), func(i int) bool { return l.size+entrySize(i+1) > l.maxSize })
+	if err := l.w.WriteEntry(now, stream, p[:n]); err != nil {
+		return 0, err
+	}
+	l.size += entrySize(n)
+	l.truncated = true
+	marker := fmt.Sprintf("\n[log truncated: exceeded the max log size of %s]\n", units.BytesSize(float64(l.maxSize)))
+	if err := l.w.WriteEntry(now, "", []byte(marker)); err != nil {
+		return n, err
+	}
+	return len(p), nil
+}
+
+func (l *stepLog) WriteString(s string) (int, error) {
+	return l.Write([]byte(s))
+}
+
+// Truncated reports if the log has been truncated
+func (l *stepLog) Truncated() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.truncated
+}
+
+func (l *stepLog) Close() error {
+	return l.f.Close()
+}
+
+type stepLogStream struct {
+	l      *stepLog
+	stream string
+}
+
+func (s *stepLogStream) Write(p []byte) (int, error) {
+	return s.l.write(s.stream, p)
+}
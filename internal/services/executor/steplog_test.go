@@ -0,0 +1,142 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/steplog"
+
+	units "github.com/docker/go-units"
+)
+
+func TestStepLog(t *testing.T) {
+	// the max size must account for the framed log header and the entries
+	// headers
+	headerSize := int64(len(steplog.Header))
+	entrySize := func(s string) int64 {
+		return int64(steplog.EntrySize(time.Now(), steplog.StreamStdout, []byte(s)))
+	}
+
+	tests := []struct {
+		name         string
+		maxSize      int64
+		writes       []string
+		out          string
+		outTruncated bool
+	}{
+		{
+			name:    "test unlimited log",
+			maxSize: 0,
+			writes:  []string{"line01\n", "line02\n", "line03\n"},
+			out:     "line01\nline02\nline03\n",
+		},
+		{
+			name:    "test log under max size",
+			maxSize: headerSize + entrySize("line\nline") + 10,
+			writes:  []string{"line\n", "line"},
+			out:     "line\nline",
+		},
+		{
+			name:    "test log of exactly max size",
+			maxSize: headerSize + entrySize("line01\nabc"),
+			writes:  []string{"line01\n", "abc"},
+			out:     "line01\nabc",
+		},
+		{
+			name:         "test single write exceeding max size",
+			maxSize:      headerSize + entrySize("line01\nlin"),
+			writes:       []string{"line01\nline02\n"},
+			out:          "line01\nlin",
+			outTruncated: true,
+		},
+		{
+			name:         "test write exceeding max size",
+			maxSize:      headerSize + entrySize("line01\nlin"),
+			writes:       []string{"line01\n", "line02\n"},
+			out:          "line01\nlin",
+			outTruncated: true,
+		},
+		{
+			name:         "test writes after truncation are discarded",
+			maxSize:      headerSize + entrySize("line01\nlin"),
+			writes:       []string{"line01\n", "line02\n", "line03\n"},
+			out:          "line01\nlin",
+			outTruncated: true,
+		},
+		{
+			name:         "test max size lower than an entry header",
+			maxSize:      headerSize + 5,
+			writes:       []string{"line01\n"},
+			out:          "",
+			outTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "agola")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			logPath := filepath.Join(dir, "step.log")
+			l, err := newStepLog(logPath, tt.maxSize)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			for _, w := range tt.writes {
+				n, err := l.Stream(steplog.StreamStdout).Write([]byte(w))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				// discarded writes must be reported as successful
+				if n != len(w) {
+					t.Fatalf("expected %d bytes written, got %d", len(w), n)
+				}
+			}
+			if err := l.Close(); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if l.Truncated() != tt.outTruncated {
+				t.Fatalf("expected truncated %t, got %t", tt.outTruncated, l.Truncated())
+			}
+
+			f, err := os.Open(logPath)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer f.Close()
+			out, err := ioutil.ReadAll(steplog.NewTextReader(f))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			expectedOut := tt.out
+			if tt.outTruncated {
+				expectedOut += fmt.Sprintf("\n[log truncated: exceeded the max log size of %s]\n", units.BytesSize(float64(tt.maxSize)))
+			}
+			if string(out) != expectedOut {
+				t.Fatalf("expected log %q, got %q", expectedOut, out)
+			}
+		})
+	}
+}
@@ -19,34 +19,47 @@ import (
 
 	"agola.io/agola/internal/services/common"
 	csapi "agola.io/agola/internal/services/configstore/api"
+	nsapi "agola.io/agola/internal/services/notification/api"
 	rsapi "agola.io/agola/internal/services/runservice/api"
 	"agola.io/agola/internal/util"
 
 	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
 )
 
 type ActionHandler struct {
-	log               *zap.SugaredLogger
-	sd                *common.TokenSigningData
-	configstoreClient *csapi.Client
-	runserviceClient  *rsapi.Client
-	agolaID           string
-	apiExposedURL     string
-	webExposedURL     string
+	log                *zap.SugaredLogger
+	sd                 *common.TokenSigningData
+	configstoreClient  *csapi.Client
+	runserviceClient   *rsapi.Client
+	notificationClient *nsapi.Client
+	agolaID            string
+	apiExposedURL      string
+	webExposedURL      string
 }
 
-func NewActionHandler(logger *zap.Logger, sd *common.TokenSigningData, configstoreClient *csapi.Client, runserviceClient *rsapi.Client, agolaID, apiExposedURL, webExposedURL string) *ActionHandler {
+func NewActionHandler(logger *zap.Logger, sd *common.TokenSigningData, configstoreClient *csapi.Client, runserviceClient *rsapi.Client, notificationClient *nsapi.Client, agolaID, apiExposedURL, webExposedURL string) *ActionHandler {
 	return &ActionHandler{
-		log:               logger.Sugar(),
-		sd:                sd,
-		configstoreClient: configstoreClient,
-		runserviceClient:  runserviceClient,
-		agolaID:           agolaID,
-		apiExposedURL:     apiExposedURL,
-		webExposedURL:     webExposedURL,
+		log:                logger.Sugar(),
+		sd:                 sd,
+		configstoreClient:  configstoreClient,
+		runserviceClient:   runserviceClient,
+		notificationClient: notificationClient,
+		agolaID:            agolaID,
+		apiExposedURL:      apiExposedURL,
+		webExposedURL:      webExposedURL,
 	}
 }
 
+// checkNotificationService returns an error if the gateway isn't configured
+// with the notification service url
+func (h *ActionHandler) checkNotificationService() error {
+	if h.notificationClient == nil {
+		return util.NewErrBadRequest(errors.Errorf("notification service not configured"))
+	}
+	return nil
+}
+
 func ErrFromRemote(resp *http.Response, err error) error {
 	if err == nil {
 		return nil
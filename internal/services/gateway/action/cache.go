@@ -0,0 +1,92 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"strings"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// projectCacheKeyPrefix returns the prefix of the project caches keys. The
+// executor prefixes the cache keys with the cache prefix (the project id) and
+// a dash.
+func (h *ActionHandler) projectCacheKeyPrefix(ctx context.Context, projectRef string) (string, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return "", errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return "", errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return "", util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	return p.ID + "-", nil
+}
+
+// GetProjectCaches returns the project caches. The returned keys are the user
+// defined keys without the project cache prefix
+func (h *ActionHandler) GetProjectCaches(ctx context.Context, projectRef string) ([]*rstypes.Cache, error) {
+	keyPrefix, err := h.projectCacheKeyPrefix(ctx, projectRef)
+	if err != nil {
+		return nil, err
+	}
+
+	caches, resp, err := h.runserviceClient.GetCaches(ctx, keyPrefix)
+	if err != nil {
+		return nil, errors.Errorf("failed to get caches: %w", ErrFromRemote(resp, err))
+	}
+	for _, c := range caches {
+		c.Key = strings.TrimPrefix(c.Key, keyPrefix)
+	}
+
+	return caches, nil
+}
+
+func (h *ActionHandler) DeleteProjectCache(ctx context.Context, projectRef, key string) error {
+	keyPrefix, err := h.projectCacheKeyPrefix(ctx, projectRef)
+	if err != nil {
+		return err
+	}
+
+	h.log.Infof("deleting project %q cache %q", projectRef, key)
+	resp, err := h.runserviceClient.DeleteCache(ctx, keyPrefix+key)
+	if err != nil {
+		return errors.Errorf("failed to delete cache: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
+
+func (h *ActionHandler) DeleteProjectCaches(ctx context.Context, projectRef string) error {
+	keyPrefix, err := h.projectCacheKeyPrefix(ctx, projectRef)
+	if err != nil {
+		return err
+	}
+
+	h.log.Infof("deleting project %q caches", projectRef)
+	resp, err := h.runserviceClient.DeleteCaches(ctx, keyPrefix)
+	if err != nil {
+		return errors.Errorf("failed to delete caches: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) checkChatNotificationOwner(ctx context.Context, projectRef string) error {
+	isVariableOwner, err := h.IsVariableOwner(ctx, types.ConfigTypeProject, projectRef)
+	if err != nil {
+		return errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+	return nil
+}
+
+func (h *ActionHandler) GetProjectChatNotifications(ctx context.Context, projectRef string) ([]*csapi.ChatNotification, error) {
+	if err := h.checkChatNotificationOwner(ctx, projectRef); err != nil {
+		return nil, err
+	}
+
+	cschatnotifications, resp, err := h.configstoreClient.GetProjectChatNotifications(ctx, projectRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return cschatnotifications, nil
+}
+
+type CreateChatNotificationRequest struct {
+	Name string
+
+	ProjectRef string
+
+	Type       types.ChatNotificationType
+	SecretName string
+	SecretKey  string
+	Channel    string
+	Events     []types.ChatNotificationEvent
+}
+
+func (h *ActionHandler) CreateProjectChatNotification(ctx context.Context, req *CreateChatNotificationRequest) (*csapi.ChatNotification, error) {
+	if err := h.checkChatNotificationOwner(ctx, req.ProjectRef); err != nil {
+		return nil, err
+	}
+
+	if !util.ValidateName(req.Name) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid chat notification name %q", req.Name))
+	}
+
+	cn := &types.ChatNotification{
+		Name:       req.Name,
+		Type:       req.Type,
+		SecretName: req.SecretName,
+		SecretKey:  req.SecretKey,
+		Channel:    req.Channel,
+		Events:     req.Events,
+	}
+
+	h.log.Infof("creating project chat notification")
+	rcn, resp, err := h.configstoreClient.CreateProjectChatNotification(ctx, req.ProjectRef, cn)
+	if err != nil {
+		return nil, errors.Errorf("failed to create chat notification: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("chat notification %s created, ID: %s", rcn.Name, rcn.ID)
+
+	return rcn, nil
+}
+
+type UpdateChatNotificationRequest struct {
+	ChatNotificationName string
+
+	Name string
+
+	ProjectRef string
+
+	Type       types.ChatNotificationType
+	SecretName string
+	SecretKey  string
+	Channel    string
+	Events     []types.ChatNotificationEvent
+}
+
+func (h *ActionHandler) UpdateProjectChatNotification(ctx context.Context, req *UpdateChatNotificationRequest) (*csapi.ChatNotification, error) {
+	if err := h.checkChatNotificationOwner(ctx, req.ProjectRef); err != nil {
+		return nil, err
+	}
+
+	if !util.ValidateName(req.Name) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid chat notification name %q", req.Name))
+	}
+
+	cn := &types.ChatNotification{
+		Name:       req.Name,
+		Type:       req.Type,
+		SecretName: req.SecretName,
+		SecretKey:  req.SecretKey,
+		Channel:    req.Channel,
+		Events:     req.Events,
+	}
+
+	h.log.Infof("updating project chat notification")
+	rcn, resp, err := h.configstoreClient.UpdateProjectChatNotification(ctx, req.ProjectRef, req.ChatNotificationName, cn)
+	if err != nil {
+		return nil, errors.Errorf("failed to update chat notification: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("chat notification %s updated, ID: %s", rcn.Name, rcn.ID)
+
+	return rcn, nil
+}
+
+func (h *ActionHandler) DeleteProjectChatNotification(ctx context.Context, projectRef, name string) error {
+	if err := h.checkChatNotificationOwner(ctx, projectRef); err != nil {
+		return err
+	}
+
+	h.log.Infof("deleting project chat notification")
+	resp, err := h.configstoreClient.DeleteProjectChatNotification(ctx, projectRef, name)
+	if err != nil {
+		return errors.Errorf("failed to delete chat notification: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
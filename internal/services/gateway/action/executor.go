@@ -0,0 +1,88 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetExecutors(ctx context.Context) ([]*rstypes.Executor, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	executors, resp, err := h.runserviceClient.GetExecutors(ctx)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return executors, nil
+}
+
+func (h *ActionHandler) CordonExecutor(ctx context.Context, executorID string) (*rstypes.Executor, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	h.log.Infof("cordoning executor %q", executorID)
+	executor, resp, err := h.runserviceClient.CordonExecutor(ctx, executorID)
+	if err != nil {
+		return nil, errors.Errorf("failed to cordon executor: %w", ErrFromRemote(resp, err))
+	}
+	return executor, nil
+}
+
+func (h *ActionHandler) UncordonExecutor(ctx context.Context, executorID string) (*rstypes.Executor, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	h.log.Infof("uncordoning executor %q", executorID)
+	executor, resp, err := h.runserviceClient.UncordonExecutor(ctx, executorID)
+	if err != nil {
+		return nil, errors.Errorf("failed to uncordon executor: %w", ErrFromRemote(resp, err))
+	}
+	return executor, nil
+}
+
+func (h *ActionHandler) DrainExecutor(ctx context.Context, executorID string) (*rsapi.ExecutorDrainStatusResponse, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	h.log.Infof("draining executor %q", executorID)
+	ds, resp, err := h.runserviceClient.DrainExecutor(ctx, executorID)
+	if err != nil {
+		return nil, errors.Errorf("failed to drain executor: %w", ErrFromRemote(resp, err))
+	}
+	return ds, nil
+}
+
+func (h *ActionHandler) GetExecutorDrainStatus(ctx context.Context, executorID string) (*rsapi.ExecutorDrainStatusResponse, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	ds, resp, err := h.runserviceClient.GetExecutorDrainStatus(ctx, executorID)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return ds, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type SearchProjectLogsRequest struct {
+	ProjectRef string
+	Query      string
+	Regex      bool
+	Since      *time.Time
+	Until      *time.Time
+	StartID    int64
+	Limit      int
+}
+
+type LogMatch struct {
+	ID         int64
+	RunID      string
+	RunCounter uint64
+	TaskID     string
+	TaskName   string
+	Step       int
+	Line       int
+	Content    string
+}
+
+// SearchProjectLogs searches the task step logs of the project runs. Only the
+// logs of the archived runs are indexed, so the logs of a run are searchable
+// only some time after the run has been archived.
+func (h *ActionHandler) SearchProjectLogs(ctx context.Context, req *SearchProjectLogsRequest) ([]*LogMatch, error) {
+	if req.Query == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty search query"))
+	}
+
+	project, err := h.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, err
+	}
+
+	group := path.Join("/", string(common.GroupTypeProject), project.ID)
+	rsMatches, resp, err := h.runserviceClient.SearchLogs(ctx, group, req.Query, req.Regex, req.Since, req.Until, req.StartID, req.Limit)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	// add the run counter and task name to the matches
+	runs := map[string]*rstypes.Run{}
+	rcs := map[string]*rstypes.RunConfig{}
+	matches := make([]*LogMatch, len(rsMatches))
+	for i, rsm := range rsMatches {
+		m := &LogMatch{
+			ID:      rsm.ID,
+			RunID:   rsm.RunID,
+			TaskID:  rsm.TaskID,
+			Step:    rsm.Step,
+			Line:    rsm.Line,
+			Content: rsm.Content,
+		}
+		matches[i] = m
+
+		if _, ok := runs[rsm.RunID]; !ok {
+			runResp, resp, err := h.runserviceClient.GetRun(ctx, rsm.RunID, nil)
+			if err != nil {
+				// the run could have been deleted after being indexed
+				h.log.Warnf("failed to get run %q: %v", rsm.RunID, ErrFromRemote(resp, err))
+				runs[rsm.RunID] = nil
+				continue
+			}
+			runs[rsm.RunID] = runResp.Run
+			rcs[rsm.RunID] = runResp.RunConfig
+		}
+		r := runs[rsm.RunID]
+		if r == nil {
+			continue
+		}
+		m.RunCounter = r.Counter
+		if rct, ok := rcs[rsm.RunID].Tasks[rsm.TaskID]; ok {
+			m.TaskName = rct.Name
+		}
+	}
+
+	return matches, nil
+}
@@ -181,6 +181,13 @@ func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectReq
 type UpdateProjectRequest struct {
 	Name       string
 	Visibility types.Visibility
+
+	// CacheQuota, when not nil, replaces the project cache quota
+	CacheQuota *int64
+
+	// RunRetention, when not nil, replaces the project run retention policy. An
+	// empty policy removes it so the global one will be used
+	RunRetention *types.RunRetentionPolicy
 }
 
 func (h *ActionHandler) UpdateProject(ctx context.Context, projectRef string, req *UpdateProjectRequest) (*csapi.Project, error) {
@@ -199,6 +206,15 @@ func (h *ActionHandler) UpdateProject(ctx context.Context, projectRef string, re
 
 	p.Name = req.Name
 	p.Visibility = req.Visibility
+	if req.CacheQuota != nil {
+		p.CacheQuota = *req.CacheQuota
+	}
+	if req.RunRetention != nil {
+		p.RunRetention = req.RunRetention
+		if *req.RunRetention == (types.RunRetentionPolicy{}) {
+			p.RunRetention = nil
+		}
+	}
 
 	h.log.Infof("updating project")
 	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
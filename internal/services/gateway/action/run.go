@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"path"
+	"time"
 
 	"agola.io/agola/internal/config"
 	gitsource "agola.io/agola/internal/gitsources"
@@ -27,6 +28,7 @@ import (
 	rsapi "agola.io/agola/internal/services/runservice/api"
 	rstypes "agola.io/agola/internal/services/runservice/types"
 	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/steplog"
 	"agola.io/agola/internal/util"
 
 	errors "golang.org/x/xerrors"
@@ -62,6 +64,10 @@ const (
 	AnnotationTagLink         = "tag_link"
 	AnnotationPullRequestID   = "pull_request_id"
 	AnnotationPullRequestLink = "pull_request_link"
+
+	// AnnotationPullRequestCommentID is the id of the pull request comment
+	// containing the run summary. It's set by the notification service
+	AnnotationPullRequestCommentID = "pull_request_comment_id"
 )
 
 func (h *ActionHandler) GetRun(ctx context.Context, runID string) (*rsapi.RunResponse, error) {
@@ -89,6 +95,56 @@ type GetRunsRequest struct {
 	StartRunID   string
 	Limit        int
 	Asc          bool
+
+	// search filters
+
+	// CommitSHA matches the runs with a commit sha starting with the provided
+	// value (so also short commit shas can be used)
+	CommitSHA     string
+	Ref           string
+	Branch        string
+	Tag           string
+	PullRequestID string
+	Trigger       string
+	Name          string
+	Annotations   map[string]string
+	Since         *time.Time
+	Until         *time.Time
+}
+
+func (req *GetRunsRequest) runsFilter() *rstypes.RunsFilter {
+	annotations := map[string]string{}
+	for k, v := range req.Annotations {
+		annotations[k] = v
+	}
+	searchAnnotations := map[string]string{
+		AnnotationRef:                req.Ref,
+		AnnotationBranch:             req.Branch,
+		AnnotationTag:                req.Tag,
+		AnnotationPullRequestID:      req.PullRequestID,
+		AnnotationRunCreationTrigger: req.Trigger,
+	}
+	for k, v := range searchAnnotations {
+		if v != "" {
+			annotations[k] = v
+		}
+	}
+	annotationPrefixes := map[string]string{}
+	if req.CommitSHA != "" {
+		annotationPrefixes[AnnotationCommitSHA] = req.CommitSHA
+	}
+
+	if req.Name == "" && len(annotations) == 0 && len(annotationPrefixes) == 0 && req.Since == nil && req.Until == nil {
+		return nil
+	}
+
+	return &rstypes.RunsFilter{
+		Name:               req.Name,
+		Annotations:        annotations,
+		AnnotationPrefixes: annotationPrefixes,
+		Since:              req.Since,
+		Until:              req.Until,
+	}
 }
 
 func (h *ActionHandler) GetRuns(ctx context.Context, req *GetRunsRequest) (*rsapi.GetRunsResponse, error) {
@@ -101,7 +157,7 @@ func (h *ActionHandler) GetRuns(ctx context.Context, req *GetRunsRequest) (*rsap
 	}
 
 	groups := []string{req.Group}
-	runsResp, resp, err := h.runserviceClient.GetRuns(ctx, req.PhaseFilter, req.ResultFilter, groups, req.LastRun, req.ChangeGroups, req.StartRunID, req.Limit, req.Asc)
+	runsResp, resp, err := h.runserviceClient.GetRuns(ctx, req.PhaseFilter, req.ResultFilter, groups, req.LastRun, req.ChangeGroups, req.runsFilter(), req.StartRunID, req.Limit, req.Asc)
 	if err != nil {
 		return nil, ErrFromRemote(resp, err)
 	}
@@ -115,6 +171,7 @@ type GetLogsRequest struct {
 	Setup  bool
 	Step   int
 	Follow bool
+	Format steplog.Format
 }
 
 func (h *ActionHandler) GetLogs(ctx context.Context, req *GetLogsRequest) (*http.Response, error) {
@@ -130,7 +187,7 @@ func (h *ActionHandler) GetLogs(ctx context.Context, req *GetLogsRequest) (*http
 		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
-	resp, err = h.runserviceClient.GetLogs(ctx, req.RunID, req.TaskID, req.Setup, req.Step, req.Follow)
+	resp, err = h.runserviceClient.GetLogs(ctx, req.RunID, req.TaskID, req.Setup, req.Step, req.Follow, req.Format)
 	if err != nil {
 		return nil, ErrFromRemote(resp, err)
 	}
@@ -437,6 +494,21 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 		cacheGroup = req.User.ID + "-" + req.UserRunRepoUUID
 	}
 
+	var cacheQuota int64
+	if req.RunType == types.RunTypeProject {
+		cacheQuota = req.Project.CacheQuota
+	}
+
+	// the project retention policy overrides the runservice global one
+	var runRetention *rstypes.RunRetentionPolicy
+	if req.RunType == types.RunTypeProject && req.Project.RunRetention != nil {
+		runRetention = &rstypes.RunRetentionPolicy{
+			KeepLast:   req.Project.RunRetention.KeepLast,
+			MaxAge:     req.Project.RunRetention.MaxAge,
+			KeepTagged: req.Project.RunRetention.KeepTagged,
+		}
+	}
+
 	data, filename, err := h.fetchConfigFiles(req.GitSource, req.RepoPath, req.CommitSHA)
 	if err != nil {
 		return util.NewErrInternal(errors.Errorf("failed to fetch config file: %w", err))
@@ -467,6 +539,7 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 			Name:              rstypes.RunGenericSetupErrorName,
 			StaticEnvironment: env,
 			Annotations:       annotations,
+			RunRetention:      runRetention,
 		}
 
 		if _, _, err := h.runserviceClient.CreateRun(ctx, createRunReq); err != nil {
@@ -487,6 +560,8 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 			StaticEnvironment: env,
 			Annotations:       annotations,
 			CacheGroup:        cacheGroup,
+			CacheQuota:        cacheQuota,
+			RunRetention:      runRetention,
 		}
 
 		if _, _, err := h.runserviceClient.CreateRun(ctx, createRunReq); err != nil {
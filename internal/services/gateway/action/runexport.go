@@ -0,0 +1,82 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+
+	"agola.io/agola/internal/services/common"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ExportRun returns the runservice response containing the run export bundle.
+// Since the bundle contains the run config with the run environment, only the
+// users that can do run actions can export it.
+func (h *ActionHandler) ExportRun(ctx context.Context, runID string) (*http.Response, error) {
+	runResp, resp, err := h.runserviceClient.GetRun(ctx, runID, nil)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	canDoRunActions, err := h.CanDoRunActions(ctx, runResp.RunConfig.Group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canDoRunActions {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	resp, err = h.runserviceClient.ExportRun(ctx, runID)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return resp, nil
+}
+
+type ImportRunRequest struct {
+	ProjectRef string
+	Data       io.Reader
+}
+
+// ImportRun imports a run export bundle as an archived run of the provided
+// project
+func (h *ActionHandler) ImportRun(ctx context.Context, req *ImportRunRequest) (*rsapi.RunResponse, error) {
+	project, resp, err := h.configstoreClient.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	isProjectOwner, err := h.IsProjectOwner(ctx, project.OwnerType, project.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	group := path.Join("/", string(common.GroupTypeProject), project.ID)
+	runResp, resp, err := h.runserviceClient.ImportRun(ctx, group, req.Data)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	h.log.Infof("run %q imported in project %q", runResp.Run.ID, project.ID)
+
+	return runResp, nil
+}
@@ -0,0 +1,357 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"agola.io/agola/internal/runconfig"
+	"agola.io/agola/internal/services/common"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultTaskDurationsRunsLimit = 10
+	MaxTaskDurationsRunsLimit     = 50
+)
+
+type RunTimeline struct {
+	RunID   string
+	Counter uint64
+	Name    string
+
+	EnqueueTime *time.Time
+	StartTime   *time.Time
+	EndTime     *time.Time
+
+	// QueueDuration is the time between the run enqueue and its start
+	QueueDuration *time.Duration
+	Duration      *time.Duration
+
+	Tasks []*RunTimelineTask
+
+	// CriticalPath contains the ids of the tasks that determined the run
+	// duration, from the first to the last executed
+	CriticalPath         []string
+	CriticalPathDuration *time.Duration
+}
+
+type RunTimelineTask struct {
+	ID     string
+	Name   string
+	Level  int
+	Status rstypes.RunTaskStatus
+
+	// ReadyTime is when the task became ready to be executed: the run start
+	// time or the end time of its last finished parent
+	ReadyTime *time.Time
+	StartTime *time.Time
+	EndTime   *time.Time
+
+	// WaitDuration is the time spent waiting for an executor (and for the
+	// approval for tasks needing it)
+	WaitDuration  *time.Duration
+	SetupDuration *time.Duration
+	Duration      *time.Duration
+
+	Steps []*RunTimelineStep
+}
+
+type RunTimelineStep struct {
+	Name     string
+	Duration *time.Duration
+}
+
+func duration(start, end *time.Time) *time.Duration {
+	if start == nil || end == nil {
+		return nil
+	}
+	d := end.Sub(*start)
+	return &d
+}
+
+func stepName(step interface{}) string {
+	switch step := step.(type) {
+	case *rstypes.RunStep:
+		return step.Name
+	case *rstypes.SaveToWorkspaceStep:
+		return "save to workspace"
+	case *rstypes.RestoreWorkspaceStep:
+		return "restore workspace"
+	case *rstypes.SaveCacheStep:
+		return "save cache"
+	case *rstypes.RestoreCacheStep:
+		return "restore cache"
+	}
+	return ""
+}
+
+func (h *ActionHandler) GetRunTimeline(ctx context.Context, runID string) (*RunTimeline, error) {
+	runResp, err := h.GetRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	return runTimeline(runResp.Run, runResp.RunConfig), nil
+}
+
+// runTimeline calculates the timeline of a run
+func runTimeline(r *rstypes.Run, rc *rstypes.RunConfig) *RunTimeline {
+	t := &RunTimeline{
+		RunID:   r.ID,
+		Counter: r.Counter,
+		Name:    r.Name,
+
+		EnqueueTime: r.EnqueueTime,
+		StartTime:   r.StartTime,
+		EndTime:     r.EndTime,
+
+		QueueDuration: duration(r.EnqueueTime, r.StartTime),
+		Duration:      duration(r.StartTime, r.EndTime),
+
+		Tasks: []*RunTimelineTask{},
+	}
+
+	for id, rct := range rc.Tasks {
+		rt, ok := r.Tasks[id]
+		if !ok {
+			continue
+		}
+
+		tt := &RunTimelineTask{
+			ID:     rt.ID,
+			Name:   rct.Name,
+			Level:  rct.Level,
+			Status: rt.Status,
+
+			ReadyTime: runconfig.TaskReadyTime(r, rc, rct),
+			StartTime: rt.StartTime,
+			EndTime:   rt.EndTime,
+
+			SetupDuration: duration(rt.SetupStep.StartTime, rt.SetupStep.EndTime),
+			Duration:      duration(rt.StartTime, rt.EndTime),
+
+			Steps: make([]*RunTimelineStep, len(rt.Steps)),
+		}
+		tt.WaitDuration = duration(tt.ReadyTime, tt.StartTime)
+
+		for i, rts := range rt.Steps {
+			s := &RunTimelineStep{
+				Duration: duration(rts.StartTime, rts.EndTime),
+			}
+			if i < len(rct.Steps) {
+				s.Name = stepName(rct.Steps[i])
+			}
+			tt.Steps[i] = s
+		}
+
+		t.Tasks = append(t.Tasks, tt)
+	}
+
+	sort.Slice(t.Tasks, func(i, j int) bool {
+		if t.Tasks[i].Level != t.Tasks[j].Level {
+			return t.Tasks[i].Level < t.Tasks[j].Level
+		}
+		return t.Tasks[i].Name < t.Tasks[j].Name
+	})
+
+	t.CriticalPath = criticalPath(r, rc)
+	if len(t.CriticalPath) > 0 {
+		first := r.Tasks[t.CriticalPath[0]]
+		last := r.Tasks[t.CriticalPath[len(t.CriticalPath)-1]]
+		t.CriticalPathDuration = duration(runconfig.TaskReadyTime(r, rc, rc.Tasks[first.ID]), last.EndTime)
+	}
+
+	return t
+}
+
+// criticalPath returns the chain of tasks that determined the run duration.
+// It starts from the last ended task and, for every task, goes back to the
+// ancestor that ended last (the one that blocked the task execution)
+func criticalPath(r *rstypes.Run, rc *rstypes.RunConfig) []string {
+	var last *rstypes.RunTask
+	for _, rt := range r.Tasks {
+		if rt.EndTime == nil {
+			continue
+		}
+		if last == nil || rt.EndTime.After(*last.EndTime) || (rt.EndTime.Equal(*last.EndTime) && rt.ID < last.ID) {
+			last = rt
+		}
+	}
+	if last == nil {
+		return nil
+	}
+
+	path := []string{last.ID}
+	cur := rc.Tasks[last.ID]
+	for cur != nil {
+		// only consider the ancestors that ended before the current task
+		// started since the others (i.e. with conditions on failure) cannot
+		// have blocked it
+		curStart := r.Tasks[cur.ID].StartTime
+
+		blocking := blockingTask(r, runconfig.GetParents(rc.Tasks, cur), curStart)
+		if blocking == nil {
+			// the direct parents were never executed (i.e. skipped), look
+			// for the blocking task between all the ancestors
+			blocking = blockingTask(r, runconfig.GetAllParents(rc.Tasks, cur), curStart)
+		}
+		if blocking == nil {
+			break
+		}
+		path = append([]string{blocking.ID}, path...)
+		cur = blocking
+	}
+
+	return path
+}
+
+// blockingTask returns, between the provided tasks, the one that ended last
+// before the start time
+func blockingTask(r *rstypes.Run, rcts []*rstypes.RunConfigTask, start *time.Time) *rstypes.RunConfigTask {
+	var blocking *rstypes.RunConfigTask
+	var blockingEnd *time.Time
+	for _, rct := range rcts {
+		rt, ok := r.Tasks[rct.ID]
+		if !ok || rt.EndTime == nil {
+			continue
+		}
+		if start != nil && rt.EndTime.After(*start) {
+			continue
+		}
+		if blockingEnd == nil || rt.EndTime.After(*blockingEnd) || (rt.EndTime.Equal(*blockingEnd) && rct.ID < blocking.ID) {
+			blocking = rct
+			blockingEnd = rt.EndTime
+		}
+	}
+	return blocking
+}
+
+type TaskDurations struct {
+	Name string
+
+	// Runs contains the task durations in the analyzed runs, from the oldest
+	// to the newest
+	Runs []*TaskRunDuration
+
+	Min     time.Duration
+	Max     time.Duration
+	Average time.Duration
+}
+
+type TaskRunDuration struct {
+	RunID    string
+	Counter  uint64
+	Status   rstypes.RunTaskStatus
+	Duration time.Duration
+}
+
+type GetProjectTaskDurationsRequest struct {
+	ProjectRef string
+	Branch     string
+	Limit      int
+}
+
+// GetProjectTaskDurations returns the durations of the tasks executed in the
+// last finished runs of a project branch
+func (h *ActionHandler) GetProjectTaskDurations(ctx context.Context, req *GetProjectTaskDurationsRequest) ([]*TaskDurations, error) {
+	if req.Branch == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty branch"))
+	}
+
+	project, err := h.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, err
+	}
+
+	group := common.GenRunGroup(common.GroupTypeProject, project.ID, common.GroupTypeBranch, req.Branch)
+	runsResp, resp, err := h.runserviceClient.GetRuns(ctx, []string{string(rstypes.RunPhaseFinished)}, nil, []string{group}, false, nil, nil, "", req.Limit, false)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	runs := []*rstypes.Run{}
+	rcs := map[string]*rstypes.RunConfig{}
+	for _, r := range runsResp.Runs {
+		runResp, resp, err := h.runserviceClient.GetRun(ctx, r.ID, nil)
+		if err != nil {
+			return nil, errors.Errorf("failed to get run %q: %w", r.ID, ErrFromRemote(resp, err))
+		}
+		runs = append(runs, runResp.Run)
+		rcs[r.ID] = runResp.RunConfig
+	}
+
+	return taskDurations(runs, rcs), nil
+}
+
+// taskDurations aggregates the durations of the finished tasks by task name
+func taskDurations(runs []*rstypes.Run, rcs map[string]*rstypes.RunConfig) []*TaskDurations {
+	// analyze the runs from the oldest to the newest
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+
+	tdsMap := map[string]*TaskDurations{}
+	for _, r := range runs {
+		rc, ok := rcs[r.ID]
+		if !ok {
+			continue
+		}
+		for id, rt := range r.Tasks {
+			rct, ok := rc.Tasks[id]
+			if !ok {
+				continue
+			}
+			d := duration(rt.StartTime, rt.EndTime)
+			if d == nil {
+				continue
+			}
+
+			td, ok := tdsMap[rct.Name]
+			if !ok {
+				td = &TaskDurations{Name: rct.Name, Min: *d, Max: *d}
+				tdsMap[rct.Name] = td
+			}
+			td.Runs = append(td.Runs, &TaskRunDuration{
+				RunID:    r.ID,
+				Counter:  r.Counter,
+				Status:   rt.Status,
+				Duration: *d,
+			})
+			if *d < td.Min {
+				td.Min = *d
+			}
+			if *d > td.Max {
+				td.Max = *d
+			}
+		}
+	}
+
+	tds := make([]*TaskDurations, 0, len(tdsMap))
+	for _, td := range tdsMap {
+		var total time.Duration
+		for _, trd := range td.Runs {
+			total += trd.Duration
+		}
+		td.Average = total / time.Duration(len(td.Runs))
+		tds = append(tds, td)
+	}
+	sort.Slice(tds, func(i, j int) bool { return tds[i].Name < tds[j].Name })
+
+	return tds
+}
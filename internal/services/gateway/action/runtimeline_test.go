@@ -0,0 +1,240 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"testing"
+	"time"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testTimelineTask defines a run task. start and end are the minutes after the
+// run start, a negative value means the time isn't set
+type testTimelineTask struct {
+	id      string
+	name    string
+	depends []string
+	start   int
+	end     int
+}
+
+func testTimelineRun(runID string, runStart time.Time, tasks []testTimelineTask) (*rstypes.Run, *rstypes.RunConfig) {
+	at := func(minutes int) *time.Time {
+		if minutes < 0 {
+			return nil
+		}
+		t := runStart.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+
+	r := &rstypes.Run{ID: runID, StartTime: &runStart, Tasks: map[string]*rstypes.RunTask{}}
+	rc := &rstypes.RunConfig{ID: runID, Tasks: map[string]*rstypes.RunConfigTask{}}
+	for _, tt := range tasks {
+		name := tt.name
+		if name == "" {
+			name = tt.id
+		}
+		rct := &rstypes.RunConfigTask{ID: tt.id, Name: name, Depends: map[string]*rstypes.RunConfigTaskDepend{}}
+		for _, d := range tt.depends {
+			rct.Depends[d] = &rstypes.RunConfigTaskDepend{TaskID: d}
+		}
+		rc.Tasks[tt.id] = rct
+
+		rt := &rstypes.RunTask{ID: tt.id, StartTime: at(tt.start), EndTime: at(tt.end), Status: rstypes.RunTaskStatusSuccess}
+		if rt.StartTime == nil {
+			rt.Status = rstypes.RunTaskStatusSkipped
+		}
+		r.Tasks[tt.id] = rt
+	}
+	return r, rc
+}
+
+func TestCriticalPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []testTimelineTask
+		out   []string
+	}{
+		{
+			name: "test no executed tasks",
+			tasks: []testTimelineTask{
+				{id: "task01", start: -1, end: -1},
+			},
+			out: nil,
+		},
+		{
+			name: "test single task",
+			tasks: []testTimelineTask{
+				{id: "task01", start: 0, end: 10},
+			},
+			out: []string{"task01"},
+		},
+		{
+			name: "test tasks chain",
+			tasks: []testTimelineTask{
+				{id: "task01", start: 0, end: 10},
+				{id: "task02", depends: []string{"task01"}, start: 10, end: 20},
+				{id: "task03", depends: []string{"task02"}, start: 20, end: 30},
+			},
+			out: []string{"task01", "task02", "task03"},
+		},
+		{
+			name: "test parallel branches",
+			tasks: []testTimelineTask{
+				{id: "task01", start: 0, end: 10},
+				{id: "task02", depends: []string{"task01"}, start: 10, end: 30},
+				{id: "task03", depends: []string{"task01"}, start: 10, end: 15},
+				{id: "task04", depends: []string{"task02", "task03"}, start: 30, end: 40},
+				// a parallel root task not in the critical path
+				{id: "task05", start: 0, end: 35},
+			},
+			out: []string{"task01", "task02", "task04"},
+		},
+		{
+			name: "test skipped parent",
+			tasks: []testTimelineTask{
+				{id: "task01", start: 0, end: 10},
+				{id: "task02", depends: []string{"task01"}, start: -1, end: -1},
+				{id: "task03", depends: []string{"task02"}, start: 12, end: 20},
+			},
+			out: []string{"task01", "task03"},
+		},
+		{
+			name: "test parent ended after the task start isn't blocking",
+			tasks: []testTimelineTask{
+				{id: "task01", start: 0, end: 10},
+				{id: "task02", start: 0, end: 25},
+				{id: "task03", depends: []string{"task01", "task02"}, start: 12, end: 30},
+			},
+			out: []string{"task01", "task03"},
+		},
+		{
+			name: "test tie between parents",
+			tasks: []testTimelineTask{
+				{id: "task02", start: 0, end: 10},
+				{id: "task01", start: 0, end: 10},
+				{id: "task03", depends: []string{"task01", "task02"}, start: 10, end: 20},
+			},
+			out: []string{"task01", "task03"},
+		},
+		{
+			name: "test tie between last ended tasks",
+			tasks: []testTimelineTask{
+				{id: "task01", start: 0, end: 10},
+				{id: "task02", depends: []string{"task01"}, start: 10, end: 20},
+				{id: "task03", start: 0, end: 20},
+			},
+			out: []string{"task01", "task02"},
+		},
+		{
+			name: "test not finished task",
+			tasks: []testTimelineTask{
+				{id: "task01", start: 0, end: 10},
+				{id: "task02", depends: []string{"task01"}, start: 10, end: -1},
+			},
+			out: []string{"task01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, rc := testTimelineRun("run01", time.Now(), tt.tasks)
+			out := criticalPath(r, rc)
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("critical path mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunTimelineCriticalPathDuration(t *testing.T) {
+	r, rc := testTimelineRun("run01", time.Now(), []testTimelineTask{
+		{id: "task01", start: 5, end: 10},
+		{id: "task02", depends: []string{"task01"}, start: 15, end: 20},
+	})
+
+	tl := runTimeline(r, rc)
+	// the critical path starts when its first task is ready (the run start)
+	if tl.CriticalPathDuration == nil || *tl.CriticalPathDuration != 20*time.Minute {
+		t.Fatalf("expected critical path duration %s, got %v", 20*time.Minute, tl.CriticalPathDuration)
+	}
+	for _, tt := range tl.Tasks {
+		if tt.ID == "task02" && (tt.WaitDuration == nil || *tt.WaitDuration != 5*time.Minute) {
+			t.Fatalf("expected task02 wait duration %s, got %v", 5*time.Minute, tt.WaitDuration)
+		}
+	}
+}
+
+func TestTaskDurations(t *testing.T) {
+	runStart := time.Now()
+
+	run01, rc01 := testTimelineRun("run01", runStart, []testTimelineTask{
+		{id: "task01", name: "build", start: 0, end: 10},
+		{id: "task02", name: "test", depends: []string{"task01"}, start: 10, end: 30},
+	})
+	run02, rc02 := testTimelineRun("run02", runStart, []testTimelineTask{
+		{id: "task03", name: "build", start: 0, end: 20},
+		// a skipped task isn't counted
+		{id: "task04", name: "test", depends: []string{"task03"}, start: -1, end: -1},
+	})
+	run03, rc03 := testTimelineRun("run03", runStart, []testTimelineTask{
+		{id: "task05", name: "build", start: 0, end: 30},
+		{id: "task06", name: "test", depends: []string{"task05"}, start: 30, end: 40},
+	})
+	// a run without run config is ignored
+	run04, _ := testTimelineRun("run04", runStart, []testTimelineTask{
+		{id: "task07", name: "build", start: 0, end: 100},
+	})
+
+	// runs are analyzed from the oldest to the newest regardless of their order
+	runs := []*rstypes.Run{run03, run04, run01, run02}
+	rcs := map[string]*rstypes.RunConfig{"run01": rc01, "run02": rc02, "run03": rc03}
+
+	expected := []*TaskDurations{
+		{
+			Name: "build",
+			Runs: []*TaskRunDuration{
+				{RunID: "run01", Status: rstypes.RunTaskStatusSuccess, Duration: 10 * time.Minute},
+				{RunID: "run02", Status: rstypes.RunTaskStatusSuccess, Duration: 20 * time.Minute},
+				{RunID: "run03", Status: rstypes.RunTaskStatusSuccess, Duration: 30 * time.Minute},
+			},
+			Min:     10 * time.Minute,
+			Max:     30 * time.Minute,
+			Average: 20 * time.Minute,
+		},
+		{
+			Name: "test",
+			Runs: []*TaskRunDuration{
+				{RunID: "run01", Status: rstypes.RunTaskStatusSuccess, Duration: 20 * time.Minute},
+				{RunID: "run03", Status: rstypes.RunTaskStatusSuccess, Duration: 10 * time.Minute},
+			},
+			Min:     10 * time.Minute,
+			Max:     20 * time.Minute,
+			Average: 15 * time.Minute,
+		},
+	}
+
+	out := taskDurations(runs, rcs)
+	if diff := cmp.Diff(expected, out); diff != "" {
+		t.Fatalf("task durations mismatch (-want +got):\n%s", diff)
+	}
+
+	if out := taskDurations([]*rstypes.Run{}, rcs); len(out) != 0 {
+		t.Fatalf("expected no task durations, got %d", len(out))
+	}
+}
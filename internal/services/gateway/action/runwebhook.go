@@ -0,0 +1,220 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"net/http"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	ntypes "agola.io/agola/internal/services/notification/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type GetRunWebhooksRequest struct {
+	ParentType types.ConfigType
+	ParentRef  string
+
+	Tree bool
+}
+
+func (h *ActionHandler) GetRunWebhooks(ctx context.Context, req *GetRunWebhooksRequest) ([]*csapi.RunWebhook, error) {
+	isVariableOwner, err := h.IsVariableOwner(ctx, req.ParentType, req.ParentRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	var csrunwebhooks []*csapi.RunWebhook
+	var resp *http.Response
+	switch req.ParentType {
+	case types.ConfigTypeProjectGroup:
+		csrunwebhooks, resp, err = h.configstoreClient.GetProjectGroupRunWebhooks(ctx, req.ParentRef, req.Tree)
+	case types.ConfigTypeProject:
+		csrunwebhooks, resp, err = h.configstoreClient.GetProjectRunWebhooks(ctx, req.ParentRef, req.Tree)
+	}
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return csrunwebhooks, nil
+}
+
+type CreateRunWebhookRequest struct {
+	Name string
+
+	ParentType types.ConfigType
+	ParentRef  string
+
+	URL        string
+	Secret     string
+	SkipVerify bool
+	Events     []types.RunWebhookEvent
+}
+
+func (h *ActionHandler) CreateRunWebhook(ctx context.Context, req *CreateRunWebhookRequest) (*csapi.RunWebhook, error) {
+	isVariableOwner, err := h.IsVariableOwner(ctx, req.ParentType, req.ParentRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	if !util.ValidateName(req.Name) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid run webhook name %q", req.Name))
+	}
+
+	rw := &types.RunWebhook{
+		Name:       req.Name,
+		URL:        req.URL,
+		Secret:     req.Secret,
+		SkipVerify: req.SkipVerify,
+		Events:     req.Events,
+	}
+
+	var resp *http.Response
+	var rrw *csapi.RunWebhook
+	switch req.ParentType {
+	case types.ConfigTypeProjectGroup:
+		h.log.Infof("creating project group run webhook")
+		rrw, resp, err = h.configstoreClient.CreateProjectGroupRunWebhook(ctx, req.ParentRef, rw)
+	case types.ConfigTypeProject:
+		h.log.Infof("creating project run webhook")
+		rrw, resp, err = h.configstoreClient.CreateProjectRunWebhook(ctx, req.ParentRef, rw)
+	}
+	if err != nil {
+		return nil, errors.Errorf("failed to create run webhook: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("run webhook %s created, ID: %s", rrw.Name, rrw.ID)
+
+	return rrw, nil
+}
+
+type UpdateRunWebhookRequest struct {
+	RunWebhookName string
+
+	Name string
+
+	ParentType types.ConfigType
+	ParentRef  string
+
+	URL string
+	// Secret is the new run webhook secret. If empty the current secret is kept
+	Secret     string
+	SkipVerify bool
+	Events     []types.RunWebhookEvent
+}
+
+func (h *ActionHandler) UpdateRunWebhook(ctx context.Context, req *UpdateRunWebhookRequest) (*csapi.RunWebhook, error) {
+	isVariableOwner, err := h.IsVariableOwner(ctx, req.ParentType, req.ParentRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	if !util.ValidateName(req.Name) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid run webhook name %q", req.Name))
+	}
+
+	rw := &types.RunWebhook{
+		Name:       req.Name,
+		URL:        req.URL,
+		Secret:     req.Secret,
+		SkipVerify: req.SkipVerify,
+		Events:     req.Events,
+	}
+
+	var resp *http.Response
+	var rrw *csapi.RunWebhook
+	switch req.ParentType {
+	case types.ConfigTypeProjectGroup:
+		h.log.Infof("updating project group run webhook")
+		rrw, resp, err = h.configstoreClient.UpdateProjectGroupRunWebhook(ctx, req.ParentRef, req.RunWebhookName, rw)
+	case types.ConfigTypeProject:
+		h.log.Infof("updating project run webhook")
+		rrw, resp, err = h.configstoreClient.UpdateProjectRunWebhook(ctx, req.ParentRef, req.RunWebhookName, rw)
+	}
+	if err != nil {
+		return nil, errors.Errorf("failed to update run webhook: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("run webhook %s updated, ID: %s", rrw.Name, rrw.ID)
+
+	return rrw, nil
+}
+
+func (h *ActionHandler) DeleteRunWebhook(ctx context.Context, parentType types.ConfigType, parentRef, name string) error {
+	isVariableOwner, err := h.IsVariableOwner(ctx, parentType, parentRef)
+	if err != nil {
+		return errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	var resp *http.Response
+	switch parentType {
+	case types.ConfigTypeProjectGroup:
+		h.log.Infof("deleting project group run webhook")
+		resp, err = h.configstoreClient.DeleteProjectGroupRunWebhook(ctx, parentRef, name)
+	case types.ConfigTypeProject:
+		h.log.Infof("deleting project run webhook")
+		resp, err = h.configstoreClient.DeleteProjectRunWebhook(ctx, parentRef, name)
+	}
+	if err != nil {
+		return errors.Errorf("failed to delete run webhook: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
+
+type GetProjectRunWebhookDeliveriesRequest struct {
+	ProjectRef string
+
+	Start string
+	Limit int
+	Asc   bool
+}
+
+func (h *ActionHandler) GetProjectRunWebhookDeliveries(ctx context.Context, req *GetProjectRunWebhookDeliveriesRequest) ([]*ntypes.RunWebhookDelivery, error) {
+	if err := h.checkNotificationService(); err != nil {
+		return nil, err
+	}
+	isVariableOwner, err := h.IsVariableOwner(ctx, types.ConfigTypeProject, req.ProjectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	project, resp, err := h.configstoreClient.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", req.ProjectRef, ErrFromRemote(resp, err))
+	}
+
+	deliveries, resp, err := h.notificationClient.GetProjectRunWebhookDeliveries(ctx, project.ID, req.Start, req.Limit, req.Asc)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q run webhook deliveries: %w", req.ProjectRef, ErrFromRemote(resp, err))
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	nsapi "agola.io/agola/internal/services/notification/api"
+	ntypes "agola.io/agola/internal/services/notification/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// getSubscriptionProject returns the project and checks that the current user
+// is a project member
+func (h *ActionHandler) getSubscriptionProject(ctx context.Context, projectRef string) (*csapi.Project, error) {
+	if err := h.checkNotificationService(); err != nil {
+		return nil, err
+	}
+	if h.CurrentUserID(ctx) == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("only users can subscribe to a project"))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectMember, err := h.IsProjectMember(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectMember {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	return p, nil
+}
+
+func (h *ActionHandler) GetProjectSubscriptions(ctx context.Context, projectRef string) ([]*ntypes.ProjectSubscription, error) {
+	if err := h.checkNotificationService(); err != nil {
+		return nil, err
+	}
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	subscriptions, resp, err := h.notificationClient.GetProjectSubscriptions(ctx, p.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q subscriptions: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	return subscriptions, nil
+}
+
+func (h *ActionHandler) GetProjectSubscription(ctx context.Context, projectRef string) (*ntypes.ProjectSubscription, error) {
+	p, err := h.getSubscriptionProject(ctx, projectRef)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription, resp, err := h.notificationClient.GetProjectSubscription(ctx, p.ID, h.CurrentUserID(ctx))
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q subscription: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	return subscription, nil
+}
+
+type PutProjectSubscriptionRequest struct {
+	ProjectRef string
+
+	Email    string
+	Branches []string
+}
+
+func (h *ActionHandler) PutProjectSubscription(ctx context.Context, req *PutProjectSubscriptionRequest) (*ntypes.ProjectSubscription, error) {
+	p, err := h.getSubscriptionProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := h.CurrentUserID(ctx)
+	if req.Email == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty subscription email"))
+	}
+	if !util.ValidateEmail(req.Email) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid subscription email %q", req.Email))
+	}
+	emails, err := h.userVerifiedEmails(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := emails[req.Email]; !ok {
+		return nil, util.NewErrBadRequest(errors.Errorf("subscription email %q isn't the email of one of the user linked accounts", req.Email))
+	}
+
+	nreq := &nsapi.PutProjectSubscriptionRequest{
+		Email:    req.Email,
+		Branches: req.Branches,
+	}
+	h.log.Infof("subscribing user %q to project %q", userID, p.ID)
+	subscription, resp, err := h.notificationClient.PutProjectSubscription(ctx, p.ID, userID, nreq)
+	if err != nil {
+		return nil, errors.Errorf("failed to subscribe to project %q: %w", req.ProjectRef, ErrFromRemote(resp, err))
+	}
+
+	return subscription, nil
+}
+
+// userVerifiedEmails returns the emails of the user linked accounts as reported
+// by their remote sources. Since users don't have an email these are the only
+// emails we know are owned by the user
+func (h *ActionHandler) userVerifiedEmails(ctx context.Context, userRef string) (map[string]struct{}, error) {
+	user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get user %q: %w", userRef, ErrFromRemote(resp, err))
+	}
+
+	emails := map[string]struct{}{}
+	for _, la := range user.LinkedAccounts {
+		rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, la.RemoteSourceID)
+		if err != nil {
+			return nil, errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, ErrFromRemote(resp, err))
+		}
+		la, err := h.RefreshLinkedAccount(ctx, rs, user.Name, la)
+		if err != nil {
+			return nil, errors.Errorf("failed to refresh linked account: %w", err)
+		}
+
+		accessToken, err := common.GetAccessToken(rs, la.UserAccessToken, la.Oauth2AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		userSource, err := common.GetUserSource(rs, accessToken)
+		if err != nil {
+			return nil, err
+		}
+		remoteUserInfo, err := userSource.GetUserInfo()
+		if err != nil {
+			return nil, errors.Errorf("failed to retrieve remote user info for remote source %q: %w", rs.ID, err)
+		}
+		if remoteUserInfo.Email != "" {
+			emails[remoteUserInfo.Email] = struct{}{}
+		}
+	}
+
+	return emails, nil
+}
+
+func (h *ActionHandler) DeleteProjectSubscription(ctx context.Context, projectRef string) error {
+	p, err := h.getSubscriptionProject(ctx, projectRef)
+	if err != nil {
+		return err
+	}
+
+	userID := h.CurrentUserID(ctx)
+	h.log.Infof("unsubscribing user %q from project %q", userID, p.ID)
+	resp, err := h.notificationClient.DeleteProjectSubscription(ctx, p.ID, userID)
+	if err != nil {
+		return errors.Errorf("failed to unsubscribe from project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	return nil
+}
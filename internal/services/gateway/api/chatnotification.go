@@ -0,0 +1,226 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+	"go.uber.org/zap"
+
+	"github.com/gorilla/mux"
+)
+
+type ChatNotificationResponse struct {
+	ID         string                        `json:"id"`
+	Name       string                        `json:"name"`
+	Type       types.ChatNotificationType    `json:"type"`
+	SecretName string                        `json:"secret_name"`
+	SecretKey  string                        `json:"secret_key"`
+	Channel    string                        `json:"channel"`
+	Events     []types.ChatNotificationEvent `json:"events"`
+}
+
+func createChatNotificationResponse(cn *csapi.ChatNotification) *ChatNotificationResponse {
+	return &ChatNotificationResponse{
+		ID:         cn.ID,
+		Name:       cn.Name,
+		Type:       cn.Type,
+		SecretName: cn.SecretName,
+		SecretKey:  cn.SecretKey,
+		Channel:    cn.Channel,
+		Events:     cn.Events,
+	}
+}
+
+type ChatNotificationsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewChatNotificationsHandler(logger *zap.Logger, ah *action.ActionHandler) *ChatNotificationsHandler {
+	return &ChatNotificationsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ChatNotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	cschatnotifications, err := h.ah.GetProjectChatNotifications(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	chatNotifications := make([]*ChatNotificationResponse, len(cschatnotifications))
+	for i, cn := range cschatnotifications {
+		chatNotifications[i] = createChatNotificationResponse(cn)
+	}
+
+	if err := httpResponse(w, http.StatusOK, chatNotifications); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateChatNotificationRequest struct {
+	Name       string                        `json:"name,omitempty"`
+	Type       types.ChatNotificationType    `json:"type,omitempty"`
+	SecretName string                        `json:"secret_name,omitempty"`
+	SecretKey  string                        `json:"secret_key,omitempty"`
+	Channel    string                        `json:"channel,omitempty"`
+	Events     []types.ChatNotificationEvent `json:"events,omitempty"`
+}
+
+type CreateChatNotificationHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateChatNotificationHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateChatNotificationHandler {
+	return &CreateChatNotificationHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateChatNotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req CreateChatNotificationRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	areq := &action.CreateChatNotificationRequest{
+		Name:       req.Name,
+		ProjectRef: projectRef,
+		Type:       req.Type,
+		SecretName: req.SecretName,
+		SecretKey:  req.SecretKey,
+		Channel:    req.Channel,
+		Events:     req.Events,
+	}
+	cschatnotification, err := h.ah.CreateProjectChatNotification(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createChatNotificationResponse(cschatnotification)
+	if err := httpResponse(w, http.StatusCreated, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateChatNotificationRequest struct {
+	Name       string                        `json:"name,omitempty"`
+	Type       types.ChatNotificationType    `json:"type,omitempty"`
+	SecretName string                        `json:"secret_name,omitempty"`
+	SecretKey  string                        `json:"secret_key,omitempty"`
+	Channel    string                        `json:"channel,omitempty"`
+	Events     []types.ChatNotificationEvent `json:"events,omitempty"`
+}
+
+type UpdateChatNotificationHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateChatNotificationHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateChatNotificationHandler {
+	return &UpdateChatNotificationHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateChatNotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	chatNotificationName := vars["chatnotificationname"]
+
+	var req UpdateChatNotificationRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	areq := &action.UpdateChatNotificationRequest{
+		ChatNotificationName: chatNotificationName,
+
+		Name:       req.Name,
+		ProjectRef: projectRef,
+		Type:       req.Type,
+		SecretName: req.SecretName,
+		SecretKey:  req.SecretKey,
+		Channel:    req.Channel,
+		Events:     req.Events,
+	}
+	cschatnotification, err := h.ah.UpdateProjectChatNotification(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createChatNotificationResponse(cschatnotification)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteChatNotificationHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteChatNotificationHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteChatNotificationHandler {
+	return &DeleteChatNotificationHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteChatNotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	chatNotificationName := vars["chatnotificationname"]
+
+	err = h.ah.DeleteProjectChatNotification(ctx, projectRef, chatNotificationName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/types"
 
@@ -161,6 +162,67 @@ func (c *Client) CreateProject(ctx context.Context, req *CreateProjectRequest) (
 	return project, resp, err
 }
 
+func (c *Client) UpdateProject(ctx context.Context, projectRef string, req *UpdateProjectRequest) (*ProjectResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project := new(ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projects", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj), project)
+	return project, resp, err
+}
+
+func (c *Client) GetProjectCaches(ctx context.Context, projectRef string) ([]*CacheResponse, *http.Response, error) {
+	caches := []*CacheResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "caches"), nil, jsonContent, nil, &caches)
+	return caches, resp, err
+}
+
+func (c *Client) GetProjectTaskDurations(ctx context.Context, projectRef, branch string, limit int) ([]*TaskDurationsResponse, *http.Response, error) {
+	q := url.Values{}
+	q.Add("branch", branch)
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	taskDurations := []*TaskDurationsResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "taskdurations"), q, jsonContent, nil, &taskDurations)
+	return taskDurations, resp, err
+}
+
+func (c *Client) SearchProjectLogs(ctx context.Context, projectRef, query string, regex bool, since, until *time.Time, start int64, limit int) ([]*LogMatchResponse, *http.Response, error) {
+	q := url.Values{}
+	q.Add("query", query)
+	if regex {
+		q.Add("regex", "")
+	}
+	if since != nil {
+		q.Add("since", since.Format(time.RFC3339))
+	}
+	if until != nil {
+		q.Add("until", until.Format(time.RFC3339))
+	}
+	if start > 0 {
+		q.Add("start", strconv.FormatInt(start, 10))
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	matches := []*LogMatchResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "logs", "search"), q, jsonContent, nil, &matches)
+	return matches, resp, err
+}
+
+func (c *Client) DeleteProjectCaches(ctx context.Context, projectRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "caches"), nil, jsonContent, nil)
+}
+
+func (c *Client) DeleteProjectCache(ctx context.Context, projectRef, key string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "caches", url.PathEscape(key)), nil, jsonContent, nil)
+}
+
 func (c *Client) CreateProjectGroupSecret(ctx context.Context, projectGroupRef string, req *CreateSecretRequest) (*SecretResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -265,6 +327,156 @@ func (c *Client) DeleteProjectVariable(ctx context.Context, projectRef, variable
 	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "variables", variableName), nil, jsonContent, nil)
 }
 
+func (c *Client) GetProjectGroupRunWebhooks(ctx context.Context, projectGroupRef string, tree bool) ([]*RunWebhookResponse, *http.Response, error) {
+	q := url.Values{}
+	if tree {
+		q.Add("tree", "")
+	}
+
+	runWebhooks := []*RunWebhookResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "runwebhooks"), q, jsonContent, nil, &runWebhooks)
+	return runWebhooks, resp, err
+}
+
+func (c *Client) GetProjectRunWebhooks(ctx context.Context, projectRef string, tree bool) ([]*RunWebhookResponse, *http.Response, error) {
+	q := url.Values{}
+	if tree {
+		q.Add("tree", "")
+	}
+
+	runWebhooks := []*RunWebhookResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "runwebhooks"), q, jsonContent, nil, &runWebhooks)
+	return runWebhooks, resp, err
+}
+
+func (c *Client) CreateProjectGroupRunWebhook(ctx context.Context, projectGroupRef string, req *CreateRunWebhookRequest) (*RunWebhookResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runWebhook := new(RunWebhookResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "runwebhooks"), nil, jsonContent, bytes.NewReader(reqj), runWebhook)
+	return runWebhook, resp, err
+}
+
+func (c *Client) UpdateProjectGroupRunWebhook(ctx context.Context, projectGroupRef, runWebhookName string, req *UpdateRunWebhookRequest) (*RunWebhookResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runWebhook := new(RunWebhookResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "runwebhooks", runWebhookName), nil, jsonContent, bytes.NewReader(reqj), runWebhook)
+	return runWebhook, resp, err
+}
+
+func (c *Client) DeleteProjectGroupRunWebhook(ctx context.Context, projectGroupRef, runWebhookName string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "runwebhooks", runWebhookName), nil, jsonContent, nil)
+}
+
+func (c *Client) CreateProjectRunWebhook(ctx context.Context, projectRef string, req *CreateRunWebhookRequest) (*RunWebhookResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runWebhook := new(RunWebhookResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", path.Join("/projects", url.PathEscape(projectRef), "runwebhooks"), nil, jsonContent, bytes.NewReader(reqj), runWebhook)
+	return runWebhook, resp, err
+}
+
+func (c *Client) UpdateProjectRunWebhook(ctx context.Context, projectRef, runWebhookName string, req *UpdateRunWebhookRequest) (*RunWebhookResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runWebhook := new(RunWebhookResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projects", url.PathEscape(projectRef), "runwebhooks", runWebhookName), nil, jsonContent, bytes.NewReader(reqj), runWebhook)
+	return runWebhook, resp, err
+}
+
+func (c *Client) DeleteProjectRunWebhook(ctx context.Context, projectRef, runWebhookName string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "runwebhooks", runWebhookName), nil, jsonContent, nil)
+}
+
+func (c *Client) GetProjectRunWebhookDeliveries(ctx context.Context, projectRef string, start string, limit int, asc bool) ([]*RunWebhookDeliveryResponse, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	if asc {
+		q.Add("asc", "")
+	}
+
+	deliveries := []*RunWebhookDeliveryResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "runwebhookdeliveries"), q, jsonContent, nil, &deliveries)
+	return deliveries, resp, err
+}
+
+func (c *Client) GetProjectSubscriptions(ctx context.Context, projectRef string) ([]*ProjectSubscriptionResponse, *http.Response, error) {
+	subscriptions := []*ProjectSubscriptionResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "subscriptions"), nil, jsonContent, nil, &subscriptions)
+	return subscriptions, resp, err
+}
+
+func (c *Client) GetProjectSubscription(ctx context.Context, projectRef string) (*ProjectSubscriptionResponse, *http.Response, error) {
+	subscription := new(ProjectSubscriptionResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "subscription"), nil, jsonContent, nil, subscription)
+	return subscription, resp, err
+}
+
+func (c *Client) PutProjectSubscription(ctx context.Context, projectRef string, req *PutProjectSubscriptionRequest) (*ProjectSubscriptionResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subscription := new(ProjectSubscriptionResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projects", url.PathEscape(projectRef), "subscription"), nil, jsonContent, bytes.NewReader(reqj), subscription)
+	return subscription, resp, err
+}
+
+func (c *Client) DeleteProjectSubscription(ctx context.Context, projectRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "subscription"), nil, jsonContent, nil)
+}
+
+func (c *Client) GetProjectChatNotifications(ctx context.Context, projectRef string) ([]*ChatNotificationResponse, *http.Response, error) {
+	chatNotifications := []*ChatNotificationResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "chatnotifications"), nil, jsonContent, nil, &chatNotifications)
+	return chatNotifications, resp, err
+}
+
+func (c *Client) CreateProjectChatNotification(ctx context.Context, projectRef string, req *CreateChatNotificationRequest) (*ChatNotificationResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chatNotification := new(ChatNotificationResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", path.Join("/projects", url.PathEscape(projectRef), "chatnotifications"), nil, jsonContent, bytes.NewReader(reqj), chatNotification)
+	return chatNotification, resp, err
+}
+
+func (c *Client) UpdateProjectChatNotification(ctx context.Context, projectRef, chatNotificationName string, req *UpdateChatNotificationRequest) (*ChatNotificationResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chatNotification := new(ChatNotificationResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projects", url.PathEscape(projectRef), "chatnotifications", chatNotificationName), nil, jsonContent, bytes.NewReader(reqj), chatNotification)
+	return chatNotification, resp, err
+}
+
+func (c *Client) DeleteProjectChatNotification(ctx context.Context, projectRef, chatNotificationName string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "chatnotifications", chatNotificationName), nil, jsonContent, nil)
+}
+
 func (c *Client) DeleteProject(ctx context.Context, projectRef string) (*http.Response, error) {
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s", url.PathEscape(projectRef)), nil, jsonContent, nil)
 }
@@ -382,7 +594,25 @@ func (c *Client) GetRun(ctx context.Context, runID string) (*RunResponse, *http.
 	return run, resp, err
 }
 
-func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups, runGroups []string, start string, limit int, asc bool) ([]*RunsResponse, *http.Response, error) {
+func (c *Client) GetRunTimeline(ctx context.Context, runID string) (*RunTimelineResponse, *http.Response, error) {
+	timeline := new(RunTimelineResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/timeline", runID), nil, jsonContent, nil, timeline)
+	return timeline, resp, err
+}
+
+// ExportRun returns the response containing the run export bundle. The caller
+// must close the response body
+func (c *Client) ExportRun(ctx context.Context, runID string) (*http.Response, error) {
+	return c.getResponse(ctx, "GET", fmt.Sprintf("/runs/%s/export", runID), nil, nil, nil)
+}
+
+func (c *Client) ImportRun(ctx context.Context, projectRef string, r io.Reader) (*RunResponse, *http.Response, error) {
+	run := new(RunResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", path.Join("/projects", url.PathEscape(projectRef), "runs", "import"), nil, nil, r, run)
+	return run, resp, err
+}
+
+func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups, runGroups []string, filter *RunsFilter, start string, limit int, asc bool) ([]*RunsResponse, *http.Response, error) {
 	q := url.Values{}
 	for _, phase := range phaseFilter {
 		q.Add("phase", phase)
@@ -396,6 +626,31 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups,
 	for _, runGroup := range runGroups {
 		q.Add("rungroup", runGroup)
 	}
+	if filter != nil {
+		filters := map[string]string{
+			"commit":      filter.CommitSHA,
+			"ref":         filter.Ref,
+			"branch":      filter.Branch,
+			"tag":         filter.Tag,
+			"pullrequest": filter.PullRequestID,
+			"trigger":     filter.Trigger,
+			"name":        filter.Name,
+		}
+		for k, v := range filters {
+			if v != "" {
+				q.Add(k, v)
+			}
+		}
+		for k, v := range filter.Annotations {
+			q.Add("annotation", k+"="+v)
+		}
+		if filter.Since != nil {
+			q.Add("since", filter.Since.Format(time.RFC3339Nano))
+		}
+		if filter.Until != nil {
+			q.Add("until", filter.Until.Format(time.RFC3339Nano))
+		}
+	}
 	if start != "" {
 		q.Add("start", start)
 	}
@@ -498,3 +753,33 @@ func (c *Client) GetOrgMembers(ctx context.Context, orgRef string) (*OrgMembersR
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/orgs/%s/members", orgRef), nil, jsonContent, nil, &res)
 	return res, resp, err
 }
+
+func (c *Client) GetExecutors(ctx context.Context) ([]*ExecutorResponse, *http.Response, error) {
+	executors := []*ExecutorResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/executors", nil, jsonContent, nil, &executors)
+	return executors, resp, err
+}
+
+func (c *Client) CordonExecutor(ctx context.Context, executorID string) (*ExecutorResponse, *http.Response, error) {
+	executor := new(ExecutorResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/executors/%s/cordon", executorID), nil, jsonContent, nil, executor)
+	return executor, resp, err
+}
+
+func (c *Client) UncordonExecutor(ctx context.Context, executorID string) (*ExecutorResponse, *http.Response, error) {
+	executor := new(ExecutorResponse)
+	resp, err := c.getParsedResponse(ctx, "DELETE", fmt.Sprintf("/executors/%s/cordon", executorID), nil, jsonContent, nil, executor)
+	return executor, resp, err
+}
+
+func (c *Client) DrainExecutor(ctx context.Context, executorID string) (*ExecutorDrainStatusResponse, *http.Response, error) {
+	ds := new(ExecutorDrainStatusResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/executors/%s/drain", executorID), nil, jsonContent, nil, ds)
+	return ds, resp, err
+}
+
+func (c *Client) GetExecutorDrainStatus(ctx context.Context, executorID string) (*ExecutorDrainStatusResponse, *http.Response, error) {
+	ds := new(ExecutorDrainStatusResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/executors/%s/drain", executorID), nil, jsonContent, nil, ds)
+	return ds, resp, err
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"go.uber.org/zap"
+
+	"github.com/gorilla/mux"
+)
+
+type ExecutorResponse struct {
+	ID                   string            `json:"id"`
+	ListenURL            string            `json:"listen_url"`
+	Archs                []string          `json:"archs"`
+	Labels               map[string]string `json:"labels"`
+	ActiveTasksLimit     int               `json:"active_tasks_limit"`
+	ActiveTasks          int               `json:"active_tasks"`
+	Cordoned             bool              `json:"cordoned"`
+	ShuttingDown         bool              `json:"shutting_down"`
+	LastStatusUpdateTime time.Time         `json:"last_status_update_time"`
+}
+
+func createExecutorResponse(e *rstypes.Executor) *ExecutorResponse {
+	archs := make([]string, len(e.Archs))
+	for i, arch := range e.Archs {
+		archs[i] = string(arch)
+	}
+
+	return &ExecutorResponse{
+		ID:                   e.ID,
+		ListenURL:            e.ListenURL,
+		Archs:                archs,
+		Labels:               e.Labels,
+		ActiveTasksLimit:     e.ActiveTasksLimit,
+		ActiveTasks:          e.ActiveTasks,
+		Cordoned:             e.Cordoned,
+		ShuttingDown:         e.ShuttingDown,
+		LastStatusUpdateTime: e.LastStatusUpdateTime,
+	}
+}
+
+type ExecutorDrainStatusResponse struct {
+	Executor *ExecutorResponse `json:"executor"`
+	// ActiveTasks are the ids of the executor tasks not yet finished
+	ActiveTasks []string `json:"active_tasks"`
+	Drained     bool     `json:"drained"`
+}
+
+func createExecutorDrainStatusResponse(ds *rsapi.ExecutorDrainStatusResponse) *ExecutorDrainStatusResponse {
+	return &ExecutorDrainStatusResponse{
+		Executor:    createExecutorResponse(ds.Executor),
+		ActiveTasks: ds.ActiveTasks,
+		Drained:     ds.Drained,
+	}
+}
+
+type ExecutorsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorsHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorsHandler {
+	return &ExecutorsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ExecutorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	executors, err := h.ah.GetExecutors(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*ExecutorResponse, len(executors))
+	for i, e := range executors {
+		res[i] = createExecutorResponse(e)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ExecutorCordonHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorCordonHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorCordonHandler {
+	return &ExecutorCordonHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ExecutorCordonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	executorID := vars["executorid"]
+
+	var executor *rstypes.Executor
+	var err error
+	// PUT cordons the executor, DELETE uncordons it
+	if r.Method == "PUT" {
+		executor, err = h.ah.CordonExecutor(ctx, executorID)
+	} else {
+		executor, err = h.ah.UncordonExecutor(ctx, executorID)
+	}
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createExecutorResponse(executor)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ExecutorDrainHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorDrainHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorDrainHandler {
+	return &ExecutorDrainHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ExecutorDrainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	executorID := vars["executorid"]
+
+	var ds *rsapi.ExecutorDrainStatusResponse
+	var err error
+	// PUT starts draining the executor, GET only reports the drain status
+	if r.Method == "PUT" {
+		ds, err = h.ah.DrainExecutor(ctx, executorID)
+	} else {
+		ds, err = h.ah.GetExecutorDrainStatus(ctx, executorID)
+	}
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createExecutorDrainStatusResponse(ds)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
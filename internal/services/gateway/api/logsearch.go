@@ -0,0 +1,146 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultLogSearchLimit = 100
+	MaxLogSearchLimit     = 1000
+)
+
+type LogMatchResponse struct {
+	ID         int64  `json:"id"`
+	RunID      string `json:"run_id"`
+	RunCounter uint64 `json:"run_counter"`
+	TaskID     string `json:"task_id"`
+	TaskName   string `json:"task_name"`
+	Step       int    `json:"step"`
+	Line       int    `json:"line"`
+	Content    string `json:"content"`
+}
+
+type ProjectLogSearchHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectLogSearchHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectLogSearchHandler {
+	return &ProjectLogSearchHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectLogSearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	q := r.URL.Query()
+
+	limitS := q.Get("limit")
+	limit := DefaultLogSearchLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit <= 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater than 0")))
+		return
+	}
+	if limit > MaxLogSearchLimit {
+		limit = MaxLogSearchLimit
+	}
+
+	var since, until *time.Time
+	if sinceS := q.Get("since"); sinceS != "" {
+		t, err := time.Parse(time.RFC3339, sinceS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse since: %w", err)))
+			return
+		}
+		since = &t
+	}
+	if untilS := q.Get("until"); untilS != "" {
+		t, err := time.Parse(time.RFC3339, untilS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse until: %w", err)))
+			return
+		}
+		until = &t
+	}
+
+	var start int64
+	if startS := q.Get("start"); startS != "" {
+		start, err = strconv.ParseInt(startS, 10, 64)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse start: %w", err)))
+			return
+		}
+	}
+
+	_, regex := q["regex"]
+
+	areq := &action.SearchProjectLogsRequest{
+		ProjectRef: projectRef,
+		Query:      q.Get("query"),
+		Regex:      regex,
+		Since:      since,
+		Until:      until,
+		StartID:    start,
+		Limit:      limit,
+	}
+	matches, err := h.ah.SearchProjectLogs(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*LogMatchResponse, len(matches))
+	for i, m := range matches {
+		res[i] = &LogMatchResponse{
+			ID:         m.ID,
+			RunID:      m.RunID,
+			RunCounter: m.RunCounter,
+			TaskID:     m.TaskID,
+			TaskName:   m.TaskName,
+			Step:       m.Step,
+			Line:       m.Line,
+			Content:    m.Content,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -18,14 +18,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"time"
 
 	csapi "agola.io/agola/internal/services/configstore/api"
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/services/types"
 	"agola.io/agola/internal/util"
 
+	units "github.com/docker/go-units"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
 )
 
 type CreateProjectRequest struct {
@@ -80,6 +83,20 @@ func (h *CreateProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 type UpdateProjectRequest struct {
 	Name       string           `json:"name,omitempty"`
 	Visibility types.Visibility `json:"visibility,omitempty"`
+
+	// CacheQuota is the max size of the project caches (i.e. 10GiB). 0 removes
+	// the quota
+	CacheQuota string `json:"cache_quota,omitempty"`
+
+	// RunRetention replaces the project run retention policy. An empty policy
+	// removes it
+	RunRetention *RunRetentionPolicy `json:"run_retention,omitempty"`
+}
+
+type RunRetentionPolicy struct {
+	KeepLast   int    `json:"keep_last,omitempty"`
+	MaxAge     string `json:"max_age,omitempty"`
+	KeepTagged bool   `json:"keep_tagged,omitempty"`
 }
 
 type UpdateProjectHandler struct {
@@ -111,6 +128,28 @@ func (h *UpdateProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		Name:       req.Name,
 		Visibility: req.Visibility,
 	}
+	if req.CacheQuota != "" {
+		cacheQuota, err := units.RAMInBytes(req.CacheQuota)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("wrong cache quota %q: %w", req.CacheQuota, err)))
+			return
+		}
+		areq.CacheQuota = &cacheQuota
+	}
+	if req.RunRetention != nil {
+		areq.RunRetention = &types.RunRetentionPolicy{
+			KeepLast:   req.RunRetention.KeepLast,
+			KeepTagged: req.RunRetention.KeepTagged,
+		}
+		if req.RunRetention.MaxAge != "" {
+			maxAge, err := time.ParseDuration(req.RunRetention.MaxAge)
+			if err != nil {
+				httpError(w, util.NewErrBadRequest(errors.Errorf("wrong run retention max age %q: %w", req.RunRetention.MaxAge, err)))
+				return
+			}
+			areq.RunRetention.MaxAge = maxAge
+		}
+	}
 	project, err := h.ah.UpdateProject(ctx, projectRef, areq)
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
@@ -240,12 +279,14 @@ func (h *ProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type ProjectResponse struct {
-	ID               string           `json:"id,omitempty"`
-	Name             string           `json:"name,omitempty"`
-	Path             string           `json:"path,omitempty"`
-	ParentPath       string           `json:"parent_path,omitempty"`
-	Visibility       types.Visibility `json:"visibility,omitempty"`
-	GlobalVisibility string           `json:"global_visibility,omitempty"`
+	ID               string              `json:"id,omitempty"`
+	Name             string              `json:"name,omitempty"`
+	Path             string              `json:"path,omitempty"`
+	ParentPath       string              `json:"parent_path,omitempty"`
+	Visibility       types.Visibility    `json:"visibility,omitempty"`
+	GlobalVisibility string              `json:"global_visibility,omitempty"`
+	CacheQuota       string              `json:"cache_quota,omitempty"`
+	RunRetention     *RunRetentionPolicy `json:"run_retention,omitempty"`
 }
 
 func createProjectResponse(r *csapi.Project) *ProjectResponse {
@@ -257,6 +298,18 @@ func createProjectResponse(r *csapi.Project) *ProjectResponse {
 		Visibility:       r.Visibility,
 		GlobalVisibility: string(r.GlobalVisibility),
 	}
+	if r.CacheQuota > 0 {
+		res.CacheQuota = units.BytesSize(float64(r.CacheQuota))
+	}
+	if r.RunRetention != nil {
+		res.RunRetention = &RunRetentionPolicy{
+			KeepLast:   r.RunRetention.KeepLast,
+			KeepTagged: r.RunRetention.KeepTagged,
+		}
+		if r.RunRetention.MaxAge > 0 {
+			res.RunRetention.MaxAge = r.RunRetention.MaxAge.String()
+		}
+	}
 
 	return res
 }
@@ -19,10 +19,12 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"agola.io/agola/internal/services/gateway/action"
 	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/steplog"
 	"agola.io/agola/internal/util"
 	"go.uber.org/zap"
 	errors "golang.org/x/xerrors"
@@ -112,6 +114,8 @@ type RunTaskResponseStep struct {
 
 	StartTime *time.Time `json:"start_time"`
 	EndTime   *time.Time `json:"end_time"`
+
+	LogTruncated bool `json:"log_truncated"`
 }
 
 func createRunResponse(r *rstypes.Run, rc *rstypes.RunConfig) *RunResponse {
@@ -192,6 +196,8 @@ func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *Run
 			Phase:     rt.Steps[i].Phase,
 			StartTime: rt.Steps[i].StartTime,
 			EndTime:   rt.Steps[i].EndTime,
+
+			LogTruncated: rt.Steps[i].LogTruncated,
 		}
 		rcts := rct.Steps[i]
 		switch rcts := rcts.(type) {
@@ -301,6 +307,22 @@ func createRunsResponse(r *rstypes.Run) *RunsResponse {
 	return run
 }
 
+// RunsFilter defines the filters used when searching runs
+type RunsFilter struct {
+	// CommitSHA matches the runs with a commit sha starting with the provided value
+	CommitSHA     string
+	Ref           string
+	Branch        string
+	Tag           string
+	PullRequestID string
+	Trigger       string
+	Name          string
+	Annotations   map[string]string
+	// Since and Until match the runs created in the provided time range
+	Since *time.Time
+	Until *time.Time
+}
+
 type RunsHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -352,6 +374,33 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	start := q.Get("start")
 
+	annotations := map[string]string{}
+	for _, a := range q["annotation"] {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("wrong annotation filter %q, must be in the format key=value", a)))
+			return
+		}
+		annotations[parts[0]] = parts[1]
+	}
+	var since, until *time.Time
+	if sinceS := q.Get("since"); sinceS != "" {
+		t, err := time.Parse(time.RFC3339, sinceS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse since: %w", err)))
+			return
+		}
+		since = &t
+	}
+	if untilS := q.Get("until"); untilS != "" {
+		t, err := time.Parse(time.RFC3339, untilS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse until: %w", err)))
+			return
+		}
+		until = &t
+	}
+
 	areq := &action.GetRunsRequest{
 		PhaseFilter:  phaseFilter,
 		ResultFilter: resultFilter,
@@ -361,6 +410,17 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		StartRunID:   start,
 		Limit:        limit,
 		Asc:          asc,
+
+		CommitSHA:     q.Get("commit"),
+		Ref:           q.Get("ref"),
+		Branch:        q.Get("branch"),
+		Tag:           q.Get("tag"),
+		PullRequestID: q.Get("pullrequest"),
+		Trigger:       q.Get("trigger"),
+		Name:          q.Get("name"),
+		Annotations:   annotations,
+		Since:         since,
+		Until:         until,
 	}
 	runsResp, err := h.ah.GetRuns(ctx, areq)
 	if httpError(w, err) {
@@ -513,12 +573,19 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		follow = true
 	}
 
+	format := steplog.Format(q.Get("format"))
+	if format != "" && !steplog.IsValidFormat(format) {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("invalid log format %q", format)))
+		return
+	}
+
 	areq := &action.GetLogsRequest{
 		RunID:  runID,
 		TaskID: taskID,
 		Setup:  setup,
 		Step:   step,
 		Follow: follow,
+		Format: format,
 	}
 
 	resp, err := h.ah.GetLogs(ctx, areq)
@@ -529,6 +596,9 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
 
 	defer resp.Body.Close()
 	if err := sendLogs(w, resp.Body); err != nil {
@@ -0,0 +1,240 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// All the durations are expressed in nanoseconds
+
+type RunTimelineResponse struct {
+	RunID   string `json:"run_id"`
+	Counter uint64 `json:"counter"`
+	Name    string `json:"name"`
+
+	EnqueueTime *time.Time `json:"enqueue_time"`
+	StartTime   *time.Time `json:"start_time"`
+	EndTime     *time.Time `json:"end_time"`
+
+	QueueDuration *time.Duration `json:"queue_duration"`
+	Duration      *time.Duration `json:"duration"`
+
+	Tasks []*RunTimelineTaskResponse `json:"tasks"`
+
+	CriticalPath         []string       `json:"critical_path"`
+	CriticalPathDuration *time.Duration `json:"critical_path_duration"`
+}
+
+type RunTimelineTaskResponse struct {
+	ID     string                `json:"id"`
+	Name   string                `json:"name"`
+	Level  int                   `json:"level"`
+	Status rstypes.RunTaskStatus `json:"status"`
+
+	ReadyTime *time.Time `json:"ready_time"`
+	StartTime *time.Time `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
+
+	WaitDuration  *time.Duration `json:"wait_duration"`
+	SetupDuration *time.Duration `json:"setup_duration"`
+	Duration      *time.Duration `json:"duration"`
+
+	Steps []*RunTimelineStepResponse `json:"steps"`
+}
+
+type RunTimelineStepResponse struct {
+	Name     string         `json:"name"`
+	Duration *time.Duration `json:"duration"`
+}
+
+func createRunTimelineResponse(t *action.RunTimeline) *RunTimelineResponse {
+	res := &RunTimelineResponse{
+		RunID:   t.RunID,
+		Counter: t.Counter,
+		Name:    t.Name,
+
+		EnqueueTime: t.EnqueueTime,
+		StartTime:   t.StartTime,
+		EndTime:     t.EndTime,
+
+		QueueDuration: t.QueueDuration,
+		Duration:      t.Duration,
+
+		Tasks: make([]*RunTimelineTaskResponse, len(t.Tasks)),
+
+		CriticalPath:         t.CriticalPath,
+		CriticalPathDuration: t.CriticalPathDuration,
+	}
+
+	for i, tt := range t.Tasks {
+		rtt := &RunTimelineTaskResponse{
+			ID:     tt.ID,
+			Name:   tt.Name,
+			Level:  tt.Level,
+			Status: tt.Status,
+
+			ReadyTime: tt.ReadyTime,
+			StartTime: tt.StartTime,
+			EndTime:   tt.EndTime,
+
+			WaitDuration:  tt.WaitDuration,
+			SetupDuration: tt.SetupDuration,
+			Duration:      tt.Duration,
+
+			Steps: make([]*RunTimelineStepResponse, len(tt.Steps)),
+		}
+		for j, s := range tt.Steps {
+			rtt.Steps[j] = &RunTimelineStepResponse{
+				Name:     s.Name,
+				Duration: s.Duration,
+			}
+		}
+		res.Tasks[i] = rtt
+	}
+
+	return res
+}
+
+type RunTimelineHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunTimelineHandler(logger *zap.Logger, ah *action.ActionHandler) *RunTimelineHandler {
+	return &RunTimelineHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunTimelineHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	timeline, err := h.ah.GetRunTimeline(ctx, runID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createRunTimelineResponse(timeline)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type TaskDurationsResponse struct {
+	Name string                     `json:"name"`
+	Runs []*TaskRunDurationResponse `json:"runs"`
+
+	Min     time.Duration `json:"min"`
+	Max     time.Duration `json:"max"`
+	Average time.Duration `json:"average"`
+}
+
+type TaskRunDurationResponse struct {
+	RunID    string                `json:"run_id"`
+	Counter  uint64                `json:"counter"`
+	Status   rstypes.RunTaskStatus `json:"status"`
+	Duration time.Duration         `json:"duration"`
+}
+
+func createTaskDurationsResponse(td *action.TaskDurations) *TaskDurationsResponse {
+	res := &TaskDurationsResponse{
+		Name:    td.Name,
+		Runs:    make([]*TaskRunDurationResponse, len(td.Runs)),
+		Min:     td.Min,
+		Max:     td.Max,
+		Average: td.Average,
+	}
+	for i, trd := range td.Runs {
+		res.Runs[i] = &TaskRunDurationResponse{
+			RunID:    trd.RunID,
+			Counter:  trd.Counter,
+			Status:   trd.Status,
+			Duration: trd.Duration,
+		}
+	}
+	return res
+}
+
+type ProjectTaskDurationsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectTaskDurationsHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectTaskDurationsHandler {
+	return &ProjectTaskDurationsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectTaskDurationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	q := r.URL.Query()
+
+	limitS := q.Get("limit")
+	limit := action.DefaultTaskDurationsRunsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit <= 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater than 0")))
+		return
+	}
+	if limit > action.MaxTaskDurationsRunsLimit {
+		limit = action.MaxTaskDurationsRunsLimit
+	}
+
+	areq := &action.GetProjectTaskDurationsRequest{
+		ProjectRef: projectRef,
+		Branch:     q.Get("branch"),
+		Limit:      limit,
+	}
+	tds, err := h.ah.GetProjectTaskDurations(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*TaskDurationsResponse, len(tds))
+	for i, td := range tds {
+		res[i] = createTaskDurationsResponse(td)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	ntypes "agola.io/agola/internal/services/notification/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+	"go.uber.org/zap"
+
+	"github.com/gorilla/mux"
+	errors "golang.org/x/xerrors"
+)
+
+type RunWebhookResponse struct {
+	ID         string                  `json:"id"`
+	Name       string                  `json:"name"`
+	URL        string                  `json:"url"`
+	HasSecret  bool                    `json:"has_secret"`
+	SkipVerify bool                    `json:"skip_verify"`
+	Events     []types.RunWebhookEvent `json:"events"`
+	ParentPath string                  `json:"parent_path"`
+}
+
+func createRunWebhookResponse(rw *csapi.RunWebhook) *RunWebhookResponse {
+	// never return the run webhook secret
+	return &RunWebhookResponse{
+		ID:         rw.ID,
+		Name:       rw.Name,
+		URL:        rw.URL,
+		HasSecret:  rw.Secret != "",
+		SkipVerify: rw.SkipVerify,
+		Events:     rw.Events,
+		ParentPath: rw.ParentPath,
+	}
+}
+
+type RunWebhooksHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunWebhooksHandler(logger *zap.Logger, ah *action.ActionHandler) *RunWebhooksHandler {
+	return &RunWebhooksHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunWebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	_, tree := query["tree"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	areq := &action.GetRunWebhooksRequest{
+		ParentType: parentType,
+		ParentRef:  parentRef,
+		Tree:       tree,
+	}
+	csrunwebhooks, err := h.ah.GetRunWebhooks(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	runWebhooks := make([]*RunWebhookResponse, len(csrunwebhooks))
+	for i, rw := range csrunwebhooks {
+		runWebhooks[i] = createRunWebhookResponse(rw)
+	}
+
+	if err := httpResponse(w, http.StatusOK, runWebhooks); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateRunWebhookRequest struct {
+	Name       string                  `json:"name,omitempty"`
+	URL        string                  `json:"url,omitempty"`
+	Secret     string                  `json:"secret,omitempty"`
+	SkipVerify bool                    `json:"skip_verify,omitempty"`
+	Events     []types.RunWebhookEvent `json:"events,omitempty"`
+}
+
+type CreateRunWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateRunWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateRunWebhookHandler {
+	return &CreateRunWebhookHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateRunWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var req CreateRunWebhookRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	areq := &action.CreateRunWebhookRequest{
+		Name:       req.Name,
+		ParentType: parentType,
+		ParentRef:  parentRef,
+		URL:        req.URL,
+		Secret:     req.Secret,
+		SkipVerify: req.SkipVerify,
+		Events:     req.Events,
+	}
+	csrunwebhook, err := h.ah.CreateRunWebhook(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createRunWebhookResponse(csrunwebhook)
+	if err := httpResponse(w, http.StatusCreated, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateRunWebhookRequest struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+	// Secret is the new run webhook secret. If empty the current secret is kept
+	Secret     string                  `json:"secret,omitempty"`
+	SkipVerify bool                    `json:"skip_verify,omitempty"`
+	Events     []types.RunWebhookEvent `json:"events,omitempty"`
+}
+
+type UpdateRunWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateRunWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateRunWebhookHandler {
+	return &UpdateRunWebhookHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateRunWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runWebhookName := vars["runwebhookname"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var req UpdateRunWebhookRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	areq := &action.UpdateRunWebhookRequest{
+		RunWebhookName: runWebhookName,
+
+		Name:       req.Name,
+		ParentType: parentType,
+		ParentRef:  parentRef,
+		URL:        req.URL,
+		Secret:     req.Secret,
+		SkipVerify: req.SkipVerify,
+		Events:     req.Events,
+	}
+	csrunwebhook, err := h.ah.UpdateRunWebhook(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createRunWebhookResponse(csrunwebhook)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteRunWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteRunWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteRunWebhookHandler {
+	return &DeleteRunWebhookHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteRunWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runWebhookName := vars["runwebhookname"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	err = h.ah.DeleteRunWebhook(ctx, parentType, parentRef, runWebhookName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+const (
+	DefaultRunWebhookDeliveriesLimit = 25
+	MaxRunWebhookDeliveriesLimit     = 40
+)
+
+type RunWebhookDeliveryAttemptResponse struct {
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration"`
+	StatusCode int           `json:"status_code"`
+	Error      string        `json:"error"`
+}
+
+type RunWebhookDeliveryResponse struct {
+	ID              string                               `json:"id"`
+	RunWebhookID    string                               `json:"run_webhook_id"`
+	RunWebhookName  string                               `json:"run_webhook_name"`
+	URL             string                               `json:"url"`
+	Event           types.RunWebhookEvent                `json:"event"`
+	RunID           string                               `json:"run_id"`
+	Payload         json.RawMessage                      `json:"payload"`
+	Status          ntypes.RunWebhookDeliveryStatus      `json:"status"`
+	Attempts        []*RunWebhookDeliveryAttemptResponse `json:"attempts"`
+	CreationTime    time.Time                            `json:"creation_time"`
+	NextAttemptTime *time.Time                           `json:"next_attempt_time"`
+}
+
+func createRunWebhookDeliveryResponse(d *ntypes.RunWebhookDelivery) *RunWebhookDeliveryResponse {
+	res := &RunWebhookDeliveryResponse{
+		ID:              d.ID,
+		RunWebhookID:    d.RunWebhookID,
+		RunWebhookName:  d.RunWebhookName,
+		URL:             d.URL,
+		Event:           d.Event,
+		RunID:           d.RunID,
+		Payload:         d.Payload,
+		Status:          d.Status,
+		Attempts:        make([]*RunWebhookDeliveryAttemptResponse, len(d.Attempts)),
+		CreationTime:    d.CreationTime,
+		NextAttemptTime: d.NextAttemptTime,
+	}
+	for i, a := range d.Attempts {
+		res.Attempts[i] = &RunWebhookDeliveryAttemptResponse{
+			Time:       a.Time,
+			Duration:   a.Duration,
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+		}
+	}
+
+	return res
+}
+
+type ProjectRunWebhookDeliveriesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRunWebhookDeliveriesHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRunWebhookDeliveriesHandler {
+	return &ProjectRunWebhookDeliveriesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRunWebhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	q := r.URL.Query()
+
+	limitS := q.Get("limit")
+	limit := DefaultRunWebhookDeliveriesLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit > MaxRunWebhookDeliveriesLimit {
+		limit = MaxRunWebhookDeliveriesLimit
+	}
+	asc := false
+	if _, ok := q["asc"]; ok {
+		asc = true
+	}
+
+	start := q.Get("start")
+
+	areq := &action.GetProjectRunWebhookDeliveriesRequest{
+		ProjectRef: projectRef,
+		Start:      start,
+		Limit:      limit,
+		Asc:        asc,
+	}
+	deliveries, err := h.ah.GetProjectRunWebhookDeliveries(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*RunWebhookDeliveryResponse, len(deliveries))
+	for i, d := range deliveries {
+		res[i] = createRunWebhookDeliveryResponse(d)
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"agola.io/agola/internal/services/gateway/action"
+	ntypes "agola.io/agola/internal/services/notification/types"
+	"agola.io/agola/internal/util"
+	"go.uber.org/zap"
+
+	"github.com/gorilla/mux"
+)
+
+type ProjectSubscriptionResponse struct {
+	UserID   string   `json:"user_id"`
+	Email    string   `json:"email"`
+	Branches []string `json:"branches"`
+}
+
+func createProjectSubscriptionResponse(s *ntypes.ProjectSubscription) *ProjectSubscriptionResponse {
+	return &ProjectSubscriptionResponse{
+		UserID:   s.UserID,
+		Email:    s.Email,
+		Branches: s.Branches,
+	}
+}
+
+type ProjectSubscriptionsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectSubscriptionsHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectSubscriptionsHandler {
+	return &ProjectSubscriptionsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectSubscriptionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	subscriptions, err := h.ah.GetProjectSubscriptions(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*ProjectSubscriptionResponse, len(subscriptions))
+	for i, s := range subscriptions {
+		res[i] = createProjectSubscriptionResponse(s)
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectSubscriptionHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectSubscriptionHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectSubscriptionHandler {
+	return &ProjectSubscriptionHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	subscription, err := h.ah.GetProjectSubscription(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectSubscriptionResponse(subscription)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type PutProjectSubscriptionRequest struct {
+	// Email must be the email of one of the user linked accounts
+	Email string `json:"email,omitempty"`
+	// Branches are the watched branches. If empty all the branches are watched
+	Branches []string `json:"branches,omitempty"`
+}
+
+type PutProjectSubscriptionHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewPutProjectSubscriptionHandler(logger *zap.Logger, ah *action.ActionHandler) *PutProjectSubscriptionHandler {
+	return &PutProjectSubscriptionHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *PutProjectSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req PutProjectSubscriptionRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.PutProjectSubscriptionRequest{
+		ProjectRef: projectRef,
+		Email:      req.Email,
+		Branches:   req.Branches,
+	}
+	subscription, err := h.ah.PutProjectSubscription(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectSubscriptionResponse(subscription)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteProjectSubscriptionHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteProjectSubscriptionHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteProjectSubscriptionHandler {
+	return &DeleteProjectSubscriptionHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteProjectSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	err = h.ah.DeleteProjectSubscription(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -47,7 +47,17 @@ func NewWebhooksHandler(logger *zap.Logger, ah *action.ActionHandler, configstor
 }
 
 func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := h.handleWebhook(r)
+	skipped, err := h.handleWebhook(r)
+	switch {
+	case errors.Is(err, &util.ErrBadRequest{}):
+		webhooksProcessed.WithLabelValues(webhookOutcomeInvalid).Inc()
+	case err != nil:
+		webhooksProcessed.WithLabelValues(webhookOutcomeError).Inc()
+	case skipped:
+		webhooksProcessed.WithLabelValues(webhookOutcomeSkipped).Inc()
+	default:
+		webhooksProcessed.WithLabelValues(webhookOutcomeSuccess).Inc()
+	}
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
@@ -58,38 +68,39 @@ func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *webhooksHandler) handleWebhook(r *http.Request) error {
+// handleWebhook handles the webhook and reports if it was skipped
+func (h *webhooksHandler) handleWebhook(r *http.Request) (bool, error) {
 	ctx := r.Context()
 
 	projectID := r.URL.Query().Get("projectid")
 	if projectID == "" {
-		return util.NewErrBadRequest(errors.Errorf("bad webhook url %q. Missing projectid", r.URL))
+		return false, util.NewErrBadRequest(errors.Errorf("bad webhook url %q. Missing projectid", r.URL))
 	}
 
 	defer r.Body.Close()
 
 	csProject, _, err := h.configstoreClient.GetProject(ctx, projectID)
 	if err != nil {
-		return util.NewErrBadRequest(errors.Errorf("failed to get project %s: %w", projectID, err))
+		return false, util.NewErrBadRequest(errors.Errorf("failed to get project %s: %w", projectID, err))
 	}
 	project := csProject.Project
 
 	user, _, err := h.configstoreClient.GetUserByLinkedAccount(ctx, project.LinkedAccountID)
 	if err != nil {
-		return util.NewErrInternal(errors.Errorf("failed to get user by linked account %q: %w", project.LinkedAccountID, err))
+		return false, util.NewErrInternal(errors.Errorf("failed to get user by linked account %q: %w", project.LinkedAccountID, err))
 	}
 	la := user.LinkedAccounts[project.LinkedAccountID]
 	if la == nil {
-		return util.NewErrInternal(errors.Errorf("linked account %q in user %q doesn't exist", project.LinkedAccountID, user.Name))
+		return false, util.NewErrInternal(errors.Errorf("linked account %q in user %q doesn't exist", project.LinkedAccountID, user.Name))
 	}
 	rs, _, err := h.configstoreClient.GetRemoteSource(ctx, la.RemoteSourceID)
 	if err != nil {
-		return util.NewErrInternal(errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, err))
+		return false, util.NewErrInternal(errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, err))
 	}
 
 	gitSource, err := h.ah.GetGitSource(ctx, rs, user.Name, la)
 	if err != nil {
-		return util.NewErrInternal(errors.Errorf("failed to create gitea client: %w", err))
+		return false, util.NewErrInternal(errors.Errorf("failed to create gitea client: %w", err))
 	}
 
 	sshPrivKey := project.SSHPrivateKey
@@ -102,13 +113,13 @@ func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 
 	webhookData, err := gitSource.ParseWebhook(r, project.WebhookSecret)
 	if err != nil {
-		return util.NewErrBadRequest(errors.Errorf("failed to parse webhook: %w", err))
+		return false, util.NewErrBadRequest(errors.Errorf("failed to parse webhook: %w", err))
 	}
 	// skip nil webhook data
 	// TODO(sgotti) report the reason of the skip
 	if webhookData == nil {
 		h.log.Infof("skipping webhook")
-		return nil
+		return true, nil
 	}
 
 	cloneURL := webhookData.SSHURL
@@ -140,8 +151,8 @@ func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 		CompareLink:     webhookData.CompareLink,
 	}
 	if err := h.ah.CreateRuns(ctx, req); err != nil {
-		return util.NewErrInternal(errors.Errorf("failed to create run: %w", err))
+		return false, util.NewErrInternal(errors.Errorf("failed to create run: %w", err))
 	}
 
-	return nil
+	return false, nil
 }
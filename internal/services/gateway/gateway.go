@@ -29,12 +29,14 @@ import (
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/services/gateway/api"
 	"agola.io/agola/internal/services/gateway/handlers"
+	nsapi "agola.io/agola/internal/services/notification/api"
 	rsapi "agola.io/agola/internal/services/runservice/api"
 	"agola.io/agola/internal/util"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	ghandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	errors "golang.org/x/xerrors"
@@ -123,8 +125,12 @@ func NewGateway(gc *config.Config) (*Gateway, error) {
 
 	configstoreClient := csapi.NewClient(c.ConfigstoreURL)
 	runserviceClient := rsapi.NewClient(c.RunserviceURL)
+	var notificationClient *nsapi.Client
+	if c.NotificationURL != "" {
+		notificationClient = nsapi.NewClient(c.NotificationURL)
+	}
 
-	ah := action.NewActionHandler(logger, sd, configstoreClient, runserviceClient, gc.ID, c.APIExposedURL, c.WebExposedURL)
+	ah := action.NewActionHandler(logger, sd, configstoreClient, runserviceClient, notificationClient, gc.ID, c.APIExposedURL, c.WebExposedURL)
 
 	return &Gateway{
 		c:                 c,
@@ -136,7 +142,8 @@ func NewGateway(gc *config.Config) (*Gateway, error) {
 	}, nil
 }
 
-func (g *Gateway) Run(ctx context.Context) error {
+// newHandler returns the gateway http handler
+func (g *Gateway) newHandler() http.Handler {
 	// noop coors handler
 	corsHandler := func(h http.Handler) http.Handler {
 		return h
@@ -176,6 +183,29 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	updateVariableHandler := api.NewUpdateVariableHandler(logger, g.ah)
 	deleteVariableHandler := api.NewDeleteVariableHandler(logger, g.ah)
 
+	runWebhooksHandler := api.NewRunWebhooksHandler(logger, g.ah)
+	createRunWebhookHandler := api.NewCreateRunWebhookHandler(logger, g.ah)
+	updateRunWebhookHandler := api.NewUpdateRunWebhookHandler(logger, g.ah)
+	deleteRunWebhookHandler := api.NewDeleteRunWebhookHandler(logger, g.ah)
+	projectRunWebhookDeliveriesHandler := api.NewProjectRunWebhookDeliveriesHandler(logger, g.ah)
+
+	chatNotificationsHandler := api.NewChatNotificationsHandler(logger, g.ah)
+	createChatNotificationHandler := api.NewCreateChatNotificationHandler(logger, g.ah)
+	updateChatNotificationHandler := api.NewUpdateChatNotificationHandler(logger, g.ah)
+	deleteChatNotificationHandler := api.NewDeleteChatNotificationHandler(logger, g.ah)
+
+	projectSubscriptionsHandler := api.NewProjectSubscriptionsHandler(logger, g.ah)
+	projectSubscriptionHandler := api.NewProjectSubscriptionHandler(logger, g.ah)
+	putProjectSubscriptionHandler := api.NewPutProjectSubscriptionHandler(logger, g.ah)
+	deleteProjectSubscriptionHandler := api.NewDeleteProjectSubscriptionHandler(logger, g.ah)
+
+	projectTaskDurationsHandler := api.NewProjectTaskDurationsHandler(logger, g.ah)
+	projectLogSearchHandler := api.NewProjectLogSearchHandler(logger, g.ah)
+
+	projectCachesHandler := api.NewProjectCachesHandler(logger, g.ah)
+	deleteProjectCachesHandler := api.NewDeleteProjectCachesHandler(logger, g.ah)
+	deleteProjectCacheHandler := api.NewDeleteProjectCacheHandler(logger, g.ah)
+
 	currentUserHandler := api.NewCurrentUserHandler(logger, g.ah)
 	userHandler := api.NewUserHandler(logger, g.ah)
 	usersHandler := api.NewUsersHandler(logger, g.ah)
@@ -208,9 +238,16 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	runtaskHandler := api.NewRuntaskHandler(logger, g.ah)
 	runActionsHandler := api.NewRunActionsHandler(logger, g.ah)
 	runTaskActionsHandler := api.NewRunTaskActionsHandler(logger, g.ah)
+	runTimelineHandler := api.NewRunTimelineHandler(logger, g.ah)
+	runExportHandler := api.NewRunExportHandler(logger, g.ah)
+	runImportHandler := api.NewRunImportHandler(logger, g.ah)
 
 	logsHandler := api.NewLogsHandler(logger, g.ah)
 
+	executorsHandler := api.NewExecutorsHandler(logger, g.ah)
+	executorCordonHandler := api.NewExecutorCordonHandler(logger, g.ah)
+	executorDrainHandler := api.NewExecutorDrainHandler(logger, g.ah)
+
 	userRemoteReposHandler := api.NewUserRemoteReposHandler(logger, g.ah, g.configstoreClient)
 
 	badgeHandler := api.NewBadgeHandler(logger, g.ah)
@@ -224,6 +261,7 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 
 	router := mux.NewRouter()
 	reposRouter := mux.NewRouter()
+	importRouter := mux.NewRouter().UseEncodedPath()
 
 	apirouter := mux.NewRouter().PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
 
@@ -268,6 +306,36 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables/{variablename}", authForcedHandler(deleteVariableHandler)).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/variables/{variablename}", authForcedHandler(deleteVariableHandler)).Methods("DELETE")
 
+	apirouter.Handle("/projectgroups/{projectgroupref}/runwebhooks", authForcedHandler(runWebhooksHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/runwebhooks", authForcedHandler(runWebhooksHandler)).Methods("GET")
+	apirouter.Handle("/projectgroups/{projectgroupref}/runwebhooks", authForcedHandler(createRunWebhookHandler)).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/runwebhooks", authForcedHandler(createRunWebhookHandler)).Methods("POST")
+	apirouter.Handle("/projectgroups/{projectgroupref}/runwebhooks/{runwebhookname}", authForcedHandler(updateRunWebhookHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/runwebhooks/{runwebhookname}", authForcedHandler(updateRunWebhookHandler)).Methods("PUT")
+	apirouter.Handle("/projectgroups/{projectgroupref}/runwebhooks/{runwebhookname}", authForcedHandler(deleteRunWebhookHandler)).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/runwebhooks/{runwebhookname}", authForcedHandler(deleteRunWebhookHandler)).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/runwebhookdeliveries", authForcedHandler(projectRunWebhookDeliveriesHandler)).Methods("GET")
+
+	apirouter.Handle("/projects/{projectref}/chatnotifications", authForcedHandler(chatNotificationsHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/chatnotifications", authForcedHandler(createChatNotificationHandler)).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/chatnotifications/{chatnotificationname}", authForcedHandler(updateChatNotificationHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/chatnotifications/{chatnotificationname}", authForcedHandler(deleteChatNotificationHandler)).Methods("DELETE")
+
+	apirouter.Handle("/projects/{projectref}/subscriptions", authForcedHandler(projectSubscriptionsHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/subscription", authForcedHandler(projectSubscriptionHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/subscription", authForcedHandler(putProjectSubscriptionHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/subscription", authForcedHandler(deleteProjectSubscriptionHandler)).Methods("DELETE")
+
+	apirouter.Handle("/projects/{projectref}/taskdurations", authOptionalHandler(projectTaskDurationsHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/logs/search", authOptionalHandler(projectLogSearchHandler)).Methods("GET")
+	// the run import is served outside the api router since run bundles
+	// exceed the max request size
+	importRouter.Handle("/api/v1alpha/projects/{projectref}/runs/import", authForcedHandler(runImportHandler)).Methods("POST")
+
+	apirouter.Handle("/projects/{projectref}/caches", authForcedHandler(projectCachesHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/caches", authForcedHandler(deleteProjectCachesHandler)).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/caches/{key}", authForcedHandler(deleteProjectCacheHandler)).Methods("DELETE")
+
 	apirouter.Handle("/user", authForcedHandler(currentUserHandler)).Methods("GET")
 	apirouter.Handle("/users/{userref}", authForcedHandler(userHandler)).Methods("GET")
 	apirouter.Handle("/users", authForcedHandler(usersHandler)).Methods("GET")
@@ -296,10 +364,16 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 
 	apirouter.Handle("/runs/{runid}", authOptionalHandler(runHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/actions", authForcedHandler(runActionsHandler)).Methods("PUT")
+	apirouter.Handle("/runs/{runid}/timeline", authOptionalHandler(runTimelineHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/export", authForcedHandler(runExportHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}", authOptionalHandler(runtaskHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}/actions", authForcedHandler(runTaskActionsHandler)).Methods("PUT")
 	apirouter.Handle("/runs", authForcedHandler(runsHandler)).Methods("GET")
 
+	apirouter.Handle("/executors", authForcedHandler(executorsHandler)).Methods("GET")
+	apirouter.Handle("/executors/{executorid}/cordon", authForcedHandler(executorCordonHandler)).Methods("PUT", "DELETE")
+	apirouter.Handle("/executors/{executorid}/drain", authForcedHandler(executorDrainHandler)).Methods("GET", "PUT")
+
 	apirouter.Handle("/user/remoterepos/{remotesourceref}", authForcedHandler(userRemoteReposHandler)).Methods("GET")
 
 	apirouter.Handle("/badges/{projectref}", badgeHandler).Methods("GET")
@@ -313,14 +387,21 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	router.Handle("/api/oauth2/callback", oauth2callbackHandler).Methods("GET")
 
 	router.Handle("/webhooks", webhooksHandler).Methods("POST")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
 	router.PathPrefix("/").HandlerFunc(handlers.NewWebBundleHandlerFunc(g.c.APIExposedURL))
 
 	maxBytesHandler := handlers.NewMaxBytesHandler(router, maxRequestSize)
 
-	mainrouter := mux.NewRouter()
+	mainrouter := mux.NewRouter().UseEncodedPath()
 	mainrouter.PathPrefix("/repos/").Handler(corsHandler(reposRouter))
+	mainrouter.Handle("/api/v1alpha/projects/{projectref}/runs/import", corsHandler(handlers.NewMaxBytesHandler(importRouter, g.c.MaxRunImportSize))).Methods("POST")
 	mainrouter.PathPrefix("/").Handler(corsHandler(maxBytesHandler))
 
+	return mainrouter
+}
+
+func (g *Gateway) Run(ctx context.Context) error {
+
 	var tlsConfig *tls.Config
 	if g.c.Web.TLS {
 		var err error
@@ -333,7 +414,7 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 
 	httpServer := http.Server{
 		Addr:      g.c.Web.ListenAddress,
-		Handler:   mainrouter,
+		Handler:   g.newHandler(),
 		TLSConfig: tlsConfig,
 	}
 
@@ -0,0 +1,131 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/config"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRunImportMaxSize(t *testing.T) {
+	var projectRef string
+	csrouter := mux.NewRouter().UseEncodedPath()
+	csrouter.HandleFunc("/api/v1alpha/projects/{projectref}", func(w http.ResponseWriter, r *http.Request) {
+		projectRef = mux.Vars(r)["projectref"]
+		_ = json.NewEncoder(w).Encode(&csapi.Project{
+			Project:   &types.Project{ID: "projectid01"},
+			OwnerType: types.ConfigTypeUser,
+			OwnerID:   "userid01",
+		})
+	})
+	cs := httptest.NewServer(csrouter)
+	defer cs.Close()
+
+	var importedSize int
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		importedSize = len(data)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(&rsapi.RunResponse{
+			Run:       &rstypes.Run{ID: "run01"},
+			RunConfig: &rstypes.RunConfig{ID: "run01"},
+		})
+	}))
+	defer rs.Close()
+
+	configstoreClient := csapi.NewClient(cs.URL)
+	runserviceClient := rsapi.NewClient(rs.URL)
+	sd := &common.TokenSigningData{}
+	g := &Gateway{
+		c: &config.Gateway{
+			AdminToken:       "admintoken",
+			MaxRunImportSize: 3 * maxRequestSize,
+		},
+		configstoreClient: configstoreClient,
+		runserviceClient:  runserviceClient,
+		ah:                action.NewActionHandler(logger, sd, configstoreClient, runserviceClient, nil, "agola", "", ""),
+		sd:                sd,
+	}
+	h := g.newHandler()
+
+	tests := []struct {
+		name       string
+		path       string
+		size       int
+		statusCode int
+	}{
+		{
+			name:       "test import run bigger than the max request size",
+			path:       "/api/v1alpha/projects/user01%2Fproject01/runs/import",
+			size:       2 * maxRequestSize,
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:       "test import run bigger than the max run import size",
+			path:       "/api/v1alpha/projects/user01%2Fproject01/runs/import",
+			size:       4 * maxRequestSize,
+			statusCode: http.StatusExpectationFailed,
+		},
+		{
+			name:       "test other api request bigger than the max request size",
+			path:       "/api/v1alpha/projects",
+			size:       2 * maxRequestSize,
+			statusCode: http.StatusExpectationFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectRef = ""
+			importedSize = 0
+
+			req := httptest.NewRequest("POST", tt.path, bytes.NewReader(make([]byte, tt.size)))
+			req.Header.Set("Authorization", "token admintoken")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status code %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			if tt.statusCode != http.StatusCreated {
+				return
+			}
+			if projectRef != "user01%2Fproject01" {
+				t.Fatalf("expected project ref %q, got %q", "user01%2Fproject01", projectRef)
+			}
+			if importedSize != tt.size {
+				t.Fatalf("expected imported run bundle size %d, got %d", tt.size, importedSize)
+			}
+		})
+	}
+}
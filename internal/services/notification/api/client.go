@@ -0,0 +1,151 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"agola.io/agola/internal/services/notification/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+var jsonContent = http.Header{"Content-Type": []string{"application/json"}}
+
+// Client represents a notification service API client.
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// NewClient initializes and returns a API client.
+func NewClient(url string) *Client {
+	return &Client{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{},
+	}
+}
+
+// SetHTTPClient replaces default http.Client with user given one.
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.client = client
+}
+
+func (c *Client) doRequest(ctx context.Context, method, path string, query url.Values, header http.Header, ibody io.Reader) (*http.Response, error) {
+	u, err := url.Parse(c.url + "/api/v1alpha" + path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), ibody)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	return c.client.Do(req)
+}
+
+func (c *Client) getResponse(ctx context.Context, method, path string, query url.Values, header http.Header, ibody io.Reader) (*http.Response, error) {
+	resp, err := c.doRequest(ctx, method, path, query, header, ibody)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return resp, err
+		}
+
+		errMap := make(map[string]interface{})
+		if err = json.Unmarshal(data, &errMap); err != nil {
+			return resp, fmt.Errorf("unknown api error (code: %d): %s", resp.StatusCode, string(data))
+		}
+		return resp, errors.New(errMap["message"].(string))
+	}
+
+	return resp, nil
+}
+
+func (c *Client) getParsedResponse(ctx context.Context, method, path string, query url.Values, header http.Header, ibody io.Reader, obj interface{}) (*http.Response, error) {
+	resp, err := c.getResponse(ctx, method, path, query, header, ibody)
+	if err != nil {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	d := json.NewDecoder(resp.Body)
+
+	return resp, d.Decode(obj)
+}
+
+func (c *Client) GetProjectRunWebhookDeliveries(ctx context.Context, projectID string, start string, limit int, asc bool) ([]*types.RunWebhookDelivery, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	if asc {
+		q.Add("asc", "")
+	}
+
+	deliveries := []*types.RunWebhookDelivery{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/runwebhookdeliveries", url.PathEscape(projectID)), q, jsonContent, nil, &deliveries)
+	return deliveries, resp, err
+}
+
+func (c *Client) GetProjectSubscriptions(ctx context.Context, projectID string) ([]*types.ProjectSubscription, *http.Response, error) {
+	subscriptions := []*types.ProjectSubscription{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/subscriptions", url.PathEscape(projectID)), nil, jsonContent, nil, &subscriptions)
+	return subscriptions, resp, err
+}
+
+func (c *Client) GetProjectSubscription(ctx context.Context, projectID, userID string) (*types.ProjectSubscription, *http.Response, error) {
+	subscription := new(types.ProjectSubscription)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/subscriptions/%s", url.PathEscape(projectID), url.PathEscape(userID)), nil, jsonContent, nil, subscription)
+	return subscription, resp, err
+}
+
+func (c *Client) PutProjectSubscription(ctx context.Context, projectID, userID string, req *PutProjectSubscriptionRequest) (*types.ProjectSubscription, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subscription := new(types.ProjectSubscription)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/subscriptions/%s", url.PathEscape(projectID), url.PathEscape(userID)), nil, jsonContent, bytes.NewReader(reqj), subscription)
+	return subscription, resp, err
+}
+
+func (c *Client) DeleteProjectSubscription(ctx context.Context, projectID, userID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/subscriptions/%s", url.PathEscape(projectID), url.PathEscape(userID)), nil, jsonContent, nil)
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/services/notification/store"
+	"agola.io/agola/internal/services/notification/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultRunWebhookDeliveriesLimit = 25
+	MaxRunWebhookDeliveriesLimit     = 40
+)
+
+type ProjectRunWebhookDeliveriesHandler struct {
+	log *zap.SugaredLogger
+	e   *etcd.Store
+}
+
+func NewProjectRunWebhookDeliveriesHandler(logger *zap.Logger, e *etcd.Store) *ProjectRunWebhookDeliveriesHandler {
+	return &ProjectRunWebhookDeliveriesHandler{log: logger.Sugar(), e: e}
+}
+
+func (h *ProjectRunWebhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectID := vars["projectid"]
+	query := r.URL.Query()
+
+	limitS := query.Get("limit")
+	limit := DefaultRunWebhookDeliveriesLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit > MaxRunWebhookDeliveriesLimit {
+		limit = MaxRunWebhookDeliveriesLimit
+	}
+	asc := false
+	if _, ok := query["asc"]; ok {
+		asc = true
+	}
+
+	start := query.Get("start")
+
+	deliveries, err := store.GetProjectRunWebhookDeliveries(ctx, h.e, projectID)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	res := filterRunWebhookDeliveries(deliveries, start, limit, asc)
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+// filterRunWebhookDeliveries sorts the deliveries by id and returns at most
+// limit deliveries after start
+func filterRunWebhookDeliveries(deliveries []*types.RunWebhookDelivery, start string, limit int, asc bool) []*types.RunWebhookDelivery {
+	if asc {
+		sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	} else {
+		sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	}
+
+	res := []*types.RunWebhookDelivery{}
+	for _, d := range deliveries {
+		if start != "" {
+			if asc && d.ID <= start {
+				continue
+			}
+			if !asc && d.ID >= start {
+				continue
+			}
+		}
+		if limit > 0 && len(res) >= limit {
+			break
+		}
+		res = append(res, d)
+	}
+
+	return res
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/services/notification/store"
+	"agola.io/agola/internal/services/notification/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type ProjectSubscriptionsHandler struct {
+	log *zap.SugaredLogger
+	e   *etcd.Store
+}
+
+func NewProjectSubscriptionsHandler(logger *zap.Logger, e *etcd.Store) *ProjectSubscriptionsHandler {
+	return &ProjectSubscriptionsHandler{log: logger.Sugar(), e: e}
+}
+
+func (h *ProjectSubscriptionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectID := vars["projectid"]
+
+	subscriptions, err := store.GetProjectSubscriptions(ctx, h.e, projectID)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, subscriptions); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectSubscriptionHandler struct {
+	log *zap.SugaredLogger
+	e   *etcd.Store
+}
+
+func NewProjectSubscriptionHandler(logger *zap.Logger, e *etcd.Store) *ProjectSubscriptionHandler {
+	return &ProjectSubscriptionHandler{log: logger.Sugar(), e: e}
+}
+
+func (h *ProjectSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectID := vars["projectid"]
+	userID := vars["userid"]
+
+	subscription, err := store.GetProjectSubscription(ctx, h.e, projectID, userID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+	if err == etcd.ErrKeyNotFound {
+		httpError(w, util.NewErrNotFound(errors.Errorf("user %q isn't subscribed to project %q", userID, projectID)))
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, subscription); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type PutProjectSubscriptionRequest struct {
+	Email    string   `json:"email"`
+	Branches []string `json:"branches"`
+}
+
+type PutProjectSubscriptionHandler struct {
+	log *zap.SugaredLogger
+	e   *etcd.Store
+}
+
+func NewPutProjectSubscriptionHandler(logger *zap.Logger, e *etcd.Store) *PutProjectSubscriptionHandler {
+	return &PutProjectSubscriptionHandler{log: logger.Sugar(), e: e}
+}
+
+func (h *PutProjectSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectID := vars["projectid"]
+	userID := vars["userid"]
+
+	var req PutProjectSubscriptionRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	if req.Email == "" {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("empty email")))
+		return
+	}
+	if !util.ValidateEmail(req.Email) {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("invalid email %q", req.Email)))
+		return
+	}
+
+	subscription := &types.ProjectSubscription{
+		ProjectID: projectID,
+		UserID:    userID,
+		Email:     req.Email,
+		Branches:  req.Branches,
+	}
+	subscription, err := store.PutProjectSubscription(ctx, h.e, subscription)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, subscription); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteProjectSubscriptionHandler struct {
+	log *zap.SugaredLogger
+	e   *etcd.Store
+}
+
+func NewDeleteProjectSubscriptionHandler(logger *zap.Logger, e *etcd.Store) *DeleteProjectSubscriptionHandler {
+	return &DeleteProjectSubscriptionHandler{log: logger.Sugar(), e: e}
+}
+
+func (h *DeleteProjectSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectID := vars["projectid"]
+	userID := vars["userid"]
+
+	if err := store.DeleteProjectSubscription(ctx, h.e, projectID, userID); err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
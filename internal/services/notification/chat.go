@@ -0,0 +1,261 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	chatColorSuccess = "#21ba45"
+	chatColorFailed  = "#db2828"
+)
+
+// chatMessage is an incoming webhook message. Mattermost accepts the slack
+// message format, the differences (links markup and channel names) are handled
+// by runChatMessage based on the chat notification type
+type chatMessage struct {
+	Channel     string                   `json:"channel,omitempty"`
+	Username    string                   `json:"username,omitempty"`
+	Text        string                   `json:"text,omitempty"`
+	Attachments []*chatMessageAttachment `json:"attachments,omitempty"`
+}
+
+type chatMessageAttachment struct {
+	Fallback  string                        `json:"fallback,omitempty"`
+	Color     string                        `json:"color,omitempty"`
+	Title     string                        `json:"title,omitempty"`
+	TitleLink string                        `json:"title_link,omitempty"`
+	Text      string                        `json:"text,omitempty"`
+	Fields    []*chatMessageAttachmentField `json:"fields,omitempty"`
+}
+
+type chatMessageAttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// chatNotificationEvents returns the chat notification events generated by a
+// finished run given the result of the previous finished run of the same
+// group (nil if there's no previous run)
+func chatNotificationEvents(result rstypes.RunResult, prevResult *rstypes.RunResult) []types.ChatNotificationEvent {
+	events := []types.ChatNotificationEvent{}
+	switch result {
+	case rstypes.RunResultFailed:
+		events = append(events, types.ChatNotificationEventRunFailed)
+		if prevResult == nil || *prevResult != rstypes.RunResultFailed {
+			events = append(events, types.ChatNotificationEventRunBroken)
+		}
+	case rstypes.RunResultSuccess:
+		events = append(events, types.ChatNotificationEventRunSucceeded)
+		if prevResult != nil && *prevResult == rstypes.RunResultFailed {
+			events = append(events, types.ChatNotificationEventRunFixed)
+		}
+	}
+	return events
+}
+
+func (n *NotificationService) sendRunChatNotifications(ctx context.Context, ev *rstypes.RunEvent) error {
+	if ev.TasksOnly || ev.Phase != rstypes.RunPhaseFinished {
+		return nil
+	}
+	if ev.Result != rstypes.RunResultFailed && ev.Result != rstypes.RunResultSuccess {
+		return nil
+	}
+
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+	groupType, groupID, err := common.GroupTypeIDFromRunGroup(run.RunConfig.Group)
+	if err != nil {
+		return err
+	}
+
+	// chat notifications are defined only for projects
+	if groupType != common.GroupTypeProject {
+		return nil
+	}
+
+	project, _, err := n.configstoreClient.GetProject(ctx, groupID)
+	if err != nil {
+		return errors.Errorf("failed to get project %s: %w", groupID, err)
+	}
+
+	chatNotifications, _, err := n.configstoreClient.GetProjectChatNotifications(ctx, project.ID)
+	if err != nil {
+		return errors.Errorf("failed to get project %s chat notifications: %w", project.ID, err)
+	}
+	if len(chatNotifications) == 0 {
+		return nil
+	}
+
+	prevRun, err := n.previousFinishedRun(ctx, run.Run)
+	if err != nil {
+		return err
+	}
+	var prevResult *rstypes.RunResult
+	if prevRun != nil {
+		prevResult = &prevRun.Result
+	}
+	events := chatNotificationEvents(ev.Result, prevResult)
+
+	secrets, _, err := n.configstoreClient.GetProjectSecrets(ctx, project.ID, true)
+	if err != nil {
+		return errors.Errorf("failed to get project %s secrets: %w", project.ID, err)
+	}
+
+	link, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate run url: %w", err)
+	}
+
+	for _, cn := range chatNotifications {
+		match := false
+		for _, e := range events {
+			if cn.MatchEvent(e) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+
+		// secrets are ordered from the nearest parent so the first one with the
+		// same name is the one to use
+		webhookURL := ""
+		for _, s := range secrets {
+			if s.Name != cn.SecretName || s.Type != types.SecretTypeInternal {
+				continue
+			}
+			webhookURL = s.Data[cn.SecretKey]
+			break
+		}
+		if webhookURL == "" {
+			log.Errorf("chat notification %q: secret %q with key %q not found", cn.Name, cn.SecretName, cn.SecretKey)
+			continue
+		}
+
+		msg := runChatMessage(cn.ChatNotification, project.Path, run, link)
+		if err := sendChatMessage(ctx, webhookURL, msg); err != nil {
+			log.Errorf("failed to send run %q chat notification %q: %+v", run.Run.ID, cn.Name, err)
+			continue
+		}
+		log.Debugf("sent run %q chat notification %q", run.Run.ID, cn.Name)
+	}
+
+	return nil
+}
+
+func runChatMessage(cn *types.ChatNotification, projectPath string, run *rsapi.RunResponse, link string) *chatMessage {
+	color := chatColorSuccess
+	if run.Run.Result == rstypes.RunResultFailed {
+		color = chatColorFailed
+	}
+
+	title := fmt.Sprintf("%s #%d %s: %s", projectPath, run.Run.Counter, run.Run.Name, run.Run.Result)
+
+	fields := []*chatMessageAttachmentField{
+		{Title: "Result", Value: string(run.Run.Result), Short: true},
+	}
+	if branch := run.Run.Annotations[action.AnnotationBranch]; branch != "" {
+		if branchLink := run.Run.Annotations[action.AnnotationBranchLink]; branchLink != "" {
+			branch = chatLink(cn.Type, branchLink, branch)
+		}
+		fields = append(fields, &chatMessageAttachmentField{Title: "Branch", Value: branch, Short: true})
+	}
+	if commitSHA := run.Run.Annotations[action.AnnotationCommitSHA]; commitSHA != "" {
+		commit := commitSHA
+		if commitLink := run.Run.Annotations[action.AnnotationCommitLink]; commitLink != "" {
+			commit = chatLink(cn.Type, commitLink, commitSHA)
+		}
+		fields = append(fields, &chatMessageAttachmentField{Title: "Commit", Value: commit, Short: true})
+	}
+
+	// only report the commit message first line
+	message := strings.SplitN(run.Run.Annotations[action.AnnotationMessage], "\n", 2)[0]
+
+	channel := cn.Channel
+	if cn.Type == types.ChatNotificationTypeMattermost {
+		// mattermost wants the channel name without the slack "#" prefix
+		channel = strings.TrimPrefix(channel, "#")
+	}
+
+	return &chatMessage{
+		Channel:  channel,
+		Username: "agola",
+		Attachments: []*chatMessageAttachment{
+			{
+				Fallback:  fmt.Sprintf("%s %s", title, link),
+				Color:     color,
+				Title:     title,
+				TitleLink: link,
+				Text:      message,
+				Fields:    fields,
+			},
+		},
+	}
+}
+
+// chatLink formats a link with the markup of the chat type: slack uses its own
+// link format while mattermost uses markdown
+func chatLink(t types.ChatNotificationType, url, text string) string {
+	switch t {
+	case types.ChatNotificationTypeMattermost:
+		return fmt.Sprintf("[%s](%s)", text, url)
+	default:
+		return fmt.Sprintf("<%s|%s>", url, text)
+	}
+}
+
+func sendChatMessage(ctx context.Context, webhookURL string, msg *chatMessage) error {
+	msgj, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(msgj))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := runWebhookHTTPClient(false).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected http status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+)
+
+func TestChatNotificationEvents(t *testing.T) {
+	success := rstypes.RunResultSuccess
+	failed := rstypes.RunResultFailed
+	stopped := rstypes.RunResultStopped
+
+	tests := []struct {
+		name       string
+		result     rstypes.RunResult
+		prevResult *rstypes.RunResult
+		out        []types.ChatNotificationEvent
+	}{
+		{
+			name:   "test first run failed",
+			result: rstypes.RunResultFailed,
+			out:    []types.ChatNotificationEvent{types.ChatNotificationEventRunFailed, types.ChatNotificationEventRunBroken},
+		},
+		{
+			name:   "test first run succeeded",
+			result: rstypes.RunResultSuccess,
+			out:    []types.ChatNotificationEvent{types.ChatNotificationEventRunSucceeded},
+		},
+		{
+			name:       "test failed after success",
+			result:     rstypes.RunResultFailed,
+			prevResult: &success,
+			out:        []types.ChatNotificationEvent{types.ChatNotificationEventRunFailed, types.ChatNotificationEventRunBroken},
+		},
+		{
+			name:       "test failed after failure",
+			result:     rstypes.RunResultFailed,
+			prevResult: &failed,
+			out:        []types.ChatNotificationEvent{types.ChatNotificationEventRunFailed},
+		},
+		{
+			name:       "test success after failure",
+			result:     rstypes.RunResultSuccess,
+			prevResult: &failed,
+			out:        []types.ChatNotificationEvent{types.ChatNotificationEventRunSucceeded, types.ChatNotificationEventRunFixed},
+		},
+		{
+			name:       "test success after stopped",
+			result:     rstypes.RunResultSuccess,
+			prevResult: &stopped,
+			out:        []types.ChatNotificationEvent{types.ChatNotificationEventRunSucceeded},
+		},
+		{
+			name:   "test stopped run",
+			result: rstypes.RunResultStopped,
+			out:    []types.ChatNotificationEvent{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := chatNotificationEvents(tt.result, tt.prevResult)
+			if !reflect.DeepEqual(out, tt.out) {
+				t.Fatalf("expected events: %v, got: %v", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestSendChatMessage(t *testing.T) {
+	msgCh := make(chan *chatMessage, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg *chatMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		msgCh <- msg
+	}))
+	defer ts.Close()
+
+	cn := &types.ChatNotification{Name: "chat01", Type: types.ChatNotificationTypeSlack, Channel: "#builds"}
+	run := &rsapi.RunResponse{
+		Run: &rstypes.Run{
+			Name:    "run01",
+			Counter: 10,
+			Result:  rstypes.RunResultFailed,
+			Annotations: map[string]string{
+				action.AnnotationBranch:    "master",
+				action.AnnotationCommitSHA: "c0ffee",
+				action.AnnotationMessage:   "commit title\n\ncommit body",
+			},
+		},
+	}
+	link := "https://agola.example.com/run01"
+
+	if err := sendChatMessage(context.Background(), ts.URL, runChatMessage(cn, "user01/project01", run, link)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	msg := <-msgCh
+	if msg.Channel != "#builds" {
+		t.Fatalf("expected channel %q, got %q", "#builds", msg.Channel)
+	}
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("expected 1 attachment, got %d", len(msg.Attachments))
+	}
+	a := msg.Attachments[0]
+	if a.TitleLink != link {
+		t.Fatalf("expected title link %q, got %q", link, a.TitleLink)
+	}
+	if a.Color != chatColorFailed {
+		t.Fatalf("expected color %q, got %q", chatColorFailed, a.Color)
+	}
+	if a.Text != "commit title" {
+		t.Fatalf("expected text %q, got %q", "commit title", a.Text)
+	}
+	if len(a.Fields) != 3 {
+		t.Fatalf("expected 3 fields, got %d", len(a.Fields))
+	}
+}
+
+func TestRunChatMessage(t *testing.T) {
+	run := &rsapi.RunResponse{
+		Run: &rstypes.Run{
+			Name:    "run01",
+			Counter: 10,
+			Result:  rstypes.RunResultSuccess,
+			Annotations: map[string]string{
+				action.AnnotationBranch:     "master",
+				action.AnnotationBranchLink: "https://git.example.com/branch/master",
+				action.AnnotationCommitSHA:  "c0ffee",
+				action.AnnotationCommitLink: "https://git.example.com/commit/c0ffee",
+			},
+		},
+	}
+	link := "https://agola.example.com/run01"
+
+	tests := []struct {
+		name    string
+		cn      *types.ChatNotification
+		channel string
+		branch  string
+		commit  string
+	}{
+		{
+			name:    "test slack",
+			cn:      &types.ChatNotification{Type: types.ChatNotificationTypeSlack, Channel: "#builds"},
+			channel: "#builds",
+			branch:  "<https://git.example.com/branch/master|master>",
+			commit:  "<https://git.example.com/commit/c0ffee|c0ffee>",
+		},
+		{
+			name:    "test mattermost",
+			cn:      &types.ChatNotification{Type: types.ChatNotificationTypeMattermost, Channel: "#builds"},
+			channel: "builds",
+			branch:  "[master](https://git.example.com/branch/master)",
+			commit:  "[c0ffee](https://git.example.com/commit/c0ffee)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := runChatMessage(tt.cn, "user01/project01", run, link)
+			if msg.Channel != tt.channel {
+				t.Fatalf("expected channel %q, got %q", tt.channel, msg.Channel)
+			}
+			fields := msg.Attachments[0].Fields
+			if len(fields) != 3 {
+				t.Fatalf("expected 3 fields, got %d", len(fields))
+			}
+			if fields[1].Value != tt.branch {
+				t.Fatalf("expected branch %q, got %q", tt.branch, fields[1].Value)
+			}
+			if fields[2].Value != tt.commit {
+				t.Fatalf("expected commit %q, got %q", tt.commit, fields[2].Value)
+			}
+		})
+	}
+}
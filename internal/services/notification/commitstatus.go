@@ -21,6 +21,7 @@ import (
 
 	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
 	"agola.io/agola/internal/services/gateway/action"
 	rstypes "agola.io/agola/internal/services/runservice/types"
 
@@ -28,28 +29,13 @@ import (
 )
 
 func (n *NotificationService) updateCommitStatus(ctx context.Context, ev *rstypes.RunEvent) error {
+	// the run commit status only depends on the run phase and result
 	var commitStatus gitsource.CommitStatus
-	if ev.Phase == rstypes.RunPhaseSetupError {
-		commitStatus = gitsource.CommitStatusError
-	}
-	if ev.Phase == rstypes.RunPhaseCancelled {
-		commitStatus = gitsource.CommitStatusError
-	}
-	if ev.Phase == rstypes.RunPhaseRunning && ev.Result == rstypes.RunResultUnknown {
-		commitStatus = gitsource.CommitStatusPending
-	}
-	if ev.Phase == rstypes.RunPhaseFinished && ev.Result != rstypes.RunResultUnknown {
-		switch ev.Result {
-		case rstypes.RunResultSuccess:
-			commitStatus = gitsource.CommitStatusSuccess
-		case rstypes.RunResultStopped:
-			fallthrough
-		case rstypes.RunResultFailed:
-			commitStatus = gitsource.CommitStatusFailed
-		}
+	if !ev.TasksOnly {
+		commitStatus = runCommitStatus(ev)
 	}
 
-	if commitStatus == "" {
+	if commitStatus == "" && len(ev.Tasks) == 0 {
 		return nil
 	}
 
@@ -67,42 +53,126 @@ func (n *NotificationService) updateCommitStatus(ctx context.Context, ev *rstype
 		return nil
 	}
 
+	// only report the statuses of the tasks that opted in
+	tasks := []*rstypes.RunEventTask{}
+	for _, t := range ev.Tasks {
+		rct, ok := run.RunConfig.Tasks[t.ID]
+		if !ok || !rct.CommitStatus {
+			continue
+		}
+		if taskCommitStatus(t.Status) == "" {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+
+	if commitStatus == "" && len(tasks) == 0 {
+		return nil
+	}
+
 	project, _, err := n.configstoreClient.GetProject(ctx, groupID)
 	if err != nil {
 		return errors.Errorf("failed to get project %s: %w", groupID, err)
 	}
 
+	gitSource, err := n.projectGitSource(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	targetURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate commit status target url: %w", err)
+	}
+	commitSHA := run.Run.Annotations[action.AnnotationCommitSHA]
+
+	if commitStatus != "" {
+		description := statusDescription(commitStatus)
+		context := fmt.Sprintf("%s/%s/%s", n.gc.ID, project.Name, run.RunConfig.Name)
+
+		if err := gitSource.CreateCommitStatus(project.RepositoryPath, commitSHA, commitStatus, targetURL, description, context); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range tasks {
+		taskStatus := taskCommitStatus(t.Status)
+		description := taskStatusDescription(t.Status)
+		context := fmt.Sprintf("%s/%s/%s/%s", n.gc.ID, project.Name, run.RunConfig.Name, t.Name)
+
+		if err := gitSource.CreateCommitStatus(project.RepositoryPath, commitSHA, taskStatus, targetURL, description, context); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// projectGitSource returns the git source of the project linked account
+func (n *NotificationService) projectGitSource(ctx context.Context, project *csapi.Project) (gitsource.GitSource, error) {
 	user, _, err := n.configstoreClient.GetUserByLinkedAccount(ctx, project.LinkedAccountID)
 	if err != nil {
-		return errors.Errorf("failed to get user by linked account %q: %w", project.LinkedAccountID, err)
+		return nil, errors.Errorf("failed to get user by linked account %q: %w", project.LinkedAccountID, err)
 	}
 	la := user.LinkedAccounts[project.LinkedAccountID]
 	if la == nil {
-		return errors.Errorf("linked account %q in user %q doesn't exist", project.LinkedAccountID, user.Name)
+		return nil, errors.Errorf("linked account %q in user %q doesn't exist", project.LinkedAccountID, user.Name)
 	}
 	rs, _, err := n.configstoreClient.GetRemoteSource(ctx, la.RemoteSourceID)
 	if err != nil {
-		return errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, err)
+		return nil, errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, err)
 	}
 
 	// TODO(sgotti) handle refreshing oauth2 tokens
 	gitSource, err := common.GetGitSource(rs, la)
 	if err != nil {
-		return errors.Errorf("failed to create gitea client: %w", err)
+		return nil, errors.Errorf("failed to create gitea client: %w", err)
 	}
+	return gitSource, nil
+}
 
-	targetURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
-	if err != nil {
-		return errors.Errorf("failed to generate commit status target url: %w", err)
+func runCommitStatus(ev *rstypes.RunEvent) gitsource.CommitStatus {
+	var commitStatus gitsource.CommitStatus
+	if ev.Phase == rstypes.RunPhaseSetupError {
+		commitStatus = gitsource.CommitStatusError
 	}
-	description := statusDescription(commitStatus)
-	context := fmt.Sprintf("%s/%s/%s", n.gc.ID, project.Name, run.RunConfig.Name)
-
-	if err := gitSource.CreateCommitStatus(project.RepositoryPath, run.Run.Annotations[action.AnnotationCommitSHA], commitStatus, targetURL, description, context); err != nil {
-		return err
+	if ev.Phase == rstypes.RunPhaseCancelled {
+		commitStatus = gitsource.CommitStatusError
 	}
+	if ev.Phase == rstypes.RunPhaseRunning && ev.Result == rstypes.RunResultUnknown {
+		commitStatus = gitsource.CommitStatusPending
+	}
+	if ev.Phase == rstypes.RunPhaseFinished && ev.Result != rstypes.RunResultUnknown {
+		switch ev.Result {
+		case rstypes.RunResultSuccess:
+			commitStatus = gitsource.CommitStatusSuccess
+		case rstypes.RunResultStopped:
+			fallthrough
+		case rstypes.RunResultFailed:
+			commitStatus = gitsource.CommitStatusFailed
+		}
+	}
+	return commitStatus
+}
 
-	return nil
+func taskCommitStatus(status rstypes.RunTaskStatus) gitsource.CommitStatus {
+	switch status {
+	case rstypes.RunTaskStatusRunning:
+		return gitsource.CommitStatusPending
+	case rstypes.RunTaskStatusSuccess:
+		return gitsource.CommitStatusSuccess
+	// a skipped task doesn't block the commit
+	case rstypes.RunTaskStatusSkipped:
+		return gitsource.CommitStatusSuccess
+	case rstypes.RunTaskStatusStopped:
+		fallthrough
+	case rstypes.RunTaskStatusFailed:
+		return gitsource.CommitStatusFailed
+	case rstypes.RunTaskStatusCancelled:
+		return gitsource.CommitStatusError
+	default:
+		return ""
+	}
 }
 
 func webRunURL(webExposedURL, projectID, runID string) (string, error) {
@@ -133,3 +203,22 @@ func statusDescription(commitStatus gitsource.CommitStatus) string {
 		return ""
 	}
 }
+
+func taskStatusDescription(status rstypes.RunTaskStatus) string {
+	switch status {
+	case rstypes.RunTaskStatusRunning:
+		return "The task is running"
+	case rstypes.RunTaskStatusSuccess:
+		return "The task finished successfully"
+	case rstypes.RunTaskStatusSkipped:
+		return "The task was skipped"
+	case rstypes.RunTaskStatusStopped:
+		return "The task was stopped"
+	case rstypes.RunTaskStatusFailed:
+		return "The task failed"
+	case rstypes.RunTaskStatusCancelled:
+		return "The task was cancelled"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"path"
+)
+
+var (
+	EtcdRunWebhookDeliveriesDir       = "runwebhookdeliveries"
+	EtcdRunWebhookDeliverySequenceKey = "runwebhookdeliverysequence"
+	EtcdRunWebhookDeliveriesLockKey   = path.Join("locks", "runwebhookdeliveries")
+
+	// pending deliveries are saved in their own dir so the deliveries loop
+	// won't list the completed ones
+	EtcdPendingRunWebhookDeliveriesDir = "pendingrunwebhookdeliveries"
+
+	EtcdProjectSubscriptionsDir = "projectsubscriptions"
+)
+
+func EtcdProjectRunWebhookDeliveriesDir(projectID string) string {
+	return path.Join(EtcdRunWebhookDeliveriesDir, projectID)
+}
+
+func EtcdRunWebhookDeliveryKey(projectID, deliveryID string) string {
+	return path.Join(EtcdRunWebhookDeliveriesDir, projectID, deliveryID)
+}
+
+func EtcdProjectPendingRunWebhookDeliveriesDir(projectID string) string {
+	return path.Join(EtcdPendingRunWebhookDeliveriesDir, projectID)
+}
+
+func EtcdPendingRunWebhookDeliveryKey(projectID, deliveryID string) string {
+	return path.Join(EtcdPendingRunWebhookDeliveriesDir, projectID, deliveryID)
+}
+
+func EtcdProjectSubscriptionsProjectDir(projectID string) string {
+	return path.Join(EtcdProjectSubscriptionsDir, projectID)
+}
+
+func EtcdProjectSubscriptionKey(projectID, userID string) string {
+	return path.Join(EtcdProjectSubscriptionsDir, projectID, userID)
+}
@@ -0,0 +1,344 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"text/template"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/config"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/notification/store"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const smtpDialTimeout = 30 * time.Second
+
+type runEmailKind string
+
+const (
+	runEmailKindFailed    runEmailKind = "failed"
+	runEmailKindRecovered runEmailKind = "recovered"
+)
+
+type runEmailData struct {
+	Kind        runEmailKind
+	ProjectPath string
+	RunName     string
+	RunCounter  uint64
+	Branch      string
+	CommitSHA   string
+	Message     string
+	Link        string
+}
+
+var runEmailSubjectTemplate = template.Must(template.New("subject").Parse(
+	`[agola] {{.ProjectPath}} #{{.RunCounter}} {{.RunName}} {{.Kind}} on branch {{.Branch}}`))
+
+var runEmailTextTemplate = template.Must(template.New("text").Parse(`{{if eq .Kind "failed"}}The run #{{.RunCounter}} "{{.RunName}}" of project {{.ProjectPath}} failed on branch {{.Branch}}.{{else}}The run #{{.RunCounter}} "{{.RunName}}" of project {{.ProjectPath}} succeeded on branch {{.Branch}} after a previous failure.{{end}}
+
+Commit: {{.CommitSHA}}
+{{.Message}}
+
+Run details: {{.Link}}
+`))
+
+var runEmailHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<p>{{if eq .Kind "failed"}}The run #{{.RunCounter}} <b>{{.RunName}}</b> of project <b>{{.ProjectPath}}</b> failed on branch <b>{{.Branch}}</b>.{{else}}The run #{{.RunCounter}} <b>{{.RunName}}</b> of project <b>{{.ProjectPath}}</b> succeeded on branch <b>{{.Branch}}</b> after a previous failure.{{end}}</p>
+<p>Commit: <code>{{.CommitSHA}}</code></p>
+<pre>{{.Message}}</pre>
+<p><a href="{{.Link}}">Run details</a></p>
+</body>
+</html>
+`))
+
+// sendRunEmails sends an email to the project subscribers (and optionally to
+// the commit author) when a branch run fails or recovers from a previous
+// failure
+func (n *NotificationService) sendRunEmails(ctx context.Context, ev *rstypes.RunEvent) error {
+	if n.c.SMTP.Host == "" {
+		return nil
+	}
+	if ev.TasksOnly || ev.Phase != rstypes.RunPhaseFinished {
+		return nil
+	}
+	if ev.Result != rstypes.RunResultFailed && ev.Result != rstypes.RunResultSuccess {
+		return nil
+	}
+
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+	groupType, groupID, err := common.GroupTypeIDFromRunGroup(run.RunConfig.Group)
+	if err != nil {
+		return err
+	}
+
+	// only notify about project branch runs
+	if groupType != common.GroupTypeProject {
+		return nil
+	}
+	if types.RunRefType(run.Run.Annotations[action.AnnotationRefType]) != types.RunRefTypeBranch {
+		return nil
+	}
+	branch := run.Run.Annotations[action.AnnotationBranch]
+
+	var kind runEmailKind
+	switch ev.Result {
+	case rstypes.RunResultFailed:
+		kind = runEmailKindFailed
+	case rstypes.RunResultSuccess:
+		prevRun, err := n.previousFinishedRun(ctx, run.Run)
+		if err != nil {
+			return err
+		}
+		if prevRun == nil || prevRun.Result != rstypes.RunResultFailed {
+			return nil
+		}
+		kind = runEmailKindRecovered
+	}
+
+	project, _, err := n.configstoreClient.GetProject(ctx, groupID)
+	if err != nil {
+		return errors.Errorf("failed to get project %s: %w", groupID, err)
+	}
+
+	subscriptions, err := store.GetProjectSubscriptions(ctx, n.e, project.ID)
+	if err != nil {
+		return errors.Errorf("failed to get project %s subscriptions: %w", project.ID, err)
+	}
+
+	recipients := []string{}
+	seen := map[string]struct{}{}
+	addRecipient := func(email string) {
+		if email == "" {
+			return
+		}
+		// the commit author email isn't validated
+		if !util.ValidateEmail(email) {
+			log.Warnf("ignoring invalid email recipient %q", email)
+			return
+		}
+		if _, ok := seen[email]; ok {
+			return
+		}
+		seen[email] = struct{}{}
+		recipients = append(recipients, email)
+	}
+	for _, s := range subscriptions {
+		if s.WatchBranch(branch) {
+			addRecipient(s.Email)
+		}
+	}
+	if n.c.SMTP.NotifyCommitAuthor {
+		authorEmail, err := n.commitAuthorEmail(ctx, project, run.Run.Annotations[action.AnnotationCommitSHA])
+		if err != nil {
+			log.Errorf("failed to get run %q commit author email: %+v", run.Run.ID, err)
+		} else {
+			addRecipient(authorEmail)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	link, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate run url: %w", err)
+	}
+
+	data := &runEmailData{
+		Kind:        kind,
+		ProjectPath: project.Path,
+		RunName:     run.Run.Name,
+		RunCounter:  run.Run.Counter,
+		Branch:      branch,
+		CommitSHA:   run.Run.Annotations[action.AnnotationCommitSHA],
+		Message:     run.Run.Annotations[action.AnnotationMessage],
+		Link:        link,
+	}
+
+	for _, to := range recipients {
+		msg, err := runEmailMessage(n.c.SMTP.FromAddress, to, data)
+		if err != nil {
+			return err
+		}
+		if err := sendEmail(&n.c.SMTP, to, msg); err != nil {
+			log.Errorf("failed to send run %q email to %q: %+v", run.Run.ID, to, err)
+			continue
+		}
+		log.Debugf("sent run %q email to %q", run.Run.ID, to)
+	}
+
+	return nil
+}
+
+// commitAuthorEmail returns the email of the commit author fetched from the
+// project git source. It isn't saved in the run since the run annotations are
+// readable by everyone that can read the project runs
+func (n *NotificationService) commitAuthorEmail(ctx context.Context, project *csapi.Project, commitSHA string) (string, error) {
+	if commitSHA == "" {
+		return "", nil
+	}
+
+	gitSource, err := n.projectGitSource(ctx, project)
+	if err != nil {
+		return "", err
+	}
+	commit, err := gitSource.GetCommit(project.RepositoryPath, commitSHA)
+	if err != nil {
+		return "", errors.Errorf("failed to get commit %q: %w", commitSHA, err)
+	}
+	// some git sources don't provide the commit information
+	if commit == nil {
+		return "", nil
+	}
+
+	return commit.AuthorEmail, nil
+}
+
+// runEmailMessage generates a multipart email message with a text and an html
+// alternative body
+func runEmailMessage(from, to string, data *runEmailData) ([]byte, error) {
+	var subject bytes.Buffer
+	if err := runEmailSubjectTemplate.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	var text bytes.Buffer
+	if err := runEmailTextTemplate.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	var html bytes.Buffer
+	if err := runEmailHTMLTemplate.Execute(&html, data); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		data        []byte
+	}{
+		{"text/plain; charset=UTF-8", text.Bytes()},
+		{"text/html; charset=UTF-8", html.Bytes()},
+	}
+	for _, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write(part.data); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject.String()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n", mw.Boundary())
+	fmt.Fprintf(&msg, "\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+func sendEmail(c *config.SMTP, to string, msg []byte) error {
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	tlsConfig := &tls.Config{ServerName: c.Host, InsecureSkipVerify: c.SkipTLSVerify}
+
+	var conn net.Conn
+	var err error
+	if c.TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpDialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpDialTimeout)
+	}
+	if err != nil {
+		return errors.Errorf("failed to connect to smtp server %q: %w", addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !c.TLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(c.FromAddress); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
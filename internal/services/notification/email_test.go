@@ -0,0 +1,160 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+
+	"agola.io/agola/internal/services/config"
+)
+
+// fakeSMTPServer is a minimal smtp server that accepts a single message
+func fakeSMTPServer(t *testing.T, ln net.Listener, msgCh chan<- []byte) {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Errorf("unexpected err: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	w("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			w("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+			w("250 OK")
+		case cmd == "DATA":
+			w("354 End data with <CR><LF>.<CR><LF>")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			msgCh <- data.Bytes()
+			w("250 OK")
+		case cmd == "QUIT":
+			w("221 Bye")
+			return
+		default:
+			w("502 Command not implemented")
+		}
+	}
+}
+
+func TestSendRunEmail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer ln.Close()
+
+	msgCh := make(chan []byte, 1)
+	go fakeSMTPServer(t, ln, msgCh)
+
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	c := &config.SMTP{
+		Host:        host,
+		Port:        port,
+		FromAddress: "agola@example.com",
+	}
+
+	data := &runEmailData{
+		Kind:        runEmailKindFailed,
+		ProjectPath: "user01/project01",
+		RunName:     "run01",
+		RunCounter:  10,
+		Branch:      "master",
+		CommitSHA:   "c0ffee",
+		Message:     "commit message",
+		Link:        "https://agola.example.com/run01",
+	}
+
+	msg, err := runEmailMessage(c.FromAddress, "user01@example.com", data)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := sendEmail(c, "user01@example.com", msg); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(<-msgCh))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if to := m.Header.Get("To"); to != "user01@example.com" {
+		t.Fatalf("unexpected To header: %q", to)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expectedSubject := "[agola] user01/project01 #10 run01 failed on branch master"
+	if subject != expectedSubject {
+		t.Fatalf("expected subject %q, got %q", expectedSubject, subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected media type: %q", mediaType)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	nparts := 0
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		nparts++
+		body, err := ioutil.ReadAll(quotedprintable.NewReader(p))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if !bytes.Contains(body, []byte(data.Link)) {
+			t.Fatalf("part %q doesn't contain run link", p.Header.Get("Content-Type"))
+		}
+	}
+	if nparts != 2 {
+		t.Fatalf("expected 2 parts, got %d", nparts)
+	}
+}
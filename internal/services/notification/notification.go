@@ -16,14 +16,19 @@ package notification
 
 import (
 	"context"
+	"crypto/tls"
+	"net/http"
 
 	"agola.io/agola/internal/common"
 	"agola.io/agola/internal/etcd"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/services/config"
 	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/notification/api"
 	rsapi "agola.io/agola/internal/services/runservice/api"
+	"agola.io/agola/internal/util"
 
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -67,9 +72,65 @@ func NewNotificationService(gc *config.Config) (*NotificationService, error) {
 
 func (n *NotificationService) Run(ctx context.Context) error {
 	go n.runEventsHandlerLoop(ctx)
+	go n.runWebhookDeliveriesLoop(ctx)
 
-	<-ctx.Done()
-	log.Infof("notification service exiting")
+	if n.c.Web.ListenAddress == "" {
+		<-ctx.Done()
+		log.Infof("notification service exiting")
+		return nil
+	}
+
+	projectRunWebhookDeliveriesHandler := api.NewProjectRunWebhookDeliveriesHandler(logger, n.e)
+
+	projectSubscriptionsHandler := api.NewProjectSubscriptionsHandler(logger, n.e)
+	projectSubscriptionHandler := api.NewProjectSubscriptionHandler(logger, n.e)
+	putProjectSubscriptionHandler := api.NewPutProjectSubscriptionHandler(logger, n.e)
+	deleteProjectSubscriptionHandler := api.NewDeleteProjectSubscriptionHandler(logger, n.e)
+
+	router := mux.NewRouter()
+	apirouter := router.PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
+
+	apirouter.Handle("/projects/{projectid}/runwebhookdeliveries", projectRunWebhookDeliveriesHandler).Methods("GET")
+
+	apirouter.Handle("/projects/{projectid}/subscriptions", projectSubscriptionsHandler).Methods("GET")
+	apirouter.Handle("/projects/{projectid}/subscriptions/{userid}", projectSubscriptionHandler).Methods("GET")
+	apirouter.Handle("/projects/{projectid}/subscriptions/{userid}", putProjectSubscriptionHandler).Methods("PUT")
+	apirouter.Handle("/projects/{projectid}/subscriptions/{userid}", deleteProjectSubscriptionHandler).Methods("DELETE")
+
+	mainrouter := mux.NewRouter()
+	mainrouter.PathPrefix("/").Handler(router)
+
+	var tlsConfig *tls.Config
+	if n.c.Web.TLS {
+		var err error
+		tlsConfig, err = util.NewTLSConfig(n.c.Web.TLSCertFile, n.c.Web.TLSKeyFile, "", false)
+		if err != nil {
+			log.Errorf("err: %+v", err)
+			return err
+		}
+	}
+
+	httpServer := http.Server{
+		Addr:      n.c.Web.ListenAddress,
+		Handler:   mainrouter,
+		TLSConfig: tlsConfig,
+	}
+
+	lerrCh := make(chan error)
+	go func() {
+		lerrCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Infof("notification service exiting")
+		httpServer.Close()
+	case err := <-lerrCh:
+		if err != nil {
+			log.Errorf("http server listen error: %+v", err)
+			return err
+		}
+	}
 
 	return nil
 }
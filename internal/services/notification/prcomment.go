@@ -0,0 +1,196 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// the number of previous runs of the same pull request where to look for
+	// an existing comment
+	pullRequestCommentPrevRunsLimit = 10
+)
+
+// updatePullRequestComment creates or updates a pull request comment with the
+// run summary. The comment id is saved in the run annotations so the runs of
+// the same pull request will update the same comment
+func (n *NotificationService) updatePullRequestComment(ctx context.Context, ev *rstypes.RunEvent) error {
+	if ev.TasksOnly || ev.Phase == rstypes.RunPhaseQueued {
+		return nil
+	}
+
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+	groupType, groupID, err := common.GroupTypeIDFromRunGroup(run.RunConfig.Group)
+	if err != nil {
+		return err
+	}
+
+	// only comment on project pull request runs
+	if groupType != common.GroupTypeProject {
+		return nil
+	}
+	if types.RunRefType(run.Run.Annotations[action.AnnotationRefType]) != types.RunRefTypePullRequest {
+		return nil
+	}
+	prID := run.Run.Annotations[action.AnnotationPullRequestID]
+	if prID == "" {
+		return nil
+	}
+
+	project, _, err := n.configstoreClient.GetProject(ctx, groupID)
+	if err != nil {
+		return errors.Errorf("failed to get project %s: %w", groupID, err)
+	}
+
+	gitSource, err := n.projectGitSource(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	link, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate run url: %w", err)
+	}
+	body := pullRequestCommentBody(run, link)
+
+	commentID := run.Run.Annotations[action.AnnotationPullRequestCommentID]
+	if commentID == "" {
+		commentID, err = n.previousPullRequestCommentID(ctx, run.Run)
+		if err != nil {
+			return err
+		}
+	}
+
+	if commentID != "" {
+		if err := gitSource.UpdatePullRequestComment(project.RepositoryPath, prID, commentID, body); err != nil {
+			return errors.Errorf("failed to update pull request %q comment %q: %w", prID, commentID, err)
+		}
+	} else {
+		commentID, err = gitSource.CreatePullRequestComment(project.RepositoryPath, prID, body)
+		if err != nil {
+			return errors.Errorf("failed to create pull request %q comment: %w", prID, err)
+		}
+		// git source doesn't support pull request comments
+		if commentID == "" {
+			return nil
+		}
+	}
+
+	if run.Run.Annotations[action.AnnotationPullRequestCommentID] != commentID {
+		annotations := map[string]string{action.AnnotationPullRequestCommentID: commentID}
+		if _, err := n.runserviceClient.RunSetAnnotations(ctx, run.Run.ID, annotations, ""); err != nil {
+			return errors.Errorf("failed to set run %q pull request comment annotation: %w", run.Run.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// previousPullRequestCommentID returns the pull request comment id saved in
+// the previous runs of the same pull request
+func (n *NotificationService) previousPullRequestCommentID(ctx context.Context, run *rstypes.Run) (string, error) {
+	runsResp, _, err := n.runserviceClient.GetRuns(ctx, nil, nil, []string{run.Group}, false, nil, nil, run.ID, pullRequestCommentPrevRunsLimit, false)
+	if err != nil {
+		return "", errors.Errorf("failed to get previous runs: %w", err)
+	}
+	for _, r := range runsResp.Runs {
+		if commentID := r.Annotations[action.AnnotationPullRequestCommentID]; commentID != "" {
+			return commentID, nil
+		}
+	}
+	return "", nil
+}
+
+func pullRequestCommentBody(run *rsapi.RunResponse, link string) string {
+	status := string(run.Run.Phase)
+	if run.Run.Phase == rstypes.RunPhaseFinished {
+		status = string(run.Run.Result)
+	}
+
+	rcts := make([]*rstypes.RunConfigTask, 0, len(run.RunConfig.Tasks))
+	for _, rct := range run.RunConfig.Tasks {
+		rcts = append(rcts, rct)
+	}
+	sort.Slice(rcts, func(i, j int) bool {
+		if rcts[i].Level != rcts[j].Level {
+			return rcts[i].Level < rcts[j].Level
+		}
+		return rcts[i].Name < rcts[j].Name
+	})
+
+	hasFailedTests := false
+	for _, rt := range run.Run.Tasks {
+		if rt.Annotations[rstypes.TaskAnnotationFailedTests] != "" {
+			hasFailedTests = true
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Agola run [#%d %s](%s): %s**\n\n", run.Run.Counter, run.Run.Name, link, status)
+	if commitSHA := run.Run.Annotations[action.AnnotationCommitSHA]; commitSHA != "" {
+		fmt.Fprintf(&b, "Commit: %s\n\n", commitSHA)
+	}
+
+	if len(rcts) == 0 {
+		return b.String()
+	}
+
+	if hasFailedTests {
+		b.WriteString("| Task | Status | Duration | Failed tests |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+	} else {
+		b.WriteString("| Task | Status | Duration |\n")
+		b.WriteString("| --- | --- | --- |\n")
+	}
+	for _, rct := range rcts {
+		rt, ok := run.Run.Tasks[rct.ID]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s |", rct.Name, rt.Status, taskDuration(rt))
+		if hasFailedTests {
+			fmt.Fprintf(&b, " %s |", rt.Annotations[rstypes.TaskAnnotationFailedTests])
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func taskDuration(rt *rstypes.RunTask) string {
+	if rt.StartTime == nil {
+		return ""
+	}
+	if rt.EndTime == nil {
+		return "running"
+	}
+	return rt.EndTime.Sub(*rt.StartTime).Round(time.Second).String()
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"testing"
+	"time"
+
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+)
+
+func TestPullRequestCommentBody(t *testing.T) {
+	startTime := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(90 * time.Second)
+
+	run := &rsapi.RunResponse{
+		Run: &rstypes.Run{
+			Name:    "run01",
+			Counter: 3,
+			Phase:   rstypes.RunPhaseFinished,
+			Result:  rstypes.RunResultFailed,
+			Tasks: map[string]*rstypes.RunTask{
+				"task01": {ID: "task01", Status: rstypes.RunTaskStatusSuccess, StartTime: &startTime, EndTime: &endTime},
+				"task02": {ID: "task02", Status: rstypes.RunTaskStatusFailed, StartTime: &startTime, EndTime: &endTime, Annotations: map[string]string{rstypes.TaskAnnotationFailedTests: "2"}},
+			},
+		},
+		RunConfig: &rstypes.RunConfig{
+			Tasks: map[string]*rstypes.RunConfigTask{
+				"task01": {ID: "task01", Name: "build", Level: 0},
+				"task02": {ID: "task02", Name: "test", Level: 1},
+			},
+		},
+	}
+
+	expected := "**Agola run [#3 run01](https://agola.example.com/run): failed**\n\n" +
+		"| Task | Status | Duration | Failed tests |\n" +
+		"| --- | --- | --- | --- |\n" +
+		"| build | success | 1m30s |  |\n" +
+		"| test | failed | 1m30s | 2 |\n"
+
+	out := pullRequestCommentBody(run, "https://agola.example.com/run")
+	if out != expected {
+		t.Fatalf("expected body:\n%s\ngot:\n%s", expected, out)
+	}
+}
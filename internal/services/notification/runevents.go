@@ -113,9 +113,34 @@ func (n *NotificationService) runEventsHandler(ctx context.Context) error {
 			if err := n.updateCommitStatus(ctx, ev); err != nil {
 				log.Infof("failed to update commit status: %v", err)
 			}
+			if err := n.enqueueRunWebhookDeliveries(ctx, ev); err != nil {
+				log.Infof("failed to enqueue run webhook deliveries: %v", err)
+			}
+			if err := n.sendRunEmails(ctx, ev); err != nil {
+				log.Infof("failed to send run emails: %v", err)
+			}
+			if err := n.sendRunChatNotifications(ctx, ev); err != nil {
+				log.Infof("failed to send run chat notifications: %v", err)
+			}
+			if err := n.updatePullRequestComment(ctx, ev); err != nil {
+				log.Infof("failed to update pull request comment: %v", err)
+			}
 
 		default:
 			return errors.Errorf("wrong data")
 		}
 	}
 }
+
+// previousFinishedRun returns the finished run preceding the provided run in
+// the same run group or nil if there's no one
+func (n *NotificationService) previousFinishedRun(ctx context.Context, run *rstypes.Run) (*rstypes.Run, error) {
+	runsResp, _, err := n.runserviceClient.GetRuns(ctx, []string{string(rstypes.RunPhaseFinished)}, nil, []string{run.Group}, false, nil, nil, run.ID, 1, false)
+	if err != nil {
+		return nil, errors.Errorf("failed to get previous run: %w", err)
+	}
+	if len(runsResp.Runs) == 0 {
+		return nil, nil
+	}
+	return runsResp.Runs[0], nil
+}
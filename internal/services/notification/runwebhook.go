@@ -0,0 +1,418 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	ncommon "agola.io/agola/internal/services/notification/common"
+	"agola.io/agola/internal/services/notification/store"
+	ntypes "agola.io/agola/internal/services/notification/types"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"go.etcd.io/etcd/clientv3/concurrency"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	runWebhookDeliveryMaxAttempts = 8
+	runWebhookDeliveryMinBackoff  = 10 * time.Second
+	runWebhookDeliveryMaxBackoff  = 30 * time.Minute
+	runWebhookDeliveryTimeout     = 10 * time.Second
+	// runWebhookDeliveryConcurrency is the max number of deliveries sent
+	// concurrently
+	runWebhookDeliveryConcurrency = 10
+
+	// runWebhookDeliveryRetention is how long completed (delivered or failed)
+	// deliveries are kept
+	runWebhookDeliveryRetention = 7 * 24 * time.Hour
+
+	runWebhookEventHeader     = "X-Agola-Event"
+	runWebhookDeliveryHeader  = "X-Agola-Delivery"
+	runWebhookSignatureHeader = "X-Agola-Signature"
+)
+
+// runWebhookEvents returns the run webhook events related to the provided run
+// event
+func runWebhookEvents(ev *rstypes.RunEvent) []types.RunWebhookEvent {
+	events := []types.RunWebhookEvent{}
+
+	if len(ev.TasksWaitingApproval) > 0 {
+		events = append(events, types.RunWebhookEventTaskWaitingApproval)
+	}
+	if ev.TasksOnly {
+		return events
+	}
+
+	switch ev.Phase {
+	case rstypes.RunPhaseQueued:
+		events = append(events, types.RunWebhookEventRunQueued)
+	case rstypes.RunPhaseRunning:
+		if ev.Result == rstypes.RunResultUnknown {
+			events = append(events, types.RunWebhookEventRunStarted)
+		}
+	case rstypes.RunPhaseCancelled:
+		events = append(events, types.RunWebhookEventRunFinished)
+	case rstypes.RunPhaseSetupError:
+		events = append(events, types.RunWebhookEventRunFinished, types.RunWebhookEventRunFailed)
+	case rstypes.RunPhaseFinished:
+		events = append(events, types.RunWebhookEventRunFinished)
+		if ev.Result == rstypes.RunResultFailed {
+			events = append(events, types.RunWebhookEventRunFailed)
+		}
+	}
+
+	return events
+}
+
+func (n *NotificationService) enqueueRunWebhookDeliveries(ctx context.Context, ev *rstypes.RunEvent) error {
+	events := runWebhookEvents(ev)
+	if len(events) == 0 {
+		return nil
+	}
+
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+	groupType, groupID, err := common.GroupTypeIDFromRunGroup(run.RunConfig.Group)
+	if err != nil {
+		return err
+	}
+
+	// run webhooks are defined only for projects
+	if groupType != common.GroupTypeProject {
+		return nil
+	}
+
+	project, _, err := n.configstoreClient.GetProject(ctx, groupID)
+	if err != nil {
+		return errors.Errorf("failed to get project %s: %w", groupID, err)
+	}
+
+	runWebhooks, _, err := n.configstoreClient.GetProjectRunWebhooks(ctx, project.ID, true)
+	if err != nil {
+		return errors.Errorf("failed to get project %s run webhooks: %w", project.ID, err)
+	}
+	if len(runWebhooks) == 0 {
+		return nil
+	}
+
+	link, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate run url: %w", err)
+	}
+
+	for _, event := range events {
+		payload := runWebhookPayload(event, ev, project, run, link)
+		payloadj, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+
+		for _, rw := range runWebhooks {
+			if !rw.MatchEvent(event) {
+				continue
+			}
+
+			id, err := store.NewRunWebhookDeliveryID(ctx, n.e)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			delivery := &ntypes.RunWebhookDelivery{
+				ID:              id,
+				ProjectID:       project.ID,
+				RunWebhookID:    rw.ID,
+				RunWebhookName:  rw.Name,
+				URL:             rw.URL,
+				Event:           event,
+				RunID:           run.Run.ID,
+				Payload:         payloadj,
+				Status:          ntypes.RunWebhookDeliveryStatusPending,
+				CreationTime:    now,
+				NextAttemptTime: &now,
+			}
+			if _, err := store.AtomicPutPendingRunWebhookDelivery(ctx, n.e, delivery); err != nil {
+				return err
+			}
+			log.Debugf("enqueued run webhook %q delivery %q for event %q", rw.Name, delivery.ID, event)
+		}
+	}
+
+	return nil
+}
+
+func runWebhookPayload(event types.RunWebhookEvent, ev *rstypes.RunEvent, project *csapi.Project, run *rsapi.RunResponse, link string) *ntypes.RunWebhookPayload {
+	r := run.Run
+	rc := run.RunConfig
+
+	payload := &ntypes.RunWebhookPayload{
+		Event: event,
+		Project: &ntypes.RunWebhookPayloadProject{
+			ID:   project.ID,
+			Name: project.Name,
+			Path: project.Path,
+		},
+		Run: &ntypes.RunWebhookPayloadRun{
+			ID:          r.ID,
+			Name:        r.Name,
+			Counter:     r.Counter,
+			Phase:       r.Phase,
+			Result:      r.Result,
+			Link:        link,
+			Annotations: r.Annotations,
+			SetupErrors: rc.SetupErrors,
+			EnqueueTime: r.EnqueueTime,
+			StartTime:   r.StartTime,
+			EndTime:     r.EndTime,
+			Tasks:       make(map[string]*ntypes.RunWebhookPayloadTask),
+		},
+	}
+
+	if event == types.RunWebhookEventTaskWaitingApproval {
+		payload.Run.TasksWaitingApproval = ev.TasksWaitingApproval
+	}
+
+	for _, rt := range r.Tasks {
+		pt := &ntypes.RunWebhookPayloadTask{
+			ID:              rt.ID,
+			Status:          rt.Status,
+			Skip:            rt.Skip,
+			WaitingApproval: rt.WaitingApproval,
+			Approved:        rt.Approved,
+			StartTime:       rt.StartTime,
+			EndTime:         rt.EndTime,
+		}
+		if rct, ok := rc.Tasks[rt.ID]; ok {
+			pt.Name = rct.Name
+		}
+		payload.Run.Tasks[rt.ID] = pt
+	}
+
+	return payload
+}
+
+func (n *NotificationService) runWebhookDeliveriesLoop(ctx context.Context) {
+	for {
+		if err := n.runWebhookDeliveries(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (n *NotificationService) runWebhookDeliveries(ctx context.Context) error {
+	session, err := concurrency.NewSession(n.e.Client(), concurrency.WithTTL(5), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	m := concurrency.NewMutex(session, ncommon.EtcdRunWebhookDeliveriesLockKey)
+
+	if err := m.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() { _ = m.Unlock(ctx) }()
+
+	deliveries, err := store.GetPendingRunWebhookDeliveries(ctx, n.e)
+	if err != nil {
+		return err
+	}
+
+	// send the deliveries concurrently so a slow endpoint won't delay the
+	// deliveries of the other run webhooks
+	sem := make(chan struct{}, runWebhookDeliveryConcurrency)
+	var wg sync.WaitGroup
+	now := time.Now()
+	for _, delivery := range deliveries {
+		if delivery.NextAttemptTime != nil && delivery.NextAttemptTime.After(now) {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(delivery *ntypes.RunWebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := n.deliverRunWebhook(ctx, delivery); err != nil {
+				log.Errorf("failed to deliver run webhook delivery %q: %+v", delivery.ID, err)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (n *NotificationService) deliverRunWebhook(ctx context.Context, delivery *ntypes.RunWebhookDelivery) error {
+	// get the current run webhook since it could have been updated or removed
+	// after the delivery was enqueued
+	runWebhooks, _, err := n.configstoreClient.GetProjectRunWebhooks(ctx, delivery.ProjectID, true)
+	if err != nil {
+		return errors.Errorf("failed to get project %s run webhooks: %w", delivery.ProjectID, err)
+	}
+	var runWebhook *csapi.RunWebhook
+	for _, rw := range runWebhooks {
+		if rw.ID == delivery.RunWebhookID {
+			runWebhook = rw
+			break
+		}
+	}
+
+	var attempt *ntypes.RunWebhookDeliveryAttempt
+	if runWebhook == nil {
+		attempt = &ntypes.RunWebhookDeliveryAttempt{
+			Time:  time.Now(),
+			Error: fmt.Sprintf("run webhook %q doesn't exist anymore", delivery.RunWebhookName),
+		}
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		delivery.Status = ntypes.RunWebhookDeliveryStatusFailed
+	} else {
+		delivery.URL = runWebhook.URL
+		attempt = sendRunWebhook(ctx, runWebhook.RunWebhook, delivery)
+		delivery.Attempts = append(delivery.Attempts, attempt)
+
+		switch {
+		case attempt.Error == "":
+			delivery.Status = ntypes.RunWebhookDeliveryStatusDelivered
+		case len(delivery.Attempts) >= runWebhookDeliveryMaxAttempts:
+			delivery.Status = ntypes.RunWebhookDeliveryStatusFailed
+		}
+	}
+
+	if delivery.Status == ntypes.RunWebhookDeliveryStatusPending {
+		nextAttemptTime := time.Now().Add(runWebhookDeliveryBackoff(len(delivery.Attempts)))
+		delivery.NextAttemptTime = &nextAttemptTime
+		log.Infof("run webhook delivery %q failed, will retry at %s: %s", delivery.ID, nextAttemptTime, attempt.Error)
+		_, err = store.AtomicPutPendingRunWebhookDelivery(ctx, n.e, delivery)
+		return err
+	}
+
+	delivery.NextAttemptTime = nil
+	return store.CompleteRunWebhookDelivery(ctx, n.e, delivery, runWebhookDeliveryRetention)
+}
+
+// runWebhookDeliveryBackoff returns the time to wait before the next delivery
+// attempt. It doubles at every attempt up to runWebhookDeliveryMaxBackoff
+func runWebhookDeliveryBackoff(attempts int) time.Duration {
+	d := runWebhookDeliveryMinBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= runWebhookDeliveryMaxBackoff {
+			d = runWebhookDeliveryMaxBackoff
+			break
+		}
+	}
+	return util.Jitter(d, 0.1)
+}
+
+// runWebhookSignature returns the hex encoded HMAC-SHA256 of the payload
+func runWebhookSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// the http clients are shared to reuse their connections
+var (
+	runWebhookClient         = newRunWebhookHTTPClient(false)
+	runWebhookInsecureClient = newRunWebhookHTTPClient(true)
+)
+
+// runWebhookHTTPClient returns the shared http client for the provided tls
+// verification option
+func runWebhookHTTPClient(skipVerify bool) *http.Client {
+	if skipVerify {
+		return runWebhookInsecureClient
+	}
+	return runWebhookClient
+}
+
+func newRunWebhookHTTPClient(skipVerify bool) *http.Client {
+	// copied from net/http until it has a clone function: https://github.com/golang/go/issues/26013
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: skipVerify},
+	}
+	return &http.Client{Transport: transport, Timeout: runWebhookDeliveryTimeout}
+}
+
+func sendRunWebhook(ctx context.Context, rw *types.RunWebhook, delivery *ntypes.RunWebhookDelivery) *ntypes.RunWebhookDeliveryAttempt {
+	attempt := &ntypes.RunWebhookDeliveryAttempt{Time: time.Now()}
+	defer func() { attempt.Duration = time.Since(attempt.Time) }()
+
+	req, err := http.NewRequest("POST", rw.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(runWebhookEventHeader, string(delivery.Event))
+	req.Header.Set(runWebhookDeliveryHeader, delivery.ID)
+	if rw.Secret != "" {
+		req.Header.Set(runWebhookSignatureHeader, "sha256="+runWebhookSignature(rw.Secret, delivery.Payload))
+	}
+
+	resp, err := runWebhookHTTPClient(rw.SkipVerify).Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode/100 != 2 {
+		attempt.Error = fmt.Sprintf("unexpected http status code: %d", resp.StatusCode)
+	}
+
+	return attempt
+}
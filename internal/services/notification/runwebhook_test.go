@@ -0,0 +1,202 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/notification/store"
+	ntypes "agola.io/agola/internal/services/notification/types"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/testutil"
+
+	"go.uber.org/zap"
+)
+
+func TestRunWebhookEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   *rstypes.RunEvent
+		out  []types.RunWebhookEvent
+	}{
+		{
+			name: "test queued run",
+			ev:   &rstypes.RunEvent{Phase: rstypes.RunPhaseQueued, Result: rstypes.RunResultUnknown},
+			out:  []types.RunWebhookEvent{types.RunWebhookEventRunQueued},
+		},
+		{
+			name: "test started run",
+			ev:   &rstypes.RunEvent{Phase: rstypes.RunPhaseRunning, Result: rstypes.RunResultUnknown},
+			out:  []types.RunWebhookEvent{types.RunWebhookEventRunStarted},
+		},
+		{
+			name: "test running run with failed result",
+			ev:   &rstypes.RunEvent{Phase: rstypes.RunPhaseRunning, Result: rstypes.RunResultFailed},
+			out:  []types.RunWebhookEvent{},
+		},
+		{
+			name: "test finished successful run",
+			ev:   &rstypes.RunEvent{Phase: rstypes.RunPhaseFinished, Result: rstypes.RunResultSuccess},
+			out:  []types.RunWebhookEvent{types.RunWebhookEventRunFinished},
+		},
+		{
+			name: "test finished failed run",
+			ev:   &rstypes.RunEvent{Phase: rstypes.RunPhaseFinished, Result: rstypes.RunResultFailed},
+			out:  []types.RunWebhookEvent{types.RunWebhookEventRunFinished, types.RunWebhookEventRunFailed},
+		},
+		{
+			name: "test run setup error",
+			ev:   &rstypes.RunEvent{Phase: rstypes.RunPhaseSetupError, Result: rstypes.RunResultUnknown},
+			out:  []types.RunWebhookEvent{types.RunWebhookEventRunFinished, types.RunWebhookEventRunFailed},
+		},
+		{
+			name: "test task waiting approval without phase change",
+			ev:   &rstypes.RunEvent{Phase: rstypes.RunPhaseRunning, Result: rstypes.RunResultUnknown, TasksWaitingApproval: []string{"task01"}, TasksOnly: true},
+			out:  []types.RunWebhookEvent{types.RunWebhookEventTaskWaitingApproval},
+		},
+		{
+			name: "test task waiting approval with phase change",
+			ev:   &rstypes.RunEvent{Phase: rstypes.RunPhaseRunning, Result: rstypes.RunResultUnknown, TasksWaitingApproval: []string{"task01"}},
+			out:  []types.RunWebhookEvent{types.RunWebhookEventTaskWaitingApproval, types.RunWebhookEventRunStarted},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := runWebhookEvents(tt.ev)
+			if !reflect.DeepEqual(out, tt.out) {
+				t.Fatalf("expected %v, got %v", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestRunWebhookSignature(t *testing.T) {
+	// expected value computed with: echo -n '{"event":"run_queued"}' | openssl dgst -sha256 -hmac secret
+	expected := "5be41c504ed6d98a5bf759eb7304acd3f25743597b4aff22b31b42de46d28850"
+	out := runWebhookSignature("secret", []byte(`{"event":"run_queued"}`))
+	if out != expected {
+		t.Fatalf("expected signature %q, got %q", expected, out)
+	}
+}
+
+func TestRunWebhookDeliveries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tetcd, err := testutil.NewTestEmbeddedEtcd(t, zap.NewNop(), dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.Start(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.WaitUp(30 * time.Second); err != nil {
+		t.Fatalf("error waiting on etcd up: %v", err)
+	}
+	defer func() { _ = tetcd.Kill() }()
+
+	ctx := context.Background()
+
+	// the slow endpoint doesn't reply until released
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	fastDone := make(chan struct{})
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(fastDone)
+	}))
+	defer fast.Close()
+
+	runWebhooks := []*csapi.RunWebhook{
+		{RunWebhook: &types.RunWebhook{ID: "rw01", Name: "slow", URL: slow.URL}},
+		{RunWebhook: &types.RunWebhook{ID: "rw02", Name: "fast", URL: fast.URL}},
+	}
+	cs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(runWebhooks)
+	}))
+	defer cs.Close()
+
+	n := &NotificationService{
+		e:                 tetcd.TestEtcd.Store,
+		configstoreClient: csapi.NewClient(cs.URL),
+	}
+
+	now := time.Now()
+	for _, rw := range runWebhooks {
+		delivery := &ntypes.RunWebhookDelivery{
+			ID:              "delivery" + rw.ID,
+			ProjectID:       "project01",
+			RunWebhookID:    rw.ID,
+			RunWebhookName:  rw.Name,
+			URL:             rw.URL,
+			Status:          ntypes.RunWebhookDeliveryStatusPending,
+			CreationTime:    now,
+			NextAttemptTime: &now,
+		}
+		if _, err := store.AtomicPutPendingRunWebhookDelivery(ctx, n.e, delivery); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	errCh := make(chan error)
+	go func() { errCh <- n.runWebhookDeliveries(ctx) }()
+
+	// the fast endpoint must not wait for the slow one
+	select {
+	case <-fastDone:
+	case <-time.After(runWebhookDeliveryTimeout / 2):
+		t.Fatalf("fast run webhook not delivered while the slow one is pending")
+	}
+	close(release)
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	pending, err := store.GetPendingRunWebhookDeliveries(ctx, n.e)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending deliveries, got %d", len(pending))
+	}
+	deliveries, err := store.GetProjectRunWebhookDeliveries(ctx, n.e, "project01")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(deliveries))
+	}
+	for _, d := range deliveries {
+		if d.Status != ntypes.RunWebhookDeliveryStatusDelivered {
+			t.Fatalf("expected delivery %q status %q, got %q", d.ID, ntypes.RunWebhookDeliveryStatusDelivered, d.Status)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/sequence"
+	"agola.io/agola/internal/services/notification/common"
+	"agola.io/agola/internal/services/notification/types"
+
+	etcdclientv3 "go.etcd.io/etcd/clientv3"
+)
+
+func NewRunWebhookDeliveryID(ctx context.Context, e *etcd.Store) (string, error) {
+	seq, err := sequence.IncSequence(ctx, e, common.EtcdRunWebhookDeliverySequenceKey)
+	if err != nil {
+		return "", err
+	}
+	return seq.String(), nil
+}
+
+// GetPendingRunWebhookDeliveries returns the pending run webhook deliveries
+// of all the projects, ordered by project id and delivery id
+func GetPendingRunWebhookDeliveries(ctx context.Context, e *etcd.Store) ([]*types.RunWebhookDelivery, error) {
+	return getRunWebhookDeliveries(ctx, e, common.EtcdPendingRunWebhookDeliveriesDir)
+}
+
+// GetProjectRunWebhookDeliveries returns the pending run webhook deliveries
+// of the provided project followed by the completed ones, both ordered by
+// delivery id
+func GetProjectRunWebhookDeliveries(ctx context.Context, e *etcd.Store, projectID string) ([]*types.RunWebhookDelivery, error) {
+	pending, err := getRunWebhookDeliveries(ctx, e, common.EtcdProjectPendingRunWebhookDeliveriesDir(projectID))
+	if err != nil {
+		return nil, err
+	}
+	completed, err := getRunWebhookDeliveries(ctx, e, common.EtcdProjectRunWebhookDeliveriesDir(projectID))
+	if err != nil {
+		return nil, err
+	}
+	return append(pending, completed...), nil
+}
+
+func getRunWebhookDeliveries(ctx context.Context, e *etcd.Store, dir string) ([]*types.RunWebhookDelivery, error) {
+	resp, err := e.List(ctx, dir, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []*types.RunWebhookDelivery{}
+
+	for _, kv := range resp.Kvs {
+		var delivery *types.RunWebhookDelivery
+		if err := json.Unmarshal(kv.Value, &delivery); err != nil {
+			return nil, err
+		}
+		delivery.Revision = kv.ModRevision
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// AtomicPutPendingRunWebhookDelivery saves a pending run webhook delivery
+func AtomicPutPendingRunWebhookDelivery(ctx context.Context, e *etcd.Store, delivery *types.RunWebhookDelivery) (*types.RunWebhookDelivery, error) {
+	deliveryj, err := json.Marshal(delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.AtomicPut(ctx, common.EtcdPendingRunWebhookDeliveryKey(delivery.ProjectID, delivery.ID), deliveryj, delivery.Revision, nil)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Revision = resp.Header.Revision
+
+	return delivery, nil
+}
+
+// CompleteRunWebhookDelivery atomically moves a delivered or failed delivery
+// from the pending deliveries to the completed ones. Completed deliveries are
+// removed after ttl
+func CompleteRunWebhookDelivery(ctx context.Context, e *etcd.Store, delivery *types.RunWebhookDelivery, ttl time.Duration) error {
+	deliveryj, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	lease, err := e.Client().Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return etcd.FromEtcdError(err)
+	}
+
+	pendingKey := common.EtcdPendingRunWebhookDeliveryKey(delivery.ProjectID, delivery.ID)
+	cmp := etcdclientv3.Compare(etcdclientv3.ModRevision(pendingKey), "=", delivery.Revision)
+	then := []etcdclientv3.Op{
+		etcdclientv3.OpDelete(pendingKey),
+		etcdclientv3.OpPut(common.EtcdRunWebhookDeliveryKey(delivery.ProjectID, delivery.ID), string(deliveryj), etcdclientv3.WithLease(lease.ID)),
+	}
+	tresp, err := e.Client().Txn(ctx).If(cmp).Then(then...).Commit()
+	if err != nil {
+		return etcd.FromEtcdError(err)
+	}
+	if !tresp.Succeeded {
+		return etcd.ErrKeyModified
+	}
+
+	return nil
+}
+
+func GetProjectSubscriptions(ctx context.Context, e *etcd.Store, projectID string) ([]*types.ProjectSubscription, error) {
+	resp, err := e.List(ctx, common.EtcdProjectSubscriptionsProjectDir(projectID), "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []*types.ProjectSubscription{}
+
+	for _, kv := range resp.Kvs {
+		var subscription *types.ProjectSubscription
+		if err := json.Unmarshal(kv.Value, &subscription); err != nil {
+			return nil, err
+		}
+		subscription.Revision = kv.ModRevision
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+func GetProjectSubscription(ctx context.Context, e *etcd.Store, projectID, userID string) (*types.ProjectSubscription, error) {
+	resp, err := e.Get(ctx, common.EtcdProjectSubscriptionKey(projectID, userID), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscription *types.ProjectSubscription
+	kv := resp.Kvs[0]
+	if err := json.Unmarshal(kv.Value, &subscription); err != nil {
+		return nil, err
+	}
+	subscription.Revision = kv.ModRevision
+
+	return subscription, nil
+}
+
+func PutProjectSubscription(ctx context.Context, e *etcd.Store, subscription *types.ProjectSubscription) (*types.ProjectSubscription, error) {
+	subscriptionj, err := json.Marshal(subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.Put(ctx, common.EtcdProjectSubscriptionKey(subscription.ProjectID, subscription.UserID), subscriptionj, nil)
+	if err != nil {
+		return nil, err
+	}
+	subscription.Revision = resp.Header.Revision
+
+	return subscription, nil
+}
+
+func DeleteProjectSubscription(ctx context.Context, e *etcd.Store, projectID, userID string) error {
+	return e.Delete(ctx, common.EtcdProjectSubscriptionKey(projectID, userID))
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"time"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	cstypes "agola.io/agola/internal/services/types"
+)
+
+type RunWebhookDeliveryStatus string
+
+const (
+	RunWebhookDeliveryStatusPending   RunWebhookDeliveryStatus = "pending"
+	RunWebhookDeliveryStatusDelivered RunWebhookDeliveryStatus = "delivered"
+	RunWebhookDeliveryStatusFailed    RunWebhookDeliveryStatus = "failed"
+)
+
+// RunWebhookDelivery records the delivery of a run webhook payload and all the
+// delivery attempts
+type RunWebhookDelivery struct {
+	ID string `json:"id,omitempty"`
+
+	ProjectID      string `json:"project_id,omitempty"`
+	RunWebhookID   string `json:"run_webhook_id,omitempty"`
+	RunWebhookName string `json:"run_webhook_name,omitempty"`
+	URL            string `json:"url,omitempty"`
+
+	Event   cstypes.RunWebhookEvent `json:"event,omitempty"`
+	RunID   string                  `json:"run_id,omitempty"`
+	Payload json.RawMessage         `json:"payload,omitempty"`
+
+	Status   RunWebhookDeliveryStatus     `json:"status,omitempty"`
+	Attempts []*RunWebhookDeliveryAttempt `json:"attempts,omitempty"`
+
+	CreationTime    time.Time  `json:"creation_time,omitempty"`
+	NextAttemptTime *time.Time `json:"next_attempt_time,omitempty"`
+
+	// internal values not saved
+	Revision int64 `json:"-"`
+}
+
+type RunWebhookDeliveryAttempt struct {
+	Time     time.Time     `json:"time,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// StatusCode is the http status code returned by the remote endpoint. It's
+	// 0 when the request failed before receiving a response
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// RunWebhookPayload is the json payload sent to the run webhooks
+type RunWebhookPayload struct {
+	Event   cstypes.RunWebhookEvent   `json:"event"`
+	Project *RunWebhookPayloadProject `json:"project"`
+	Run     *RunWebhookPayloadRun     `json:"run"`
+}
+
+type RunWebhookPayloadProject struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type RunWebhookPayloadRun struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Counter     uint64            `json:"counter"`
+	Phase       rstypes.RunPhase  `json:"phase"`
+	Result      rstypes.RunResult `json:"result"`
+	Link        string            `json:"link"`
+	Annotations map[string]string `json:"annotations"`
+	SetupErrors []string          `json:"setup_errors,omitempty"`
+
+	EnqueueTime *time.Time `json:"enqueue_time,omitempty"`
+	StartTime   *time.Time `json:"start_time,omitempty"`
+	EndTime     *time.Time `json:"end_time,omitempty"`
+
+	Tasks map[string]*RunWebhookPayloadTask `json:"tasks"`
+
+	// TasksWaitingApproval are the ids of the tasks that started waiting for an
+	// approval. Populated only on task_waiting_approval events
+	TasksWaitingApproval []string `json:"tasks_waiting_approval,omitempty"`
+}
+
+type RunWebhookPayloadTask struct {
+	ID              string                `json:"id"`
+	Name            string                `json:"name"`
+	Status          rstypes.RunTaskStatus `json:"status"`
+	Skip            bool                  `json:"skip"`
+	WaitingApproval bool                  `json:"waiting_approval"`
+	Approved        bool                  `json:"approved"`
+
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+}
+
+// ProjectSubscription is a user subscription to the email notifications of a
+// project
+type ProjectSubscription struct {
+	ProjectID string `json:"project_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+
+	// Email is the address where notifications are sent
+	Email string `json:"email,omitempty"`
+
+	// Branches are the watched branches. If empty all the branches are watched
+	Branches []string `json:"branches,omitempty"`
+
+	// internal values not saved
+	Revision int64 `json:"-"`
+}
+
+func (s *ProjectSubscription) WatchBranch(branch string) bool {
+	if len(s.Branches) == 0 {
+		return true
+	}
+	for _, b := range s.Branches {
+		if b == branch {
+			return true
+		}
+	}
+	return false
+}
@@ -16,7 +16,9 @@ package action
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"path"
 	"time"
 
@@ -24,6 +26,7 @@ import (
 	"agola.io/agola/internal/db"
 	"agola.io/agola/internal/etcd"
 	"agola.io/agola/internal/objectstorage"
+	ostypes "agola.io/agola/internal/objectstorage/types"
 	"agola.io/agola/internal/runconfig"
 	"agola.io/agola/internal/sequence"
 	"agola.io/agola/internal/services/runservice/common"
@@ -129,6 +132,71 @@ func (h *ActionHandler) StopRun(ctx context.Context, req *RunStopRequest) error
 	return err
 }
 
+type RunSetAnnotationsRequest struct {
+	RunID                   string
+	Annotations             map[string]string
+	ChangeGroupsUpdateToken string
+}
+
+// RunSetAnnotations adds the provided annotations to the run annotations,
+// overriding the existing ones with the same key. For archived runs the
+// ChangeGroupsUpdateToken is ignored and the updated run is saved in the
+// object storage
+func (h *ActionHandler) RunSetAnnotations(ctx context.Context, req *RunSetAnnotationsRequest) error {
+	cgt, err := types.UnmarshalChangeGroupsUpdateToken(req.ChangeGroupsUpdateToken)
+	if err != nil {
+		return err
+	}
+
+	r, _, err := store.GetRun(ctx, h.e, req.RunID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return err
+	}
+	if r == nil {
+		return h.archivedRunSetAnnotations(ctx, req)
+	}
+
+	setRunAnnotations(r, req.Annotations)
+
+	_, err = store.AtomicPutRun(ctx, h.e, r, nil, cgt)
+	return err
+}
+
+func (h *ActionHandler) archivedRunSetAnnotations(ctx context.Context, req *RunSetAnnotationsRequest) error {
+	// use a per run changegroup to detect concurrent annotations updates
+	cgNames := []string{"runannotations-" + req.RunID}
+	rf, cgt, err := h.dm.ReadObject(string(common.DataTypeRun), req.RunID, cgNames)
+	if err != nil {
+		if err == ostypes.ErrNotExist {
+			return util.NewErrNotFound(errors.Errorf("run %q doesn't exist", req.RunID))
+		}
+		return err
+	}
+	defer rf.Close()
+	var r *types.Run
+	if err := json.NewDecoder(rf).Decode(&r); err != nil {
+		return err
+	}
+
+	setRunAnnotations(r, req.Annotations)
+
+	ra, err := store.OSTSaveRunAction(r)
+	if err != nil {
+		return err
+	}
+	_, err = h.dm.WriteWal(ctx, []*datamanager.Action{ra}, cgt)
+	return err
+}
+
+func setRunAnnotations(r *types.Run, annotations map[string]string) {
+	if r.Annotations == nil {
+		r.Annotations = make(map[string]string)
+	}
+	for k, v := range annotations {
+		r.Annotations[k] = v
+	}
+}
+
 type RunCreateRequest struct {
 	RunConfigTasks    map[string]*types.RunConfigTask
 	Name              string
@@ -136,6 +204,8 @@ type RunCreateRequest struct {
 	SetupErrors       []string
 	StaticEnvironment map[string]string
 	CacheGroup        string
+	CacheQuota        int64
+	RunRetention      *types.RunRetentionPolicy
 
 	// existing run fields
 	RunID      string
@@ -165,7 +235,16 @@ func (h *ActionHandler) CreateRun(ctx context.Context, req *RunCreateRequest) (*
 		return nil, err
 	}
 
-	return rb, h.saveRun(ctx, rb, runcgt)
+	if err := h.saveRun(ctx, rb, runcgt); err != nil {
+		return nil, err
+	}
+
+	// save the run cache group quota that will be enforced by the cache cleaner
+	if err := store.OSTSetCacheQuota(h.ost, store.CachePrefix(rb.Rc), rb.Rc.CacheQuota); err != nil {
+		h.log.Warnf("failed to save run %q cache quota: %v", rb.Run.ID, err)
+	}
+
+	return rb, nil
 }
 
 func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*types.RunBundle, error) {
@@ -212,6 +291,8 @@ func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*typ
 		Environment:       req.Environment,
 		Annotations:       req.Annotations,
 		CacheGroup:        req.CacheGroup,
+		CacheQuota:        req.CacheQuota,
+		RunRetention:      req.RunRetention,
 	}
 
 	run := genRun(rc)
@@ -550,22 +631,135 @@ func (h *ActionHandler) ApproveRunTask(ctx context.Context, req *RunTaskApproveR
 	return err
 }
 
-func (h *ActionHandler) DeleteExecutor(ctx context.Context, executorID string) error {
-	// mark all executor tasks as failed
-	ets, err := store.GetExecutorTasks(ctx, h.e, executorID)
+// maxRunTaskUpdateRetries is the max number of attempts to update a run task
+// when the run is concurrently updated
+const maxRunTaskUpdateRetries = 5
+
+type RunTaskLogUploadRequest struct {
+	ExecutorID string
+	TaskID     string
+	Setup      bool
+	Step       int
+	Data       io.Reader
+}
+
+// UploadRunTaskLog saves a task log pushed by an executor and marks its log
+// phase as finished so the runservice won't fetch it from the executor
+func (h *ActionHandler) UploadRunTaskLog(ctx context.Context, req *RunTaskLogUploadRequest) error {
+	runID, rt, err := h.getExecutorTaskRunTask(ctx, req.ExecutorID, req.TaskID)
 	if err != nil {
 		return err
 	}
+	if !req.Setup && (req.Step < 0 || req.Step >= len(rt.Steps)) {
+		return util.NewErrBadRequest(errors.Errorf("no such step %d for task %q", req.Step, req.TaskID))
+	}
 
-	for _, et := range ets {
-		et.Status.Phase = types.ExecutorTaskPhaseFailed
-		et.FailError = "executor deleted"
-		if _, err := store.AtomicPutExecutorTask(ctx, h.e, et); err != nil {
+	var logPath string
+	if req.Setup {
+		logPath = store.OSTRunTaskSetupLogPath(rt.ID)
+	} else {
+		logPath = store.OSTRunTaskStepLogPath(rt.ID, req.Step)
+	}
+	if err := store.OSTWriteCompressedObject(h.ost, logPath, req.Data); err != nil {
+		return err
+	}
+
+	return h.updateRunTask(ctx, runID, rt.ID, func(rt *types.RunTask) {
+		if req.Setup {
+			rt.SetupStep.LogPhase = types.RunTaskFetchPhaseFinished
+		} else {
+			rt.Steps[req.Step].LogPhase = types.RunTaskFetchPhaseFinished
+		}
+	})
+}
+
+type RunTaskArchiveUploadRequest struct {
+	ExecutorID string
+	TaskID     string
+	Step       int
+	Data       io.Reader
+}
+
+// UploadRunTaskArchive saves a task workspace archive pushed by an executor
+// and marks its archive phase as finished so the runservice won't fetch it
+// from the executor
+func (h *ActionHandler) UploadRunTaskArchive(ctx context.Context, req *RunTaskArchiveUploadRequest) error {
+	runID, rt, err := h.getExecutorTaskRunTask(ctx, req.ExecutorID, req.TaskID)
+	if err != nil {
+		return err
+	}
+	archiveIndex := -1
+	for i, sn := range rt.WorkspaceArchives {
+		if sn == req.Step {
+			archiveIndex = i
+			break
+		}
+	}
+	if archiveIndex < 0 {
+		return util.NewErrBadRequest(errors.Errorf("no workspace archive for task %q, step %d", req.TaskID, req.Step))
+	}
+
+	if err := store.OSTWriteHashedObject(h.ost, store.OSTRunTaskArchivePath(rt.ID, req.Step), store.OSTRunTaskArchiveHashPath(rt.ID, req.Step), req.Data); err != nil {
+		return err
+	}
+
+	return h.updateRunTask(ctx, runID, rt.ID, func(rt *types.RunTask) {
+		rt.WorkspaceArchivesPhase[archiveIndex] = types.RunTaskFetchPhaseFinished
+	})
+}
+
+// getExecutorTaskRunTask returns the run id and the run task of the executor
+// task with the provided id. The executor task must be assigned to the
+// provided executor, so a lost executor whose task has been rescheduled
+// cannot overwrite the new attempt data
+func (h *ActionHandler) getExecutorTaskRunTask(ctx context.Context, executorID, taskID string) (string, *types.RunTask, error) {
+	et, err := store.GetExecutorTask(ctx, h.e, taskID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			return "", nil, util.NewErrNotFound(errors.Errorf("executor task %q doesn't exist", taskID))
+		}
+		return "", nil, err
+	}
+	if et.Status.ExecutorID != executorID {
+		return "", nil, util.NewErrBadRequest(errors.Errorf("executor task %q is not assigned to executor %q", taskID, executorID))
+	}
+	r, _, err := store.GetRun(ctx, h.e, et.RunID)
+	if err != nil {
+		return "", nil, err
+	}
+	rt, ok := r.Tasks[taskID]
+	if !ok {
+		return "", nil, util.NewErrNotFound(errors.Errorf("run %q doesn't have task %q", r.ID, taskID))
+	}
+	return r.ID, rt, nil
+}
+
+// updateRunTask applies update to the run task and saves the run retrying
+// when the run has been concurrently updated
+func (h *ActionHandler) updateRunTask(ctx context.Context, runID, taskID string, update func(rt *types.RunTask)) error {
+	var err error
+	for i := 0; i < maxRunTaskUpdateRetries; i++ {
+		var r *types.Run
+		r, _, err = store.GetRun(ctx, h.e, runID)
+		if err != nil {
 			return err
 		}
+		rt, ok := r.Tasks[taskID]
+		if !ok {
+			return errors.Errorf("run %q doesn't have task %q", runID, taskID)
+		}
+		update(rt)
+
+		if _, err = store.AtomicPutRun(ctx, h.e, r, nil, nil); err == nil {
+			return nil
+		}
 	}
+	return err
+}
 
-	// delete the executor
+func (h *ActionHandler) DeleteExecutor(ctx context.Context, executorID string) error {
+	// delete the executor, its not finished executor tasks will be rescheduled
+	// or marked as failed by the executor tasks cleaner
 	if err := store.DeleteExecutor(ctx, h.e, executorID); err != nil {
 		return err
 	}
@@ -573,6 +767,100 @@ func (h *ActionHandler) DeleteExecutor(ctx context.Context, executorID string) e
 	return nil
 }
 
+// maxExecutorUpdateRetries is the max number of attempts to update an executor
+// when it's concurrently updated by the executor status updates
+const maxExecutorUpdateRetries = 5
+
+func (h *ActionHandler) GetExecutors(ctx context.Context) ([]*types.Executor, error) {
+	return store.GetExecutors(ctx, h.e)
+}
+
+func (h *ActionHandler) getExecutor(ctx context.Context, executorID string) (*types.Executor, error) {
+	executor, err := store.GetExecutor(ctx, h.e, executorID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			return nil, util.NewErrNotFound(errors.Errorf("executor %q doesn't exist", executorID))
+		}
+		return nil, err
+	}
+	return executor, nil
+}
+
+// SetExecutorCordoned cordons or uncordons an executor. A cordoned executor
+// won't be chosen to run new tasks but will continue executing its current
+// tasks
+func (h *ActionHandler) SetExecutorCordoned(ctx context.Context, executorID string, cordoned bool) (*types.Executor, error) {
+	var err error
+	for i := 0; i < maxExecutorUpdateRetries; i++ {
+		var executor *types.Executor
+		executor, err = h.getExecutor(ctx, executorID)
+		if err != nil {
+			return nil, err
+		}
+		if executor.Cordoned == cordoned {
+			return executor, nil
+		}
+		executor.Cordoned = cordoned
+
+		if _, err = store.AtomicPutExecutor(ctx, h.e, executor); err == nil {
+			return executor, nil
+		}
+		if err != etcd.ErrKeyModified {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+type ExecutorDrainStatus struct {
+	Executor *types.Executor
+	// ActiveTasks are the executor tasks assigned to the executor and not yet
+	// finished
+	ActiveTasks []*types.ExecutorTask
+}
+
+// Drained reports if the executor is cordoned and has no active tasks
+func (s *ExecutorDrainStatus) Drained() bool {
+	return !s.Executor.Schedulable() && len(s.ActiveTasks) == 0
+}
+
+func (h *ActionHandler) GetExecutorDrainStatus(ctx context.Context, executorID string) (*ExecutorDrainStatus, error) {
+	executor, err := h.getExecutor(ctx, executorID)
+	if err != nil {
+		return nil, err
+	}
+	return h.executorDrainStatus(ctx, executor)
+}
+
+// DrainExecutor cordons the executor and returns its drain status. The
+// executor is drained when all its active tasks are finished
+func (h *ActionHandler) DrainExecutor(ctx context.Context, executorID string) (*ExecutorDrainStatus, error) {
+	executor, err := h.SetExecutorCordoned(ctx, executorID, true)
+	if err != nil {
+		return nil, err
+	}
+	return h.executorDrainStatus(ctx, executor)
+}
+
+func (h *ActionHandler) executorDrainStatus(ctx context.Context, executor *types.Executor) (*ExecutorDrainStatus, error) {
+	ets, err := store.GetExecutorTasks(ctx, h.e, executor.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	activeTasks := []*types.ExecutorTask{}
+	for _, et := range ets {
+		if !et.Status.Phase.IsFinished() {
+			activeTasks = append(activeTasks, et)
+		}
+	}
+
+	return &ExecutorDrainStatus{
+		Executor:    executor,
+		ActiveTasks: activeTasks,
+	}, nil
+}
+
 func (h *ActionHandler) getRunCounter(group string) (uint64, *datamanager.ChangeGroupsUpdateToken, error) {
 	// use the first group dir after the root
 	pl := util.PathList(group)
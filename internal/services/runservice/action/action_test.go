@@ -15,11 +15,24 @@
 package action
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/posix"
+	"agola.io/agola/internal/services/runservice/store"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/testutil"
 	"agola.io/agola/internal/util"
+	errors "golang.org/x/xerrors"
+
 	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
 )
 
 func TestRecreateRun(t *testing.T) {
@@ -277,3 +290,258 @@ func TestRecreateRun(t *testing.T) {
 		})
 	}
 }
+
+func setupUploadTest(t *testing.T, ctx context.Context, dir string) (*ActionHandler, *testutil.TestEmbeddedEtcd) {
+	logger := zap.NewNop()
+
+	tetcd, err := testutil.NewTestEmbeddedEtcd(t, logger, dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.Start(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.WaitUp(30 * time.Second); err != nil {
+		t.Fatalf("error waiting on etcd up: %v", err)
+	}
+
+	ps, err := posix.New(filepath.Join(dir, "ost"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(ps, "/")
+	h := NewActionHandler(logger, tetcd.TestEtcd.Store, nil, ost, nil)
+
+	r := &types.Run{
+		ID: "run01",
+		Tasks: map[string]*types.RunTask{
+			"task01": &types.RunTask{
+				ID:                     "task01",
+				Steps:                  []*types.RunTaskStep{&types.RunTaskStep{}, &types.RunTaskStep{}},
+				WorkspaceArchives:      []int{1},
+				WorkspaceArchivesPhase: []types.RunTaskFetchPhase{types.RunTaskFetchPhaseNotStarted},
+			},
+		},
+	}
+	if _, err := store.AtomicPutRun(ctx, h.e, r, nil, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	et := &types.ExecutorTask{
+		ID:     "task01",
+		RunID:  "run01",
+		Status: types.ExecutorTaskStatus{ExecutorID: "executor01"},
+	}
+	if _, err := store.AtomicPutExecutorTask(ctx, h.e, et); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	return h, tetcd
+}
+
+func readObject(t *testing.T, ost *objectstorage.ObjStorage, p string) string {
+	f, err := store.OSTReadObject(ost, p)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	return string(data)
+}
+
+func TestUploadRunTaskLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	h, tetcd := setupUploadTest(t, ctx, dir)
+	defer func() { _ = tetcd.Kill() }()
+
+	tests := []struct {
+		name       string
+		executorID string
+		taskID     string
+		setup      bool
+		step       int
+		path       string
+		err        error
+	}{
+		{
+			name:       "test upload setup log",
+			executorID: "executor01",
+			taskID:     "task01",
+			setup:      true,
+			path:       store.OSTRunTaskSetupLogPath("task01"),
+		},
+		{
+			name:       "test upload step log",
+			executorID: "executor01",
+			taskID:     "task01",
+			step:       1,
+			path:       store.OSTRunTaskStepLogPath("task01", 1),
+		},
+		{
+			name:       "test upload log of not existing task",
+			executorID: "executor01",
+			taskID:     "task02",
+			err:        &util.ErrNotFound{},
+		},
+		{
+			name:       "test upload log from another executor",
+			executorID: "executor02",
+			taskID:     "task01",
+			err:        &util.ErrBadRequest{},
+		},
+		{
+			name:       "test upload log of not existing step",
+			executorID: "executor01",
+			taskID:     "task01",
+			step:       2,
+			err:        &util.ErrBadRequest{},
+		},
+		{
+			name:       "test upload log of negative step",
+			executorID: "executor01",
+			taskID:     "task01",
+			step:       -1,
+			err:        &util.ErrBadRequest{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.UploadRunTaskLog(ctx, &RunTaskLogUploadRequest{
+				ExecutorID: tt.executorID,
+				TaskID:     tt.taskID,
+				Setup:      tt.setup,
+				Step:       tt.step,
+				Data:       strings.NewReader("log data"),
+			})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if data := readObject(t, h.ost, tt.path); data != "log data" {
+				t.Fatalf("expected log %q, got %q", "log data", data)
+			}
+			r, _, err := store.GetRun(ctx, h.e, "run01")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			rt := r.Tasks[tt.taskID]
+			phase := rt.SetupStep.LogPhase
+			if !tt.setup {
+				phase = rt.Steps[tt.step].LogPhase
+			}
+			if phase != types.RunTaskFetchPhaseFinished {
+				t.Fatalf("expected log phase %q, got %q", types.RunTaskFetchPhaseFinished, phase)
+			}
+		})
+	}
+
+	// the logs not uploaded must be still fetched by the runservice
+	r, _, err := store.GetRun(ctx, h.e, "run01")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if phase := r.Tasks["task01"].Steps[0].LogPhase; phase == types.RunTaskFetchPhaseFinished {
+		t.Fatalf("unexpected log phase %q for step 0", phase)
+	}
+}
+
+func TestUploadRunTaskArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	h, tetcd := setupUploadTest(t, ctx, dir)
+	defer func() { _ = tetcd.Kill() }()
+
+	tests := []struct {
+		name       string
+		executorID string
+		taskID     string
+		step       int
+		err        error
+	}{
+		{
+			name:       "test upload archive of not existing task",
+			executorID: "executor01",
+			taskID:     "task02",
+			step:       1,
+			err:        &util.ErrNotFound{},
+		},
+		{
+			name:       "test upload archive from another executor",
+			executorID: "executor02",
+			taskID:     "task01",
+			step:       1,
+			err:        &util.ErrBadRequest{},
+		},
+		{
+			name:       "test upload archive of step without archive",
+			executorID: "executor01",
+			taskID:     "task01",
+			step:       0,
+			err:        &util.ErrBadRequest{},
+		},
+		{
+			name:       "test upload archive",
+			executorID: "executor01",
+			taskID:     "task01",
+			step:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.UploadRunTaskArchive(ctx, &RunTaskArchiveUploadRequest{
+				ExecutorID: tt.executorID,
+				TaskID:     tt.taskID,
+				Step:       tt.step,
+				Data:       strings.NewReader("archive data"),
+			})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if data := readObject(t, h.ost, store.OSTRunTaskArchivePath(tt.taskID, tt.step)); data != "archive data" {
+				t.Fatalf("expected archive %q, got %q", "archive data", data)
+			}
+			hash, err := store.OSTReadObjectHash(h.ost, store.OSTRunTaskArchiveHashPath(tt.taskID, tt.step))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if hash == "" {
+				t.Fatalf("expected archive hash")
+			}
+			r, _, err := store.GetRun(ctx, h.e, "run01")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if phase := r.Tasks[tt.taskID].WorkspaceArchivesPhase[0]; phase != types.RunTaskFetchPhaseFinished {
+				t.Fatalf("expected archive phase %q, got %q", types.RunTaskFetchPhaseFinished, phase)
+			}
+		})
+	}
+}
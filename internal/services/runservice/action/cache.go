@@ -0,0 +1,70 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	ostypes "agola.io/agola/internal/objectstorage/types"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// GetCaches returns the caches whose key starts with keyPrefix
+func (h *ActionHandler) GetCaches(ctx context.Context, keyPrefix string) ([]*types.Cache, error) {
+	if keyPrefix == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty cache key prefix"))
+	}
+	return store.OSTGetCaches(h.ost, keyPrefix)
+}
+
+func (h *ActionHandler) DeleteCache(ctx context.Context, key string) error {
+	exists, err := h.cacheExists(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return util.NewErrNotFound(errors.Errorf("cache %q doesn't exist", key))
+	}
+
+	h.log.Infof("deleting cache %q", key)
+	return store.OSTDeleteCache(h.ost, key)
+}
+
+// DeleteCaches deletes all the caches whose key starts with keyPrefix
+func (h *ActionHandler) DeleteCaches(ctx context.Context, keyPrefix string) error {
+	caches, err := h.GetCaches(ctx, keyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, c := range caches {
+		h.log.Infof("deleting cache %q", c.Key)
+		if err := store.OSTDeleteCache(h.ost, c.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *ActionHandler) cacheExists(key string) (bool, error) {
+	_, err := h.ost.Stat(store.OSTCachePath(key))
+	if err != nil && err != ostypes.ErrNotExist {
+		return false, err
+	}
+	return err == nil, nil
+}
@@ -0,0 +1,427 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	ostypes "agola.io/agola/internal/objectstorage/types"
+	"agola.io/agola/internal/sequence"
+	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// A run export bundle is a gzip compressed tar archive containing the run and
+// run config followed by the run tasks logs and workspace archives saved with
+// their objectstorage path.
+const (
+	runExportRunFile       = "run.json"
+	runExportRunConfigFile = "runconfig.json"
+)
+
+type runExportObject struct {
+	path string
+	// hashPath is the path of the object hash, set only for workspace archives
+	hashPath string
+}
+
+// runExportObjects returns the objectstorage objects containing the logs and
+// workspace archives of the run tasks
+func runExportObjects(r *types.Run) []*runExportObject {
+	rtIDs := make([]string, 0, len(r.Tasks))
+	for rtID := range r.Tasks {
+		rtIDs = append(rtIDs, rtID)
+	}
+	sort.Strings(rtIDs)
+
+	objects := []*runExportObject{}
+	for _, rtID := range rtIDs {
+		objects = append(objects, runTaskExportObjects(rtID, r.Tasks[rtID])...)
+	}
+	return objects
+}
+
+// runTaskExportObjects returns the objectstorage objects containing the logs
+// and workspace archives of the run task rt saved with task id rtID
+func runTaskExportObjects(rtID string, rt *types.RunTask) []*runExportObject {
+	objects := []*runExportObject{{path: store.OSTRunTaskSetupLogPath(rtID)}}
+	for i := range rt.Steps {
+		objects = append(objects, &runExportObject{path: store.OSTRunTaskStepLogPath(rtID, i)})
+	}
+	for _, step := range rt.WorkspaceArchives {
+		objects = append(objects, &runExportObject{
+			path:     store.OSTRunTaskArchivePath(rtID, step),
+			hashPath: store.OSTRunTaskArchiveHashPath(rtID, step),
+		})
+	}
+	return objects
+}
+
+// GetRunExport returns the run and run config of the run to export. Only
+// archived runs, whose logs and workspace archives are all saved in the
+// objectstorage, can be exported.
+func (h *ActionHandler) GetRunExport(ctx context.Context, runID string) (*types.RunBundle, error) {
+	r, err := store.GetRunEtcdOrOST(ctx, h.e, h.dm, runID)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, util.NewErrNotFound(errors.Errorf("run %q doesn't exist", runID))
+	}
+	if !r.Archived {
+		return nil, util.NewErrBadRequest(errors.Errorf("run %q isn't archived", runID))
+	}
+
+	rc, err := store.OSTGetRunConfig(h.dm, runID)
+	if err != nil {
+		return nil, errors.Errorf("cannot get run config %q: %w", runID, err)
+	}
+
+	return &types.RunBundle{
+		Run: r,
+		Rc:  rc,
+	}, nil
+}
+
+// WriteRunExport writes the run export bundle to w
+func (h *ActionHandler) WriteRunExport(rb *types.RunBundle, w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	now := time.Now()
+
+	rj, err := json.Marshal(rb.Run)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, runExportRunFile, now, int64(len(rj)), bytes.NewReader(rj)); err != nil {
+		return err
+	}
+	rcj, err := json.Marshal(rb.Rc)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, runExportRunConfigFile, now, int64(len(rcj)), bytes.NewReader(rcj)); err != nil {
+		return err
+	}
+
+	for _, o := range runExportObjects(rb.Run) {
+		if err := h.writeRunExportObject(tw, o.path, now); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func (h *ActionHandler) writeRunExportObject(tw *tar.Writer, p string, modTime time.Time) error {
+	f, err := store.OSTReadObject(h.ost, p)
+	if err != nil {
+		// tasks not executed don't have logs and archives
+		if err == ostypes.ErrNotExist {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	// the uncompressed object size is needed to write the tar header so save
+	// it to a temporary file
+	tmpf, err := ioutil.TempFile("", "agola-runexport")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpf.Name())
+	defer tmpf.Close()
+
+	size, err := io.Copy(tmpf, f)
+	if err != nil {
+		return err
+	}
+	if _, err := tmpf.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return writeTarFile(tw, p, modTime, size, tmpf)
+}
+
+func writeTarFile(tw *tar.Writer, name string, modTime time.Time, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+type RunImportRequest struct {
+	// Group, when not empty, replaces the root group (i.e. /project/projectid)
+	// of the imported run group
+	Group string
+	Data  io.Reader
+}
+
+// ImportRun restores a run from a run export bundle. The run is saved as an
+// archived run with a new id and new tasks ids, so the bundle content cannot
+// overwrite the data of other runs.
+func (h *ActionHandler) ImportRun(ctx context.Context, req *RunImportRequest) (*types.RunBundle, error) {
+	gr, err := gzip.NewReader(req.Data)
+	if err != nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("failed to read run bundle: %w", err))
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+
+	var r *types.Run
+	var rc *types.RunConfig
+	var objects map[string]*runExportObject
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, util.NewErrBadRequest(errors.Errorf("failed to read run bundle: %w", err))
+		}
+
+		switch hdr.Name {
+		case runExportRunFile:
+			if r != nil {
+				return nil, util.NewErrBadRequest(errors.Errorf("duplicated file %q in run bundle", hdr.Name))
+			}
+			if err := json.NewDecoder(tr).Decode(&r); err != nil {
+				return nil, util.NewErrBadRequest(errors.Errorf("failed to decode run: %w", err))
+			}
+		case runExportRunConfigFile:
+			if rc != nil {
+				return nil, util.NewErrBadRequest(errors.Errorf("duplicated file %q in run bundle", hdr.Name))
+			}
+			if err := json.NewDecoder(tr).Decode(&rc); err != nil {
+				return nil, util.NewErrBadRequest(errors.Errorf("failed to decode run config: %w", err))
+			}
+		default:
+			if r == nil || rc == nil {
+				return nil, util.NewErrBadRequest(errors.Errorf("run bundle must start with the run and run config"))
+			}
+			if objects == nil {
+				if objects, err = h.prepareImportRun(ctx, r, rc, req.Group); err != nil {
+					return nil, err
+				}
+			}
+
+			o, ok := objects[hdr.Name]
+			if !ok {
+				return nil, util.NewErrBadRequest(errors.Errorf("unexpected file %q in run bundle", hdr.Name))
+			}
+			// an object already written (i.e. a duplicated bundle file) must
+			// not be overwritten
+			if err := h.checkImportObject(o.path); err != nil {
+				return nil, err
+			}
+			if o.hashPath != "" {
+				err = store.OSTWriteHashedObject(h.ost, o.path, o.hashPath, tr)
+			} else {
+				err = store.OSTWriteCompressedObject(h.ost, o.path, tr)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if r == nil || rc == nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("run bundle doesn't contain the run and run config"))
+	}
+	if objects == nil {
+		// a run without any log or archive
+		if _, err := h.prepareImportRun(ctx, r, rc, req.Group); err != nil {
+			return nil, err
+		}
+	}
+
+	// write the run markers so the task data won't be removed by the runs
+	// cleaner while the imported run exists
+	for _, rt := range r.Tasks {
+		for _, p := range []string{store.OSTRunTaskLogsRunPath(rt.ID, r.ID), store.OSTRunTaskArchivesRunPath(rt.ID, r.ID)} {
+			if err := h.checkImportObject(p); err != nil {
+				return nil, err
+			}
+			if err := h.ost.WriteObject(p, bytes.NewReader([]byte{}), 0, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ra, err := store.OSTSaveRunAction(r)
+	if err != nil {
+		return nil, err
+	}
+	rca, err := store.OSTSaveRunConfigAction(rc)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Infof("importing run %q in group %q", r.ID, r.Group)
+	if _, err := h.dm.WriteWal(ctx, []*datamanager.Action{rca, ra}, nil); err != nil {
+		return nil, err
+	}
+
+	return &types.RunBundle{
+		Run: r,
+		Rc:  rc,
+	}, nil
+}
+
+// prepareImportRun validates the imported run, assigns new ids to it and its
+// tasks and updates its group. It returns the run objects to import by their
+// path in the run bundle.
+func (h *ActionHandler) prepareImportRun(ctx context.Context, r *types.Run, rc *types.RunConfig, rootGroup string) (map[string]*runExportObject, error) {
+	if r.ID != rc.ID {
+		return nil, util.NewErrBadRequest(errors.Errorf("run id %q doesn't match run config id %q", r.ID, rc.ID))
+	}
+	if !r.Phase.IsFinished() {
+		return nil, util.NewErrBadRequest(errors.Errorf("run %q isn't finished", r.ID))
+	}
+
+	var group string
+	if rootGroup != "" {
+		var err error
+		group, err = replaceRootGroup(r.Group, rootGroup)
+		if err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+	}
+
+	// generate a new run sequence that will be the same for the run and runconfig
+	seq, err := sequence.IncSequence(ctx, h.e, common.EtcdRunSequenceKey)
+	if err != nil {
+		return nil, err
+	}
+	taskIDs, err := remapImportRun(util.DefaultUUIDGenerator{}, r, rc, seq.String())
+	if err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+
+	objects := map[string]*runExportObject{}
+	for oldID, newID := range taskIDs {
+		rt := r.Tasks[newID]
+		oldObjects := runTaskExportObjects(oldID, rt)
+		for i, o := range runTaskExportObjects(newID, rt) {
+			objects[oldObjects[i].path] = o
+		}
+	}
+
+	if group != "" {
+		r.Group = group
+		rc.Group = group
+	}
+	r.Archived = true
+
+	return objects, nil
+}
+
+// remapImportRun assigns newID to the imported run and new ids to its tasks.
+// It returns the new tasks ids by their imported id.
+func remapImportRun(uuid util.UUIDGenerator, r *types.Run, rc *types.RunConfig, newID string) (map[string]string, error) {
+	if len(r.Tasks) != len(rc.Tasks) {
+		return nil, errors.Errorf("run tasks don't match run config tasks")
+	}
+	taskIDs := map[string]string{}
+	for id, rt := range r.Tasks {
+		rct, ok := rc.Tasks[id]
+		if !ok || rt == nil || rct == nil || rt.ID != id || rct.ID != id {
+			return nil, errors.Errorf("run task %q doesn't match run config task", id)
+		}
+		taskIDs[id] = uuid.New(rct.Name).String()
+	}
+	for id, rct := range rc.Tasks {
+		for depID, d := range rct.Depends {
+			if _, ok := taskIDs[depID]; !ok || d == nil || d.TaskID != depID {
+				return nil, errors.Errorf("run config task %q depends on unknown task %q", id, depID)
+			}
+		}
+	}
+
+	tasks := make(map[string]*types.RunTask, len(r.Tasks))
+	for id, rt := range r.Tasks {
+		rt.ID = taskIDs[id]
+		tasks[rt.ID] = rt
+	}
+	r.Tasks = tasks
+
+	rcts := make(map[string]*types.RunConfigTask, len(rc.Tasks))
+	for id, rct := range rc.Tasks {
+		rct.ID = taskIDs[id]
+		depends := make(map[string]*types.RunConfigTaskDepend, len(rct.Depends))
+		for depID, d := range rct.Depends {
+			d.TaskID = taskIDs[depID]
+			depends[d.TaskID] = d
+		}
+		rct.Depends = depends
+		rcts[rct.ID] = rct
+	}
+	rc.Tasks = rcts
+
+	r.ID = newID
+	r.Revision = 0
+	rc.ID = newID
+
+	return taskIDs, nil
+}
+
+// checkImportObject checks that the imported object doesn't already exist
+func (h *ActionHandler) checkImportObject(p string) error {
+	_, err := h.ost.Stat(p)
+	if err == nil {
+		return util.NewErrBadRequest(errors.Errorf("object %q already exists", p))
+	}
+	if err != ostypes.ErrNotExist {
+		return err
+	}
+	return nil
+}
+
+// replaceRootGroup replaces the first two group path entries (the group type
+// and id) with rootGroup
+func replaceRootGroup(group, rootGroup string) (string, error) {
+	pl := util.PathList(group)
+	if len(pl) < 2 {
+		return "", errors.Errorf("wrong group path %q", group)
+	}
+	return path.Join(append([]string{rootGroup}, pl[2:]...)...), nil
+}
@@ -0,0 +1,299 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/posix"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteRunExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps, err := posix.New(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(ps, "/")
+	h := &ActionHandler{ost: ost}
+
+	rb := &types.RunBundle{
+		Run: &types.Run{
+			ID: "run01",
+			Tasks: map[string]*types.RunTask{
+				"task01": &types.RunTask{
+					ID:                "task01",
+					Steps:             []*types.RunTaskStep{&types.RunTaskStep{}, &types.RunTaskStep{}},
+					WorkspaceArchives: []int{1},
+				},
+				// a task never executed without logs
+				"task02": &types.RunTask{
+					ID:    "task02",
+					Steps: []*types.RunTaskStep{&types.RunTaskStep{}},
+				},
+			},
+		},
+		Rc: &types.RunConfig{ID: "run01"},
+	}
+
+	objects := map[string]string{
+		store.OSTRunTaskSetupLogPath("task01"):   "setup log",
+		store.OSTRunTaskStepLogPath("task01", 0): "step 0 log",
+		store.OSTRunTaskStepLogPath("task01", 1): "step 1 log",
+		store.OSTRunTaskArchivePath("task01", 1): "step 1 archive",
+	}
+	for p, data := range objects {
+		if err := store.OSTWriteCompressedObject(ost, p, strings.NewReader(data)); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := h.WriteRunExport(rb, &buf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	tr := tar.NewReader(gr)
+
+	names := []string{}
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		names = append(names, hdr.Name)
+		files[hdr.Name] = string(data)
+	}
+
+	expectedNames := []string{
+		runExportRunFile,
+		runExportRunConfigFile,
+		store.OSTRunTaskSetupLogPath("task01"),
+		store.OSTRunTaskStepLogPath("task01", 0),
+		store.OSTRunTaskStepLogPath("task01", 1),
+		store.OSTRunTaskArchivePath("task01", 1),
+	}
+	if diff := cmp.Diff(expectedNames, names); diff != "" {
+		t.Fatalf("mismatching bundle files: %s", diff)
+	}
+	for p, data := range objects {
+		if files[p] != data {
+			t.Fatalf("expected file %q content %q, got %q", p, data, files[p])
+		}
+	}
+}
+
+func TestReplaceRootGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		group     string
+		rootGroup string
+		out       string
+		err       bool
+	}{
+		{
+			name:      "test project branch group",
+			group:     "/project/projectid01/branch/master",
+			rootGroup: "/project/projectid02",
+			out:       "/project/projectid02/branch/master",
+		},
+		{
+			name:      "test project root group",
+			group:     "/project/projectid01",
+			rootGroup: "/project/projectid02",
+			out:       "/project/projectid02",
+		},
+		{
+			name:      "test wrong group",
+			group:     "/project",
+			rootGroup: "/project/projectid02",
+			err:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := replaceRootGroup(tt.group, tt.rootGroup)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if out != tt.out {
+				t.Fatalf("expected group %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestRemapImportRun(t *testing.T) {
+	uuid := util.TestUUIDGenerator{}
+	newTask01 := uuid.New("task01").String()
+	newTask02 := uuid.New("task02").String()
+
+	newRun := func() (*types.Run, *types.RunConfig) {
+		r := &types.Run{
+			ID:       "run01",
+			Revision: 10,
+			Tasks: map[string]*types.RunTask{
+				"rt01": &types.RunTask{ID: "rt01"},
+				"rt02": &types.RunTask{ID: "rt02"},
+			},
+		}
+		rc := &types.RunConfig{
+			ID: "run01",
+			Tasks: map[string]*types.RunConfigTask{
+				"rt01": &types.RunConfigTask{ID: "rt01", Name: "task01"},
+				"rt02": &types.RunConfigTask{
+					ID:   "rt02",
+					Name: "task02",
+					Depends: map[string]*types.RunConfigTaskDepend{
+						"rt01": &types.RunConfigTaskDepend{TaskID: "rt01"},
+					},
+				},
+			},
+		}
+		return r, rc
+	}
+
+	t.Run("test remap run", func(t *testing.T) {
+		r, rc := newRun()
+		taskIDs, err := remapImportRun(uuid, r, rc, "run02")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		expectedTaskIDs := map[string]string{"rt01": newTask01, "rt02": newTask02}
+		if diff := cmp.Diff(expectedTaskIDs, taskIDs); diff != "" {
+			t.Fatalf("mismatching task ids: %s", diff)
+		}
+		expectedRun := &types.Run{
+			ID: "run02",
+			Tasks: map[string]*types.RunTask{
+				newTask01: &types.RunTask{ID: newTask01},
+				newTask02: &types.RunTask{ID: newTask02},
+			},
+		}
+		if diff := cmp.Diff(expectedRun, r); diff != "" {
+			t.Fatalf("mismatching run: %s", diff)
+		}
+		expectedRc := &types.RunConfig{
+			ID: "run02",
+			Tasks: map[string]*types.RunConfigTask{
+				newTask01: &types.RunConfigTask{ID: newTask01, Name: "task01", Depends: map[string]*types.RunConfigTaskDepend{}},
+				newTask02: &types.RunConfigTask{
+					ID:   newTask02,
+					Name: "task02",
+					Depends: map[string]*types.RunConfigTaskDepend{
+						newTask01: &types.RunConfigTaskDepend{TaskID: newTask01},
+					},
+				},
+			},
+		}
+		if diff := cmp.Diff(expectedRc, rc); diff != "" {
+			t.Fatalf("mismatching run config: %s", diff)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		modify func(r *types.Run, rc *types.RunConfig)
+	}{
+		{
+			name: "test run task key not matching task id",
+			modify: func(r *types.Run, rc *types.RunConfig) {
+				r.Tasks["rt01"].ID = "../../rt01"
+			},
+		},
+		{
+			name: "test run config task key not matching task id",
+			modify: func(r *types.Run, rc *types.RunConfig) {
+				rc.Tasks["rt01"].ID = "rt03"
+			},
+		},
+		{
+			name: "test run task missing in run config",
+			modify: func(r *types.Run, rc *types.RunConfig) {
+				delete(rc.Tasks, "rt01")
+			},
+		},
+		{
+			name: "test nil run task",
+			modify: func(r *types.Run, rc *types.RunConfig) {
+				r.Tasks["rt01"] = nil
+			},
+		},
+		{
+			name: "test depend on unknown task",
+			modify: func(r *types.Run, rc *types.RunConfig) {
+				rc.Tasks["rt02"].Depends["rt03"] = &types.RunConfigTaskDepend{TaskID: "rt03"}
+			},
+		},
+		{
+			name: "test depend key not matching task id",
+			modify: func(r *types.Run, rc *types.RunConfig) {
+				rc.Tasks["rt02"].Depends["rt01"].TaskID = "rt02"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, rc := newRun()
+			tt.modify(r, rc)
+			if _, err := remapImportRun(uuid, r, rc, "run02"); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			// the run must not be modified on error
+			if r.ID != "run01" || rc.ID != "run01" {
+				t.Fatalf("expected unmodified run")
+			}
+		})
+	}
+}
@@ -20,7 +20,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/db"
@@ -32,6 +35,7 @@ import (
 	"agola.io/agola/internal/services/runservice/readdb"
 	"agola.io/agola/internal/services/runservice/store"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/steplog"
 	"agola.io/agola/internal/util"
 
 	"github.com/gorilla/mux"
@@ -190,7 +194,16 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		follow = true
 	}
 
-	if err, sendError := h.readTaskLogs(ctx, runID, taskID, setup, step, w, follow); err != nil {
+	format := steplog.FormatText
+	if f := q.Get("format"); f != "" {
+		format = steplog.Format(f)
+		if !steplog.IsValidFormat(format) {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err, sendError := h.readTaskLogs(ctx, runID, taskID, setup, step, w, follow, format); err != nil {
 		h.log.Errorf("err: %+v", err)
 		if sendError {
 			switch err.(type) {
@@ -203,7 +216,7 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, setup bool, step int, w http.ResponseWriter, follow bool) (error, bool) {
+func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, setup bool, step int, w http.ResponseWriter, follow bool, format steplog.Format) (error, bool) {
 	r, err := store.GetRunEtcdOrOST(ctx, h.e, h.dm, runID)
 	if err != nil {
 		return err, true
@@ -228,7 +241,7 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 		} else {
 			logPath = store.OSTRunTaskStepLogPath(task.ID, step)
 		}
-		f, err := h.ost.ReadObject(logPath)
+		f, err := store.OSTReadObject(h.ost, logPath)
 		if err != nil {
 			if err == ostypes.ErrNotExist {
 				return common.NewErrNotExist(err), true
@@ -236,7 +249,7 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 			return err, true
 		}
 		defer f.Close()
-		return sendLogs(w, f), false
+		return sendLogs(w, f, format), false
 	}
 
 	et, err := store.GetExecutorTask(ctx, h.e, task.ID)
@@ -272,19 +285,43 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 		return errors.Errorf("received http status: %d", req.StatusCode), true
 	}
 
-	return sendLogs(w, req.Body), false
+	return sendLogs(w, req.Body, format), false
 }
 
-func sendLogs(w http.ResponseWriter, r io.Reader) error {
+// sendLogs decodes the stored step log and sends it in the requested format
+func sendLogs(w http.ResponseWriter, r io.Reader, format steplog.Format) error {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	buf := make([]byte, 406)
-
 	var flusher http.Flusher
 	if fl, ok := w.(http.Flusher); ok {
 		flusher = fl
 	}
+
+	if format == steplog.FormatJSON {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		d := steplog.NewDecoder(r)
+		enc := json.NewEncoder(w)
+		for {
+			e, err := d.Next()
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	r = steplog.NewTextReader(r)
+	buf := make([]byte, 406)
+
 	stop := false
 	for {
 		if stop {
@@ -479,12 +516,18 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	start := query.Get("start")
 
+	filter, err := runsFilterFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var runs []*types.Run
 	var cgt *types.ChangeGroupsUpdateToken
 
-	err := h.readDB.Do(func(tx *db.Tx) error {
+	err = h.readDB.Do(func(tx *db.Tx) error {
 		var err error
-		runs, err = h.readDB.GetRuns(tx, groups, lastRun, phaseFilter, resultFilter, start, limit, sortOrder)
+		runs, err = h.readDB.GetRuns(tx, groups, lastRun, phaseFilter, resultFilter, filter, start, limit, sortOrder)
 		if err != nil {
 			h.log.Errorf("err: %+v", err)
 			return err
@@ -513,6 +556,49 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// runsFilterFromQuery returns the runs filter defined by the query parameters
+// or nil if no filter is defined
+func runsFilterFromQuery(query url.Values) (*types.RunsFilter, error) {
+	filter := &types.RunsFilter{
+		Name:               query.Get("name"),
+		Annotations:        map[string]string{},
+		AnnotationPrefixes: map[string]string{},
+	}
+	for _, a := range query["annotation"] {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("wrong annotation filter %q", a)
+		}
+		filter.Annotations[parts[0]] = parts[1]
+	}
+	for _, a := range query["annotationprefix"] {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("wrong annotation prefix filter %q", a)
+		}
+		filter.AnnotationPrefixes[parts[0]] = parts[1]
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, errors.Errorf("cannot parse since: %w", err)
+		}
+		filter.Since = &t
+	}
+	if until := query.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, errors.Errorf("cannot parse until: %w", err)
+		}
+		filter.Until = &t
+	}
+
+	if filter.Name == "" && len(filter.Annotations) == 0 && len(filter.AnnotationPrefixes) == 0 && filter.Since == nil && filter.Until == nil {
+		return nil, nil
+	}
+	return filter, nil
+}
+
 type RunCreateRequest struct {
 	// new run fields
 	RunConfigTasks    map[string]*types.RunConfigTask `json:"run_config_tasks"`
@@ -521,6 +607,8 @@ type RunCreateRequest struct {
 	SetupErrors       []string                        `json:"setup_errors"`
 	StaticEnvironment map[string]string               `json:"static_environment"`
 	CacheGroup        string                          `json:"cache_group"`
+	CacheQuota        int64                           `json:"cache_quota"`
+	RunRetention      *types.RunRetentionPolicy       `json:"run_retention"`
 
 	// existing run fields
 	RunID      string   `json:"run_id"`
@@ -563,6 +651,8 @@ func (h *RunCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		SetupErrors:       req.SetupErrors,
 		StaticEnvironment: req.StaticEnvironment,
 		CacheGroup:        req.CacheGroup,
+		CacheQuota:        req.CacheQuota,
+		RunRetention:      req.RunRetention,
 
 		RunID:      req.RunID,
 		FromStart:  req.FromStart,
@@ -592,8 +682,9 @@ func (h *RunCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type RunActionType string
 
 const (
-	RunActionTypeChangePhase RunActionType = "changephase"
-	RunActionTypeStop        RunActionType = "stop"
+	RunActionTypeChangePhase    RunActionType = "changephase"
+	RunActionTypeStop           RunActionType = "stop"
+	RunActionTypeSetAnnotations RunActionType = "setannotations"
 )
 
 type RunActionsRequest struct {
@@ -601,6 +692,9 @@ type RunActionsRequest struct {
 
 	Phase                   types.RunPhase `json:"phase"`
 	ChangeGroupsUpdateToken string         `json:"change_groups_update_tokens"`
+
+	// set Annotations fields
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type RunActionsHandler struct {
@@ -649,6 +743,17 @@ func (h *RunActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			httpError(w, err)
 			return
 		}
+	case RunActionTypeSetAnnotations:
+		creq := &action.RunSetAnnotationsRequest{
+			RunID:                   runID,
+			Annotations:             req.Annotations,
+			ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
+		}
+		if err := h.ah.RunSetAnnotations(ctx, creq); err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
 	default:
 		http.Error(w, "", http.StatusBadRequest)
 		return
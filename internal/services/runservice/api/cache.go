@@ -0,0 +1,107 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"agola.io/agola/internal/services/runservice/action"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type CachesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCachesHandler(logger *zap.Logger, ah *action.ActionHandler) *CachesHandler {
+	return &CachesHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *CachesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keyPrefix := r.URL.Query().Get("prefix")
+
+	caches, err := h.ah.GetCaches(ctx, keyPrefix)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, caches); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CachesDeleteHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCachesDeleteHandler(logger *zap.Logger, ah *action.ActionHandler) *CachesDeleteHandler {
+	return &CachesDeleteHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *CachesDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keyPrefix := r.URL.Query().Get("prefix")
+
+	err := h.ah.DeleteCaches(ctx, keyPrefix)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CacheDeleteHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCacheDeleteHandler(logger *zap.Logger, ah *action.ActionHandler) *CacheDeleteHandler {
+	return &CacheDeleteHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *CacheDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	key := vars["key"]
+
+	err := h.ah.DeleteCache(ctx, key)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
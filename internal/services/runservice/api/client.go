@@ -25,8 +25,10 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/steplog"
 	errors "golang.org/x/xerrors"
 )
 
@@ -137,6 +139,36 @@ func (c *Client) GetExecutorTasks(ctx context.Context, executorID string) ([]*rs
 	return ets, resp, err
 }
 
+func (c *Client) GetExecutors(ctx context.Context) ([]*rstypes.Executor, *http.Response, error) {
+	executors := []*rstypes.Executor{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/executors", nil, jsonContent, nil, &executors)
+	return executors, resp, err
+}
+
+func (c *Client) CordonExecutor(ctx context.Context, executorID string) (*rstypes.Executor, *http.Response, error) {
+	executor := new(rstypes.Executor)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/executor/%s/cordon", executorID), nil, jsonContent, nil, executor)
+	return executor, resp, err
+}
+
+func (c *Client) UncordonExecutor(ctx context.Context, executorID string) (*rstypes.Executor, *http.Response, error) {
+	executor := new(rstypes.Executor)
+	resp, err := c.getParsedResponse(ctx, "DELETE", fmt.Sprintf("/executor/%s/cordon", executorID), nil, jsonContent, nil, executor)
+	return executor, resp, err
+}
+
+func (c *Client) DrainExecutor(ctx context.Context, executorID string) (*ExecutorDrainStatusResponse, *http.Response, error) {
+	ds := new(ExecutorDrainStatusResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/executor/%s/drain", executorID), nil, jsonContent, nil, ds)
+	return ds, resp, err
+}
+
+func (c *Client) GetExecutorDrainStatus(ctx context.Context, executorID string) (*ExecutorDrainStatusResponse, *http.Response, error) {
+	ds := new(ExecutorDrainStatusResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/executor/%s/drain", executorID), nil, jsonContent, nil, ds)
+	return ds, resp, err
+}
+
 func (c *Client) GetArchive(ctx context.Context, taskID string, step int) (*http.Response, error) {
 	q := url.Values{}
 	q.Add("taskid", taskID)
@@ -145,6 +177,36 @@ func (c *Client) GetArchive(ctx context.Context, taskID string, step int) (*http
 	return c.getResponse(ctx, "GET", "/executor/archives", q, -1, nil, nil)
 }
 
+func (c *Client) CheckArchive(ctx context.Context, taskID string, step int) (*http.Response, error) {
+	q := url.Values{}
+	q.Add("taskid", taskID)
+	q.Add("step", strconv.Itoa(step))
+
+	return c.getResponse(ctx, "HEAD", "/executor/archives", q, -1, nil, nil)
+}
+
+func (c *Client) PutLog(ctx context.Context, executorID, taskID string, setup bool, step int, size int64, r io.Reader) (*http.Response, error) {
+	q := url.Values{}
+	q.Add("executorid", executorID)
+	q.Add("taskid", taskID)
+	if setup {
+		q.Add("setup", "")
+	} else {
+		q.Add("step", strconv.Itoa(step))
+	}
+
+	return c.getResponse(ctx, "PUT", "/executor/logs", q, size, nil, r)
+}
+
+func (c *Client) PutArchive(ctx context.Context, executorID, taskID string, step int, size int64, r io.Reader) (*http.Response, error) {
+	q := url.Values{}
+	q.Add("executorid", executorID)
+	q.Add("taskid", taskID)
+	q.Add("step", strconv.Itoa(step))
+
+	return c.getResponse(ctx, "PUT", "/executor/archives", q, size, nil, r)
+}
+
 func (c *Client) CheckCache(ctx context.Context, key string, prefix bool) (*http.Response, error) {
 	q := url.Values{}
 	if prefix {
@@ -165,7 +227,27 @@ func (c *Client) PutCache(ctx context.Context, key string, size int64, r io.Read
 	return c.getResponse(ctx, "POST", fmt.Sprintf("/executor/caches/%s", url.PathEscape(key)), nil, size, nil, r)
 }
 
-func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups []string, lastRun bool, changeGroups []string, start string, limit int, asc bool) (*GetRunsResponse, *http.Response, error) {
+func (c *Client) GetCaches(ctx context.Context, keyPrefix string) ([]*rstypes.Cache, *http.Response, error) {
+	q := url.Values{}
+	q.Add("prefix", keyPrefix)
+
+	caches := []*rstypes.Cache{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/caches", q, jsonContent, nil, &caches)
+	return caches, resp, err
+}
+
+func (c *Client) DeleteCache(ctx context.Context, key string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/caches/%s", url.PathEscape(key)), nil, -1, jsonContent, nil)
+}
+
+func (c *Client) DeleteCaches(ctx context.Context, keyPrefix string) (*http.Response, error) {
+	q := url.Values{}
+	q.Add("prefix", keyPrefix)
+
+	return c.getResponse(ctx, "DELETE", "/caches", q, -1, jsonContent, nil)
+}
+
+func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups []string, lastRun bool, changeGroups []string, filter *rstypes.RunsFilter, start string, limit int, asc bool) (*GetRunsResponse, *http.Response, error) {
 	q := url.Values{}
 	for _, phase := range phaseFilter {
 		q.Add("phase", phase)
@@ -182,6 +264,23 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups
 	for _, changeGroup := range changeGroups {
 		q.Add("changegroup", changeGroup)
 	}
+	if filter != nil {
+		if filter.Name != "" {
+			q.Add("name", filter.Name)
+		}
+		for k, v := range filter.Annotations {
+			q.Add("annotation", k+"="+v)
+		}
+		for k, v := range filter.AnnotationPrefixes {
+			q.Add("annotationprefix", k+"="+v)
+		}
+		if filter.Since != nil {
+			q.Add("since", filter.Since.Format(time.RFC3339Nano))
+		}
+		if filter.Until != nil {
+			q.Add("until", filter.Until.Format(time.RFC3339Nano))
+		}
+	}
 	if start != "" {
 		q.Add("start", start)
 	}
@@ -198,27 +297,27 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups
 }
 
 func (c *Client) GetQueuedRuns(ctx context.Context, start string, limit int, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{}, false, changeGroups, start, limit, true)
+	return c.GetRuns(ctx, []string{"queued"}, nil, []string{}, false, changeGroups, nil, start, limit, true)
 }
 
 func (c *Client) GetRunningRuns(ctx context.Context, start string, limit int, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"running"}, nil, []string{}, false, changeGroups, start, limit, true)
+	return c.GetRuns(ctx, []string{"running"}, nil, []string{}, false, changeGroups, nil, start, limit, true)
 }
 
 func (c *Client) GetGroupQueuedRuns(ctx context.Context, group string, limit int, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, false, changeGroups, "", limit, false)
+	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, false, changeGroups, nil, "", limit, false)
 }
 
 func (c *Client) GetGroupRunningRuns(ctx context.Context, group string, limit int, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"running"}, nil, []string{group}, false, changeGroups, "", limit, false)
+	return c.GetRuns(ctx, []string{"running"}, nil, []string{group}, false, changeGroups, nil, "", limit, false)
 }
 
 func (c *Client) GetGroupFirstQueuedRuns(ctx context.Context, group string, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, false, changeGroups, "", 1, true)
+	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, false, changeGroups, nil, "", 1, true)
 }
 
 func (c *Client) GetGroupLastRun(ctx context.Context, group string, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, nil, nil, []string{group}, false, changeGroups, "", 1, false)
+	return c.GetRuns(ctx, nil, nil, []string{group}, false, changeGroups, nil, "", 1, false)
 }
 
 func (c *Client) CreateRun(ctx context.Context, req *RunCreateRequest) (*RunResponse, *http.Response, error) {
@@ -250,6 +349,16 @@ func (c *Client) StartRun(ctx context.Context, runID string, changeGroupsUpdateT
 	return c.RunActions(ctx, runID, req)
 }
 
+func (c *Client) RunSetAnnotations(ctx context.Context, runID string, annotations map[string]string, changeGroupsUpdateToken string) (*http.Response, error) {
+	req := &RunActionsRequest{
+		ActionType:              RunActionTypeSetAnnotations,
+		Annotations:             annotations,
+		ChangeGroupsUpdateToken: changeGroupsUpdateToken,
+	}
+
+	return c.RunActions(ctx, runID, req)
+}
+
 func (c *Client) RunTaskActions(ctx context.Context, runID, taskID string, req *RunTaskActionsRequest) (*http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -288,7 +397,7 @@ func (c *Client) GetRun(ctx context.Context, runID string, changeGroups []string
 	return runResponse, resp, err
 }
 
-func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool, step int, follow bool) (*http.Response, error) {
+func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool, step int, follow bool, format steplog.Format) (*http.Response, error) {
 	q := url.Values{}
 	q.Add("runid", runID)
 	q.Add("taskid", taskID)
@@ -300,10 +409,55 @@ func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool,
 	if follow {
 		q.Add("follow", "")
 	}
+	if format != "" {
+		q.Add("format", string(format))
+	}
 
 	return c.getResponse(ctx, "GET", "/logs", q, -1, nil, nil)
 }
 
+func (c *Client) ExportRun(ctx context.Context, runID string) (*http.Response, error) {
+	return c.getResponse(ctx, "GET", fmt.Sprintf("/runs/%s/export", runID), nil, -1, nil, nil)
+}
+
+// ImportRun imports a run export bundle. When not empty, group replaces the
+// root group of the imported run group
+func (c *Client) ImportRun(ctx context.Context, group string, r io.Reader) (*RunResponse, *http.Response, error) {
+	q := url.Values{}
+	if group != "" {
+		q.Add("group", group)
+	}
+
+	res := new(RunResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", "/runs/import", q, nil, r, res)
+	return res, resp, err
+}
+
+func (c *Client) SearchLogs(ctx context.Context, group, query string, regex bool, since, until *time.Time, start int64, limit int) ([]*rstypes.LogMatch, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	q.Add("query", query)
+	if regex {
+		q.Add("regex", "")
+	}
+	if since != nil {
+		q.Add("since", since.Format(time.RFC3339))
+	}
+	if until != nil {
+		q.Add("until", until.Format(time.RFC3339))
+	}
+	if start > 0 {
+		q.Add("start", strconv.FormatInt(start, 10))
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	matches := []*rstypes.LogMatch{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/logs/search", q, jsonContent, nil, &matches)
+	return matches, resp, err
+}
+
 func (c *Client) GetRunEvents(ctx context.Context, startRunEventID string) (*http.Response, error) {
 	q := url.Values{}
 	q.Add("startruneventid", startRunEventID)
@@ -18,6 +18,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -30,9 +31,11 @@ import (
 	"agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/store"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
 )
 
 type ExecutorStatusHandler struct {
@@ -61,7 +64,7 @@ func (h *ExecutorStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 	// set last status update time
 	executor.LastStatusUpdateTime = time.Now()
 
-	if _, err := store.PutExecutor(ctx, h.e, executor); err != nil {
+	if _, err := store.UpdateExecutorStatus(ctx, h.e, executor); err != nil {
 		http.Error(w, "", http.StatusInternalServerError)
 		return
 	}
@@ -235,6 +238,26 @@ func (h *ArchivesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Cache-Control", "no-cache")
 
+	hash, err := store.OSTReadObjectHash(h.ost, store.OSTRunTaskArchiveHashPath(taskID, step))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hash != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", hash))
+	}
+
+	if r.Method == "HEAD" {
+		if _, err := h.ost.Stat(store.OSTRunTaskArchivePath(taskID, step)); err != nil {
+			if err == ostypes.ErrNotExist {
+				http.Error(w, "", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		}
+		return
+	}
+
 	if err := h.readArchive(taskID, step, w); err != nil {
 		switch err.(type) {
 		case common.ErrNotExist:
@@ -248,7 +271,7 @@ func (h *ArchivesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (h *ArchivesHandler) readArchive(rtID string, step int, w io.Writer) error {
 	archivePath := store.OSTRunTaskArchivePath(rtID, step)
-	f, err := h.ost.ReadObject(archivePath)
+	f, err := store.OSTReadObject(h.ost, archivePath)
 	if err != nil {
 		if err == ostypes.ErrNotExist {
 			return common.NewErrNotExist(err)
@@ -302,6 +325,15 @@ func (h *CacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	hash, err := store.OSTReadObjectHash(h.ost, store.OSTCacheHashPath(matchedKey))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hash != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", hash))
+	}
+
 	if r.Method == "HEAD" {
 		return
 	}
@@ -317,6 +349,11 @@ func (h *CacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+
+	// update the cache last access time used for lru eviction
+	if err := store.OSTTouchCache(h.ost, matchedKey); err != nil {
+		h.log.Warnf("failed to update cache %q access time: %v", matchedKey, err)
+	}
 }
 
 func matchCache(ost *objectstorage.ObjStorage, key string, prefix bool) (string, error) {
@@ -357,7 +394,7 @@ func matchCache(ost *objectstorage.ObjStorage, key string, prefix bool) (string,
 
 func (h *CacheHandler) readCache(key string, w io.Writer) error {
 	cachePath := store.OSTCachePath(key)
-	f, err := h.ost.ReadObject(cachePath)
+	f, err := store.OSTReadObject(h.ost, cachePath)
 	if err != nil {
 		if err == ostypes.ErrNotExist {
 			return common.NewErrNotExist(err)
@@ -411,21 +448,14 @@ func (h *CacheCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	size := int64(-1)
-	sizeStr := r.Header.Get("Content-Length")
-	if sizeStr != "" {
-		size, err = strconv.ParseInt(sizeStr, 10, 64)
-		if err != nil {
-			http.Error(w, "", http.StatusBadRequest)
-			return
-		}
-	}
-
 	cachePath := store.OSTCachePath(key)
-	if err := h.ost.WriteObject(cachePath, r.Body, size, false); err != nil {
+	if err := store.OSTWriteHashedObject(h.ost, cachePath, store.OSTCacheHashPath(key), r.Body); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := store.OSTTouchCache(h.ost, key); err != nil {
+		h.log.Warnf("failed to update cache %q access time: %v", key, err)
+	}
 }
 
 type ExecutorDeleteHandler struct {
@@ -456,3 +486,199 @@ func (h *ExecutorDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		return
 	}
 }
+
+type LogUploadHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewLogUploadHandler(logger *zap.Logger, ah *action.ActionHandler) *LogUploadHandler {
+	return &LogUploadHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *LogUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	// TODO(sgotti) Check authorized call from executors
+
+	taskID := q.Get("taskid")
+	if taskID == "" {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("taskid is empty")))
+		return
+	}
+	_, setup := q["setup"]
+	step := -1
+	if !setup {
+		var err error
+		step, err = strconv.Atoi(q.Get("step"))
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse step number %q", q.Get("step"))))
+			return
+		}
+	}
+
+	req := &action.RunTaskLogUploadRequest{
+		ExecutorID: q.Get("executorid"),
+		TaskID:     taskID,
+		Setup:      setup,
+		Step:       step,
+		Data:       r.Body,
+	}
+	err := h.ah.UploadRunTaskLog(ctx, req)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+}
+
+type ArchiveUploadHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewArchiveUploadHandler(logger *zap.Logger, ah *action.ActionHandler) *ArchiveUploadHandler {
+	return &ArchiveUploadHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *ArchiveUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	// TODO(sgotti) Check authorized call from executors
+
+	taskID := q.Get("taskid")
+	if taskID == "" {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("taskid is empty")))
+		return
+	}
+	step, err := strconv.Atoi(q.Get("step"))
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse step number %q", q.Get("step"))))
+		return
+	}
+
+	req := &action.RunTaskArchiveUploadRequest{
+		ExecutorID: q.Get("executorid"),
+		TaskID:     taskID,
+		Step:       step,
+		Data:       r.Body,
+	}
+	err = h.ah.UploadRunTaskArchive(ctx, req)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+}
+
+type ExecutorsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorsHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorsHandler {
+	return &ExecutorsHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *ExecutorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	executors, err := h.ah.GetExecutors(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, executors); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ExecutorCordonHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorCordonHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorCordonHandler {
+	return &ExecutorCordonHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *ExecutorCordonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	executorID := vars["executorid"]
+
+	// PUT cordons the executor, DELETE uncordons it
+	cordoned := r.Method == "PUT"
+
+	executor, err := h.ah.SetExecutorCordoned(ctx, executorID, cordoned)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, executor); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ExecutorDrainStatusResponse struct {
+	Executor *types.Executor `json:"executor"`
+	// ActiveTasks are the ids of the executor tasks not yet finished
+	ActiveTasks []string `json:"active_tasks"`
+	Drained     bool     `json:"drained"`
+}
+
+type ExecutorDrainHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorDrainHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorDrainHandler {
+	return &ExecutorDrainHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *ExecutorDrainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	executorID := vars["executorid"]
+
+	var ds *action.ExecutorDrainStatus
+	var err error
+	// PUT starts draining the executor, GET only reports the drain status
+	if r.Method == "PUT" {
+		ds, err = h.ah.DrainExecutor(ctx, executorID)
+	} else {
+		ds, err = h.ah.GetExecutorDrainStatus(ctx, executorID)
+	}
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &ExecutorDrainStatusResponse{
+		Executor:    ds.Executor,
+		ActiveTasks: make([]string, len(ds.ActiveTasks)),
+		Drained:     ds.Drained(),
+	}
+	for i, et := range ds.ActiveTasks {
+		res.ActiveTasks[i] = et.ID
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/runservice/logindex"
+	"agola.io/agola/internal/util"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type LogSearchHandler struct {
+	log      *zap.SugaredLogger
+	logIndex *logindex.LogIndex
+}
+
+func NewLogSearchHandler(logger *zap.Logger, logIndex *logindex.LogIndex) *LogSearchHandler {
+	return &LogSearchHandler{
+		log:      logger.Sugar(),
+		logIndex: logIndex,
+	}
+}
+
+func (h *LogSearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	_, regex := q["regex"]
+	req := &logindex.SearchRequest{
+		Group: q.Get("group"),
+		Query: q.Get("query"),
+		Regex: regex,
+	}
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse since: %w", err)))
+			return
+		}
+		req.Since = &t
+	}
+	if until := q.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse until: %w", err)))
+			return
+		}
+		req.Until = &t
+	}
+	if limitS := q.Get("limit"); limitS != "" {
+		limit, err := strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+		req.Limit = limit
+	}
+	if startS := q.Get("start"); startS != "" {
+		start, err := strconv.ParseInt(startS, 10, 64)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse start: %w", err)))
+			return
+		}
+		req.StartID = start
+	}
+
+	matches, err := h.logIndex.Search(req)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, matches); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"agola.io/agola/internal/services/runservice/action"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type RunExportHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunExportHandler(logger *zap.Logger, ah *action.ActionHandler) *RunExportHandler {
+	return &RunExportHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *RunExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	rb, err := h.ah.GetRunExport(ctx, runID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+".tar.gz"))
+
+	// the response has already started, errors can only be logged
+	if err := h.ah.WriteRunExport(rb, w); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RunImportHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunImportHandler(logger *zap.Logger, ah *action.ActionHandler) *RunImportHandler {
+	return &RunImportHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *RunImportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	areq := &action.RunImportRequest{
+		Group: r.URL.Query().Get("group"),
+		Data:  r.Body,
+	}
+	rb, err := h.ah.ImportRun(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &RunResponse{
+		Run:       rb.Run,
+		RunConfig: rb.Rc,
+	}
+
+	if err := httpResponse(w, http.StatusCreated, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logindex
+
+var Stmts = []string{
+	// indexedrun contains the indexed runs. Since the runs are indexed one at
+	// a time the run log lines will have consecutive docids from mindocid to
+	// maxdocid
+	"create table indexedrun (id varchar, grouppath varchar, enqueuetime bigint, mindocid bigint, maxdocid bigint, PRIMARY KEY (id))",
+	"create index indexedrun_grouppath on indexedrun (grouppath)",
+
+	// logline is the full text index of the task step log lines. Only the
+	// line content is indexed
+	"create virtual table logline using fts4(runid, taskid, step, linenum, content, notindexed=runid, notindexed=taskid, notindexed=step, notindexed=linenum, tokenize=unicode61)",
+}
@@ -0,0 +1,616 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logindex
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/objectstorage"
+	ostypes "agola.io/agola/internal/objectstorage/types"
+	"agola.io/agola/internal/services/runservice/readdb"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/steplog"
+	"agola.io/agola/internal/util"
+
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	indexerInterval = 10 * time.Second
+
+	// maxLineSize is the max indexed size of a log line, longer lines are
+	// truncated
+	maxLineSize = 4096
+
+	// insertBatchSize is the number of log lines inserted with a single
+	// statement
+	insertBatchSize = 100
+	// commitBatchSize is the number of log lines written in a single
+	// transaction
+	commitBatchSize = 1000
+
+	// searchPageSize is the number of candidate lines read from the index for
+	// every search query
+	searchPageSize = 1000
+)
+
+var (
+	// Use postgresql $ placeholder. It'll be converted to ? from the provided db functions
+	sb = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	indexedrunInsert = sb.Insert("indexedrun").Columns("id", "grouppath", "enqueuetime", "mindocid", "maxdocid")
+	loglineInsert    = sb.Insert("logline").Columns("runid", "taskid", "step", "linenum", "content")
+)
+
+// LogIndex is a local full text index of the archived runs task step logs.
+// Every runservice instance keeps its own index in sync with the archived runs
+// in its readdb, so a run logs are searchable only some time after the run has
+// been archived.
+type LogIndex struct {
+	log    *zap.SugaredLogger
+	ldb    *db.DB
+	readDB *readdb.ReadDB
+	ost    *objectstorage.ObjStorage
+	dm     *datamanager.DataManager
+
+	// dbLock avoids concurrent searches while writing to the index since with
+	// the sqlite shared cache they will fail with a locked table error
+	dbLock sync.RWMutex
+}
+
+func NewLogIndex(logger *zap.Logger, dataDir string, readDB *readdb.ReadDB, ost *objectstorage.ObjStorage, dm *datamanager.DataManager) (*LogIndex, error) {
+	if err := os.MkdirAll(dataDir, 0770); err != nil {
+		return nil, err
+	}
+	ldb, err := db.NewDB(db.Sqlite3, filepath.Join(dataDir, "db"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ldb.Create(Stmts); err != nil {
+		return nil, err
+	}
+
+	return &LogIndex{
+		log:    logger.Sugar(),
+		ldb:    ldb,
+		readDB: readDB,
+		ost:    ost,
+		dm:     dm,
+	}, nil
+}
+
+func (li *LogIndex) Run(ctx context.Context) {
+	for {
+		if err := li.sync(ctx); err != nil {
+			li.log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			li.ldb.Close()
+			return
+		case <-time.After(indexerInterval):
+		}
+	}
+}
+
+// sync indexes the logs of the runs archived in the objectstorage, whose
+// logs are all saved in the objectstorage, and removes from the index the
+// deleted runs
+func (li *LogIndex) sync(ctx context.Context) error {
+	var runIDs []string
+	err := li.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		runIDs, err = li.readDB.GetRunIDsOST(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return li.syncRuns(ctx, runIDs, func(runID string) (*types.Run, error) {
+		return store.OSTGetRun(li.dm, runID)
+	})
+}
+
+// syncRuns indexes the logs of the provided runs not already indexed and
+// removes from the index the runs not provided. A run that fails to be
+// indexed is skipped and will be retried at the next sync.
+func (li *LogIndex) syncRuns(ctx context.Context, runIDs []string, getRun func(runID string) (*types.Run, error)) error {
+	indexedRunIDs, err := li.indexedRunIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, runID := range runIDs {
+		if _, ok := indexedRunIDs[runID]; ok {
+			delete(indexedRunIDs, runID)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		r, err := getRun(runID)
+		if err != nil {
+			// the run could have been deleted in the meantime
+			li.log.Warnf("cannot get run %q: %v", runID, err)
+			continue
+		}
+		// don't block the indexing of the other runs
+		if err := li.indexRun(r); err != nil {
+			li.log.Errorf("failed to index run %q logs: %+v", runID, err)
+			continue
+		}
+	}
+
+	// the remaining runs don't exist anymore
+	for runID := range indexedRunIDs {
+		if err := li.deleteRun(runID); err != nil {
+			return errors.Errorf("failed to delete run %q logs from index: %w", runID, err)
+		}
+	}
+
+	return nil
+}
+
+func (li *LogIndex) indexedRunIDs() (map[string]struct{}, error) {
+	runIDs := map[string]struct{}{}
+	err := li.ldb.Do(func(tx *db.Tx) error {
+		rows, err := tx.Query("select id from indexedrun")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var runID string
+			if err := rows.Scan(&runID); err != nil {
+				return errors.Errorf("failed to scan rows: %w", err)
+			}
+			runIDs[runID] = struct{}{}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runIDs, nil
+}
+
+// indexRun indexes the run logs. The log lines are written in transactions of
+// commitBatchSize lines so the dbLock isn't held for the whole run indexing.
+// Since only the sync loop writes to the index the run lines will have
+// consecutive docids. The indexedrun row is written as last so the run lines
+// won't be searchable until the run is fully indexed.
+func (li *LogIndex) indexRun(r *types.Run) error {
+	li.log.Debugf("indexing run %q logs", r.ID)
+
+	rtIDs := make([]string, 0, len(r.Tasks))
+	for rtID := range r.Tasks {
+		rtIDs = append(rtIDs, rtID)
+	}
+	sort.Strings(rtIDs)
+
+	var startDocID int64
+	err := li.writeTx(func(tx *db.Tx) error {
+		// remove the lines of a previous partially indexed run
+		if _, err := tx.Exec("delete from logline where docid > (select coalesce(max(maxdocid), 0) from indexedrun)"); err != nil {
+			return errors.Errorf("failed to delete partially indexed log lines: %w", err)
+		}
+		var err error
+		startDocID, err = maxDocID(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	lines := make([]*logLine, 0, commitBatchSize)
+	addLine := func(l *logLine) error {
+		lines = append(lines, l)
+		if len(lines) < commitBatchSize {
+			return nil
+		}
+		if err := li.writeLines(lines); err != nil {
+			return err
+		}
+		lines = lines[:0]
+		return nil
+	}
+	for _, rtID := range rtIDs {
+		rt := r.Tasks[rtID]
+		for step := range rt.Steps {
+			if err := li.indexStepLog(r.ID, rt.ID, step, addLine); err != nil {
+				return err
+			}
+		}
+	}
+	if err := li.writeLines(lines); err != nil {
+		return err
+	}
+
+	return li.writeTx(func(tx *db.Tx) error {
+		endDocID, err := maxDocID(tx)
+		if err != nil {
+			return err
+		}
+
+		// add ending slash to distinguish between final group (i.e project/projectid/branch/feature and project/projectid/branch/feature02)
+		groupPath := r.Group
+		if !strings.HasSuffix(groupPath, "/") {
+			groupPath += "/"
+		}
+		var enqueueTime interface{}
+		if r.EnqueueTime != nil {
+			enqueueTime = r.EnqueueTime.UnixNano()
+		}
+
+		q, args, err := indexedrunInsert.Values(r.ID, groupPath, enqueueTime, startDocID+1, endDocID).ToSql()
+		if err != nil {
+			return errors.Errorf("failed to build query: %w", err)
+		}
+		_, err = tx.Exec(q, args...)
+		return err
+	})
+}
+
+// writeTx executes f in a transaction holding the dbLock
+func (li *LogIndex) writeTx(f func(tx *db.Tx) error) error {
+	li.dbLock.Lock()
+	defer li.dbLock.Unlock()
+
+	return li.ldb.Do(f)
+}
+
+type logLine struct {
+	runID   string
+	taskID  string
+	step    int
+	lineNum int
+	content string
+}
+
+func (li *LogIndex) writeLines(lines []*logLine) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	return li.writeTx(func(tx *db.Tx) error {
+		for i := 0; i < len(lines); i += insertBatchSize {
+			j := i + insertBatchSize
+			if j > len(lines) {
+				j = len(lines)
+			}
+			insert := loglineInsert
+			for _, l := range lines[i:j] {
+				insert = insert.Values(l.runID, l.taskID, l.step, l.lineNum, l.content)
+			}
+			if err := execInsert(tx, insert); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (li *LogIndex) indexStepLog(runID, rtID string, step int, addLine func(l *logLine) error) error {
+	f, err := store.OSTReadObject(li.ost, store.OSTRunTaskStepLogPath(rtID, step))
+	if err != nil {
+		// steps not executed don't have logs
+		if err == ostypes.ErrNotExist {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(steplog.NewTextReader(f))
+	for lineNum := 1; ; lineNum++ {
+		line, err := readLine(br, maxLineSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := addLine(&logLine{runID: runID, taskID: rtID, step: step, lineNum: lineNum, content: line}); err != nil {
+			return err
+		}
+	}
+}
+
+func execInsert(tx *db.Tx, insert sq.InsertBuilder) error {
+	q, args, err := insert.ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	_, err = tx.Exec(q, args...)
+	return err
+}
+
+// readLine reads a line truncating it to maxSize bytes
+func readLine(br *bufio.Reader, maxSize int) (string, error) {
+	var line []byte
+	for {
+		l, isPrefix, err := br.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if len(line) < maxSize {
+			if len(line)+len(l) > maxSize {
+				l = l[:maxSize-len(line)]
+			}
+			line = append(line, l...)
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	return string(line), nil
+}
+
+func maxDocID(tx *db.Tx) (int64, error) {
+	var docID sql.NullInt64
+	if err := tx.QueryRow("select max(docid) from logline").Scan(&docID); err != nil {
+		return 0, err
+	}
+	return docID.Int64, nil
+}
+
+func (li *LogIndex) deleteRun(runID string) error {
+	li.log.Debugf("deleting run %q logs from index", runID)
+
+	li.dbLock.Lock()
+	defer li.dbLock.Unlock()
+
+	return li.ldb.Do(func(tx *db.Tx) error {
+		var minDocID, maxDocID int64
+		if err := tx.QueryRow("select mindocid, maxdocid from indexedrun where id = $1", runID).Scan(&minDocID, &maxDocID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("delete from logline where docid >= $1 and docid <= $2", minDocID, maxDocID); err != nil {
+			return errors.Errorf("failed to delete log lines: %w", err)
+		}
+		if _, err := tx.Exec("delete from indexedrun where id = $1", runID); err != nil {
+			return errors.Errorf("failed to delete indexed run: %w", err)
+		}
+		return nil
+	})
+}
+
+type SearchRequest struct {
+	// Group limits the search to the runs in the group and its subgroups
+	Group string
+	// Query is matched (case insensitive) against the log lines words: a
+	// line matches if it contains Query starting at the start of a word (i.e.
+	// "conn refused" matches "connection refused" but "onnection" doesn't)
+	Query string
+	// Regex defines if Query is a regular expression
+	Regex bool
+	// Since and Until limit the search to the runs created in the time range
+	Since *time.Time
+	Until *time.Time
+	// StartID returns only the matches after the match with the provided ID.
+	// Used to get the next matches of a limited search
+	StartID int64
+	Limit   int
+}
+
+// Search returns the log lines matching the search query ordered by their
+// position in the index (runs are indexed roughly in creation order). The full
+// text index is used to select the candidate lines that are then filtered by
+// the query, the candidates are read in pages of searchPageSize lines until
+// the limit is reached.
+func (li *LogIndex) Search(req *SearchRequest) ([]*types.LogMatch, error) {
+	if req.Query == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty search query"))
+	}
+
+	var match func(line string) bool
+	var fq string
+	if req.Regex {
+		re, err := regexp.Compile(req.Query)
+		if err != nil {
+			return nil, util.NewErrBadRequest(errors.Errorf("wrong regular expression: %w", err))
+		}
+		match = re.MatchString
+		// cannot fail since the regexp has been already compiled
+		sre, _ := syntax.Parse(req.Query, syntax.Perl)
+		fq = ftsRegexpQuery(sre)
+	} else {
+		query := strings.ToLower(req.Query)
+		match = func(line string) bool {
+			return strings.Contains(strings.ToLower(line), query)
+		}
+		fq = ftsQuery(req.Query)
+	}
+
+	matches := []*types.LogMatch{}
+	startID := req.StartID
+	for {
+		lines, err := li.searchLines(req, fq, startID, searchPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range lines {
+			startID = m.ID
+			if !match(m.Content) {
+				continue
+			}
+			matches = append(matches, m)
+			if req.Limit > 0 && len(matches) >= req.Limit {
+				return matches, nil
+			}
+		}
+		if len(lines) < searchPageSize {
+			return matches, nil
+		}
+	}
+}
+
+// searchLines returns at most limit candidate lines, after the line with
+// startID, matching the full text search query fq
+func (li *LogIndex) searchLines(req *SearchRequest, fq string, startID int64, limit int) ([]*types.LogMatch, error) {
+	s := sb.Select("logline.docid", "logline.runid", "logline.taskid", "logline.step", "logline.linenum", "logline.content").From("logline")
+	s = s.Join("indexedrun on indexedrun.id = logline.runid")
+	if req.Group != "" {
+		groupPath := req.Group
+		if !strings.HasSuffix(groupPath, "/") {
+			groupPath += "/"
+		}
+		s = s.Where(sq.Like{"indexedrun.grouppath": groupPath + "%"})
+	}
+	if req.Since != nil {
+		s = s.Where(sq.GtOrEq{"indexedrun.enqueuetime": req.Since.UnixNano()})
+	}
+	if req.Until != nil {
+		s = s.Where(sq.LtOrEq{"indexedrun.enqueuetime": req.Until.UnixNano()})
+	}
+	if fq != "" {
+		s = s.Where("logline.content match ?", fq)
+	}
+	if startID > 0 {
+		s = s.Where(sq.Gt{"logline.docid": startID})
+	}
+	s = s.OrderBy("logline.docid asc").Limit(uint64(limit))
+
+	q, args, err := s.ToSql()
+	li.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	li.dbLock.RLock()
+	defer li.dbLock.RUnlock()
+
+	lines := []*types.LogMatch{}
+	err = li.ldb.Do(func(tx *db.Tx) error {
+		rows, err := tx.Query(q, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			m := &types.LogMatch{}
+			if err := rows.Scan(&m.ID, &m.RunID, &m.TaskID, &m.Step, &m.Line, &m.Content); err != nil {
+				return errors.Errorf("failed to scan rows: %w", err)
+			}
+			lines = append(lines, m)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+func isTokenChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// ftsTerms returns the full text search terms matching the lines containing s.
+// When wordStart is false s could start in the middle of a word so its first
+// token is used only if s starts with a separator. The last token could be
+// the start of a longer word so it's used as a prefix query if s doesn't end
+// with a separator.
+func ftsTerms(s string, wordStart bool) []string {
+	tokens := strings.FieldsFunc(s, func(r rune) bool { return !isTokenChar(r) })
+	if len(tokens) == 0 {
+		return nil
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	last, _ := utf8.DecodeLastRuneInString(s)
+
+	terms := []string{}
+	for i, t := range tokens {
+		// lowercase the tokens to not use them as query operators (AND, OR,
+		// NOT)
+		t = strings.ToLower(t)
+		if i == 0 && !wordStart && isTokenChar(first) {
+			continue
+		}
+		if i == len(tokens)-1 && isTokenChar(last) {
+			t += "*"
+		}
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+// ftsQuery returns a full text search query matching the lines containing s
+// starting at the start of a word or an empty string if s doesn't contain
+// usable tokens
+func ftsQuery(s string) string {
+	return strings.Join(ftsTerms(s, true), " ")
+}
+
+// ftsRegexpQuery returns a full text search query matching the lines
+// containing the literal parts required by the regular expression or an empty
+// string if there aren't usable literal parts
+func ftsRegexpQuery(re *syntax.Regexp) string {
+	terms := []string{}
+	for _, lit := range regexpLiterals(re) {
+		terms = append(terms, ftsTerms(lit, false)...)
+	}
+	return strings.Join(terms, " ")
+}
+
+// regexpLiterals returns the literal strings contained in every string
+// matched by the regular expression
+func regexpLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexpLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return regexpLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		lits := []string{}
+		for _, sub := range re.Sub {
+			lits = append(lits, regexpLiterals(sub)...)
+		}
+		return lits
+	}
+	return nil
+}
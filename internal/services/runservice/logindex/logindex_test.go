@@ -0,0 +1,361 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logindex
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"regexp/syntax"
+	"strings"
+	"testing"
+	"time"
+
+	slog "agola.io/agola/internal/log"
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/posix"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/steplog"
+	"agola.io/agola/internal/util"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+var logger = slog.New(level)
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{in: "error", out: "error*"},
+		{in: " error", out: "error*"},
+		{in: " error ", out: "error"},
+		{in: "connection refused", out: "connection refused*"},
+		{in: "dial tcp: connection refused", out: "dial tcp connection refused*"},
+		{in: "OR NOT ", out: "or not"},
+		{in: "...", out: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out := ftsQuery(tt.in)
+			if out != tt.out {
+				t.Fatalf("expected query %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestFTSRegexpQuery(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{in: "^FAIL: Test.*", out: "test*"},
+		{in: "connection (refused|reset)", out: ""},
+		{in: " connection (refused|reset)", out: "connection"},
+		{in: "(dial tcp: )+connection", out: "tcp"},
+		{in: "x{2,}yz", out: ""},
+		{in: "[a-z]+ error", out: "error*"},
+		{in: "error?", out: ""},
+		{in: ".*", out: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			re, err := syntax.Parse(tt.in, syntax.Perl)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			out := ftsRegexpQuery(re)
+			if out != tt.out {
+				t.Fatalf("expected query %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps, err := posix.New(dir + "/ost")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(ps, "/")
+
+	li, err := NewLogIndex(logger, dir+"/logindex", nil, ost, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	now := time.Now()
+	runs := []*types.Run{
+		&types.Run{
+			ID:          "run01",
+			Group:       "/project/project01/branch/master",
+			EnqueueTime: util.TimePtr(now.Add(-2 * time.Hour)),
+			Tasks: map[string]*types.RunTask{
+				"task01": &types.RunTask{ID: "task01", Steps: []*types.RunTaskStep{&types.RunTaskStep{}, &types.RunTaskStep{}}},
+			},
+		},
+		&types.Run{
+			ID:          "run02",
+			Group:       "/project/project01/branch/master",
+			EnqueueTime: util.TimePtr(now.Add(-1 * time.Hour)),
+			Tasks: map[string]*types.RunTask{
+				"task02": &types.RunTask{ID: "task02", Steps: []*types.RunTaskStep{&types.RunTaskStep{}}},
+			},
+		},
+		&types.Run{
+			ID:          "run03",
+			Group:       "/project/project02/branch/master",
+			EnqueueTime: util.TimePtr(now),
+			Tasks: map[string]*types.RunTask{
+				"task03": &types.RunTask{ID: "task03", Steps: []*types.RunTaskStep{&types.RunTaskStep{}}},
+			},
+		},
+	}
+
+	// task03 log is in the framed format
+	var framedLog bytes.Buffer
+	w, err := steplog.NewWriter(&framedLog)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := w.WriteEntry(now, steplog.StreamStdout, []byte("dial tcp: connection refused\n")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	logs := map[string]string{
+		store.OSTRunTaskStepLogPath("task01", 0): "building\ndial tcp: connection refused\ndone\n",
+		store.OSTRunTaskStepLogPath("task01", 1): "running tests\nFAIL: TestSomething\n",
+		store.OSTRunTaskStepLogPath("task02", 0): "building\nerror: Connection Refused by peer\n" + strings.Repeat("x", maxLineSize*2) + "\n",
+		store.OSTRunTaskStepLogPath("task03", 0): framedLog.String(),
+	}
+	for p, data := range logs {
+		if err := store.OSTWriteCompressedObject(ost, p, strings.NewReader(data)); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	for _, r := range runs {
+		if err := li.indexRun(r); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		req  *SearchRequest
+		out  []*types.LogMatch
+	}{
+		{
+			name: "test string search",
+			req:  &SearchRequest{Group: "/project/project01", Query: "connection refused"},
+			out: []*types.LogMatch{
+				{RunID: "run01", TaskID: "task01", Step: 0, Line: 2, Content: "dial tcp: connection refused"},
+				{RunID: "run02", TaskID: "task02", Step: 0, Line: 2, Content: "error: Connection Refused by peer"},
+			},
+		},
+		{
+			name: "test partial words string search",
+			req:  &SearchRequest{Group: "/project/project01", Query: "connection refu"},
+			out: []*types.LogMatch{
+				{RunID: "run01", TaskID: "task01", Step: 0, Line: 2, Content: "dial tcp: connection refused"},
+				{RunID: "run02", TaskID: "task02", Step: 0, Line: 2, Content: "error: Connection Refused by peer"},
+			},
+		},
+		{
+			name: "test string search not at word start",
+			req:  &SearchRequest{Group: "/project/project01", Query: "onnection"},
+			out:  []*types.LogMatch{},
+		},
+		{
+			name: "test single word string search",
+			req:  &SearchRequest{Group: "/project/project01", Query: "FAIL"},
+			out: []*types.LogMatch{
+				{RunID: "run01", TaskID: "task01", Step: 1, Line: 2, Content: "FAIL: TestSomething"},
+			},
+		},
+		{
+			name: "test regex search",
+			req:  &SearchRequest{Group: "/project/project01", Query: "^FAIL: Test.*", Regex: true},
+			out: []*types.LogMatch{
+				{RunID: "run01", TaskID: "task01", Step: 1, Line: 2, Content: "FAIL: TestSomething"},
+			},
+		},
+		{
+			name: "test search with time range",
+			req:  &SearchRequest{Group: "/project/project01", Query: "connection refused", Since: util.TimePtr(now.Add(-90 * time.Minute))},
+			out: []*types.LogMatch{
+				{RunID: "run02", TaskID: "task02", Step: 0, Line: 2, Content: "error: Connection Refused by peer"},
+			},
+		},
+		{
+			name: "test search with limit",
+			req:  &SearchRequest{Query: "connection refused", Limit: 1},
+			out: []*types.LogMatch{
+				{RunID: "run01", TaskID: "task01", Step: 0, Line: 2, Content: "dial tcp: connection refused"},
+			},
+		},
+		{
+			name: "test truncated line",
+			req:  &SearchRequest{Group: "/project/project01", Query: "xxx"},
+			out: []*types.LogMatch{
+				{RunID: "run02", TaskID: "task02", Step: 0, Line: 3, Content: strings.Repeat("x", maxLineSize)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := li.Search(tt.req)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out, cmpopts.IgnoreFields(types.LogMatch{}, "ID")); diff != "" {
+				t.Fatalf("mismatching matches: %s", diff)
+			}
+		})
+	}
+
+	t.Run("test deleted run", func(t *testing.T) {
+		if err := li.deleteRun("run01"); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		out, err := li.Search(&SearchRequest{Query: "connection refused"})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		expected := []*types.LogMatch{
+			{RunID: "run02", TaskID: "task02", Step: 0, Line: 2, Content: "error: Connection Refused by peer"},
+			{RunID: "run03", TaskID: "task03", Step: 0, Line: 1, Content: "dial tcp: connection refused"},
+		}
+		if diff := cmp.Diff(expected, out, cmpopts.IgnoreFields(types.LogMatch{}, "ID")); diff != "" {
+			t.Fatalf("mismatching matches: %s", diff)
+		}
+	})
+
+	t.Run("test search start", func(t *testing.T) {
+		req := &SearchRequest{Query: "connection refused", Limit: 1}
+		out, err := li.Search(req)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(out) != 1 || out[0].RunID != "run02" {
+			t.Fatalf("expected a run02 match, got: %s", util.Dump(out))
+		}
+		req.StartID = out[0].ID
+		out, err = li.Search(req)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(out) != 1 || out[0].RunID != "run03" {
+			t.Fatalf("expected a run03 match, got: %s", util.Dump(out))
+		}
+		req.StartID = out[0].ID
+		out, err = li.Search(req)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(out) != 0 {
+			t.Fatalf("expected no matches, got: %s", util.Dump(out))
+		}
+	})
+}
+
+func TestSyncRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps, err := posix.New(dir + "/ost")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(ps, "/")
+
+	li, err := NewLogIndex(logger, dir+"/logindex", nil, ost, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	runs := map[string]*types.Run{}
+	for _, id := range []string{"run01", "run02", "run03"} {
+		runs[id] = &types.Run{
+			ID:    id,
+			Group: "/project/project01/branch/master",
+			Tasks: map[string]*types.RunTask{
+				"task" + id: &types.RunTask{ID: "task" + id, Steps: []*types.RunTaskStep{&types.RunTaskStep{}}},
+			},
+		}
+		if err := store.OSTWriteCompressedObject(ost, store.OSTRunTaskStepLogPath("task"+id, 0), strings.NewReader("log of "+id+"\n")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	// truncate run02 compressed step log so its indexing will fail
+	f, err := ost.ReadObject(store.OSTRunTaskStepLogPath("taskrun02", 0))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := ost.WriteObject(store.OSTRunTaskStepLogPath("taskrun02", 0), bytes.NewReader(data[:len(data)-10]), -1, false); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	getRun := func(runID string) (*types.Run, error) {
+		return runs[runID], nil
+	}
+
+	if err := li.syncRuns(context.Background(), []string{"run01", "run02", "run03"}, getRun); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	indexedRunIDs, err := li.indexedRunIDs()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expectedRunIDs := map[string]struct{}{"run01": struct{}{}, "run03": struct{}{}}
+	if diff := cmp.Diff(expectedRunIDs, indexedRunIDs); diff != "" {
+		t.Fatalf("mismatching indexed runs: %s", diff)
+	}
+
+	// a deleted run is removed from the index
+	if err := li.syncRuns(context.Background(), []string{"run03"}, getRun); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	out, err := li.Search(&SearchRequest{Group: "/project/project01", Query: "log of"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(out) != 1 || out[0].RunID != "run03" {
+		t.Fatalf("expected a match only in run03, got: %s", util.Dump(out))
+	}
+}
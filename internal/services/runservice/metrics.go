@@ -0,0 +1,208 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runservice
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/runconfig"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	fetchTypeLog     = "log"
+	fetchTypeArchive = "archive"
+
+	metricsUpdaterInterval = 10 * time.Second
+)
+
+var (
+	runsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agola_runservice_runs",
+			Help: "Number of queued and running runs",
+		},
+		[]string{"phase", "group_type"},
+	)
+	taskQueueWaitHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "agola_runservice_task_queue_wait_seconds",
+			Help:    "Time between a task being ready to run and its execution start",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+	)
+	taskDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "agola_runservice_task_duration_seconds",
+			Help:    "Duration of the executed tasks",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 15),
+		},
+		[]string{"status"},
+	)
+	executorActiveTasksGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agola_runservice_executor_active_tasks",
+			Help: "Number of active tasks reported by the executor",
+		},
+		[]string{"executor"},
+	)
+	executorActiveTasksLimitGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agola_runservice_executor_active_tasks_limit",
+			Help: "Max number of concurrent tasks reported by the executor",
+		},
+		[]string{"executor"},
+	)
+	fetcherBacklogGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agola_runservice_fetcher_backlog",
+			Help: "Number of logs and archives of finished tasks not yet fetched from the executors",
+		},
+		[]string{"type"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(runsGauge)
+	prometheus.MustRegister(taskQueueWaitHistogram)
+	prometheus.MustRegister(taskDurationHistogram)
+	prometheus.MustRegister(executorActiveTasksGauge)
+	prometheus.MustRegister(executorActiveTasksLimitGauge)
+	prometheus.MustRegister(fetcherBacklogGauge)
+}
+
+func (s *Runservice) metricsUpdaterLoop(ctx context.Context) {
+	for {
+		log.Debugf("metricsUpdaterLoop")
+
+		if err := s.metricsUpdater(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		time.Sleep(metricsUpdaterInterval)
+	}
+}
+
+func (s *Runservice) metricsUpdater(ctx context.Context) error {
+	runs, err := store.GetRuns(ctx, s.e)
+	if err != nil {
+		return err
+	}
+	updateRunsMetrics(runs)
+
+	logs, archives := fetcherBacklog(runs)
+	fetcherBacklogGauge.WithLabelValues(fetchTypeLog).Set(float64(logs))
+	fetcherBacklogGauge.WithLabelValues(fetchTypeArchive).Set(float64(archives))
+
+	executors, err := store.GetExecutors(ctx, s.e)
+	if err != nil {
+		return err
+	}
+	executorActiveTasksGauge.Reset()
+	executorActiveTasksLimitGauge.Reset()
+	for _, executor := range executors {
+		executorActiveTasksGauge.WithLabelValues(executor.ID).Set(float64(executor.ActiveTasks))
+		executorActiveTasksLimitGauge.WithLabelValues(executor.ID).Set(float64(executor.ActiveTasksLimit))
+	}
+
+	return nil
+}
+
+// runGroupType returns the group type of a run group (i.e. for
+// /project/projectid/branch/master it's "branch")
+func runGroupType(group string) string {
+	pl := util.PathList(group)
+	if len(pl) < 3 {
+		return ""
+	}
+	return pl[2]
+}
+
+func updateRunsMetrics(runs []*types.Run) {
+	type runsKey struct {
+		phase     types.RunPhase
+		groupType string
+	}
+	counts := map[runsKey]int{}
+	for _, r := range runs {
+		if r.Phase != types.RunPhaseQueued && r.Phase != types.RunPhaseRunning {
+			continue
+		}
+		counts[runsKey{phase: r.Phase, groupType: runGroupType(r.Group)}]++
+	}
+
+	runsGauge.Reset()
+	for k, c := range counts {
+		runsGauge.WithLabelValues(string(k.phase), k.groupType).Set(float64(c))
+	}
+}
+
+// observeRunTaskMetrics records the queue wait time and the duration of the run
+// task when its status changed from prevStatus
+func observeRunTaskMetrics(prevStatus types.RunTaskStatus, r *types.Run, rc *types.RunConfig, rt *types.RunTask) {
+	if prevStatus == rt.Status {
+		return
+	}
+	if prevStatus == types.RunTaskStatusNotStarted && rt.StartTime != nil && !rt.Approved {
+		// tasks that waited for an approval are ignored since the approval time
+		// isn't known
+		if rct, ok := rc.Tasks[rt.ID]; ok {
+			if readyTime := runconfig.TaskReadyTime(r, rc, rct); readyTime != nil && rt.StartTime.After(*readyTime) {
+				taskQueueWaitHistogram.Observe(rt.StartTime.Sub(*readyTime).Seconds())
+			}
+		}
+	}
+	if !prevStatus.IsFinished() && rt.Status.IsFinished() && rt.StartTime != nil && rt.EndTime != nil {
+		taskDurationHistogram.WithLabelValues(string(rt.Status)).Observe(rt.EndTime.Sub(*rt.StartTime).Seconds())
+	}
+}
+
+// fetcherBacklog returns the number of logs and archives of the finished run
+// tasks that must still be fetched
+func fetcherBacklog(runs []*types.Run) (int, int) {
+	logs, archives := 0, 0
+	for _, r := range runs {
+		for _, rt := range r.Tasks {
+			if !rt.Status.IsFinished() {
+				continue
+			}
+			if rt.SetupStep.LogPhase == types.RunTaskFetchPhaseNotStarted {
+				logs++
+			}
+			for _, rts := range rt.Steps {
+				if rts.LogPhase == types.RunTaskFetchPhaseNotStarted {
+					logs++
+				}
+			}
+			for _, phase := range rt.WorkspaceArchivesPhase {
+				if phase == types.RunTaskFetchPhaseNotStarted {
+					archives++
+				}
+			}
+		}
+	}
+	return logs, archives
+}
@@ -18,7 +18,11 @@ var Stmts = []string{
 	// last processed etcd event revision
 	"create table revision (revision bigint, PRIMARY KEY(revision))",
 
-	"create table run (id varchar, grouppath varchar, phase varchar, result varchar, PRIMARY KEY (id, grouppath, phase))",
+	"create table run (id varchar, grouppath varchar, phase varchar, result varchar, name varchar, enqueuetime bigint, PRIMARY KEY (id, grouppath, phase))",
+
+	// runannotation contains the run annotations to search runs by annotation
+	"create table runannotation (id varchar, annotation varchar, value varchar, PRIMARY KEY (id, annotation))",
+	"create index runannotation_annotation_value on runannotation (annotation, value)",
 
 	"create table rundata (id varchar, data bytea, PRIMARY KEY (id))",
 
@@ -35,7 +39,10 @@ var Stmts = []string{
 
 	"create table changegrouprevision_ost (id varchar, revision varchar, PRIMARY KEY (id, revision))",
 
-	"create table run_ost (id varchar, grouppath varchar, phase varchar, result varchar, PRIMARY KEY (id, grouppath, phase))",
+	"create table run_ost (id varchar, grouppath varchar, phase varchar, result varchar, name varchar, enqueuetime bigint, PRIMARY KEY (id, grouppath, phase))",
+
+	"create table runannotation_ost (id varchar, annotation varchar, value varchar, PRIMARY KEY (id, annotation))",
+	"create index runannotation_ost_annotation_value on runannotation_ost (annotation, value)",
 
 	"create table rundata_ost (id varchar, data bytea, PRIMARY KEY (id))",
 
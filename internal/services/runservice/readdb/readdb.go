@@ -60,7 +60,9 @@ var (
 	revisionInsert = sb.Insert("revision").Columns("revision")
 
 	//runSelect = sb.Select("id", "grouppath", "phase", "result").From("run")
-	runInsert = sb.Insert("run").Columns("id", "grouppath", "phase", "result")
+	runInsert = sb.Insert("run").Columns("id", "grouppath", "phase", "result", "name", "enqueuetime")
+
+	runannotationInsert = sb.Insert("runannotation").Columns("id", "annotation", "value")
 
 	rundataInsert = sb.Insert("rundata").Columns("id", "data")
 
@@ -75,7 +77,9 @@ var (
 	revisionOSTInsert = sb.Insert("revision_ost").Columns("revision")
 
 	//runOSTSelect = sb.Select("id", "grouppath", "phase", "result").From("run_ost")
-	runOSTInsert = sb.Insert("run_ost").Columns("id", "grouppath", "phase", "result")
+	runOSTInsert = sb.Insert("run_ost").Columns("id", "grouppath", "phase", "result", "name", "enqueuetime")
+
+	runannotationOSTInsert = sb.Insert("runannotation_ost").Columns("id", "annotation", "value")
 
 	rundataOSTInsert = sb.Insert("rundata_ost").Columns("id", "data")
 
@@ -123,6 +127,22 @@ func NewReadDB(ctx context.Context, logger *zap.Logger, dataDir string, e *etcd.
 		return nil, err
 	}
 
+	// the readdb is rebuilt from the etcd and objectstorage data, so if it has
+	// been created by a previous version with an older schema just recreate it
+	if !hasCurrentSchema(rdb) {
+		rdb.Close()
+		if err := os.Remove(filepath.Join(dataDir, "db")); err != nil {
+			return nil, err
+		}
+		rdb, err = db.NewDB(db.Sqlite3, filepath.Join(dataDir, "db"))
+		if err != nil {
+			return nil, err
+		}
+		if err := rdb.Create(Stmts); err != nil {
+			return nil, err
+		}
+	}
+
 	readDB := &ReadDB{
 		log:     logger.Sugar(),
 		e:       e,
@@ -135,6 +155,19 @@ func NewReadDB(ctx context.Context, logger *zap.Logger, dataDir string, e *etcd.
 	return readDB, nil
 }
 
+// hasCurrentSchema checks that the db contains the tables and columns added in
+// the latest schema
+func hasCurrentSchema(rdb *db.DB) bool {
+	err := rdb.Do(func(tx *db.Tx) error {
+		rows, err := tx.Query("select run.name, run.enqueuetime, runannotation.value from run, runannotation limit 1")
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	})
+	return err == nil
+}
+
 func (r *ReadDB) SetInitialized(initialized bool) {
 	r.initLock.Lock()
 	r.Initialized = initialized
@@ -274,6 +307,8 @@ func (r *ReadDB) Run(ctx context.Context) error {
 	}
 	r.SetInitialized(true)
 
+	go r.syncLagUpdaterLoop(ctx)
+
 	errCh := make(chan error)
 	for {
 		for {
@@ -339,7 +374,7 @@ func (r *ReadDB) handleEvents(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		lastRuns, err = r.GetActiveRuns(tx, nil, true, nil, nil, "", 1, types.SortOrderDesc)
+		lastRuns, err = r.GetActiveRuns(tx, nil, true, nil, nil, nil, "", 1, types.SortOrderDesc)
 		return err
 	})
 	if err != nil {
@@ -445,6 +480,9 @@ func (r *ReadDB) handleRunEvent(tx *db.Tx, ev *etcdclientv3.Event, wresp *etcdcl
 		if _, err := tx.Exec("delete from run where id = $1", runID); err != nil {
 			return errors.Errorf("failed to delete run: %w", err)
 		}
+		if _, err := tx.Exec("delete from runannotation where id = $1", runID); err != nil {
+			return errors.Errorf("failed to delete run annotations: %w", err)
+		}
 
 		// Run has been deleted from etcd, this means that it was stored in the objectstorage
 		// TODO(sgotti) this is here just to avoid a window where the run is not in
@@ -903,6 +941,9 @@ func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
 	case datamanager.ActionTypeDelete:
 		switch action.DataType {
 		case string(common.DataTypeRun):
+			if err := r.deleteRunOST(tx, action.ID); err != nil {
+				return err
+			}
 		case string(common.DataTypeRunCounter):
 		}
 	}
@@ -995,7 +1036,7 @@ func insertRun(tx *db.Tx, run *types.Run, data []byte) error {
 	if _, err := tx.Exec("delete from run where id = $1", run.ID); err != nil {
 		return errors.Errorf("failed to delete run: %w", err)
 	}
-	q, args, err := runInsert.Values(run.ID, groupPath, run.Phase, run.Result).ToSql()
+	q, args, err := runInsert.Values(run.ID, groupPath, run.Phase, run.Result, run.Name, runEnqueueTime(run)).ToSql()
 	if err != nil {
 		return errors.Errorf("failed to build query: %w", err)
 	}
@@ -1003,6 +1044,14 @@ func insertRun(tx *db.Tx, run *types.Run, data []byte) error {
 		return err
 	}
 
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec("delete from runannotation where id = $1", run.ID); err != nil {
+		return errors.Errorf("failed to delete run annotations: %w", err)
+	}
+	if err := insertRunAnnotations(tx, runannotationInsert, run); err != nil {
+		return err
+	}
+
 	// poor man insert or update that works because transaction isolation level is serializable
 	if _, err := tx.Exec("delete from rundata where id = $1", run.ID); err != nil {
 		return errors.Errorf("failed to delete rundata: %w", err)
@@ -1029,7 +1078,7 @@ func (r *ReadDB) insertRunOST(tx *db.Tx, run *types.Run, data []byte) error {
 	if _, err := tx.Exec("delete from run_ost where id = $1", run.ID); err != nil {
 		return errors.Errorf("failed to delete run objectstorage: %w", err)
 	}
-	q, args, err := runOSTInsert.Values(run.ID, groupPath, run.Phase, run.Result).ToSql()
+	q, args, err := runOSTInsert.Values(run.ID, groupPath, run.Phase, run.Result, run.Name, runEnqueueTime(run)).ToSql()
 	if err != nil {
 		return errors.Errorf("failed to build query: %w", err)
 	}
@@ -1037,6 +1086,14 @@ func (r *ReadDB) insertRunOST(tx *db.Tx, run *types.Run, data []byte) error {
 		return err
 	}
 
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec("delete from runannotation_ost where id = $1", run.ID); err != nil {
+		return errors.Errorf("failed to delete run annotations objectstorage: %w", err)
+	}
+	if err := insertRunAnnotations(tx, runannotationOSTInsert, run); err != nil {
+		return err
+	}
+
 	// poor man insert or update that works because transaction isolation level is serializable
 	if _, err := tx.Exec("delete from rundata_ost where id = $1", run.ID); err != nil {
 		return errors.Errorf("failed to delete rundata: %w", err)
@@ -1052,6 +1109,46 @@ func (r *ReadDB) insertRunOST(tx *db.Tx, run *types.Run, data []byte) error {
 	return nil
 }
 
+func (r *ReadDB) deleteRunOST(tx *db.Tx, runID string) error {
+	if _, err := tx.Exec("delete from run_ost where id = $1", runID); err != nil {
+		return errors.Errorf("failed to delete run objectstorage: %w", err)
+	}
+	if _, err := tx.Exec("delete from rundata_ost where id = $1", runID); err != nil {
+		return errors.Errorf("failed to delete rundata: %w", err)
+	}
+	if _, err := tx.Exec("delete from runannotation_ost where id = $1", runID); err != nil {
+		return errors.Errorf("failed to delete run annotations objectstorage: %w", err)
+	}
+
+	return nil
+}
+
+func insertRunAnnotations(tx *db.Tx, insert sq.InsertBuilder, run *types.Run) error {
+	if len(run.Annotations) == 0 {
+		return nil
+	}
+	for k, v := range run.Annotations {
+		insert = insert.Values(run.ID, k, v)
+	}
+	q, args, err := insert.ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// runEnqueueTime returns the run enqueue time as unix nanoseconds or nil if not
+// defined
+func runEnqueueTime(run *types.Run) interface{} {
+	if run.EnqueueTime == nil {
+		return nil
+	}
+	return run.EnqueueTime.UnixNano()
+}
+
 func insertChangeGroupRevision(tx *db.Tx, changegroupID string, revision int64) error {
 	// poor man insert or update that works because transaction isolation level is serializable
 	if _, err := tx.Exec("delete from changegrouprevision where id = $1", changegroupID); err != nil {
@@ -1121,11 +1218,11 @@ func (r *ReadDB) GetChangeGroupsUpdateTokens(tx *db.Tx, groups []string) (*types
 	return &types.ChangeGroupsUpdateToken{CurRevision: revision, ChangeGroupsRevisions: changeGroupsRevisions}, nil
 }
 
-func (r *ReadDB) GetActiveRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	return r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+func (r *ReadDB) GetActiveRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, filter *types.RunsFilter, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
+	return r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, filter, startRunID, limit, sortOrder)
 }
 
-func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*types.Run, error) {
+func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, filter *types.RunsFilter, startRunID string, limit int, sortOrder types.SortOrder) ([]*types.Run, error) {
 	useObjectStorage := false
 	for _, phase := range phaseFilter {
 		if phase == types.RunPhaseFinished || phase == types.RunPhaseCancelled {
@@ -1136,7 +1233,7 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 		useObjectStorage = true
 	}
 
-	runDataRDB, err := r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+	runDataRDB, err := r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, filter, startRunID, limit, sortOrder)
 	if err != nil {
 		return nil, err
 	}
@@ -1149,7 +1246,7 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 
 	if useObjectStorage {
 		// skip if the phase requested is not finished
-		runDataOST, err := r.GetRunsFilteredOST(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+		runDataOST, err := r.GetRunsFilteredOST(tx, groups, lastRun, phaseFilter, resultFilter, filter, startRunID, limit, sortOrder)
 		if err != nil {
 			return nil, err
 		}
@@ -1215,7 +1312,7 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 	return aruns, nil
 }
 
-func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter []types.RunResult, groups []string, lastRun bool, startRunID string, limit int, sortOrder types.SortOrder, objectstorage bool) sq.SelectBuilder {
+func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter []types.RunResult, filter *types.RunsFilter, groups []string, lastRun bool, startRunID string, limit int, sortOrder types.SortOrder, objectstorage bool) sq.SelectBuilder {
 	runt := "run"
 	rundatat := "rundata"
 	fields := []string{"run.id", "run.grouppath", "run.phase", "rundata.data"}
@@ -1241,6 +1338,9 @@ func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter
 	if len(resultFilter) > 0 {
 		s = s.Where(sq.Eq{"result": resultFilter})
 	}
+	if filter != nil {
+		s = r.runsFilterQuery(s, filter, objectstorage)
+	}
 	if startRunID != "" {
 		if lastRun {
 			switch sortOrder {
@@ -1282,8 +1382,46 @@ func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter
 	return s
 }
 
-func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, groups, lastRun, startRunID, limit, sortOrder, false)
+func (r *ReadDB) runsFilterQuery(s sq.SelectBuilder, filter *types.RunsFilter, objectstorage bool) sq.SelectBuilder {
+	runannotationt := "runannotation"
+	if objectstorage {
+		runannotationt = "runannotation_ost"
+	}
+
+	if filter.Name != "" {
+		s = s.Where(sq.Eq{"run.name": filter.Name})
+	}
+	for _, k := range sortedKeys(filter.Annotations) {
+		s = s.Where(fmt.Sprintf("run.id in (select id from %s where annotation = ? and value = ?)", runannotationt), k, filter.Annotations[k])
+	}
+	for _, k := range sortedKeys(filter.AnnotationPrefixes) {
+		s = s.Where(fmt.Sprintf(`run.id in (select id from %s where annotation = ? and value like ? escape '\')`, runannotationt), k, likeEscaper.Replace(filter.AnnotationPrefixes[k])+"%")
+	}
+	if filter.Since != nil {
+		s = s.Where(sq.GtOrEq{"run.enqueuetime": filter.Since.UnixNano()})
+	}
+	if filter.Until != nil {
+		s = s.Where(sq.LtOrEq{"run.enqueuetime": filter.Until.UnixNano()})
+	}
+
+	return s
+}
+
+// likeEscaper escapes the like pattern special chars so the value is matched
+// literally by a like with "escape '\'"
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, filter *types.RunsFilter, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
+	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, filter, groups, lastRun, startRunID, limit, sortOrder, false)
 
 	q, args, err := s.ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
@@ -1294,8 +1432,8 @@ func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, groups []string, lastRun bool,
 	return fetchRuns(tx, q, args...)
 }
 
-func (r *ReadDB) GetRunsFilteredOST(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, groups, lastRun, startRunID, limit, sortOrder, true)
+func (r *ReadDB) GetRunsFilteredOST(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, filter *types.RunsFilter, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
+	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, filter, groups, lastRun, startRunID, limit, sortOrder, true)
 
 	q, args, err := s.ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
@@ -1306,6 +1444,63 @@ func (r *ReadDB) GetRunsFilteredOST(tx *db.Tx, groups []string, lastRun bool, ph
 	return fetchRuns(tx, q, args...)
 }
 
+// GetRunGroupsOST returns the groups of the runs saved in the objectstorage
+func (r *ReadDB) GetRunGroupsOST(tx *db.Tx) ([]string, error) {
+	q, args, err := sb.Select("distinct grouppath").From("run_ost").OrderBy("grouppath asc").ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []string{}
+	for rows.Next() {
+		var groupPath string
+		if err := rows.Scan(&groupPath); err != nil {
+			return nil, errors.Errorf("failed to scan rows: %w", err)
+		}
+		// remove the ending slash added when inserting the run
+		groups = append(groups, strings.TrimSuffix(groupPath, "/"))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// GetRunIDsOST returns the ids of all the runs saved in the objectstorage
+func (r *ReadDB) GetRunIDsOST(tx *db.Tx) ([]string, error) {
+	q, args, err := sb.Select("id").From("run_ost").OrderBy("id asc").ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runIDs := []string{}
+	for rows.Next() {
+		var runID string
+		if err := rows.Scan(&runID); err != nil {
+			return nil, errors.Errorf("failed to scan rows: %w", err)
+		}
+		runIDs = append(runIDs, runID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return runIDs, nil
+}
+
 func (r *ReadDB) GetRun(tx *db.Tx, runID string) (*types.Run, error) {
 	run, err := r.getRun(tx, runID, false)
 	if err != nil {
@@ -0,0 +1,232 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+func setupReadDB(t *testing.T, dir string) *ReadDB {
+	r, err := NewReadDB(context.Background(), zap.NewNop(), dir, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	r.SetInitialized(true)
+	return r
+}
+
+func TestGetRunsFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := setupReadDB(t, dir)
+
+	now := time.Now()
+	at := func(hours int) *time.Time {
+		t := now.Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+
+	// active runs are saved in the run tables, archived runs in the run_ost
+	// tables
+	activeRuns := []*types.Run{
+		{ID: "run01", Group: "/project/projectid01", Phase: types.RunPhaseRunning, Name: "build", EnqueueTime: at(-3), Annotations: map[string]string{"commit_sha": "abc123", "ref": "refs/heads/master"}},
+		{ID: "run02", Group: "/project/projectid01", Phase: types.RunPhaseQueued, Name: "test", EnqueueTime: at(-1), Annotations: map[string]string{"commit_sha": "abd456", "ref": "refs/heads/feature_01"}},
+	}
+	archivedRuns := []*types.Run{
+		{ID: "run03", Group: "/project/projectid01", Phase: types.RunPhaseFinished, Name: "build", EnqueueTime: at(-5), Annotations: map[string]string{"commit_sha": "abc789", "ref": "refs/heads/featureX01"}},
+		{ID: "run04", Group: "/project/projectid02", Phase: types.RunPhaseFinished, Name: "build", EnqueueTime: at(-2), Annotations: map[string]string{"commit_sha": "a%c000", "ref": "refs/heads/master"}},
+	}
+
+	err = r.rdb.Do(func(tx *db.Tx) error {
+		for _, run := range activeRuns {
+			data, err := json.Marshal(run)
+			if err != nil {
+				return err
+			}
+			if err := insertRun(tx, run, data); err != nil {
+				return err
+			}
+		}
+		for _, run := range archivedRuns {
+			data, err := json.Marshal(run)
+			if err != nil {
+				return err
+			}
+			if err := r.insertRunOST(tx, run, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		phase  []types.RunPhase
+		filter *types.RunsFilter
+		out    []string
+	}{
+		{
+			name: "test no filter",
+			out:  []string{"run01", "run02", "run03", "run04"},
+		},
+		{
+			name:   "test filter by name",
+			filter: &types.RunsFilter{Name: "build"},
+			out:    []string{"run01", "run03", "run04"},
+		},
+		{
+			name:   "test filter by annotation on active and archived runs",
+			filter: &types.RunsFilter{Annotations: map[string]string{"ref": "refs/heads/master"}},
+			out:    []string{"run01", "run04"},
+		},
+		{
+			name:   "test filter by multiple annotations",
+			filter: &types.RunsFilter{Annotations: map[string]string{"ref": "refs/heads/master", "commit_sha": "abc123"}},
+			out:    []string{"run01"},
+		},
+		{
+			name:   "test filter by annotation prefix",
+			filter: &types.RunsFilter{AnnotationPrefixes: map[string]string{"commit_sha": "abc"}},
+			out:    []string{"run01", "run03"},
+		},
+		{
+			name:   "test filter by annotation prefix with like wildcard %",
+			filter: &types.RunsFilter{AnnotationPrefixes: map[string]string{"commit_sha": "a%c"}},
+			out:    []string{"run04"},
+		},
+		{
+			name:   "test filter by annotation prefix with like wildcard _",
+			filter: &types.RunsFilter{AnnotationPrefixes: map[string]string{"ref": "refs/heads/feature_"}},
+			out:    []string{"run02"},
+		},
+		{
+			name:   "test filter by time range",
+			filter: &types.RunsFilter{Since: at(-4), Until: at(-2)},
+			out:    []string{"run01", "run04"},
+		},
+		{
+			name:   "test filter by name and group",
+			groups: []string{"/project/projectid01"},
+			filter: &types.RunsFilter{Name: "build"},
+			out:    []string{"run01", "run03"},
+		},
+		{
+			name:   "test filter with active phase doesn't return archived runs",
+			phase:  []types.RunPhase{types.RunPhaseRunning},
+			filter: &types.RunsFilter{Name: "build"},
+			out:    []string{"run01"},
+		},
+		{
+			name:   "test filter without matches",
+			filter: &types.RunsFilter{Name: "build", Annotations: map[string]string{"ref": "refs/heads/feature_01"}},
+			out:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs []*types.Run
+			err := r.Do(func(tx *db.Tx) error {
+				var err error
+				runs, err = r.GetRuns(tx, tt.groups, false, tt.phase, nil, tt.filter, "", 10, types.SortOrderAsc)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			out := []string{}
+			for _, run := range runs {
+				out = append(out, run.ID)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("runs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewReadDBOldSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// create a db with the previous schema, without the run name and enqueue
+	// time and the run annotations
+	odb, err := db.NewDB(db.Sqlite3, filepath.Join(dir, "db"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := odb.Create([]string{
+		"create table run (id varchar, grouppath varchar, phase varchar, result varchar, PRIMARY KEY (id, grouppath, phase))",
+		"create table run_ost (id varchar, grouppath varchar, phase varchar, result varchar, PRIMARY KEY (id, grouppath, phase))",
+	}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if hasCurrentSchema(odb) {
+		t.Fatalf("expected old schema")
+	}
+	odb.Close()
+
+	r := setupReadDB(t, dir)
+	if !hasCurrentSchema(r.rdb) {
+		t.Fatalf("expected current schema")
+	}
+
+	// the recreated db must be usable
+	run := &types.Run{ID: "run01", Group: "/project/projectid01", Phase: types.RunPhaseFinished, Name: "build", Annotations: map[string]string{"ref": "refs/heads/master"}}
+	err = r.rdb.Do(func(tx *db.Tx) error {
+		data, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		return r.insertRunOST(tx, run, data)
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var id string
+	err = r.Do(func(tx *db.Tx) error {
+		return tx.QueryRow("select id from runannotation_ost where annotation = $1", "ref").Scan(&id)
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if id != "run01" {
+		t.Fatalf("expected run annotation for run %q, got %q", "run01", id)
+	}
+}
@@ -29,11 +29,14 @@ import (
 	"agola.io/agola/internal/services/runservice/action"
 	"agola.io/agola/internal/services/runservice/api"
 	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/logindex"
 	"agola.io/agola/internal/services/runservice/readdb"
 	"agola.io/agola/internal/services/runservice/types"
 	"agola.io/agola/internal/util"
 
+	units "github.com/docker/go-units"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	etcdclientv3 "go.etcd.io/etcd/clientv3"
 	"go.uber.org/zap/zapcore"
 )
@@ -67,12 +70,15 @@ func (s *Runservice) etcdPinger(ctx context.Context) error {
 }
 
 type Runservice struct {
-	c      *config.Runservice
-	e      *etcd.Store
-	ost    *objectstorage.ObjStorage
-	dm     *datamanager.DataManager
-	readDB *readdb.ReadDB
-	ah     *action.ActionHandler
+	c        *config.Runservice
+	e        *etcd.Store
+	ost      *objectstorage.ObjStorage
+	dm       *datamanager.DataManager
+	readDB   *readdb.ReadDB
+	logIndex *logindex.LogIndex
+	ah       *action.ActionHandler
+
+	cacheMaxSize int64
 }
 
 func NewRunservice(ctx context.Context, c *config.Runservice) (*Runservice, error) {
@@ -95,6 +101,13 @@ func NewRunservice(ctx context.Context, c *config.Runservice) (*Runservice, erro
 		ost: ost,
 	}
 
+	if c.RunCacheMaxSize != "" {
+		s.cacheMaxSize, err = units.RAMInBytes(c.RunCacheMaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	dmConf := &datamanager.DataManagerConfig{
 		BasePath: "rundata",
 		E:        e,
@@ -117,6 +130,12 @@ func NewRunservice(ctx context.Context, c *config.Runservice) (*Runservice, erro
 	}
 	s.readDB = readDB
 
+	logIndex, err := logindex.NewLogIndex(logger, filepath.Join(c.DataDir, "logindex"), readDB, ost, dm)
+	if err != nil {
+		return nil, err
+	}
+	s.logIndex = logIndex
+
 	ah := action.NewActionHandler(logger, e, readDB, ost, dm)
 	s.ah = ah
 
@@ -157,6 +176,7 @@ func (s *Runservice) Run(ctx context.Context) error {
 	}
 
 	go func() { errCh <- s.readDB.Run(ctx) }()
+	go s.logIndex.Run(ctx)
 
 	ch := make(chan *types.ExecutorTask)
 
@@ -168,11 +188,21 @@ func (s *Runservice) Run(ctx context.Context) error {
 	archivesHandler := api.NewArchivesHandler(logger, s.ost)
 	cacheHandler := api.NewCacheHandler(logger, s.ost)
 	cacheCreateHandler := api.NewCacheCreateHandler(logger, s.ost)
+	logUploadHandler := api.NewLogUploadHandler(logger, s.ah)
+	archiveUploadHandler := api.NewArchiveUploadHandler(logger, s.ah)
 
 	// api from clients
 	executorDeleteHandler := api.NewExecutorDeleteHandler(logger, s.ah)
+	executorsHandler := api.NewExecutorsHandler(logger, s.ah)
+	executorCordonHandler := api.NewExecutorCordonHandler(logger, s.ah)
+	executorDrainHandler := api.NewExecutorDrainHandler(logger, s.ah)
+
+	cachesHandler := api.NewCachesHandler(logger, s.ah)
+	cachesDeleteHandler := api.NewCachesDeleteHandler(logger, s.ah)
+	cacheDeleteHandler := api.NewCacheDeleteHandler(logger, s.ah)
 
 	logsHandler := api.NewLogsHandler(logger, s.e, s.ost, s.dm)
+	logSearchHandler := api.NewLogSearchHandler(logger, s.logIndex)
 
 	runHandler := api.NewRunHandler(logger, s.e, s.dm, s.readDB)
 	runTaskActionsHandler := api.NewRunTaskActionsHandler(logger, s.ah)
@@ -180,30 +210,46 @@ func (s *Runservice) Run(ctx context.Context) error {
 	runActionsHandler := api.NewRunActionsHandler(logger, s.ah)
 	runCreateHandler := api.NewRunCreateHandler(logger, s.ah)
 	runEventsHandler := api.NewRunEventsHandler(logger, s.e, s.ost, s.dm)
+	runExportHandler := api.NewRunExportHandler(logger, s.ah)
+	runImportHandler := api.NewRunImportHandler(logger, s.ah)
 
 	changeGroupsUpdateTokensHandler := api.NewChangeGroupsUpdateTokensHandler(logger, s.readDB)
 
 	router := mux.NewRouter()
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter()
 
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
 	// don't return 404 on a call to an undefined handler but 400 to distinguish between a non existent resource and a wrong method
 	apirouter.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadRequest) })
 
 	apirouter.Handle("/executor/{executorid}", executorStatusHandler).Methods("POST")
 	apirouter.Handle("/executor/{executorid}", executorDeleteHandler).Methods("DELETE")
+	apirouter.Handle("/executor/{executorid}/cordon", executorCordonHandler).Methods("PUT", "DELETE")
+	apirouter.Handle("/executor/{executorid}/drain", executorDrainHandler).Methods("GET", "PUT")
 	apirouter.Handle("/executor/{executorid}/tasks", executorTasksHandler).Methods("GET")
 	apirouter.Handle("/executor/{executorid}/tasks/{taskid}", executorTaskHandler).Methods("GET")
 	apirouter.Handle("/executor/{executorid}/tasks/{taskid}", executorTaskStatusHandler).Methods("POST")
-	apirouter.Handle("/executor/archives", archivesHandler).Methods("GET")
+	apirouter.Handle("/executor/archives", archivesHandler).Methods("GET", "HEAD")
+	apirouter.Handle("/executor/archives", archiveUploadHandler).Methods("PUT")
+	apirouter.Handle("/executor/logs", logUploadHandler).Methods("PUT")
 	apirouter.Handle("/executor/caches/{key}", cacheHandler).Methods("HEAD")
 	apirouter.Handle("/executor/caches/{key}", cacheHandler).Methods("GET")
 	apirouter.Handle("/executor/caches/{key}", cacheCreateHandler).Methods("POST")
+	apirouter.Handle("/executors", executorsHandler).Methods("GET")
+
+	apirouter.Handle("/caches", cachesHandler).Methods("GET")
+	apirouter.Handle("/caches", cachesDeleteHandler).Methods("DELETE")
+	apirouter.Handle("/caches/{key}", cacheDeleteHandler).Methods("DELETE")
 
 	apirouter.Handle("/logs", logsHandler).Methods("GET")
+	apirouter.Handle("/logs/search", logSearchHandler).Methods("GET")
 
 	apirouter.Handle("/runs/events", runEventsHandler).Methods("GET")
+	apirouter.Handle("/runs/import", runImportHandler).Methods("POST")
 	apirouter.Handle("/runs/{runid}", runHandler).Methods("GET")
 	apirouter.Handle("/runs/{runid}/actions", runActionsHandler).Methods("PUT")
+	apirouter.Handle("/runs/{runid}/export", runExportHandler).Methods("GET")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}/actions", runTaskActionsHandler).Methods("PUT")
 	apirouter.Handle("/runs", runsHandler).Methods("GET")
 	apirouter.Handle("/runs", runCreateHandler).Methods("POST")
@@ -222,8 +268,14 @@ func (s *Runservice) Run(ctx context.Context) error {
 	go s.fetcherLoop(ctx)
 	go s.finishedRunsArchiverLoop(ctx)
 	go s.compactChangeGroupsLoop(ctx)
-	go s.cacheCleanerLoop(ctx, s.c.RunCacheExpireInterval)
+	go s.cacheCleanerLoop(ctx, s.c.RunCacheExpireInterval, s.cacheMaxSize)
+	go s.runsCleanerLoop(ctx, &types.RunRetentionPolicy{
+		KeepLast:   s.c.RunRetention.KeepLast,
+		MaxAge:     s.c.RunRetention.MaxAge,
+		KeepTagged: s.c.RunRetention.KeepTagged,
+	})
 	go s.executorTaskUpdateHandler(ctx, ch)
+	go s.metricsUpdaterLoop(ctx)
 
 	go s.etcdPingerLoop(ctx)
 
@@ -21,15 +21,17 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
-	"strconv"
+	"strings"
 	"time"
 
 	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
 	"agola.io/agola/internal/etcd"
 	slog "agola.io/agola/internal/log"
 	ostypes "agola.io/agola/internal/objectstorage/types"
 	"agola.io/agola/internal/runconfig"
 	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/readdb"
 	"agola.io/agola/internal/services/runservice/store"
 	"agola.io/agola/internal/services/runservice/types"
 	"agola.io/agola/internal/util"
@@ -42,9 +44,17 @@ import (
 )
 
 const (
-	cacheCleanerInterval = 1 * 24 * time.Hour
+	cacheCleanerInterval = 1 * time.Hour
+	runsCleanerInterval  = 1 * time.Hour
 
 	defaultExecutorNotAliveInterval = 60 * time.Second
+
+	// maxExecutorLossReschedules is the max number of times a task is
+	// rescheduled after its executor was lost
+	maxExecutorLossReschedules = 3
+
+	// runGroupTypeTag is the group type of the runs created for a git tag
+	runGroupTypeTag = "tag"
 )
 
 var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
@@ -226,7 +236,7 @@ func (s *Runservice) submitRunTasks(ctx context.Context, r *types.Run, rc *types
 	for _, rt := range tasks {
 		rct := rc.Tasks[rt.ID]
 
-		executor, err := s.chooseExecutor(ctx, rct)
+		executor, err := s.chooseExecutor(ctx, rt, rct)
 		if err != nil {
 			return err
 		}
@@ -261,12 +271,22 @@ func (s *Runservice) submitRunTasks(ctx context.Context, r *types.Run, rc *types
 
 // chooseExecutor chooses the executor to schedule the task on. Now it's a very simple/dumb selection
 // TODO(sgotti) improve this to use executor statistic, labels (arch type) etc...
-func (s *Runservice) chooseExecutor(ctx context.Context, rct *types.RunConfigTask) (*types.Executor, error) {
+func (s *Runservice) chooseExecutor(ctx context.Context, rt *types.RunTask, rct *types.RunConfigTask) (*types.Executor, error) {
 	executors, err := store.GetExecutors(ctx, s.e)
 	if err != nil {
 		return nil, err
 	}
-	return chooseExecutor(executors, rct), nil
+
+	// never schedule a task again on an executor lost while executing it
+	availableExecutors := []*types.Executor{}
+	for _, e := range executors {
+		if util.StringInSlice(rt.FencedExecutors, e.ID) {
+			continue
+		}
+		availableExecutors = append(availableExecutors, e)
+	}
+
+	return chooseExecutor(availableExecutors, rct), nil
 }
 
 func chooseExecutor(executors []*types.Executor, rct *types.RunConfigTask) *types.Executor {
@@ -283,6 +303,11 @@ func chooseExecutor(executors []*types.Executor, rct *types.RunConfigTask) *type
 			continue
 		}
 
+		// skip cordoned or shutting down executors
+		if !e.Schedulable() {
+			continue
+		}
+
 		// skip executor provileged containers are required but not allowed
 		if requiresPrivilegedContainers && !e.AllowPrivilegedContainers {
 			continue
@@ -335,11 +360,6 @@ func (s *Runservice) genExecutorTask(ctx context.Context, r *types.Run, rt *type
 	// run config Environment variables ovverride every other environment variable
 	mergeEnv(environment, rc.Environment)
 
-	cachePrefix := store.OSTRootGroup(r.Group)
-	if rc.CacheGroup != "" {
-		cachePrefix = rc.CacheGroup
-	}
-
 	et := &types.ExecutorTask{
 		// The executorTask ID must be the same as the runTask ID so we can detect if
 		// there's already an executorTask scheduled for that run task and we can get
@@ -349,18 +369,23 @@ func (s *Runservice) genExecutorTask(ctx context.Context, r *types.Run, rt *type
 		TaskName:    rct.Name,
 		Arch:        rct.Runtime.Arch,
 		Containers:  rct.Runtime.Containers,
+		NetworkMode: rct.Runtime.NetworkMode,
+		K8s:         rct.Runtime.K8s,
 		Environment: environment,
 		WorkingDir:  rct.WorkingDir,
 		Shell:       rct.Shell,
 		User:        rct.User,
 		Steps:       rct.Steps,
-		CachePrefix: cachePrefix,
+		CachePrefix: store.CachePrefix(rc),
+		Attempt:     rt.Attempt,
 		Status: types.ExecutorTaskStatus{
 			Phase:      types.ExecutorTaskPhaseNotStarted,
 			Steps:      make([]*types.ExecutorTaskStepStatus, len(rct.Steps)),
 			ExecutorID: executor.ID,
 		},
 		DockerRegistriesAuth: rct.DockerRegistriesAuth,
+		MaxLogSize:           rct.MaxLogSize,
+		FailOnLogTruncation:  rct.FailOnLogTruncation,
 	}
 
 	for i := range et.Status.Steps {
@@ -502,6 +527,8 @@ func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.Ru
 
 	prevPhase := r.Phase
 	prevResult := r.Result
+	prevTasksWaitingApproval := r.TasksWaitingApproval()
+	prevTasksStatus := runTasksStatus(r)
 
 	activeExecutorTasks, err := s.runActiveExecutorTasks(ctx, r.ID)
 	if err != nil {
@@ -512,14 +539,27 @@ func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.Ru
 		return err
 	}
 
+	newTasksWaitingApproval := []string{}
+	for _, rtID := range r.TasksWaitingApproval() {
+		if !util.StringInSlice(prevTasksWaitingApproval, rtID) {
+			newTasksWaitingApproval = append(newTasksWaitingApproval, rtID)
+		}
+	}
+
 	var runEvent *types.RunEvent
-	// detect changes to phase and result and set related events
-	if prevPhase != r.Phase || prevResult != r.Result {
+	// detect changes to phase and result or new tasks waiting approval and set
+	// related events
+	phaseChanged := prevPhase != r.Phase || prevResult != r.Result
+	if phaseChanged || len(newTasksWaitingApproval) > 0 {
 		var err error
 		runEvent, err = common.NewRunEvent(ctx, s.e, r.ID, r.Phase, r.Result)
 		if err != nil {
 			return err
 		}
+		if len(newTasksWaitingApproval) > 0 {
+			runEvent.TasksWaitingApproval = newTasksWaitingApproval
+		}
+		runEvent.TasksOnly = !phaseChanged
 	}
 
 	r, err = store.AtomicPutRun(ctx, s.e, r, runEvent, nil)
@@ -546,7 +586,19 @@ func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.Ru
 		if err != nil {
 			return err
 		}
-		r, err = store.AtomicPutRun(ctx, s.e, r, nil, nil)
+
+		// emit an event for tasks that changed status (skipped or cancelled)
+		var runEvent *types.RunEvent
+		if changedTasks := changedRunTasks(prevTasksStatus, r, rc); len(changedTasks) > 0 {
+			runEvent, err = common.NewRunEvent(ctx, s.e, r.ID, r.Phase, r.Result)
+			if err != nil {
+				return err
+			}
+			runEvent.Tasks = changedTasks
+			runEvent.TasksOnly = true
+		}
+
+		r, err = store.AtomicPutRun(ctx, s.e, r, runEvent, nil)
 		if err != nil {
 			return err
 		}
@@ -654,17 +706,59 @@ func (s *Runservice) handleExecutorTaskUpdate(ctx context.Context, et *types.Exe
 		return errors.Errorf("cannot get run config %q: %w", r.ID, err)
 	}
 
+	prevTasksStatus := runTasksStatus(r)
 	if err := s.updateRunTaskStatus(ctx, et, r); err != nil {
 		return err
 	}
-	r, err = store.AtomicPutRun(ctx, s.e, r, nil, nil)
+
+	var runEvent *types.RunEvent
+	if changedTasks := changedRunTasks(prevTasksStatus, r, rc); len(changedTasks) > 0 {
+		runEvent, err = common.NewRunEvent(ctx, s.e, r.ID, r.Phase, r.Result)
+		if err != nil {
+			return err
+		}
+		runEvent.Tasks = changedTasks
+		runEvent.TasksOnly = true
+	}
+
+	r, err = store.AtomicPutRun(ctx, s.e, r, runEvent, nil)
 	if err != nil {
 		return err
 	}
 
+	if rt, ok := r.Tasks[et.ID]; ok {
+		observeRunTaskMetrics(prevTasksStatus[et.ID], r, rc, rt)
+	}
+
 	return s.scheduleRun(ctx, r, rc)
 }
 
+func runTasksStatus(r *types.Run) map[string]types.RunTaskStatus {
+	tasksStatus := make(map[string]types.RunTaskStatus, len(r.Tasks))
+	for id, rt := range r.Tasks {
+		tasksStatus[id] = rt.Status
+	}
+	return tasksStatus
+}
+
+// changedRunTasks returns the run tasks whose status is different from the
+// provided previous status
+func changedRunTasks(prevTasksStatus map[string]types.RunTaskStatus, r *types.Run, rc *types.RunConfig) []*types.RunEventTask {
+	changedTasks := []*types.RunEventTask{}
+	for id, rt := range r.Tasks {
+		if prevTasksStatus[id] == rt.Status {
+			continue
+		}
+		changedTask := &types.RunEventTask{ID: id, Status: rt.Status}
+		if rct, ok := rc.Tasks[id]; ok {
+			changedTask.Name = rct.Name
+		}
+		changedTasks = append(changedTasks, changedTask)
+	}
+	sort.Slice(changedTasks, func(i, j int) bool { return changedTasks[i].ID < changedTasks[j].ID })
+	return changedTasks
+}
+
 func (s *Runservice) updateRunTaskStatus(ctx context.Context, et *types.ExecutorTask, r *types.Run) error {
 	log.Debugf("et: %s", util.Dump(et))
 
@@ -673,6 +767,11 @@ func (s *Runservice) updateRunTaskStatus(ctx context.Context, et *types.Executor
 		return errors.Errorf("no such run task with id %s for run %s", et.ID, r.ID)
 	}
 
+	if util.StringInSlice(rt.FencedExecutors, et.Status.ExecutorID) {
+		log.Warnf("ignoring executor task %s update from fenced executor %s", et.ID, et.Status.ExecutorID)
+		return nil
+	}
+
 	rt.StartTime = et.Status.StartTime
 	rt.EndTime = et.Status.EndTime
 
@@ -737,6 +836,16 @@ func (s *Runservice) updateRunTaskStatus(ctx context.Context, et *types.Executor
 		rt.Steps[i].Phase = s.Phase
 		rt.Steps[i].StartTime = s.StartTime
 		rt.Steps[i].EndTime = s.EndTime
+		rt.Steps[i].LogTruncated = s.LogTruncated
+	}
+
+	if len(et.Status.Annotations) > 0 {
+		if rt.Annotations == nil {
+			rt.Annotations = map[string]string{}
+		}
+		for k, v := range et.Status.Annotations {
+			rt.Annotations[k] = v
+		}
 	}
 
 	return nil
@@ -831,14 +940,29 @@ func (s *Runservice) executorTaskCleaner(ctx context.Context, et *types.Executor
 	}
 
 	if !et.Status.Phase.IsFinished() {
-		// if the executor doesn't exists anymore mark the not finished executor tasks as failed
 		executor, err := store.GetExecutor(ctx, s.e, et.Status.ExecutorID)
 		if err != nil && err != etcd.ErrKeyNotFound {
 			return err
 		}
+
+		// the executor is lost when it doesn't exist anymore or it isn't
+		// reporting its status
+		executorLost := executor == nil || executor.LastStatusUpdateTime.Add(defaultExecutorNotAliveInterval).Before(time.Now())
+		if executorLost {
+			rescheduled, err := s.rescheduleExecutorTask(ctx, et)
+			if err != nil {
+				return err
+			}
+			if rescheduled {
+				return nil
+			}
+		}
+
+		// if the executor doesn't exists anymore mark the not finished executor tasks as failed
 		if executor == nil {
 			log.Warnf("executor with id %q doesn't exist. marking executor task %q as failed", et.Status.ExecutorID, et.ID)
 			et.Status.Phase = types.ExecutorTaskPhaseFailed
+			et.FailError = "executor deleted"
 			if _, err := store.AtomicPutExecutorTask(ctx, s.e, et); err != nil {
 				return err
 			}
@@ -847,6 +971,88 @@ func (s *Runservice) executorTaskCleaner(ctx context.Context, et *types.Executor
 	return nil
 }
 
+// rescheduleExecutorTask reschedules an executor task whose executor was lost
+// if its run task allows it. The run task is reset to not started and the lost
+// executor is fenced, then the executor task is removed so the runs scheduler
+// will submit a new attempt to another executor. Since the executor task is
+// removed and the lost executor can't receive it again, every update from the
+// lost executor will be rejected keeping the at most once execution.
+// It returns false if the executor task must not be rescheduled.
+func (s *Runservice) rescheduleExecutorTask(ctx context.Context, et *types.ExecutorTask) (bool, error) {
+	r, _, err := store.GetRun(ctx, s.e, et.RunID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	// don't reschedule tasks of runs that are stopping or already have a result
+	if r.Stop || r.Result.IsSet() {
+		return false, nil
+	}
+	rt, ok := r.Tasks[et.ID]
+	if !ok {
+		return false, errors.Errorf("no such run task with id %s for run %s", et.ID, r.ID)
+	}
+
+	rc, err := store.OSTGetRunConfig(s.dm, r.ID)
+	if err != nil {
+		return false, errors.Errorf("cannot get run config %q: %w", r.ID, err)
+	}
+	rct, ok := rc.Tasks[rt.ID]
+	if !ok {
+		return false, errors.Errorf("no such run config task with id %s for run config %s", rt.ID, rc.ID)
+	}
+	if !rct.RescheduleOnExecutorLoss {
+		return false, nil
+	}
+
+	// the run task could have already been reset by a previous reschedule that
+	// failed to remove the executor task
+	if !util.StringInSlice(rt.FencedExecutors, et.Status.ExecutorID) {
+		if rt.Attempt >= maxExecutorLossReschedules {
+			log.Warnf("executor task %q reached the max number of reschedules", et.ID)
+			return false, nil
+		}
+
+		log.Infof("executor %q lost, rescheduling executor task %q", et.Status.ExecutorID, et.ID)
+		resetRunTask(rt)
+		rt.Attempt++
+		rt.FencedExecutors = append(rt.FencedExecutors, et.Status.ExecutorID)
+
+		if _, err := store.AtomicPutRun(ctx, s.e, r, nil, nil); err != nil {
+			return false, err
+		}
+	}
+
+	if err := store.DeleteExecutorTask(ctx, s.e, et.ID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// resetRunTask resets the run task status to not started
+func resetRunTask(rt *types.RunTask) {
+	rt.Status = types.RunTaskStatusNotStarted
+	rt.StartTime = nil
+	rt.EndTime = nil
+
+	rt.SetupStep = types.RunTaskStep{
+		Phase:    types.ExecutorTaskPhaseNotStarted,
+		LogPhase: types.RunTaskFetchPhaseNotStarted,
+	}
+	for i := range rt.Steps {
+		rt.Steps[i] = &types.RunTaskStep{
+			Phase:    types.ExecutorTaskPhaseNotStarted,
+			LogPhase: types.RunTaskFetchPhaseNotStarted,
+		}
+	}
+	for i := range rt.WorkspaceArchivesPhase {
+		rt.WorkspaceArchivesPhase[i] = types.RunTaskFetchPhaseNotStarted
+	}
+}
+
 func (s *Runservice) runTasksUpdaterLoop(ctx context.Context) {
 	for {
 		log.Debugf("runTasksUpdater")
@@ -959,16 +1165,7 @@ func (s *Runservice) fetchLog(ctx context.Context, rt *types.RunTask, setup bool
 		return errors.Errorf("received http status: %d", r.StatusCode)
 	}
 
-	size := int64(-1)
-	sizeStr := r.Header.Get("Content-Length")
-	if sizeStr != "" {
-		size, err = strconv.ParseInt(sizeStr, 10, 64)
-		if err != nil {
-			return errors.Errorf("failed to parse content length %q", sizeStr)
-		}
-	}
-
-	return s.ost.WriteObject(logPath, r.Body, size, false)
+	return store.OSTWriteCompressedObject(s.ost, logPath, r.Body)
 }
 
 func (s *Runservice) finishSetupLogPhase(ctx context.Context, runID, runTaskID string) error {
@@ -1110,16 +1307,7 @@ func (s *Runservice) fetchArchive(ctx context.Context, rt *types.RunTask, stepnu
 		return errors.Errorf("received http status: %d", r.StatusCode)
 	}
 
-	size := int64(-1)
-	sizeStr := r.Header.Get("Content-Length")
-	if sizeStr != "" {
-		size, err = strconv.ParseInt(sizeStr, 10, 64)
-		if err != nil {
-			return errors.Errorf("failed to parse content length %q", sizeStr)
-		}
-	}
-
-	return s.ost.WriteObject(path, r.Body, size, false)
+	return store.OSTWriteHashedObject(s.ost, path, store.OSTRunTaskArchiveHashPath(rt.ID, stepnum), r.Body)
 }
 
 func (s *Runservice) fetchTaskArchives(ctx context.Context, runID string, rt *types.RunTask) {
@@ -1355,9 +1543,9 @@ func (s *Runservice) runOSTArchiver(ctx context.Context, r *types.Run) error {
 	return nil
 }
 
-func (s *Runservice) cacheCleanerLoop(ctx context.Context, cacheExpireInterval time.Duration) {
+func (s *Runservice) cacheCleanerLoop(ctx context.Context, cacheExpireInterval time.Duration, cacheMaxSize int64) {
 	for {
-		if err := s.cacheCleaner(ctx, cacheExpireInterval); err != nil {
+		if err := s.cacheCleaner(ctx, cacheExpireInterval, cacheMaxSize); err != nil {
 			log.Errorf("err: %+v", err)
 		}
 
@@ -1371,7 +1559,11 @@ func (s *Runservice) cacheCleanerLoop(ctx context.Context, cacheExpireInterval t
 	}
 }
 
-func (s *Runservice) cacheCleaner(ctx context.Context, cacheExpireInterval time.Duration) error {
+// cacheCleaner removes the caches not used since cacheExpireInterval, the least
+// recently used caches of the cache prefixes exceeding their quota and, when
+// cacheMaxSize is greater than 0, the least recently used caches to keep the
+// total caches size under cacheMaxSize
+func (s *Runservice) cacheCleaner(ctx context.Context, cacheExpireInterval time.Duration, cacheMaxSize int64) error {
 	log.Debugf("cacheCleaner")
 
 	session, err := concurrency.NewSession(s.e.Client(), concurrency.WithTTL(5), concurrency.WithContext(ctx))
@@ -1390,18 +1582,267 @@ func (s *Runservice) cacheCleaner(ctx context.Context, cacheExpireInterval time.
 	}
 	defer func() { _ = m.Unlock(ctx) }()
 
+	caches, err := store.OSTGetCaches(s.ost, "")
+	if err != nil {
+		return err
+	}
+
+	validCaches := []*types.Cache{}
+	for _, c := range caches {
+		if c.LastUsed.Add(cacheExpireInterval).Before(time.Now()) {
+			if err := store.OSTDeleteCache(s.ost, c.Key); err != nil {
+				log.Warnf("failed to delete cache %q: %v", c.Key, err)
+			}
+			continue
+		}
+		validCaches = append(validCaches, c)
+	}
+
+	quotas, err := store.OSTGetCacheQuotas(s.ost)
+	if err != nil {
+		return err
+	}
+	evicted := map[string]struct{}{}
+	for cachePrefix, quota := range quotas {
+		prefixCaches := []*types.Cache{}
+		for _, c := range validCaches {
+			if strings.HasPrefix(c.Key, cachePrefix+"-") {
+				prefixCaches = append(prefixCaches, c)
+			}
+		}
+		for _, c := range store.CachesToEvict(prefixCaches, quota) {
+			log.Infof("evicting cache %q, quota for cache prefix %q exceeded", c.Key, cachePrefix)
+			if err := store.OSTDeleteCache(s.ost, c.Key); err != nil {
+				log.Warnf("failed to delete cache %q: %v", c.Key, err)
+				continue
+			}
+			evicted[c.Key] = struct{}{}
+		}
+	}
+	if len(evicted) > 0 {
+		remainingCaches := []*types.Cache{}
+		for _, c := range validCaches {
+			if _, ok := evicted[c.Key]; !ok {
+				remainingCaches = append(remainingCaches, c)
+			}
+		}
+		validCaches = remainingCaches
+	}
+
+	if cacheMaxSize > 0 {
+		for _, c := range store.CachesToEvict(validCaches, cacheMaxSize) {
+			log.Infof("evicting cache %q, caches max size exceeded", c.Key)
+			if err := store.OSTDeleteCache(s.ost, c.Key); err != nil {
+				log.Warnf("failed to delete cache %q: %v", c.Key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Runservice) runsCleanerLoop(ctx context.Context, defaultPolicy *types.RunRetentionPolicy) {
+	for {
+		if err := s.runsCleaner(ctx, defaultPolicy); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		time.Sleep(runsCleanerInterval)
+	}
+}
+
+// runsCleaner removes the archived runs not retained by their group retention
+// policy with their logs and workspace archives
+func (s *Runservice) runsCleaner(ctx context.Context, defaultPolicy *types.RunRetentionPolicy) error {
+	log.Debugf("runsCleaner")
+
+	session, err := concurrency.NewSession(s.e.Client(), concurrency.WithTTL(5), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	m := concurrency.NewMutex(session, common.EtcdRunsCleanerLockKey)
+
+	if err := m.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() { _ = m.Unlock(ctx) }()
+
+	var groups []string
+	err = s.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		groups, err = s.readDB.GetRunGroupsOST(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// a recreated run reuses the task ids of the tasks that weren't restarted.
+	// Collect the task ids of the active runs since their logs and archives
+	// markers could be not yet written
+	activeRuns, err := store.GetRuns(ctx, s.e)
+	if err != nil {
+		return err
+	}
+	activeTasks := map[string]struct{}{}
+	for _, r := range activeRuns {
+		for _, rt := range r.Tasks {
+			activeTasks[rt.ID] = struct{}{}
+		}
+	}
+
+	for _, group := range groups {
+		if err := s.runGroupCleaner(ctx, group, defaultPolicy, activeTasks); err != nil {
+			log.Errorf("failed to clean runs of group %q: %+v", group, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Runservice) runGroupCleaner(ctx context.Context, group string, defaultPolicy *types.RunRetentionPolicy, activeTasks map[string]struct{}) error {
+	var runsData []*readdb.RunData
+	err := s.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		runsData, err = s.readDB.GetRunsFilteredOST(tx, []string{group}, false, nil, nil, nil, "", 0, types.SortOrderDesc)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(runsData) == 0 {
+		return nil
+	}
+
+	// use the retention policy of the latest run since it's the current
+	// project policy
+	rc, err := store.OSTGetRunConfig(s.dm, runsData[0].ID)
+	if err != nil {
+		return errors.Errorf("cannot get run config %q: %w", runsData[0].ID, err)
+	}
+	policy := defaultPolicy
+	if rc.RunRetention != nil {
+		policy = rc.RunRetention
+	}
+	if !policy.Enabled() {
+		return nil
+	}
+
+	now := time.Now()
+	for i, rd := range runsData {
+		if i < policy.KeepLast {
+			continue
+		}
+		r, err := store.OSTGetRun(s.dm, rd.ID)
+		if err != nil {
+			return errors.Errorf("cannot get run %q: %w", rd.ID, err)
+		}
+		if retainRun(r, policy, now) {
+			continue
+		}
+		if err := s.deleteArchivedRun(ctx, r, activeTasks); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retainRun reports if the run, not already kept by the policy KeepLast rule,
+// must be kept
+func retainRun(r *types.Run, policy *types.RunRetentionPolicy, now time.Time) bool {
+	if policy.KeepTagged && isTagRunGroup(r.Group) {
+		return true
+	}
+	if policy.MaxAge > 0 {
+		t := r.EndTime
+		if t == nil {
+			t = r.EnqueueTime
+		}
+		if t != nil && t.Add(policy.MaxAge).After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTagRunGroup reports if the run group contains a tag group type
+func isTagRunGroup(group string) bool {
+	pl := util.PathList(group)
+	for i := 0; i < len(pl); i += 2 {
+		if pl[i] == runGroupTypeTag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Runservice) deleteArchivedRun(ctx context.Context, r *types.Run, activeTasks map[string]struct{}) error {
+	log.Infof("deleting run %q", r.ID)
+
+	// first remove the run markers so, if the run removal fails, the task data
+	// won't be removed while the run still exists
+	for _, rt := range r.Tasks {
+		for _, p := range []string{store.OSTRunTaskLogsRunPath(rt.ID, r.ID), store.OSTRunTaskArchivesRunPath(rt.ID, r.ID)} {
+			if err := s.ost.DeleteObject(p); err != nil && err != ostypes.ErrNotExist {
+				return err
+			}
+		}
+	}
+
+	actions := []*datamanager.Action{
+		store.OSTDeleteRunAction(r.ID),
+		store.OSTDeleteRunConfigAction(r.ID),
+	}
+	if _, err := s.dm.WriteWal(ctx, actions, nil); err != nil {
+		return err
+	}
+
+	// remove the task data only when no other run (created recreating this
+	// run) references the same task
+	for _, rt := range r.Tasks {
+		if _, ok := activeTasks[rt.ID]; ok {
+			continue
+		}
+		if err := s.deleteUnusedTaskData(store.OSTRunTaskLogsRunsDir(rt.ID), store.OSTRunTaskLogsDataDir(rt.ID)); err != nil {
+			log.Warnf("failed to delete task %q logs: %v", rt.ID, err)
+		}
+		if err := s.deleteUnusedTaskData(store.OSTRunTaskArchivesRunsDir(rt.ID), store.OSTRunTaskArchivesDataDir(rt.ID)); err != nil {
+			log.Warnf("failed to delete task %q archives: %v", rt.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteUnusedTaskData deletes all the objects inside dataDir if runsDir
+// doesn't contain any run marker
+func (s *Runservice) deleteUnusedTaskData(runsDir, dataDir string) error {
 	doneCh := make(chan struct{})
 	defer close(doneCh)
-	for object := range s.ost.List(store.OSTCacheDir()+"/", "", true, doneCh) {
+
+	for object := range s.ost.List(runsDir+"/", "", true, doneCh) {
 		if object.Err != nil {
 			return object.Err
 		}
-		if object.LastModified.Add(cacheExpireInterval).Before(time.Now()) {
-			if err := s.ost.DeleteObject(object.Path); err != nil {
-				if err != ostypes.ErrNotExist {
-					log.Warnf("failed to delete cache object %q: %v", object.Path, err)
-				}
-			}
+		// another run uses this task data
+		return nil
+	}
+
+	for object := range s.ost.List(dataDir+"/", "", true, doneCh) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if err := s.ost.DeleteObject(object.Path); err != nil && err != ostypes.ErrNotExist {
+			return err
 		}
 	}
 
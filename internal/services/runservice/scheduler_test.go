@@ -563,6 +563,20 @@ func TestChooseExecutor(t *testing.T) {
 		return e
 	}()
 
+	executorCordoned := func() *types.Executor {
+		e := executorOK.DeepCopy()
+		e.ID = "executorCordoned"
+		e.Cordoned = true
+		return e
+	}()
+
+	executorShuttingDown := func() *types.Executor {
+		e := executorOK.DeepCopy()
+		e.ID = "executorShuttingDown"
+		e.ShuttingDown = true
+		return e
+	}()
+
 	executorOKMultipleArchs := func() *types.Executor {
 		e := executorOK.DeepCopy()
 		e.ID = "executorOKMultipleArchs"
@@ -625,6 +639,24 @@ func TestChooseExecutor(t *testing.T) {
 			rct:       rct,
 			out:       nil,
 		},
+		{
+			name:      "test single executor cordoned",
+			executors: []*types.Executor{executorCordoned},
+			rct:       rct,
+			out:       nil,
+		},
+		{
+			name:      "test single executor shutting down",
+			executors: []*types.Executor{executorShuttingDown},
+			rct:       rct,
+			out:       nil,
+		},
+		{
+			name:      "test cordoned executor is skipped",
+			executors: []*types.Executor{executorCordoned, executorShuttingDown, executorOK},
+			rct:       rct,
+			out:       executorOK,
+		},
 		{
 			name: "test single executor with different arch",
 			executors: func() []*types.Executor {
@@ -673,3 +705,148 @@ func TestChooseExecutor(t *testing.T) {
 		})
 	}
 }
+
+func TestChangedRunTasks(t *testing.T) {
+	rc := &types.RunConfig{
+		Tasks: map[string]*types.RunConfigTask{
+			"task01": {ID: "task01", Name: "task01"},
+			"task02": {ID: "task02", Name: "task02"},
+			"task03": {ID: "task03", Name: "task03"},
+		},
+	}
+	r := &types.Run{
+		Tasks: map[string]*types.RunTask{
+			"task01": {ID: "task01", Status: types.RunTaskStatusRunning},
+			"task02": {ID: "task02", Status: types.RunTaskStatusNotStarted},
+			"task03": {ID: "task03", Status: types.RunTaskStatusNotStarted},
+		},
+	}
+
+	prevTasksStatus := runTasksStatus(r)
+
+	if out := changedRunTasks(prevTasksStatus, r, rc); len(out) != 0 {
+		t.Fatalf("expected no changed tasks, got: %v", out)
+	}
+
+	r.Tasks["task01"].Status = types.RunTaskStatusSuccess
+	r.Tasks["task03"].Status = types.RunTaskStatusSkipped
+
+	expected := []*types.RunEventTask{
+		{ID: "task01", Name: "task01", Status: types.RunTaskStatusSuccess},
+		{ID: "task03", Name: "task03", Status: types.RunTaskStatusSkipped},
+	}
+	out := changedRunTasks(prevTasksStatus, r, rc)
+	if diff := cmp.Diff(expected, out); diff != "" {
+		t.Fatalf("changed tasks mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResetRunTask(t *testing.T) {
+	now := time.Now()
+	rt := &types.RunTask{
+		ID:        "task01",
+		Status:    types.RunTaskStatusRunning,
+		StartTime: &now,
+		SetupStep: types.RunTaskStep{
+			Phase:     types.ExecutorTaskPhaseSuccess,
+			LogPhase:  types.RunTaskFetchPhaseFinished,
+			StartTime: &now,
+			EndTime:   &now,
+		},
+		Steps: []*types.RunTaskStep{
+			{Phase: types.ExecutorTaskPhaseSuccess, LogPhase: types.RunTaskFetchPhaseFinished, StartTime: &now, EndTime: &now},
+			{Phase: types.ExecutorTaskPhaseRunning, LogPhase: types.RunTaskFetchPhaseNotStarted, StartTime: &now},
+		},
+		WorkspaceArchives:      []int{0},
+		WorkspaceArchivesPhase: []types.RunTaskFetchPhase{types.RunTaskFetchPhaseFinished},
+		Attempt:                1,
+		FencedExecutors:        []string{"executor01"},
+	}
+
+	expected := &types.RunTask{
+		ID:     "task01",
+		Status: types.RunTaskStatusNotStarted,
+		SetupStep: types.RunTaskStep{
+			Phase:    types.ExecutorTaskPhaseNotStarted,
+			LogPhase: types.RunTaskFetchPhaseNotStarted,
+		},
+		Steps: []*types.RunTaskStep{
+			{Phase: types.ExecutorTaskPhaseNotStarted, LogPhase: types.RunTaskFetchPhaseNotStarted},
+			{Phase: types.ExecutorTaskPhaseNotStarted, LogPhase: types.RunTaskFetchPhaseNotStarted},
+		},
+		WorkspaceArchives:      []int{0},
+		WorkspaceArchivesPhase: []types.RunTaskFetchPhase{types.RunTaskFetchPhaseNotStarted},
+		// attempts and fenced executors are kept
+		Attempt:         1,
+		FencedExecutors: []string{"executor01"},
+	}
+
+	resetRunTask(rt)
+	if diff := cmp.Diff(expected, rt); diff != "" {
+		t.Fatalf("run task mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRetainRun(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-1 * time.Hour)
+	old := now.Add(-48 * time.Hour)
+
+	tests := []struct {
+		name   string
+		run    *types.Run
+		policy *types.RunRetentionPolicy
+		out    bool
+	}{
+		{
+			name:   "test old run",
+			run:    &types.Run{Group: "/project/projectid/branch/master", EndTime: &old},
+			policy: &types.RunRetentionPolicy{KeepLast: 10, MaxAge: 24 * time.Hour},
+			out:    false,
+		},
+		{
+			name:   "test recent run",
+			run:    &types.Run{Group: "/project/projectid/branch/master", EndTime: &recent},
+			policy: &types.RunRetentionPolicy{MaxAge: 24 * time.Hour},
+			out:    true,
+		},
+		{
+			name:   "test recent run without max age",
+			run:    &types.Run{Group: "/project/projectid/branch/master", EndTime: &recent},
+			policy: &types.RunRetentionPolicy{KeepLast: 10},
+			out:    false,
+		},
+		{
+			name:   "test recent run without end time",
+			run:    &types.Run{Group: "/project/projectid/branch/master", EnqueueTime: &recent},
+			policy: &types.RunRetentionPolicy{MaxAge: 24 * time.Hour},
+			out:    true,
+		},
+		{
+			name:   "test old tagged run",
+			run:    &types.Run{Group: "/project/projectid/tag/v1.0.0", EndTime: &old},
+			policy: &types.RunRetentionPolicy{MaxAge: 24 * time.Hour, KeepTagged: true},
+			out:    true,
+		},
+		{
+			name:   "test old tagged run not kept",
+			run:    &types.Run{Group: "/project/projectid/tag/v1.0.0", EndTime: &old},
+			policy: &types.RunRetentionPolicy{MaxAge: 24 * time.Hour},
+			out:    false,
+		},
+		{
+			name:   "test old branch named tag",
+			run:    &types.Run{Group: "/project/projectid/branch/tag", EndTime: &old},
+			policy: &types.RunRetentionPolicy{MaxAge: 24 * time.Hour, KeepTagged: true},
+			out:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := retainRun(tt.run, tt.policy, now); out != tt.out {
+				t.Fatalf("expected %t, got %t", tt.out, out)
+			}
+		})
+	}
+}
@@ -15,15 +15,26 @@
 package store
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"path"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/objectstorage"
 	ostypes "agola.io/agola/internal/objectstorage/types"
 	"agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/types"
@@ -151,6 +162,10 @@ func OSTRunTaskArchivePath(rtID string, step int) string {
 	return path.Join(OSTRunTaskArchivesDataDir(rtID), fmt.Sprintf("%d.tar", step))
 }
 
+func OSTRunTaskArchiveHashPath(rtID string, step int) string {
+	return path.Join(OSTRunTaskArchivesDataDir(rtID), fmt.Sprintf("%d.tar.sha256", step))
+}
+
 func OSTRunTaskArchivesRunPath(rtID, runID string) string {
 	return path.Join(OSTRunTaskArchivesRunsDir(rtID), runID)
 }
@@ -163,11 +178,272 @@ func OSTCachePath(key string) string {
 	return path.Join(OSTCacheDir(), fmt.Sprintf("%s.tar", key))
 }
 
+// OSTCacheHashDir is outside the caches dir so the caches prefix matching won't
+// return the hash objects
+func OSTCacheHashDir() string {
+	return "cachehashes"
+}
+
+func OSTCacheHashPath(key string) string {
+	return path.Join(OSTCacheHashDir(), fmt.Sprintf("%s.sha256", key))
+}
+
 func OSTCacheKey(p string) string {
 	base := path.Base(p)
 	return strings.TrimSuffix(base, path.Ext(base))
 }
 
+// OSTCacheAccessDir contains an empty object per cache, rewritten every time
+// the cache is used, whose modification time is the cache last access time
+func OSTCacheAccessDir() string {
+	return "cacheaccess"
+}
+
+func OSTCacheAccessPath(key string) string {
+	return path.Join(OSTCacheAccessDir(), key)
+}
+
+// OSTTouchCache updates the cache last access time
+func OSTTouchCache(ost *objectstorage.ObjStorage, key string) error {
+	return ost.WriteObject(OSTCacheAccessPath(key), bytes.NewReader([]byte{}), 0, false)
+}
+
+// OSTGetCaches returns the caches whose key starts with keyPrefix
+func OSTGetCaches(ost *objectstorage.ObjStorage, keyPrefix string) ([]*types.Cache, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	// list the access objects instead of getting them one by one for every cache
+	accessTimes := map[string]time.Time{}
+	for object := range ost.List(OSTCacheAccessDir()+"/"+keyPrefix, "", true, doneCh) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		accessTimes[path.Base(object.Path)] = object.LastModified
+	}
+
+	caches := []*types.Cache{}
+	for object := range ost.List(OSTCacheDir()+"/"+keyPrefix, "", true, doneCh) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		key := OSTCacheKey(object.Path)
+		cache := &types.Cache{
+			Key:      key,
+			Size:     object.Size,
+			LastUsed: object.LastModified,
+		}
+		// caches saved before the access time tracking don't have an access object
+		if accessTime, ok := accessTimes[key]; ok && accessTime.After(cache.LastUsed) {
+			cache.LastUsed = accessTime
+		}
+		caches = append(caches, cache)
+	}
+
+	return caches, nil
+}
+
+// CachePrefix returns the prefix of the keys of the run config caches
+func CachePrefix(rc *types.RunConfig) string {
+	if rc.CacheGroup != "" {
+		return rc.CacheGroup
+	}
+	return OSTRootGroup(rc.Group)
+}
+
+// OSTCacheQuotasDir contains an object per cache prefix with a quota,
+// containing the quota in bytes
+func OSTCacheQuotasDir() string {
+	return "cachequotas"
+}
+
+func OSTCacheQuotaPath(cachePrefix string) string {
+	return path.Join(OSTCacheQuotasDir(), cachePrefix)
+}
+
+// OSTSetCacheQuota saves the quota of the caches with cachePrefix. A quota of 0
+// removes it
+func OSTSetCacheQuota(ost *objectstorage.ObjStorage, cachePrefix string, quota int64) error {
+	if quota <= 0 {
+		if err := ost.DeleteObject(OSTCacheQuotaPath(cachePrefix)); err != nil && err != ostypes.ErrNotExist {
+			return err
+		}
+		return nil
+	}
+	data := []byte(strconv.FormatInt(quota, 10))
+	return ost.WriteObject(OSTCacheQuotaPath(cachePrefix), bytes.NewReader(data), int64(len(data)), true)
+}
+
+// OSTGetCacheQuotas returns the caches quotas by cache prefix
+func OSTGetCacheQuotas(ost *objectstorage.ObjStorage) (map[string]int64, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	quotas := map[string]int64{}
+	for object := range ost.List(OSTCacheQuotasDir()+"/", "", true, doneCh) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		f, err := ost.ReadObject(object.Path)
+		if err != nil {
+			if err == ostypes.ErrNotExist {
+				continue
+			}
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		quota, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("wrong cache quota in object %q: %w", object.Path, err)
+		}
+		quotas[path.Base(object.Path)] = quota
+	}
+
+	return quotas, nil
+}
+
+// OSTDeleteCache deletes the cache and its related objects
+func OSTDeleteCache(ost *objectstorage.ObjStorage, key string) error {
+	// delete the hash before the cache object so a new cache with the same key
+	// won't be served with a stale hash
+	for _, p := range []string{OSTCacheHashPath(key), OSTCacheAccessPath(key), OSTCachePath(key)} {
+		if err := ost.DeleteObject(p); err != nil && err != ostypes.ErrNotExist {
+			return err
+		}
+	}
+	return nil
+}
+
+// CachesToEvict returns the least recently used caches to remove to keep the
+// total caches size under maxSize
+func CachesToEvict(caches []*types.Cache, maxSize int64) []*types.Cache {
+	var size int64
+	for _, c := range caches {
+		size += c.Size
+	}
+
+	lru := make([]*types.Cache, len(caches))
+	copy(lru, caches)
+	sort.SliceStable(lru, func(i, j int) bool { return lru[i].LastUsed.Before(lru[j].LastUsed) })
+
+	evict := []*types.Cache{}
+	for _, c := range lru {
+		if size <= maxSize {
+			break
+		}
+		evict = append(evict, c)
+		size -= c.Size
+	}
+
+	return evict
+}
+
+// gzipEncodingHeader is written at the start of the gzip compressed objects.
+// Objects without it (saved before the compression was introduced) are read as
+// is
+var gzipEncodingHeader = []byte("agola-content-encoding: gzip\n")
+
+// OSTWriteCompressedObject writes the gzip compressed object prefixed by the
+// content encoding header. Use OSTReadObject to read it.
+func OSTWriteCompressedObject(ost *objectstorage.ObjStorage, p string, r io.Reader) error {
+	pr, pw := io.Pipe()
+	// unblock the compressing goroutine if WriteObject returns without
+	// consuming all the data
+	defer pr.Close()
+
+	go func() {
+		gw := gzip.NewWriter(pw)
+		_, err := io.Copy(gw, r)
+		if err == nil {
+			err = gw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return ost.WriteObject(p, io.MultiReader(bytes.NewReader(gzipEncodingHeader), pr), -1, false)
+}
+
+type objectReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *objectReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// OSTReadObject returns the object content, decompressing it if it was saved
+// with OSTWriteCompressedObject
+func OSTReadObject(ost *objectstorage.ObjStorage, p string) (io.ReadCloser, error) {
+	f, err := ost.ReadObject(p)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(f)
+	header, err := br.Peek(len(gzipEncodingHeader))
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+	if !bytes.Equal(header, gzipEncodingHeader) {
+		return &objectReader{Reader: br, closers: []io.Closer{f}}, nil
+	}
+
+	if _, err := br.Discard(len(gzipEncodingHeader)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	gr, err := gzip.NewReader(br)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &objectReader{Reader: gr, closers: []io.Closer{gr, f}}, nil
+}
+
+// OSTWriteHashedObject writes the compressed object and then an object at
+// hashPath containing the hex encoded sha256 of its uncompressed content. The
+// hash is used as the object etag so the executors can reuse their locally
+// cached archives.
+func OSTWriteHashedObject(ost *objectstorage.ObjStorage, p, hashPath string, r io.Reader) error {
+	h := sha256.New()
+	if err := OSTWriteCompressedObject(ost, p, io.TeeReader(r, h)); err != nil {
+		return err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	return ost.WriteObject(hashPath, strings.NewReader(hash), int64(len(hash)), false)
+}
+
+// OSTReadObjectHash returns the object hash saved at hashPath or an empty
+// string if it doesn't exist
+func OSTReadObjectHash(ost *objectstorage.ObjStorage, hashPath string) (string, error) {
+	f, err := ost.ReadObject(hashPath)
+	if err != nil {
+		if err == ostypes.ErrNotExist {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+
+	hash, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
 func OSTGetRunConfig(dm *datamanager.DataManager, runConfigID string) (*types.RunConfig, error) {
 	rcf, _, err := dm.ReadObject(string(common.DataTypeRunConfig), runConfigID, nil)
 	if err != nil {
@@ -230,6 +506,22 @@ func OSTSaveRunAction(r *types.Run) (*datamanager.Action, error) {
 	return action, nil
 }
 
+func OSTDeleteRunAction(runID string) *datamanager.Action {
+	return &datamanager.Action{
+		ActionType: datamanager.ActionTypeDelete,
+		DataType:   string(common.DataTypeRun),
+		ID:         runID,
+	}
+}
+
+func OSTDeleteRunConfigAction(runConfigID string) *datamanager.Action {
+	return &datamanager.Action{
+		ActionType: datamanager.ActionTypeDelete,
+		DataType:   string(common.DataTypeRunConfig),
+		ID:         runConfigID,
+	}
+}
+
 func GetExecutor(ctx context.Context, e *etcd.Store, executorID string) (*types.Executor, error) {
 	resp, err := e.Get(ctx, common.EtcdExecutorKey(executorID), 0)
 	if err != nil {
@@ -281,6 +573,38 @@ func PutExecutor(ctx context.Context, e *etcd.Store, executor *types.Executor) (
 	return executor, nil
 }
 
+func AtomicPutExecutor(ctx context.Context, e *etcd.Store, executor *types.Executor) (*types.Executor, error) {
+	executorj, err := json.Marshal(executor)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.AtomicPut(ctx, common.EtcdExecutorKey(executor.ID), executorj, executor.Revision, nil)
+	if err != nil {
+		return nil, err
+	}
+	executor.Revision = resp.Header.Revision
+
+	return executor, nil
+}
+
+// UpdateExecutorStatus saves the executor status reported by the executor
+// keeping the values managed by the runservice (like the cordoned state)
+func UpdateExecutorStatus(ctx context.Context, e *etcd.Store, executor *types.Executor) (*types.Executor, error) {
+	curExecutor, err := GetExecutor(ctx, e, executor.ID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return nil, err
+	}
+
+	executor.Revision = 0
+	if curExecutor != nil {
+		executor.Cordoned = curExecutor.Cordoned
+		executor.Revision = curExecutor.Revision
+	}
+
+	return AtomicPutExecutor(ctx, e, executor)
+}
+
 func DeleteExecutor(ctx context.Context, e *etcd.Store, executorID string) error {
 	return e.Delete(ctx, common.EtcdExecutorKey(executorID))
 }
@@ -326,6 +650,12 @@ func UpdateExecutorTaskStatus(ctx context.Context, e *etcd.Store, et *types.Exec
 	//	return nil, errors.Errorf("concurrency exception")
 	//}
 
+	// reject updates from an executor that doesn't own the executor task (i.e.
+	// a lost executor whose task has been rescheduled)
+	if et.Status.ExecutorID != curEt.Status.ExecutorID {
+		return nil, errors.Errorf("executor task %q is not assigned to executor %q", et.ID, et.Status.ExecutorID)
+	}
+
 	curEt.Status = et.Status
 	return AtomicPutExecutorTask(ctx, e, curEt)
 }
@@ -0,0 +1,218 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/posix"
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCachesToEvict(t *testing.T) {
+	now := time.Now()
+
+	caches := []*types.Cache{
+		{Key: "cache01", Size: 100, LastUsed: now.Add(-1 * time.Hour)},
+		{Key: "cache02", Size: 200, LastUsed: now.Add(-3 * time.Hour)},
+		{Key: "cache03", Size: 300, LastUsed: now},
+		{Key: "cache04", Size: 400, LastUsed: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		name    string
+		maxSize int64
+		out     []string
+	}{
+		{
+			name:    "test under max size",
+			maxSize: 1000,
+			out:     []string{},
+		},
+		{
+			name:    "test evict least recently used",
+			maxSize: 900,
+			out:     []string{"cache02"},
+		},
+		{
+			name:    "test evict multiple caches",
+			maxSize: 500,
+			out:     []string{"cache02", "cache04"},
+		},
+		{
+			name:    "test evict all caches",
+			maxSize: 0,
+			out:     []string{"cache02", "cache04", "cache01", "cache03"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := []string{}
+			for _, c := range CachesToEvict(caches, tt.maxSize) {
+				out = append(out, c.Key)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("evicted caches mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompressedObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps, err := posix.New(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(ps, "/")
+
+	data := strings.Repeat("step log line\n", 1000)
+
+	tests := []struct {
+		name  string
+		write func(p string) error
+	}{
+		{
+			name: "test compressed object",
+			write: func(p string) error {
+				return OSTWriteCompressedObject(ost, p, strings.NewReader(data))
+			},
+		},
+		{
+			name: "test uncompressed object",
+			write: func(p string) error {
+				return ost.WriteObject(p, strings.NewReader(data), int64(len(data)), false)
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := fmt.Sprintf("object%d", i)
+			if err := tt.write(p); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			f, err := OSTReadObject(ost, p)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer f.Close()
+			out, err := ioutil.ReadAll(f)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !bytes.Equal(out, []byte(data)) {
+				t.Fatalf("read data doesn't match written data")
+			}
+		})
+	}
+}
+
+func TestOSTGetCaches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps, err := posix.New(dir + "/ost")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(ps, "/")
+
+	for _, key := range []string{"project01-cache01", "project01-cache02", "project02-cache01"} {
+		if err := ost.WriteObject(OSTCachePath(key), bytes.NewReader([]byte("data")), 4, true); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	// project01-cache02 is used after its creation
+	lastUsed := time.Now().Add(1 * time.Hour).Truncate(time.Second)
+	if err := OSTTouchCache(ost, "project01-cache02"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := os.Chtimes(dir+"/ost/data/"+OSTCacheAccessPath("project01-cache02"), lastUsed, lastUsed); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	caches, err := OSTGetCaches(ost, "project01-")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(caches) != 2 {
+		t.Fatalf("expected 2 caches, got %d", len(caches))
+	}
+	for _, c := range caches {
+		if c.Size != 4 {
+			t.Fatalf("expected cache %q size 4, got %d", c.Key, c.Size)
+		}
+		if c.Key == "project01-cache02" && !c.LastUsed.Equal(lastUsed) {
+			t.Fatalf("expected cache %q last used %v, got %v", c.Key, lastUsed, c.LastUsed)
+		}
+		if c.Key == "project01-cache01" && !c.LastUsed.Before(lastUsed) {
+			t.Fatalf("expected cache %q last used before %v, got %v", c.Key, lastUsed, c.LastUsed)
+		}
+	}
+}
+
+func TestOSTCacheQuotas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps, err := posix.New(dir + "/ost")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(ps, "/")
+
+	if err := OSTSetCacheQuota(ost, "project01", 100); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := OSTSetCacheQuota(ost, "project02", 200); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// a 0 quota removes it, also when not existing
+	for _, cachePrefix := range []string{"project02", "project03"} {
+		if err := OSTSetCacheQuota(ost, cachePrefix, 0); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	quotas, err := OSTGetCacheQuotas(ost)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if diff := cmp.Diff(map[string]int64{"project01": 100}, quotas); diff != "" {
+		t.Fatalf("quotas mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"agola.io/agola/internal/common"
@@ -36,6 +37,20 @@ const (
 	SortOrderDesc
 )
 
+// RunsFilter defines additional filters used when searching runs
+type RunsFilter struct {
+	// Name matches the runs with the provided name
+	Name string
+	// Annotations matches the runs having all the provided annotations
+	Annotations map[string]string
+	// AnnotationPrefixes matches the runs having all the provided annotations
+	// with a value starting with the provided prefix
+	AnnotationPrefixes map[string]string
+	// Since and Until match the runs enqueued in the provided time range
+	Since *time.Time
+	Until *time.Time
+}
+
 type RunBundle struct {
 	Run *Run
 	Rc  *RunConfig
@@ -246,6 +261,13 @@ type RunTask struct {
 
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
+
+	// Attempt is the number of times the task has been rescheduled after its
+	// executor was lost
+	Attempt int `json:"attempt,omitempty"`
+	// FencedExecutors are the executors lost while executing the task. The task
+	// won't be scheduled again on them and their updates will be ignored
+	FencedExecutors []string `json:"fenced_executors,omitempty"`
 }
 
 func (rt *RunTask) LogsFetchFinished() bool {
@@ -278,6 +300,10 @@ type RunTaskStep struct {
 
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
+
+	// LogTruncated reports if the step log was truncated since it exceeded
+	// the max log size
+	LogTruncated bool `json:"log_truncated,omitempty"`
 }
 
 // RunConfig
@@ -317,6 +343,14 @@ type RunConfig struct {
 
 	// CacheGroup is the cache group where the run caches belongs
 	CacheGroup string `json:"cache_group,omitempty"`
+
+	// CacheQuota is the max size in bytes of all the caches of the cache group,
+	// enforced by the cache cleaner. 0 means no quota
+	CacheQuota int64 `json:"cache_quota,omitempty"`
+
+	// RunRetention is the retention policy for the runs of the run group. When
+	// nil the global retention policy is used
+	RunRetention *RunRetentionPolicy `json:"run_retention,omitempty"`
 }
 
 func (rc *RunConfig) DeepCopy() *RunConfig {
@@ -327,6 +361,23 @@ func (rc *RunConfig) DeepCopy() *RunConfig {
 	return nrc.(*RunConfig)
 }
 
+// RunRetentionPolicy defines which archived runs of a run group are kept. A run
+// is kept when at least one of the rules matches it.
+type RunRetentionPolicy struct {
+	// KeepLast is the number of latest runs to keep for every run group
+	KeepLast int `json:"keep_last,omitempty"`
+	// MaxAge keeps the runs younger than MaxAge
+	MaxAge time.Duration `json:"max_age,omitempty"`
+	// KeepTagged always keeps the runs of a tag run group
+	KeepTagged bool `json:"keep_tagged,omitempty"`
+}
+
+// Enabled reports if the policy will remove some runs. When no KeepLast or
+// MaxAge rule is defined all the runs are kept.
+func (p *RunRetentionPolicy) Enabled() bool {
+	return p != nil && (p.KeepLast > 0 || p.MaxAge > 0)
+}
+
 type RunConfigTask struct {
 	Level                int                             `json:"level,omitempty"`
 	ID                   string                          `json:"id,omitempty"`
@@ -340,8 +391,16 @@ type RunConfigTask struct {
 	Steps                Steps                           `json:"steps,omitempty"`
 	IgnoreFailure        bool                            `json:"ignore_failure,omitempty"`
 	NeedsApproval        bool                            `json:"needs_approval,omitempty"`
+	CommitStatus         bool                            `json:"commit_status,omitempty"`
 	Skip                 bool                            `json:"skip,omitempty"`
 	DockerRegistriesAuth map[string]DockerRegistryAuth   `json:"docker_registries_auth"`
+	// RescheduleOnExecutorLoss reports if the task must be executed again on
+	// another executor when its executor is lost
+	RescheduleOnExecutorLoss bool `json:"reschedule_on_executor_loss,omitempty"`
+	// MaxLogSize is the max size in bytes of every step log. 0 means use the
+	// executor default. It's capped by the executor max log size
+	MaxLogSize          int64 `json:"max_log_size,omitempty"`
+	FailOnLogTruncation bool  `json:"fail_on_log_truncation,omitempty"`
 }
 
 func (rct *RunConfigTask) DeepCopy() *RunConfigTask {
@@ -376,6 +435,8 @@ type DockerRegistryAuthType string
 const (
 	DockerRegistryAuthTypeBasic       DockerRegistryAuthType = "basic"
 	DockerRegistryAuthTypeEncodedAuth DockerRegistryAuthType = "encodedauth"
+	DockerRegistryAuthTypeECR         DockerRegistryAuthType = "ecr"
+	DockerRegistryAuthTypeOAuth2      DockerRegistryAuthType = "oauth2"
 )
 
 type DockerRegistryAuth struct {
@@ -388,13 +449,47 @@ type DockerRegistryAuth struct {
 	// encoded auth string
 	Auth string `json:"auth"`
 
-	// future auths like aws ecr auth
+	// aws ecr auth
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+
+	// oauth2 auth
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
 }
 
+type NetworkMode string
+
+const (
+	NetworkModeShared   NetworkMode = "shared"
+	NetworkModeIsolated NetworkMode = "isolated"
+)
+
 type Runtime struct {
-	Type       RuntimeType  `json:"type,omitempty"`
-	Arch       common.Arch  `json:"arch,omitempty"`
-	Containers []*Container `json:"containers,omitempty"`
+	Type        RuntimeType  `json:"type,omitempty"`
+	Arch        common.Arch  `json:"arch,omitempty"`
+	Containers  []*Container `json:"containers,omitempty"`
+	NetworkMode NetworkMode  `json:"network_mode,omitempty"`
+	K8s         *RuntimeK8s  `json:"k8s,omitempty"`
+}
+
+type RuntimeK8s struct {
+	NodeSelector       map[string]string `json:"node_selector,omitempty"`
+	Tolerations        []*K8sToleration  `json:"tolerations,omitempty"`
+	ServiceAccountName string            `json:"service_account_name,omitempty"`
+	PriorityClassName  string            `json:"priority_class_name,omitempty"`
+	Annotations        map[string]string `json:"annotations,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+}
+
+type K8sToleration struct {
+	Key               string `json:"key,omitempty"`
+	Operator          string `json:"operator,omitempty"`
+	Value             string `json:"value,omitempty"`
+	Effect            string `json:"effect,omitempty"`
+	TolerationSeconds *int64 `json:"toleration_seconds,omitempty"`
 }
 
 type Step interface{}
@@ -465,6 +560,8 @@ type ExecutorTask struct {
 	TaskName    string            `json:"task_name,omitempty"`
 	Arch        common.Arch       `json:"arch,omitempty"`
 	Containers  []*Container      `json:"containers,omitempty"`
+	NetworkMode NetworkMode       `json:"network_mode,omitempty"`
+	K8s         *RuntimeK8s       `json:"k8s,omitempty"`
 	Environment map[string]string `json:"environment,omitempty"`
 	WorkingDir  string            `json:"working_dir,omitempty"`
 	Shell       string            `json:"shell,omitempty"`
@@ -487,6 +584,36 @@ type ExecutorTask struct {
 
 	// Stop is used to signal from the scheduler when the task must be stopped
 	Stop bool `json:"stop,omitempty"`
+
+	// Attempt is the run task attempt executed by this executor task
+	Attempt int `json:"attempt,omitempty"`
+
+	// MaxLogSize is the max size in bytes of every step log. When 0 or greater
+	// than the executor configured max log size, the latter is used
+	MaxLogSize int64 `json:"max_log_size,omitempty"`
+	// FailOnLogTruncation makes a step fail when its log is truncated
+	FailOnLogTruncation bool `json:"fail_on_log_truncation,omitempty"`
+}
+
+// Cache is a task cache saved in the object storage
+type Cache struct {
+	Key  string `json:"key,omitempty"`
+	Size int64  `json:"size,omitempty"`
+	// LastUsed is the last time the cache was saved or restored
+	LastUsed time.Time `json:"last_used,omitempty"`
+}
+
+// LogMatch is a task step log line matching a log search
+type LogMatch struct {
+	// ID identifies the match in the log index, it's used as the start of the
+	// next search when paging the results
+	ID     int64  `json:"id"`
+	RunID  string `json:"run_id,omitempty"`
+	TaskID string `json:"task_id,omitempty"`
+	Step   int    `json:"step"`
+	// Line is the line number, starting from 1
+	Line    int    `json:"line"`
+	Content string `json:"content,omitempty"`
 }
 
 type ExecutorTaskStatus struct {
@@ -498,6 +625,32 @@ type ExecutorTaskStatus struct {
 
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
+
+	// Annotations are the task annotations reported by the task steps. They
+	// are added to the run task annotations
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+const (
+	// TaskAnnotationsFileEnv is the environment variable, defined in every
+	// run step, with the path of the file where the steps can report task
+	// annotations as "key=value" lines
+	TaskAnnotationsFileEnv = "AGOLA_TASK_ANNOTATIONS_FILE"
+
+	// TaskAnnotationFailedTests is the task annotation reporting the number
+	// of failed tests
+	TaskAnnotationFailedTests = "failed_tests"
+)
+
+// ValidReportedTaskAnnotation reports if the task annotation can be reported
+// by the task steps
+func ValidReportedTaskAnnotation(key, value string) bool {
+	switch key {
+	case TaskAnnotationFailedTests:
+		n, err := strconv.Atoi(value)
+		return err == nil && n >= 0
+	}
+	return false
 }
 
 type ExecutorTaskStepStatus struct {
@@ -507,14 +660,30 @@ type ExecutorTaskStepStatus struct {
 	EndTime   *time.Time `json:"end_time,omitempty"`
 
 	ExitCode int `json:"exit_code,omitempty"`
+
+	LogTruncated bool `json:"log_truncated,omitempty"`
 }
 
+type ImagePullPolicy string
+
+const (
+	ImagePullPolicyAlways       ImagePullPolicy = "always"
+	ImagePullPolicyIfNotPresent ImagePullPolicy = "if_not_present"
+	ImagePullPolicyNever        ImagePullPolicy = "never"
+)
+
 type Container struct {
 	Image       string            `json:"image,omitempty"`
 	Environment map[string]string `json:"environment,omitempty"`
 	User        string            `json:"user,omitempty"`
 	Privileged  bool              `json:"privileged"`
 	Entrypoint  string            `json:"entrypoint"`
+	// ImagePullPolicy defines when the container image is pulled. If empty the
+	// image is always pulled
+	ImagePullPolicy ImagePullPolicy `json:"image_pull_policy,omitempty"`
+	// Alias is the name the container is reachable at from the other
+	// containers when using the isolated network mode
+	Alias string `json:"alias,omitempty"`
 }
 
 type WorkspaceOperation struct {
@@ -632,12 +801,25 @@ type Executor struct {
 	// SiblingExecutors are all the executors in the ExecutorGroup
 	SiblingsExecutors []string `json:"siblings_executors,omitempty"`
 
+	// Cordoned is set by an administrator to exclude the executor from the
+	// executors chosen to run new tasks. It's kept across executor status
+	// updates
+	Cordoned bool `json:"cordoned,omitempty"`
+	// ShuttingDown is reported by the executor when it's terminating. Like a
+	// cordoned executor it won't be chosen to run new tasks
+	ShuttingDown bool `json:"shutting_down,omitempty"`
+
 	LastStatusUpdateTime time.Time `json:"last_status_update_time,omitempty"`
 
 	// internal values not saved
 	Revision int64 `json:"-"`
 }
 
+// Schedulable reports if the executor can be chosen to run new tasks
+func (e *Executor) Schedulable() bool {
+	return !e.Cordoned && !e.ShuttingDown
+}
+
 func (e *Executor) DeepCopy() *Executor {
 	ne, err := copystructure.Copy(e)
 	if err != nil {
@@ -651,4 +833,20 @@ type RunEvent struct {
 	RunID    string
 	Phase    RunPhase
 	Result   RunResult
+
+	// TasksWaitingApproval are the run tasks that started waiting for an
+	// approval
+	TasksWaitingApproval []string
+	// Tasks are the run tasks whose status changed
+	Tasks []*RunEventTask
+	// TasksOnly is true when the run phase and result didn't change and the
+	// event was emitted only because of run tasks changes (new tasks waiting
+	// for an approval or tasks status changes)
+	TasksOnly bool
+}
+
+type RunEventTask struct {
+	ID     string
+	Name   string
+	Status RunTaskStatus
 }
@@ -0,0 +1,31 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var runQueueWaitHistogram = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "agola_scheduler_run_queue_wait_seconds",
+		Help:    "Time between a run being queued and being started by the scheduler",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	},
+)
+
+func init() {
+	prometheus.MustRegister(runQueueWaitHistogram)
+}
@@ -16,8 +16,10 @@ package scheduler
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"time"
 
 	slog "agola.io/agola/internal/log"
@@ -26,6 +28,8 @@ import (
 	rsapi "agola.io/agola/internal/services/runservice/api"
 	"agola.io/agola/internal/util"
 
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	errors "golang.org/x/xerrors"
@@ -97,6 +101,8 @@ func (s *Scheduler) scheduleRun(ctx context.Context, groupID string) error {
 		log.Debugf("changegroups: %s", runningRunsResponse.ChangeGroupsUpdateToken)
 		if _, err := s.runserviceClient.StartRun(ctx, run.ID, runningRunsResponse.ChangeGroupsUpdateToken); err != nil {
 			log.Errorf("failed to start run %s: %v", run.ID, err)
+		} else if run.EnqueueTime != nil {
+			runQueueWaitHistogram.Observe(time.Since(*run.EnqueueTime).Seconds())
 		}
 	}
 
@@ -199,8 +205,48 @@ func (s *Scheduler) Run(ctx context.Context) error {
 	go s.scheduleLoop(ctx)
 	go s.approveLoop(ctx)
 
-	<-ctx.Done()
-	log.Infof("scheduler exiting")
+	// the web server is optional and only used to expose the metrics
+	if s.c.Web.ListenAddress == "" {
+		<-ctx.Done()
+		log.Infof("scheduler exiting")
+
+		return nil
+	}
+
+	router := mux.NewRouter()
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	var tlsConfig *tls.Config
+	if s.c.Web.TLS {
+		var err error
+		tlsConfig, err = util.NewTLSConfig(s.c.Web.TLSCertFile, s.c.Web.TLSKeyFile, "", false)
+		if err != nil {
+			log.Errorf("err: %+v", err)
+			return err
+		}
+	}
+
+	httpServer := http.Server{
+		Addr:      s.c.Web.ListenAddress,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+
+	lerrCh := make(chan error)
+	go func() {
+		lerrCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Infof("scheduler exiting")
+		httpServer.Close()
+	case err := <-lerrCh:
+		if err != nil {
+			log.Errorf("http server listen error: %+v", err)
+			return err
+		}
+	}
 
 	return nil
 }
@@ -36,6 +36,9 @@ const (
 	ConfigTypeRemoteSource ConfigType = "remotesource"
 	ConfigTypeSecret       ConfigType = "secret"
 	ConfigTypeVariable     ConfigType = "variable"
+	ConfigTypeRunWebhook   ConfigType = "runwebhook"
+
+	ConfigTypeChatNotification ConfigType = "chatnotification"
 )
 
 type Visibility string
@@ -307,6 +310,27 @@ type Project struct {
 	// Webhooksecret is the secret passed to git sources that support a
 	// secret/token for signing or verifying the webhook payload
 	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	// CacheQuota is the max size in bytes of the project caches. When exceeded
+	// the least recently used caches are removed by the runservice cache
+	// cleaner. A changed quota is applied starting from the next project run.
+	// 0 means no quota
+	CacheQuota int64 `json:"cache_quota,omitempty"`
+
+	// RunRetention overrides the global run retention policy for the project
+	// runs. When nil the global policy is used
+	RunRetention *RunRetentionPolicy `json:"run_retention,omitempty"`
+}
+
+// RunRetentionPolicy defines which finished runs are kept. A run is kept when
+// at least one of the rules matches it.
+type RunRetentionPolicy struct {
+	// KeepLast is the number of latest runs to keep for every run group
+	KeepLast int `json:"keep_last,omitempty"`
+	// MaxAge keeps the runs younger than MaxAge
+	MaxAge time.Duration `json:"max_age,omitempty"`
+	// KeepTagged always keeps the runs created for a tag
+	KeepTagged bool `json:"keep_tagged,omitempty"`
 }
 
 type SecretType string
@@ -356,6 +380,141 @@ type VariableValue struct {
 	When *When `json:"when,omitempty"`
 }
 
+type RunWebhookEvent string
+
+const (
+	RunWebhookEventRunQueued           RunWebhookEvent = "run_queued"
+	RunWebhookEventRunStarted          RunWebhookEvent = "run_started"
+	RunWebhookEventRunFinished         RunWebhookEvent = "run_finished"
+	RunWebhookEventRunFailed           RunWebhookEvent = "run_failed"
+	RunWebhookEventTaskWaitingApproval RunWebhookEvent = "task_waiting_approval"
+)
+
+func IsValidRunWebhookEvent(e RunWebhookEvent) bool {
+	switch e {
+	case RunWebhookEventRunQueued:
+	case RunWebhookEventRunStarted:
+	case RunWebhookEventRunFinished:
+	case RunWebhookEventRunFailed:
+	case RunWebhookEventTaskWaitingApproval:
+	default:
+		return false
+	}
+	return true
+}
+
+// RunWebhook is an outgoing webhook called by the notification service on run
+// events. Run webhooks defined in a project group are inherited by all its
+// projects and subgroups
+type RunWebhook struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	Parent Parent `json:"parent,omitempty"`
+
+	URL string `json:"url,omitempty"`
+
+	// Secret is used to sign the payload with HMAC-SHA256. The signature is sent
+	// in the X-Agola-Signature header
+	Secret string `json:"secret,omitempty"`
+
+	SkipVerify bool `json:"skip_verify,omitempty"`
+
+	// Events are the events that will trigger the webhook. If empty all the
+	// events will trigger it
+	Events []RunWebhookEvent `json:"events,omitempty"`
+}
+
+func (w *RunWebhook) MatchEvent(e RunWebhookEvent) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, we := range w.Events {
+		if we == e {
+			return true
+		}
+	}
+	return false
+}
+
+type ChatNotificationType string
+
+const (
+	ChatNotificationTypeSlack      ChatNotificationType = "slack"
+	ChatNotificationTypeMattermost ChatNotificationType = "mattermost"
+)
+
+func IsValidChatNotificationType(t ChatNotificationType) bool {
+	return t == ChatNotificationTypeSlack || t == ChatNotificationTypeMattermost
+}
+
+type ChatNotificationEvent string
+
+const (
+	// ChatNotificationEventRunFailed is sent on every failed run
+	ChatNotificationEventRunFailed ChatNotificationEvent = "run_failed"
+	// ChatNotificationEventRunSucceeded is sent on every successful run
+	ChatNotificationEventRunSucceeded ChatNotificationEvent = "run_succeeded"
+	// ChatNotificationEventRunBroken is sent when a run fails and the previous
+	// run of the same group succeeded (or there's no previous run)
+	ChatNotificationEventRunBroken ChatNotificationEvent = "run_broken"
+	// ChatNotificationEventRunFixed is sent when a run succeeds and the previous
+	// run of the same group failed
+	ChatNotificationEventRunFixed ChatNotificationEvent = "run_fixed"
+)
+
+func IsValidChatNotificationEvent(e ChatNotificationEvent) bool {
+	switch e {
+	case ChatNotificationEventRunFailed:
+	case ChatNotificationEventRunSucceeded:
+	case ChatNotificationEventRunBroken:
+	case ChatNotificationEventRunFixed:
+	default:
+		return false
+	}
+	return true
+}
+
+// DefaultChatNotificationEvents are the events used when a chat notification
+// doesn't define them. Only run state changes are sent to avoid noise
+var DefaultChatNotificationEvents = []ChatNotificationEvent{ChatNotificationEventRunBroken, ChatNotificationEventRunFixed}
+
+// ChatNotification is a project chat (slack or mattermost) incoming webhook
+// called by the notification service on run events
+type ChatNotification struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	Parent Parent `json:"parent,omitempty"`
+
+	Type ChatNotificationType `json:"type,omitempty"`
+
+	// SecretName and SecretKey reference the project secret (and its data key)
+	// containing the incoming webhook url
+	SecretName string `json:"secret_name,omitempty"`
+	SecretKey  string `json:"secret_key,omitempty"`
+
+	// Channel overrides the incoming webhook default channel
+	Channel string `json:"channel,omitempty"`
+
+	// Events are the events that will trigger the notification. If empty
+	// DefaultChatNotificationEvents will be used
+	Events []ChatNotificationEvent `json:"events,omitempty"`
+}
+
+func (n *ChatNotification) MatchEvent(e ChatNotificationEvent) bool {
+	events := n.Events
+	if len(events) == 0 {
+		events = DefaultChatNotificationEvents
+	}
+	for _, ne := range events {
+		if ne == e {
+			return true
+		}
+	}
+	return false
+}
+
 type When struct {
 	Branch *WhenConditions `json:"branch,omitempty"`
 	Tag    *WhenConditions `json:"tag,omitempty"`
@@ -0,0 +1,265 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package steplog implements the framed format of the tasks steps logs.
+//
+// A framed log starts with Header followed by a sequence of entries. Every
+// entry is a text line "<unix nanoseconds> <stream> <data length>\n" followed
+// by the entry data. The stream is "-" when unknown (i.e. when the command
+// is executed with a tty). Logs not starting with Header are raw logs
+// written by older executors.
+package steplog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	Header = "\x00agola-steplog-v1\n"
+
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+
+	noStream = "-"
+
+	// maxEntrySize is the max size of a decoded entry data. Longer entries
+	// are returned as multiple entries
+	maxEntrySize = 64 * 1024
+)
+
+// Format is the format used when returning a step log
+type Format string
+
+const (
+	// FormatText is the raw log text
+	FormatText Format = "text"
+	// FormatJSON are json lines of log entries
+	FormatJSON Format = "json"
+)
+
+func IsValidFormat(f Format) bool {
+	return f == FormatText || f == FormatJSON
+}
+
+// Entry is a log entry. Time is nil for raw logs entries
+type Entry struct {
+	Time   *time.Time `json:"time,omitempty"`
+	Stream string     `json:"stream,omitempty"`
+	Data   string     `json:"data"`
+}
+
+// Writer writes framed log entries. Every written line is saved in a
+// different entry.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter writes the log header to w and returns a Writer.
+func NewWriter(w io.Writer) (*Writer, error) {
+	if _, err := io.WriteString(w, Header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteEntry writes data as one entry per line (the last one could be a
+// partial line)
+func (w *Writer) WriteEntry(t time.Time, stream string, data []byte) error {
+	if stream == "" {
+		stream = noStream
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for len(data) > 0 {
+		line := nextLine(data)
+		data = data[len(line):]
+
+		if _, err := fmt.Fprintf(w.w, "%d %s %d\n", t.UnixNano(), stream, len(line)); err != nil {
+			return err
+		}
+		if _, err := w.w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EntrySize returns the size of the framed entries written by WriteEntry for
+// data, entries headers included
+func EntrySize(t time.Time, stream string, data []byte) int {
+	if stream == "" {
+		stream = noStream
+	}
+	// header without the data length: "<unix nanoseconds> <stream> \n"
+	headerSize := len(strconv.FormatInt(t.UnixNano(), 10)) + len(stream) + 3
+
+	size := 0
+	for len(data) > 0 {
+		line := nextLine(data)
+		data = data[len(line):]
+		size += headerSize + len(strconv.Itoa(len(line))) + len(line)
+	}
+	return size
+}
+
+// nextLine returns the first line of data (the last one could be a partial
+// line)
+func nextLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i+1]
+	}
+	return data
+}
+
+// Decoder reads log entries from both framed and raw logs. Entries (or raw
+// lines) longer than maxEntrySize are returned split in multiple entries.
+type Decoder struct {
+	br *bufio.Reader
+
+	detected bool
+	framed   bool
+
+	// time, stream and remaining data size of the current framed entry
+	entryTime   time.Time
+	entryStream string
+	remaining   int
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{br: bufio.NewReaderSize(r, maxEntrySize)}
+}
+
+func (d *Decoder) detect() error {
+	d.detected = true
+	h, err := d.br.Peek(len(Header))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if string(h) == Header {
+		d.framed = true
+		_, err := d.br.Discard(len(Header))
+		return err
+	}
+	return nil
+}
+
+// Next returns the next log entry. It returns io.EOF when there are no more
+// entries.
+func (d *Decoder) Next() (*Entry, error) {
+	if !d.detected {
+		if err := d.detect(); err != nil {
+			return nil, err
+		}
+	}
+
+	if !d.framed {
+		// a line longer than the buffer is returned in multiple entries
+		line, err := d.br.ReadSlice('\n')
+		if len(line) > 0 {
+			return &Entry{Data: string(line)}, nil
+		}
+		return nil, err
+	}
+
+	if d.remaining == 0 {
+		if err := d.readEntryHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	size := d.remaining
+	if size > maxEntrySize {
+		size = maxEntrySize
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(d.br, data); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	d.remaining -= size
+
+	t := d.entryTime
+	return &Entry{Time: &t, Stream: d.entryStream, Data: string(data)}, nil
+}
+
+func (d *Decoder) readEntryHeader() error {
+	hb, err := d.br.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF && len(hb) > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if err == bufio.ErrBufferFull {
+			return errors.Errorf("malformed log entry header: too long")
+		}
+		return err
+	}
+	h := string(hb)
+	parts := strings.Split(strings.TrimSuffix(h, "\n"), " ")
+	if len(parts) != 3 {
+		return errors.Errorf("malformed log entry header %q", h)
+	}
+	nsec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return errors.Errorf("malformed log entry time %q: %w", parts[0], err)
+	}
+	size, err := strconv.Atoi(parts[2])
+	if err != nil || size < 0 {
+		return errors.Errorf("malformed log entry size %q", parts[2])
+	}
+
+	d.entryTime = time.Unix(0, nsec).UTC()
+	d.entryStream = ""
+	if parts[1] != noStream {
+		d.entryStream = parts[1]
+	}
+	d.remaining = size
+	return nil
+}
+
+type textReader struct {
+	d   *Decoder
+	buf string
+}
+
+// NewTextReader returns a reader of the raw log text
+func NewTextReader(r io.Reader) io.Reader {
+	return &textReader{d: NewDecoder(r)}
+}
+
+func (r *textReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		e, err := r.d.Next()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = e.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package steplog
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecoder(t *testing.T) {
+	t1 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	var framed bytes.Buffer
+	w, err := NewWriter(&framed)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := w.WriteEntry(t1, "", []byte("line01\nline02\npartial")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := w.WriteEntry(t2, StreamStderr, []byte(" line\n")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		out  []*Entry
+		text string
+	}{
+		{
+			name: "test framed log",
+			in:   framed.String(),
+			out: []*Entry{
+				{Time: &t1, Data: "line01\n"},
+				{Time: &t1, Data: "line02\n"},
+				{Time: &t1, Data: "partial"},
+				{Time: &t2, Stream: StreamStderr, Data: " line\n"},
+			},
+			text: "line01\nline02\npartial line\n",
+		},
+		{
+			name: "test raw log",
+			in:   "line01\nline02\npartial",
+			out: []*Entry{
+				{Data: "line01\n"},
+				{Data: "line02\n"},
+				{Data: "partial"},
+			},
+			text: "line01\nline02\npartial",
+		},
+		{
+			name: "test empty log",
+			in:   "",
+			text: "",
+		},
+		{
+			name: "test empty framed log",
+			in:   Header,
+			text: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []*Entry
+			d := NewDecoder(strings.NewReader(tt.in))
+			for {
+				e, err := d.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				out = append(out, e)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("entries mismatch (-want +got):\n%s", diff)
+			}
+
+			text, err := ioutil.ReadAll(NewTextReader(strings.NewReader(tt.in)))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if string(text) != tt.text {
+				t.Fatalf("got text %q, want %q", text, tt.text)
+			}
+		})
+	}
+}
+
+func TestDecoderTruncatedEntry(t *testing.T) {
+	d := NewDecoder(strings.NewReader(Header + "1 - 10\nshort"))
+	if _, err := d.Next(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got err %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestDecoderLongEntry(t *testing.T) {
+	t1 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := strings.Repeat("x", maxEntrySize*2+10) + "\n"
+
+	var framed bytes.Buffer
+	w, err := NewWriter(&framed)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := w.WriteEntry(t1, StreamStdout, []byte(data)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		out  []*Entry
+	}{
+		{
+			name: "test framed log",
+			in:   framed.String(),
+			out: []*Entry{
+				{Time: &t1, Stream: StreamStdout, Data: data[:maxEntrySize]},
+				{Time: &t1, Stream: StreamStdout, Data: data[maxEntrySize : 2*maxEntrySize]},
+				{Time: &t1, Stream: StreamStdout, Data: data[2*maxEntrySize:]},
+			},
+		},
+		{
+			name: "test raw log",
+			in:   data,
+			out: []*Entry{
+				{Data: data[:maxEntrySize]},
+				{Data: data[maxEntrySize : 2*maxEntrySize]},
+				{Data: data[2*maxEntrySize:]},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []*Entry
+			d := NewDecoder(strings.NewReader(tt.in))
+			for {
+				e, err := d.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				out = append(out, e)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("entries mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecoderHugeEntrySize(t *testing.T) {
+	// the entry size must not be trusted to allocate the entry data
+	d := NewDecoder(strings.NewReader(Header + "1 - 9223372036854775807\nshort"))
+	if _, err := d.Next(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got err %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestEntrySize(t *testing.T) {
+	t1 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, data := range []string{"", "line01\n", "line01\nline02\npartial", strings.Repeat("x", 1000) + "\n"} {
+		for _, stream := range []string{"", StreamStderr} {
+			var buf bytes.Buffer
+			w := &Writer{w: &buf}
+			if err := w.WriteEntry(t1, stream, []byte(data)); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if size := EntrySize(t1, stream, []byte(data)); size != buf.Len() {
+				t.Fatalf("expected entry size %d for %q, got %d", buf.Len(), data, size)
+			}
+		}
+	}
+}
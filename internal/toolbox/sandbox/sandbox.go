@@ -0,0 +1,435 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sandbox implements the init process of the sandbox driver pods.
+//
+// The init process is started by the executor inside new user, mount, pid,
+// network, uts and ipc namespaces. It sets up the pod root filesystem, pivots
+// into it and then serves the exec requests received on a unix socket. Every
+// exec request carries the process stdin, stdout and stderr file descriptors
+// so the executed processes are childs of the init process and inherit all its
+// namespaces.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// ListenerFD is the fd of the unix socket listener passed to the init
+	// process
+	ListenerFD = 3
+	// StatusFD is the fd where the init process will write the setup status
+	StatusFD = 4
+
+	// StatusOK is the status written by the init process when the setup
+	// completed successfully
+	StatusOK = "ok"
+
+	// maxRequestSize is the max size of an exec request
+	maxRequestSize = 1024 * 1024
+
+	oldRootDir = ".oldroot"
+)
+
+// Config is the init process configuration
+type Config struct {
+	// RootFS is the host path of the pod root filesystem
+	RootFS string `json:"rootfs"`
+	// ToolboxDir is the host dir containing the toolbox. It'll be mounted in
+	// InitVolumeDir
+	ToolboxDir    string `json:"toolbox_dir"`
+	InitVolumeDir string `json:"init_volume_dir"`
+	Hostname      string `json:"hostname"`
+}
+
+type ExecRequest struct {
+	Cmd        []string          `json:"cmd"`
+	Env        map[string]string `json:"env"`
+	WorkingDir string            `json:"working_dir"`
+}
+
+type ExecResponse struct {
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Init sets up the pod and serves the exec requests. It must be executed as the
+// root user inside the new namespaces.
+func Init(c *Config) error {
+	status := os.NewFile(StatusFD, "status")
+	lf := os.NewFile(ListenerFD, "listener")
+	l, err := net.FileListener(lf)
+	// close the inherited fd (FileListener uses a dup) so it won't be leaked to
+	// the executed processes
+	lf.Close()
+	if err != nil {
+		err = errors.Errorf("failed to get listener: %w", err)
+		_, _ = status.WriteString(err.Error())
+		status.Close()
+		return err
+	}
+	ul, ok := l.(*net.UnixListener)
+	if !ok {
+		err := errors.Errorf("listener isn't a unix socket listener")
+		_, _ = status.WriteString(err.Error())
+		status.Close()
+		return err
+	}
+
+	if err := setup(c); err != nil {
+		_, _ = status.WriteString(err.Error())
+		status.Close()
+		return err
+	}
+	_, _ = status.WriteString(StatusOK)
+	status.Close()
+
+	s := newServer()
+	go s.reaper()
+
+	for {
+		conn, err := ul.AcceptUnix()
+		if err != nil {
+			return errors.Errorf("accept error: %w", err)
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func setup(c *Config) error {
+	if c.Hostname != "" {
+		if err := syscall.Sethostname([]byte(c.Hostname)); err != nil {
+			return errors.Errorf("failed to set hostname: %w", err)
+		}
+	}
+	if err := loopbackUp(); err != nil {
+		return errors.Errorf("failed to set loopback interface up: %w", err)
+	}
+	if err := setupRootFS(c); err != nil {
+		return errors.Errorf("failed to setup rootfs: %w", err)
+	}
+	return nil
+}
+
+func mount(source, target, fstype string, flags uintptr, data string) error {
+	if err := syscall.Mount(source, target, fstype, flags, data); err != nil {
+		return errors.Errorf("failed to mount %q on %q: %w", source, target, err)
+	}
+	return nil
+}
+
+func setupRootFS(c *Config) error {
+	rootfs := c.RootFS
+
+	// don't propagate our mounts to the host
+	if err := mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+	// pivot_root requires the new root to be a mount point
+	if err := mount(rootfs, rootfs, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+
+	if c.InitVolumeDir != "" {
+		initVolumeDir := filepath.Join(rootfs, filepath.Clean("/"+c.InitVolumeDir))
+		if err := os.MkdirAll(initVolumeDir, 0755); err != nil {
+			return err
+		}
+		if err := mount(c.ToolboxDir, initVolumeDir, "", syscall.MS_BIND, ""); err != nil {
+			return err
+		}
+	}
+
+	procDir := filepath.Join(rootfs, "proc")
+	if err := os.MkdirAll(procDir, 0555); err != nil {
+		return err
+	}
+	if err := mount("proc", procDir, "proc", syscall.MS_NOSUID|syscall.MS_NOEXEC|syscall.MS_NODEV, ""); err != nil {
+		return err
+	}
+
+	if err := setupDev(filepath.Join(rootfs, "dev")); err != nil {
+		return err
+	}
+
+	oldRoot := filepath.Join(rootfs, oldRootDir)
+	if err := os.MkdirAll(oldRoot, 0700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(rootfs, oldRoot); err != nil {
+		return errors.Errorf("failed to pivot root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Unmount("/"+oldRootDir, syscall.MNT_DETACH); err != nil {
+		return errors.Errorf("failed to unmount old root: %w", err)
+	}
+	return os.Remove("/" + oldRootDir)
+}
+
+// setupDev creates a minimal /dev. Since we cannot create device nodes inside
+// a user namespace the host devices are bind mounted.
+func setupDev(devDir string) error {
+	if err := os.MkdirAll(devDir, 0755); err != nil {
+		return err
+	}
+	if err := mount("tmpfs", devDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755"); err != nil {
+		return err
+	}
+
+	for _, dev := range []string{"null", "zero", "full", "random", "urandom", "tty"} {
+		p := filepath.Join(devDir, dev)
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		if err := mount(filepath.Join("/dev", dev), p, "", syscall.MS_BIND, ""); err != nil {
+			return err
+		}
+	}
+
+	links := map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(devDir, name)); err != nil {
+			return err
+		}
+	}
+
+	shmDir := filepath.Join(devDir, "shm")
+	if err := os.MkdirAll(shmDir, 01777); err != nil {
+		return err
+	}
+	return mount("shm", shmDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "mode=1777")
+}
+
+// loopbackUp sets the loopback interface of the new network namespace up
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var ifr struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(ifr.name[:], "lo")
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return errno
+	}
+	ifr.flags |= syscall.IFF_UP | syscall.IFF_RUNNING
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// server executes the requested processes. Since the init process is the pid 1
+// of the pod pid namespace it must also reap the orphaned processes, so all
+// the childs are reaped by a single reaper that dispatches the exit status of
+// the processes started by the server.
+type server struct {
+	procs     map[int]chan syscall.WaitStatus
+	procsLock sync.Mutex
+}
+
+func newServer() *server {
+	return &server{
+		procs: map[int]chan syscall.WaitStatus{},
+	}
+}
+
+func (s *server) reaper() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGCHLD)
+
+	for range sigs {
+		for {
+			var ws syscall.WaitStatus
+			pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil || pid <= 0 {
+				break
+			}
+			s.procsLock.Lock()
+			if ch, ok := s.procs[pid]; ok {
+				ch <- ws
+				delete(s.procs, pid)
+			}
+			s.procsLock.Unlock()
+		}
+	}
+}
+
+func (s *server) start(req *ExecRequest, files []*os.File) (chan syscall.WaitStatus, error) {
+	if len(req.Cmd) == 0 {
+		return nil, errors.Errorf("empty command")
+	}
+	env := makeEnv(req.Env)
+	p, err := lookPath(req.Cmd[0], req.Env["PATH"], req.WorkingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the lock while starting the process so the reaper cannot receive its
+	// exit status before it's registered
+	s.procsLock.Lock()
+	defer s.procsLock.Unlock()
+
+	proc, err := os.StartProcess(p, req.Cmd, &os.ProcAttr{
+		Dir:   req.WorkingDir,
+		Env:   env,
+		Files: files,
+		Sys:   &syscall.SysProcAttr{Setsid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan syscall.WaitStatus, 1)
+	s.procs[proc.Pid] = ch
+
+	return ch, nil
+}
+
+func (s *server) handleConn(conn *net.UnixConn) {
+	defer conn.Close()
+
+	res := &ExecResponse{}
+	ws, err := s.exec(conn)
+	if err != nil {
+		res.ExitCode = -1
+		res.Error = err.Error()
+	} else {
+		switch {
+		case ws.Exited():
+			res.ExitCode = ws.ExitStatus()
+		case ws.Signaled():
+			res.ExitCode = 128 + int(ws.Signal())
+		}
+	}
+
+	if err := json.NewEncoder(conn).Encode(res); err != nil {
+		log.Printf("failed to write exec response: %v", err)
+	}
+}
+
+func (s *server) exec(conn *net.UnixConn) (syscall.WaitStatus, error) {
+	buf := make([]byte, maxRequestSize)
+	oob := make([]byte, syscall.CmsgSpace(3*4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return 0, errors.Errorf("failed to read exec request: %w", err)
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return 0, errors.Errorf("failed to parse control message: %w", err)
+	}
+	files := []*os.File{}
+	for _, msg := range msgs {
+		fds, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			return 0, errors.Errorf("failed to parse unix rights: %w", err)
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd)))
+		}
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if len(files) != 3 {
+		return 0, errors.Errorf("expected 3 file descriptors, got %d", len(files))
+	}
+
+	var req *ExecRequest
+	if err := json.Unmarshal(buf[:n], &req); err != nil {
+		return 0, errors.Errorf("failed to unmarshal exec request: %w", err)
+	}
+
+	ch, err := s.start(req, files)
+	if err != nil {
+		// like a shell report the error on the process stderr with exit code
+		// 127 if the command wasn't found or 126 if it couldn't be executed
+		_, _ = fmt.Fprintf(files[2], "%v\n", err)
+		if errors.Is(err, exec.ErrNotFound) || os.IsNotExist(err) {
+			return syscall.WaitStatus(127 << 8), nil
+		}
+		return syscall.WaitStatus(126 << 8), nil
+	}
+	// close our copies of the process files so the client will receive EOF
+	// when the process (and its childs) exit
+	for _, f := range files {
+		f.Close()
+	}
+	files = nil
+
+	return <-ch, nil
+}
+
+func makeEnv(env map[string]string) []string {
+	s := make([]string, 0, len(env))
+	for k, v := range env {
+		s = append(s, k+"="+v)
+	}
+	return s
+}
+
+// lookPath searches for an executable in the provided PATH
+func lookPath(file, path, dir string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	for _, d := range filepath.SplitList(path) {
+		if d == "" {
+			d = "."
+		}
+		p := filepath.Join(d, file)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() && fi.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return "", errors.Errorf("executable %q not found in $PATH: %w", file, exec.ErrNotFound)
+}
@@ -16,7 +16,9 @@ package util
 
 import (
 	"errors"
+	"net/mail"
 	"regexp"
+	"strings"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -35,3 +37,16 @@ func ValidateName(s string) bool {
 	}
 	return nameRegexp.MatchString(s)
 }
+
+// ValidateEmail reports if s is a plain email address (without a display
+// name). Since it's used in email headers it must not contain line breaks
+func ValidateEmail(s string) bool {
+	if strings.ContainsAny(s, "\r\n") {
+		return false
+	}
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return false
+	}
+	return a.Address == s
+}
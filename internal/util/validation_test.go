@@ -65,3 +65,26 @@ func TestValidateName(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		ok    bool
+	}{
+		{"user@example.com", true},
+		{"first.last+tag@sub.example.com", true},
+		{"", false},
+		{"user", false},
+		{"user@", false},
+		{"User <user@example.com>", false},
+		{"user@example.com\r\nBcc: other@example.com", false},
+		{"user@example.com\nBcc: other@example.com", false},
+		{"user@example.com, other@example.com", false},
+	}
+
+	for _, tt := range tests {
+		if ok := ValidateEmail(tt.email); ok != tt.ok {
+			t.Errorf("email %q: got %t but wanted: %t", tt.email, ok, tt.ok)
+		}
+	}
+}
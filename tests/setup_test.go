@@ -179,7 +179,8 @@ func setup(ctx context.Context, t *testing.T, dir string) (*testutil.TestEmbedde
 				Method:   "hmac",
 				Key:      "supersecretsigningkey",
 			},
-			AdminToken: "admintoken",
+			AdminToken:       "admintoken",
+			MaxRunImportSize: 1024 * 1024 * 1024,
 		},
 		Scheduler: config.Scheduler{
 			Debug:         false,
@@ -190,6 +191,10 @@ func setup(ctx context.Context, t *testing.T, dir string) (*testutil.TestEmbedde
 			WebExposedURL:  "",
 			RunserviceURL:  "",
 			ConfigstoreURL: "",
+			Web: config.Web{
+				ListenAddress: ":4004",
+				TLS:           false,
+			},
 			Etcd: config.Etcd{
 				Endpoints: "",
 			},
@@ -277,6 +282,10 @@ func setup(ctx context.Context, t *testing.T, dir string) (*testutil.TestEmbedde
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
+	_, nsPort, err := testutil.GetFreePort(true, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
 	listenAddress, gitServerPort, err := testutil.GetFreePort(true, false)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
@@ -285,12 +294,14 @@ func setup(ctx context.Context, t *testing.T, dir string) (*testutil.TestEmbedde
 	gwURL := fmt.Sprintf("http://%s:%s", listenAddress, gwPort)
 	csURL := fmt.Sprintf("http://%s:%s", listenAddress, csPort)
 	rsURL := fmt.Sprintf("http://%s:%s", listenAddress, rsPort)
+	nsURL := fmt.Sprintf("http://%s:%s", listenAddress, nsPort)
 	gitServerURL := fmt.Sprintf("http://%s:%s", listenAddress, gitServerPort)
 
 	c.Gateway.Web.ListenAddress = fmt.Sprintf("%s:%s", listenAddress, gwPort)
 	c.Configstore.Web.ListenAddress = fmt.Sprintf("%s:%s", listenAddress, csPort)
 	c.Runservice.Web.ListenAddress = fmt.Sprintf("%s:%s", listenAddress, rsPort)
 	c.Executor.Web.ListenAddress = fmt.Sprintf("%s:%s", listenAddress, exPort)
+	c.Notification.Web.ListenAddress = fmt.Sprintf("%s:%s", listenAddress, nsPort)
 	c.Gitserver.Web.ListenAddress = fmt.Sprintf("%s:%s", listenAddress, gitServerPort)
 
 	c.Gateway.APIExposedURL = gwURL
@@ -298,6 +309,7 @@ func setup(ctx context.Context, t *testing.T, dir string) (*testutil.TestEmbedde
 	c.Gateway.RunserviceURL = rsURL
 	c.Gateway.ConfigstoreURL = csURL
 	c.Gateway.GitserverURL = gitServerURL
+	c.Gateway.NotificationURL = nsURL
 
 	c.Scheduler.RunserviceURL = rsURL
 
@@ -536,7 +548,7 @@ func TestRun(t *testing.T) {
 	// TODO(sgotti) add an util to wait for a run phase
 	time.Sleep(10 * time.Second)
 
-	runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
+	runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/project", project.ID)}, nil, nil, "", 0, false)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}